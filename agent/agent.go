@@ -66,13 +66,31 @@ func NewAgent(
 	// Create CompactModel for summarization
 	compactModel := llm.NewCompactModel(cfg, lg)
 
+	// Pinned pages survive AutoCollapse, so their total size is capped
+	agentConfig := config.DefaultAgentConfig()
+	contextMgr.SetPinnedTokenBudget(agentConfig.PinnedTokenBudget)
+
+	// Log scheduled page expiries applied before each LLM call
+	contextMgr.SetExpiryHandler(func(t memcicontext.ExpiryTransition) {
+		if t.Err != nil {
+			lg.Warn("Failed to expire page",
+				logger.String("page", string(t.Page)),
+				logger.String("action", string(t.Action)),
+				logger.Err(t.Err))
+			return
+		}
+		lg.Info("Page expired",
+			logger.String("page", string(t.Page)),
+			logger.String("action", string(t.Action)))
+	})
+
 	return &Agent{
 		model:              model,
 		compactModel:       compactModel,
 		contextMgr:         contextMgr,
 		toolProvider:       toolProvider,
 		executor:           executor,
-		config:             config.DefaultAgentConfig(),
+		config:             agentConfig,
 		stateManager:       NewStateManager(),
 		currentTurnMessages: message.NewMessageList(),
 		logger:             lg,
@@ -203,6 +221,16 @@ func (a *Agent) Run(ctx context.Context, userQuery string) (*AgentResult, error)
 
 // manageContextWindow checks and manages token limits
 func (a *Agent) manageContextWindow(ctx context.Context) error {
+	// Keep every segment within its own token budget first
+	budgetCollapsed, err := a.contextMgr.EnforceSegmentBudgets()
+	if err != nil {
+		return err
+	}
+	if len(budgetCollapsed) > 0 {
+		a.logger.Info("Collapsed pages over segment budget",
+			logger.Int("count", len(budgetCollapsed)))
+	}
+
 	currentTokens, err := a.contextMgr.EstimateTokens()
 	if err != nil {
 		return err
@@ -11,6 +11,7 @@ import (
 	memcicontext "memci/context"
 	"memci/llm"
 	"memci/logger"
+	"memci/tokenizer"
 )
 
 // ANSI 颜色代码
@@ -29,6 +30,7 @@ const (
 // CLI 表示命令行交互界面
 type CLI struct {
 	agent  *agent.Agent
+	ctxMgr *memcicontext.ContextManager
 	logger logger.Logger
 	reader *bufio.Reader
 }
@@ -36,9 +38,13 @@ type CLI struct {
 // NewCLI 创建一个新的 CLI 实例
 func NewCLI(cfg *config.Config, lg logger.Logger) *CLI {
 	// 创建上下文管理器
-	ctxMgr, restored := memcicontext.NewContextManager(&cfg.Context)
+	ctxMgr, restored, err := memcicontext.NewContextManager(&cfg.Context)
+	if err != nil {
+		lg.Fatal("Failed to create context manager", logger.Err(err))
+	}
 	if restored {
 		lg.Info("Restore successfully")
+		checkIntegrityOnStartup(ctxMgr, cfg.Context.RepairOnStartup, lg)
 		goto here
 	}
 	if err := ctxMgr.Initialize(); err != nil {
@@ -49,11 +55,28 @@ func NewCLI(cfg *config.Config, lg logger.Logger) *CLI {
 		lg.Fatal("Failed to build system prompts", logger.Err(err))
 	}
 here:
+	// 配置语义检索的 Embedder
+	embedder, err := memcicontext.NewEmbedderFromConfig(cfg)
+	if err != nil {
+		lg.Fatal("Failed to create embedder", logger.Err(err))
+	}
+	ctxMgr.SetEmbedder(embedder)
+
+	// 配置 Agent 模型对应的分词器，词表缺失时使用启发式估算
+	modelName := llm.ModelName(cfg.LLM.AgentModel)
+	tk, err := llm.LoadTokenizer(cfg.Context.TokenizerDir, modelName)
+	if err != nil {
+		lg.Warn("Tokenizer not available, falling back to heuristic token estimation", logger.Err(err))
+		tk = tokenizer.NewHeuristicTokenizer()
+	}
+	ctxMgr.SetTokenizer(tk)
+
 	// 创建 Agent
-	agt := agent.NewAgent(cfg, lg, llm.ModelName(cfg.LLM.AgentModel), ctxMgr)
+	agt := agent.NewAgent(cfg, lg, modelName, ctxMgr)
 
 	return &CLI{
 		agent:  agt,
+		ctxMgr: ctxMgr,
 		logger: lg,
 		reader: bufio.NewReader(os.Stdin),
 	}
@@ -97,6 +120,14 @@ func (c *CLI) printWelcome() {
 	fmt.Printf("  %s/help%s    - 显示帮助信息\n", Yellow, Reset)
 	fmt.Printf("  %s/quit%s   - 退出程序\n", Yellow, Reset)
 	fmt.Printf("  %s/clear%s  - 清空屏幕\n", Yellow, Reset)
+	fmt.Printf("  %s/export%s - 导出记忆归档\n", Yellow, Reset)
+	fmt.Printf("  %s/import%s - 导入记忆归档\n", Yellow, Reset)
+	fmt.Printf("  %s/import-md%s - 导入 markdown 文档\n", Yellow, Reset)
+	fmt.Printf("  %s/export-md%s - 导出页面为 markdown\n", Yellow, Reset)
+	fmt.Printf("  %s/diff%s   - 显示上一轮以来的页面树变更\n", Yellow, Reset)
+	fmt.Printf("  %s/check%s  - 检查页面树完整性\n", Yellow, Reset)
+	fmt.Printf("  %s/repair%s - 修复完整性问题（--dry-run 预览）\n", Yellow, Reset)
+	fmt.Printf("  %s/gc%s     - 删除不可达的页面（--dry-run 预览）\n", Yellow, Reset)
 	fmt.Println()
 	fmt.Printf("%s────────────────────────────────────────────────────────────────%s\n", Gray, Reset)
 	fmt.Println()
@@ -112,6 +143,28 @@ func (c *CLI) readInput() (string, error) {
 	return strings.TrimSpace(line), nil
 }
 
+// checkIntegrityOnStartup 检查恢复后的页面树完整性，repair 为 true 时自动修复
+func checkIntegrityOnStartup(ctxMgr *memcicontext.ContextManager, repair bool, lg logger.Logger) {
+	report := ctxMgr.CheckIntegrity()
+	if report.OK() {
+		return
+	}
+	if !repair {
+		lg.Warn("Restored memory has integrity issues, run /check for details and /repair to fix them",
+			logger.Int("issues", len(report.Issues)))
+		return
+	}
+	report, err := ctxMgr.Repair(false)
+	if err != nil {
+		lg.Error("Failed to repair restored memory", logger.Err(err))
+		return
+	}
+	lg.Info("Restored memory repaired",
+		logger.Int("issues", len(report.Issues)),
+		logger.Int("repaired", report.Repaired),
+		logger.Int("unrepairable", report.Unrepairable()))
+}
+
 // handleCommand 处理特殊命令，返回 true 表示是命令不需要执行 Agent
 func (c *CLI) handleCommand(input string) bool {
 	switch input {
@@ -128,6 +181,34 @@ func (c *CLI) handleCommand(input string) bool {
 	case "/help", "/h":
 		c.printHelp()
 		return true
+	case "/diff":
+		c.printDiff()
+		return true
+	case "/check":
+		c.printIntegrity(c.ctxMgr.CheckIntegrity())
+		return true
+	}
+
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/export":
+		c.exportArchive(fields[1:])
+		return true
+	case "/import":
+		c.importArchive(fields[1:])
+		return true
+	case "/import-md":
+		c.importMarkdown(fields[1:])
+		return true
+	case "/export-md":
+		c.exportMarkdown(fields[1:])
+		return true
+	case "/repair":
+		c.repair(fields[1:])
+		return true
+	case "/gc":
+		c.collectGarbage(fields[1:])
+		return true
 	}
 
 	if strings.HasPrefix(input, "/") {
@@ -139,6 +220,178 @@ func (c *CLI) handleCommand(input string) bool {
 	return false
 }
 
+// exportArchive 处理 /export <file>
+func (c *CLI) exportArchive(args []string) {
+	if len(args) != 1 {
+		fmt.Printf("%s用法: /export <file>%s\n", Gray, Reset)
+		return
+	}
+	if err := c.ctxMgr.ExportArchive(args[0]); err != nil {
+		c.printError(err)
+		return
+	}
+	fmt.Printf("%s✅ 记忆已导出到 %s%s\n", Green, args[0], Reset)
+}
+
+// importArchive 处理 /import <file> [--replace]
+func (c *CLI) importArchive(args []string) {
+	mode := memcicontext.ImportMerge
+	var paths []string
+	for _, arg := range args {
+		if arg == "--replace" {
+			mode = memcicontext.ImportReplace
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if len(paths) != 1 {
+		fmt.Printf("%s用法: /import <file> [--replace]%s\n", Gray, Reset)
+		return
+	}
+	path := paths[0]
+
+	result, err := c.ctxMgr.ImportArchive(path, mode)
+	if err != nil {
+		c.printError(err)
+		return
+	}
+	c.logger.Info("Memory archive imported",
+		logger.String("path", path),
+		logger.String("mode", mode.String()),
+		logger.Int("pages", result.Pages))
+	fmt.Printf("%s✅ 已导入 %d 个 Page，新增 %d 个 Segment（%s），%d 个 Page 重新分配了索引%s\n",
+		Green, result.Pages, result.Segments, mode, len(result.Remapped), Reset)
+}
+
+// importMarkdown 处理 /import-md <file> <parent>
+func (c *CLI) importMarkdown(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("%s用法: /import-md <file> <parent>%s\n", Gray, Reset)
+		return
+	}
+	created, err := c.ctxMgr.ImportMarkdownFile(args[0], memcicontext.PageIndex(args[1]))
+	if err != nil {
+		c.printError(err)
+		return
+	}
+	fmt.Printf("%s✅ 已在 %s 下创建 %d 个页面%s\n", Green, args[1], len(created), Reset)
+}
+
+// exportMarkdown 处理 /export-md <page> <file>
+func (c *CLI) exportMarkdown(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("%s用法: /export-md <page> <file>%s\n", Gray, Reset)
+		return
+	}
+	if err := c.ctxMgr.ExportMarkdownFile(memcicontext.PageIndex(args[0]), args[1]); err != nil {
+		c.printError(err)
+		return
+	}
+	fmt.Printf("%s✅ 页面 %s 已导出到 %s%s\n", Green, args[0], args[1], Reset)
+}
+
+// printDiff 处理 /diff，打印自上一轮快照以来的页面树变更
+func (c *CLI) printDiff() {
+	diff := c.ctxMgr.DiffSinceLastExport()
+	fmt.Printf("%s页面树变更（%d 项）:%s\n", Gray, len(diff.Changes), Reset)
+	for _, change := range diff.Changes {
+		color := Yellow
+		switch change.Kind {
+		case memcicontext.ChangeAdded:
+			color = Green
+		case memcicontext.ChangeRemoved:
+			color = Red
+		}
+		fmt.Printf("  %s%s%s\n", color, change, Reset)
+	}
+	fmt.Println()
+}
+
+// repair 处理 /repair [--dry-run]
+func (c *CLI) repair(args []string) {
+	dryRun := false
+	for _, arg := range args {
+		if arg != "--dry-run" {
+			fmt.Printf("%s用法: /repair [--dry-run]%s\n", Gray, Reset)
+			return
+		}
+		dryRun = true
+	}
+	report, err := c.ctxMgr.Repair(dryRun)
+	if err != nil {
+		c.printError(err)
+		return
+	}
+	if !dryRun && report.Repaired > 0 {
+		c.logger.Info("Memory repaired",
+			logger.Int("issues", len(report.Issues)),
+			logger.Int("repaired", report.Repaired))
+	}
+	c.printIntegrity(report)
+}
+
+// printIntegrity 打印完整性检查或修复的结果
+func (c *CLI) printIntegrity(report *memcicontext.IntegrityReport) {
+	if report.OK() {
+		fmt.Printf("%s✅ 已检查 %d 个页面、%d 个 Segment，未发现问题%s\n\n", Green, report.Pages, report.Segments, Reset)
+		return
+	}
+	fmt.Printf("%s已检查 %d 个页面、%d 个 Segment，发现 %d 个问题:%s\n", Gray, report.Pages, report.Segments, len(report.Issues), Reset)
+	for _, issue := range report.Issues {
+		color := Yellow
+		if !issue.Repairable() {
+			color = Red
+		}
+		fmt.Printf("  %s%s%s\n", color, issue, Reset)
+	}
+	switch {
+	case report.DryRun:
+		fmt.Printf("%s（预览）执行 /repair 应用以上修复%s\n", Gray, Reset)
+	case report.Repaired > 0:
+		fmt.Printf("%s✅ 已修复，写入 %d 个对象%s\n", Green, report.Repaired, Reset)
+	default:
+		fmt.Printf("%s执行 /repair --dry-run 预览修复，/repair 应用修复%s\n", Gray, Reset)
+	}
+	if n := report.Unrepairable(); n > 0 {
+		fmt.Printf("%s⚠  %d 个问题无法自动修复%s\n", Yellow, n, Reset)
+	}
+	fmt.Println()
+}
+
+// collectGarbage 处理 /gc [--dry-run]
+func (c *CLI) collectGarbage(args []string) {
+	dryRun := false
+	for _, arg := range args {
+		if arg != "--dry-run" {
+			fmt.Printf("%s用法: /gc [--dry-run]%s\n", Gray, Reset)
+			return
+		}
+		dryRun = true
+	}
+	report, err := c.ctxMgr.CollectGarbage(dryRun)
+	if err != nil {
+		c.printError(err)
+		return
+	}
+	if len(report.Garbage) == 0 {
+		fmt.Printf("%s✅ 已检查 %d 个页面，没有不可达的页面%s\n\n", Green, report.Pages, Reset)
+		return
+	}
+	fmt.Printf("%s已检查 %d 个页面，%d 个页面无法从任何 Segment 根页面到达（约 %d tokens）:%s\n",
+		Gray, report.Pages, len(report.Garbage), report.Tokens, Reset)
+	for _, index := range report.Garbage {
+		fmt.Printf("  %s%s%s\n", Yellow, index, Reset)
+	}
+	if dryRun {
+		fmt.Printf("%s（预览）执行 /gc 删除以上页面，需要保留时先执行 /repair 将其挂回 Segment 根页面%s\n\n", Gray, Reset)
+		return
+	}
+	c.logger.Info("Unreachable pages collected",
+		logger.Int("pages", len(report.Garbage)),
+		logger.Int("tokens", report.Tokens))
+	fmt.Printf("%s✅ 已删除 %d 个页面%s\n\n", Green, len(report.Garbage), Reset)
+}
+
 // executeAgent 执行 Agent
 func (c *CLI) executeAgent(input string) error {
 	fmt.Printf("%s🔄 正在思考...%s\n", Blue, Reset)
@@ -192,6 +445,14 @@ func (c *CLI) printHelp() {
 	fmt.Printf("  %s/help%s    - 显示此帮助信息\n", Yellow, Reset)
 	fmt.Printf("  %s/quit%s   - 退出程序\n", Yellow, Reset)
 	fmt.Printf("  %s/clear%s  - 清空屏幕\n", Yellow, Reset)
+	fmt.Printf("  %s/export <file>%s            - 导出全部记忆到归档文件\n", Yellow, Reset)
+	fmt.Printf("  %s/import <file> [--replace]%s - 从归档文件导入记忆（默认合并，--replace 替换现有记忆）\n", Yellow, Reset)
+	fmt.Printf("  %s/import-md <file> <parent>%s - 将 markdown 文档按标题层级导入到指定页面下\n", Yellow, Reset)
+	fmt.Printf("  %s/export-md <page> <file>%s  - 将页面子树导出为 markdown 文档\n", Yellow, Reset)
+	fmt.Printf("  %s/diff%s                      - 显示上一轮快照以来的页面树变更（新增、删除、移动、重命名、展开/隐藏、编辑）\n", Yellow, Reset)
+	fmt.Printf("  %s/check%s                     - 检查页面树完整性（环、孤立页面、重复子页面、父子不一致、索引前缀和计数器）\n", Yellow, Reset)
+	fmt.Printf("  %s/repair [--dry-run]%s        - 修复完整性问题（--dry-run 只预览修复动作）\n", Yellow, Reset)
+	fmt.Printf("  %s/gc [--dry-run]%s            - 删除无法从任何 Segment 根页面到达的页面（--dry-run 只列出）\n", Yellow, Reset)
 	fmt.Println()
 	fmt.Printf("%s交互方式:%s\n", Gray, Reset)
 	fmt.Printf("  直接输入您的问题或指令，Agent 将使用工具来帮助您。\n")
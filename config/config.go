@@ -32,8 +32,47 @@ type LogConfig struct {
 // ContextConfig 上下文系统配置
 type ContextConfig struct {
 	// 存储配置
-	StorageBaseDir string `toml:"storage_base_dir" mapstructure:"storage_base_dir" default:"./data/storage"`
-	StorageUseGzip bool   `toml:"storage_use_gzip" mapstructure:"storage_use_gzip" default:"true"`          // 是否使用 gzip 压缩存储
+	StorageBaseDir      string `toml:"storage_base_dir" mapstructure:"storage_base_dir" default:"./data/storage"`
+	StorageUseGzip      bool   `toml:"storage_use_gzip" mapstructure:"storage_use_gzip" default:"true"`           // 是否使用 gzip 压缩存储
+	StorageType         string `toml:"storage_type" mapstructure:"storage_type" default:"file"`                   // 存储后端: file, wal
+	WALCompactThreshold int    `toml:"wal_compact_threshold" mapstructure:"wal_compact_threshold" default:"1000"` // WAL 自动压缩阈值（日志记录数）
+
+	// 缓存配置
+	PageCacheSize int `toml:"page_cache_size" mapstructure:"page_cache_size" default:"1024"` // Page 内存缓存容量（LRU），<0 表示不限
+
+	// 语义检索配置
+	Embedder         string `toml:"embedder" mapstructure:"embedder" default:"hash"`                            // 嵌入实现: hash（本地）, openai（复用 LLM 的 BaseUrl 调用 /embeddings）
+	EmbeddingModel   string `toml:"embedding_model" mapstructure:"embedding_model" default:"text-embedding-v3"` // openai 嵌入模型
+	EmbeddingDim     int    `toml:"embedding_dim" mapstructure:"embedding_dim" default:"256"`                   // hash 嵌入维度
+	EmbeddingTimeout int    `toml:"embedding_timeout" mapstructure:"embedding_timeout" default:"30"`            // openai 嵌入请求超时（秒）
+
+	// Segment token 预算，键为 Segment ID，值为该 Segment 渲染后允许的最大 token 数
+	SegmentBudgets map[string]int `toml:"segment_budgets" mapstructure:"segment_budgets"`
+
+	// 分词器配置
+	TokenizerDir string `toml:"tokenizer_dir" mapstructure:"tokenizer_dir" default:"./data/tokenizers"` // 词表目录，每个模型的词表位于 <dir>/<qwen|deepseek>/ 下
+
+	// 折叠策略: oldest（最早创建）, lru（最久未访问）, largest（占用最多）, importance（重要性最低）
+	CollapsePolicy string `toml:"collapse_policy" mapstructure:"collapse_policy" default:"oldest"`
+
+	// 渲染格式: markdown（默认）, xml, json；SegmentRenderers 为单个 Segment 指定格式，键为 Segment ID
+	Renderer         string            `toml:"renderer" mapstructure:"renderer" default:"markdown"`
+	SegmentRenderers map[string]string `toml:"segment_renderers" mapstructure:"segment_renderers"`
+	ShowTags         bool              `toml:"show_tags" mapstructure:"show_tags"` // 在渲染结果中显示页面标签
+
+	// Agent 可创建的自定义 Segment 数量上限，<0 表示不限
+	MaxCustomSegments int `toml:"max_custom_segments" mapstructure:"max_custom_segments" default:"8"`
+
+	// 启动恢复后发现页面树完整性问题时自动修复；关闭时只记录警告，可通过 /repair 手动修复
+	RepairOnStartup bool `toml:"repair_on_startup" mapstructure:"repair_on_startup"`
+
+	// 删除 Page 时改为冷归档整棵子树（可通过 restore_page 恢复），而不是从存储删除
+	ArchiveOnRemove bool `toml:"archive_on_remove" mapstructure:"archive_on_remove"`
+
+	// 静态加密：密钥文件内容为 base64 编码的 32 字节 AES-256 密钥，环境变量 MEMCI_ENCRYPTION_KEY 优先；
+	// 轮换密钥时将旧密钥文件加入 EncryptionOldKeyFiles（或环境变量 MEMCI_ENCRYPTION_OLD_KEYS，逗号分隔）
+	EncryptionKeyFile     string   `toml:"encryption_key_file" mapstructure:"encryption_key_file"`
+	EncryptionOldKeyFiles []string `toml:"encryption_old_key_files" mapstructure:"encryption_old_key_files"`
 }
 
 // AgentConfig holds agent configuration
@@ -46,6 +85,9 @@ type AgentConfig struct {
 	MaxTokens   int // Max tokens before auto-collapse (default: 8000)
 	TokenMargin int // Safety margin for tokens (default: 1000)
 
+	// Pinned pages
+	PinnedTokenBudget int // Max tokens of pinned pages, pinning beyond it is rejected (default: 2000)
+
 	// Error handling
 	MaxRetries int           // Max retries on transient errors (default: 3)
 	RetryDelay time.Duration // Delay between retries (default: 1s)
@@ -74,13 +116,14 @@ type GRPCConfig struct {
 // DefaultAgentConfig returns default agent configuration
 func DefaultAgentConfig() *AgentConfig {
 	return &AgentConfig{
-		MaxIterations:    10,
-		IterationTimeout: 30 * time.Second,
-		MaxTokens:        8000,
-		TokenMargin:      1000,
-		MaxRetries:       3,
-		RetryDelay:       1 * time.Second,
-		ToolTimeout:      10 * time.Second,
+		MaxIterations:     10,
+		IterationTimeout:  30 * time.Second,
+		MaxTokens:         8000,
+		TokenMargin:       1000,
+		PinnedTokenBudget: 2000,
+		MaxRetries:        3,
+		RetryDelay:        1 * time.Second,
+		ToolTimeout:       10 * time.Second,
 	}
 }
 
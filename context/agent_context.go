@@ -69,9 +69,9 @@ func (ac *AgentContext) checkPermission(pageIndex PageIndex, operation string) e
 // getRequiredLevel 根据操作类型确定所需权限级别
 func getRequiredLevel(operation string) PermissionLevel {
 	switch operation {
-	case "updatePage", "movePage", "removePage", "expandDetails", "hideDetails", "createPage":
+	case "updatePage", "movePage", "removePage", "expandDetails", "hideDetails", "createPage", "revertPage", "archivePage", "restorePage", "setImportance", "setTag", "removeTag", "createLink", "deleteLink", "setExpiry", "clearExpiry", "pinPage", "unpinPage":
 		return WriteLevel
-	case "getSegment", "listSegments", "getPage", "getChildren", "getParent", "getAncestors":
+	case "getSegment", "listSegments", "getPage", "getChildren", "getParent", "getAncestors", "getPageHistory", "findByTag", "getLinks", "getBacklinks", "previewRemove":
 		return ReadLevel
 	default:
 		return SystemLevel
@@ -106,6 +106,41 @@ func (ac *AgentContext) ListSegments() ([]Segment, error) {
 	return ac.system.ListSegments()
 }
 
+// ============ 自定义 Segment 管理方法 ============
+
+// checkCustomSegment 检查Segment是否为Agent可管理的自定义Segment
+func (ac *AgentContext) checkCustomSegment(id SegmentID) error {
+	segment, err := ac.system.GetSegment(id)
+	if err != nil {
+		return err
+	}
+	if segment.GetType() != CustomSegment {
+		return fmt.Errorf("segment %s is a %s: only custom segments can be managed by the agent", id, segment.GetType())
+	}
+	return nil
+}
+
+// CreateSegment 创建自定义Segment（可读写），返回根Page的索引
+func (ac *AgentContext) CreateSegment(id SegmentID, name, description string) (PageIndex, error) {
+	return ac.system.createCustomSegmentInternal(ActorAgent, id, name, description)
+}
+
+// RenameSegment 修改自定义Segment的名称和描述，空值表示不修改
+func (ac *AgentContext) RenameSegment(id SegmentID, name, description string) error {
+	if err := ac.checkCustomSegment(id); err != nil {
+		return err
+	}
+	return ac.system.renameSegmentInternal(ActorAgent, id, name, description)
+}
+
+// DeleteSegment 删除自定义Segment及其下的所有Page
+func (ac *AgentContext) DeleteSegment(id SegmentID) error {
+	if err := ac.checkCustomSegment(id); err != nil {
+		return err
+	}
+	return ac.system.deleteSegmentInternal(ActorAgent, id)
+}
+
 // ============ Page 操作方法 ============
 
 // ============ 状态变更方法 ============
@@ -118,7 +153,7 @@ func (ac *AgentContext) UpdatePage(pageIndex PageIndex, name, description string
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.updatePageInternal(pageIndex, name, description)
+	return ac.system.updatePageInternal(ActorAgent, pageIndex, name, description)
 }
 
 // ExpandDetails 展开Page详情（写权限）
@@ -129,7 +164,7 @@ func (ac *AgentContext) ExpandDetails(pageIndex PageIndex) error {
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.expandDetailsInternal(pageIndex)
+	return ac.system.expandDetailsInternal(ActorAgent, pageIndex)
 }
 
 // HideDetails 隐藏Page详情（写权限）
@@ -140,7 +175,7 @@ func (ac *AgentContext) HideDetails(pageIndex PageIndex) error {
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.hideDetailsInternal(pageIndex)
+	return ac.system.hideDetailsInternal(ActorAgent, pageIndex)
 }
 
 // ============ 结构操作方法 ============
@@ -156,7 +191,7 @@ func (ac *AgentContext) MovePage(source, target PageIndex) error {
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.movePageInternal(source, target)
+	return ac.system.movePageInternal(ActorAgent, source, target)
 }
 
 // RemovePage 删除Page（写权限）
@@ -167,7 +202,18 @@ func (ac *AgentContext) RemovePage(pageIndex PageIndex) error {
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.RemovePage(pageIndex)
+	return ac.system.removePageInternal(ActorAgent, pageIndex)
+}
+
+// PreviewRemove 预览删除Page的影响（只读）
+func (ac *AgentContext) PreviewRemove(pageIndex PageIndex) (*RemovalPreview, error) {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "previewRemove"); err != nil {
+		return nil, err
+	}
+
+	// 2. 调用ContextSystem方法
+	return ac.system.PreviewRemove(pageIndex)
 }
 
 // CreateDetailPage 创建DetailPage（写权限）
@@ -178,7 +224,7 @@ func (ac *AgentContext) CreateDetailPage(name, description, detail string, paren
 	}
 
 	// 2. 调用ContextSystem内部方法
-	return ac.system.createDetailPageInternal(name, description, detail, parentIndex)
+	return ac.system.createDetailPageInternal(ActorAgent, name, description, detail, parentIndex)
 }
 
 // CreateContentsPage 创建ContentsPage（写权限）
@@ -198,7 +244,242 @@ func (ac *AgentContext) CreateContentsPage(name, description string, parentIndex
 	}
 
 	// 3. 调用ContextSystem内部方法
-	return ac.system.createContentsPageInternal(name, description, parentIndex, children...)
+	return ac.system.createContentsPageInternal(ActorAgent, name, description, parentIndex, children...)
+}
+
+// ============ 修订历史方法 ============
+
+// GetPageHistory 获取Page修订历史（只读）
+func (ac *AgentContext) GetPageHistory(pageIndex PageIndex) ([]*PageRevision, error) {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "getPageHistory"); err != nil {
+		return nil, err
+	}
+
+	// 2. 调用ContextSystem方法
+	return ac.system.GetPageHistory(pageIndex)
+}
+
+// RevertPage 回滚Page到指定修订（写权限）
+func (ac *AgentContext) RevertPage(pageIndex PageIndex, revision int) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "revertPage"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.revertPageInternal(ActorAgent, pageIndex, revision)
+}
+
+// ============ 重要性方法 ============
+
+// SetImportance 设置Page的重要性分数（0~1，写权限）
+func (ac *AgentContext) SetImportance(pageIndex PageIndex, importance float64) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "setImportance"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.setImportanceInternal(ActorAgent, pageIndex, importance)
+}
+
+// ============ 标签方法 ============
+
+// SetTag 设置Page标签（写权限）
+func (ac *AgentContext) SetTag(pageIndex PageIndex, key, value string) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "setTag"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.setTagInternal(ActorAgent, pageIndex, key, value)
+}
+
+// RemoveTag 删除Page标签（写权限）
+func (ac *AgentContext) RemoveTag(pageIndex PageIndex, key string) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "removeTag"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.removeTagInternal(ActorAgent, pageIndex, key)
+}
+
+// FindByTag 查找带有指定标签的Page，value 为空时匹配任意值（只读）
+//
+// 只返回Agent有读权限的Segment中的Page。
+func (ac *AgentContext) FindByTag(key, value string) []Page {
+	var pages []Page
+	var indices []PageIndex
+	for _, page := range ac.system.FindByTag(key, value) {
+		if ac.checkPermission(page.GetIndex(), "findByTag") != nil {
+			continue
+		}
+		pages = append(pages, page)
+		indices = append(indices, page.GetIndex())
+	}
+	ac.system.recordAccess(AccessFind, indices...)
+	return pages
+}
+
+// ============ 链接方法 ============
+
+// CreateLink 创建 source 指向 target 的链接（source 需写权限，target 需读权限）
+func (ac *AgentContext) CreateLink(source, target PageIndex, linkType string) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(source, "createLink"); err != nil {
+		return err
+	}
+	if err := ac.checkPermission(target, "getLinks"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.addLinkInternal(ActorAgent, source, target, linkType)
+}
+
+// DeleteLink 删除 source 指向 target 的链接，linkType 为空时删除全部类型（写权限）
+func (ac *AgentContext) DeleteLink(source, target PageIndex, linkType string) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(source, "deleteLink"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.removeLinkInternal(ActorAgent, source, target, linkType)
+}
+
+// FollowLinks 获取Page链接指向的Page，linkType 为空时返回全部类型（只读）
+//
+// 只返回Agent有读权限的目标，返回的链接与Page一一对应。
+func (ac *AgentContext) FollowLinks(pageIndex PageIndex, linkType string) ([]PageLink, []Page, error) {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "getLinks"); err != nil {
+		return nil, nil, err
+	}
+
+	// 2. 调用ContextSystem方法
+	links, err := ac.system.GetLinks(pageIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	var followed []PageLink
+	var pages []Page
+	for _, link := range links {
+		if linkType != "" && link.Type != linkType {
+			continue
+		}
+		if ac.checkPermission(link.Target, "getLinks") != nil {
+			continue
+		}
+		target, err := ac.system.GetPage(link.Target)
+		if err != nil {
+			continue
+		}
+		followed = append(followed, link)
+		pages = append(pages, target)
+	}
+
+	// 3. 记录访问
+	ac.system.recordAccess(AccessView, pageIndex)
+	return followed, pages, nil
+}
+
+// GetBacklinks 获取指向Page的链接，只返回Agent有读权限的来源（只读）
+func (ac *AgentContext) GetBacklinks(pageIndex PageIndex) ([]Backlink, error) {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "getBacklinks"); err != nil {
+		return nil, err
+	}
+
+	// 2. 调用ContextSystem方法
+	var backlinks []Backlink
+	for _, backlink := range ac.system.GetBacklinks(pageIndex) {
+		if ac.checkPermission(backlink.Source, "getBacklinks") == nil {
+			backlinks = append(backlinks, backlink)
+		}
+	}
+	return backlinks, nil
+}
+
+// ============ 到期方法 ============
+
+// SetExpiry 设置Page的到期时间和到期动作（写权限）
+func (ac *AgentContext) SetExpiry(pageIndex PageIndex, at time.Time, action ExpiryAction) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "setExpiry"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.setExpiryInternal(ActorAgent, pageIndex, at, action)
+}
+
+// ClearExpiry 取消Page的到期设置（写权限）
+func (ac *AgentContext) ClearExpiry(pageIndex PageIndex) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "clearExpiry"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.clearExpiryInternal(ActorAgent, pageIndex)
+}
+
+// ============ 固定方法 ============
+
+// PinPage 固定Page，自动折叠时不会隐藏（写权限）
+func (ac *AgentContext) PinPage(pageIndex PageIndex) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "pinPage"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.pinPageInternal(ActorAgent, pageIndex)
+}
+
+// UnpinPage 取消固定Page（写权限）
+func (ac *AgentContext) UnpinPage(pageIndex PageIndex) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "unpinPage"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.unpinPageInternal(ActorAgent, pageIndex)
+}
+
+// ============ 冷归档方法 ============
+
+// ArchivePage 将Page子树移入冷归档层（写权限）
+func (ac *AgentContext) ArchivePage(pageIndex PageIndex) error {
+	// 1. 权限检查
+	if err := ac.checkPermission(pageIndex, "archivePage"); err != nil {
+		return err
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.archivePageInternal(ActorAgent, pageIndex)
+}
+
+// RestorePage 恢复冷归档的Page子树，parentIndex 为空时恢复到原父节点（写权限）
+func (ac *AgentContext) RestorePage(pageIndex, parentIndex PageIndex) error {
+	// 1. 权限检查（需要检查归档Page和目标父Page）
+	if err := ac.checkPermission(pageIndex, "restorePage"); err != nil {
+		return err
+	}
+	if parentIndex != "" {
+		if err := ac.checkPermission(parentIndex, "restorePage"); err != nil {
+			return err
+		}
+	}
+
+	// 2. 调用ContextSystem内部方法
+	return ac.system.restorePageInternal(ActorAgent, pageIndex, parentIndex)
 }
 
 // ============ 查询方法 ============
@@ -211,7 +492,14 @@ func (ac *AgentContext) GetPage(pageIndex PageIndex) (Page, error) {
 	}
 
 	// 2. 调用ContextSystem方法
-	return ac.system.GetPage(pageIndex)
+	page, err := ac.system.GetPage(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 记录访问
+	ac.system.recordAccess(AccessView, pageIndex)
+	return page, nil
 }
 
 // GetChildren 获取子Page列表（只读）
@@ -222,7 +510,14 @@ func (ac *AgentContext) GetChildren(pageIndex PageIndex) ([]Page, error) {
 	}
 
 	// 2. 调用ContextSystem方法
-	return ac.system.GetChildren(pageIndex)
+	children, err := ac.system.GetChildren(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 记录访问
+	ac.system.recordAccess(AccessView, pageIndex)
+	return children, nil
 }
 
 // GetParent 获取父Page（只读）
@@ -251,5 +546,39 @@ func (ac *AgentContext) GetAncestors(pageIndex PageIndex) ([]Page, error) {
 func (ac *AgentContext) FindPage(query string) []Page {
 	// FindPage 不需要权限检查，返回所有匹配的结果
 	// Agent可以搜索任何内容，但只能读取有权限的Page
-	return ac.system.FindPage(query)
+	pages := ac.system.FindPage(query)
+	indices := make([]PageIndex, len(pages))
+	for i, page := range pages {
+		indices[i] = page.GetIndex()
+	}
+	ac.system.recordAccess(AccessFind, indices...)
+	return pages
+}
+
+// SearchPages 全文搜索Page，按相关度排序（只读）
+func (ac *AgentContext) SearchPages(query string, opts SearchOptions) []SearchResult {
+	// 与 FindPage 一致，搜索不需要权限检查
+	results := ac.system.Search(query, opts)
+	ac.recordFound(results)
+	return results
+}
+
+// Recall 语义检索与查询最相关的 k 个Page（只读）
+func (ac *AgentContext) Recall(query string, k int) ([]SearchResult, error) {
+	// 与 FindPage 一致，检索不需要权限检查
+	results, err := ac.system.Recall(query, k)
+	if err != nil {
+		return nil, err
+	}
+	ac.recordFound(results)
+	return results, nil
+}
+
+// recordFound 记录搜索结果中的Page被找到
+func (ac *AgentContext) recordFound(results []SearchResult) {
+	indices := make([]PageIndex, len(results))
+	for i, result := range results {
+		indices[i] = result.Page.GetIndex()
+	}
+	ac.system.recordAccess(AccessFind, indices...)
 }
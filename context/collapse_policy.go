@@ -0,0 +1,116 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 内置折叠策略名称
+const (
+	CollapseOldestFirst      = "oldest"     // 最早创建的优先折叠
+	CollapseLeastRecent      = "lru"        // 最久未访问的优先折叠
+	CollapseLargestFirst     = "largest"    // 占用token最多的优先折叠
+	CollapseLowestImportance = "importance" // 重要性最低的优先折叠
+)
+
+// CollapseCandidate 可折叠的候选页面
+type CollapseCandidate struct {
+	Page         Page
+	Tokens       int       // 页面当前渲染后的估算token数
+	LastAccessed time.Time // 最近访问时间（从未访问时为创建时间）
+	Importance   float64   // 重要性分数
+}
+
+// CollapsePolicy 折叠策略，决定 AutoCollapse 和 Segment 预算执行时先折叠哪些页面
+type CollapsePolicy interface {
+	// Name 返回策略名称
+	Name() string
+	// Order 返回候选页面的折叠顺序，越靠前越先折叠（不修改入参）
+	Order(candidates []CollapseCandidate) []CollapseCandidate
+}
+
+// NewCollapsePolicy 根据名称创建内置折叠策略，名称为空时使用 oldest
+func NewCollapsePolicy(name string) (CollapsePolicy, error) {
+	switch name {
+	case "", CollapseOldestFirst:
+		return oldestFirstPolicy{}, nil
+	case CollapseLeastRecent:
+		return leastRecentPolicy{}, nil
+	case CollapseLargestFirst:
+		return largestFirstPolicy{}, nil
+	case CollapseLowestImportance:
+		return lowestImportancePolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown collapse policy: %s", name)
+	}
+}
+
+// sortCandidates 按 less 稳定排序候选页面的副本，相同时按创建时间、再按索引排序保证顺序确定
+func sortCandidates(candidates []CollapseCandidate, less func(a, b CollapseCandidate) (bool, bool)) []CollapseCandidate {
+	sorted := append([]CollapseCandidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if result, decided := less(sorted[i], sorted[j]); decided {
+			return result
+		}
+		ci, cj := sorted[i].Page.GetCreatedAt(), sorted[j].Page.GetCreatedAt()
+		if !ci.Equal(cj) {
+			return ci.Before(cj)
+		}
+		return sorted[i].Page.GetIndex() < sorted[j].Page.GetIndex()
+	})
+	return sorted
+}
+
+// oldestFirstPolicy 最早创建的优先折叠
+type oldestFirstPolicy struct{}
+
+func (oldestFirstPolicy) Name() string { return CollapseOldestFirst }
+
+func (oldestFirstPolicy) Order(candidates []CollapseCandidate) []CollapseCandidate {
+	return sortCandidates(candidates, func(a, b CollapseCandidate) (bool, bool) {
+		return false, false
+	})
+}
+
+// leastRecentPolicy 最久未访问的优先折叠
+type leastRecentPolicy struct{}
+
+func (leastRecentPolicy) Name() string { return CollapseLeastRecent }
+
+func (leastRecentPolicy) Order(candidates []CollapseCandidate) []CollapseCandidate {
+	return sortCandidates(candidates, func(a, b CollapseCandidate) (bool, bool) {
+		if a.LastAccessed.Equal(b.LastAccessed) {
+			return false, false
+		}
+		return a.LastAccessed.Before(b.LastAccessed), true
+	})
+}
+
+// largestFirstPolicy 占用token最多的优先折叠
+type largestFirstPolicy struct{}
+
+func (largestFirstPolicy) Name() string { return CollapseLargestFirst }
+
+func (largestFirstPolicy) Order(candidates []CollapseCandidate) []CollapseCandidate {
+	return sortCandidates(candidates, func(a, b CollapseCandidate) (bool, bool) {
+		if a.Tokens == b.Tokens {
+			return false, false
+		}
+		return a.Tokens > b.Tokens, true
+	})
+}
+
+// lowestImportancePolicy 重要性最低的优先折叠
+type lowestImportancePolicy struct{}
+
+func (lowestImportancePolicy) Name() string { return CollapseLowestImportance }
+
+func (lowestImportancePolicy) Order(candidates []CollapseCandidate) []CollapseCandidate {
+	return sortCandidates(candidates, func(a, b CollapseCandidate) (bool, bool) {
+		if a.Importance == b.Importance {
+			return false, false
+		}
+		return a.Importance < b.Importance, true
+	})
+}
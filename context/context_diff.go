@@ -0,0 +1,313 @@
+package context
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageState 某一时刻 Page 的结构状态（用于比较，不保存完整 detail）
+type PageState struct {
+	Index       PageIndex
+	Name        string
+	Description string
+	Parent      PageIndex
+	IsContents  bool
+	Visibility  PageVisibility
+	Lifecycle   PageLifecycle
+	DetailHash  uint64 // detail 内容的哈希
+	DetailLen   int    // detail 字符数
+}
+
+// TreeSnapshot 某一时刻的页面树快照
+//
+// Pages 只包含本进程中加载过或修改过的 Page；其余 Page 自启动以来没有变化，不参与比较。
+type TreeSnapshot struct {
+	TakenAt time.Time
+	Pages   map[PageIndex]PageState
+
+	baseline map[PageIndex]PageState // 从存储首次加载时的状态，包括之后被删除的 Page
+}
+
+// ChangeKind 页面变更类型
+type ChangeKind string
+
+const (
+	ChangeAdded     ChangeKind = "added"
+	ChangeRemoved   ChangeKind = "removed"
+	ChangeMoved     ChangeKind = "moved"
+	ChangeRenamed   ChangeKind = "renamed"
+	ChangeDescribed ChangeKind = "described"
+	ChangeExpanded  ChangeKind = "expanded"
+	ChangeHidden    ChangeKind = "hidden"
+	ChangeEdited    ChangeKind = "edited"
+	ChangeArchived  ChangeKind = "archived"
+	ChangeRestored  ChangeKind = "restored"
+)
+
+// PageChange 单个页面的一项变更，From/To 为变更前后的值（含义随类型而定）
+type PageChange struct {
+	Kind  ChangeKind
+	Index PageIndex
+	Name  string
+	From  string
+	To    string
+}
+
+// String 返回变更的单行描述
+func (c PageChange) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ [%s] %s (added under %s)", c.Index, c.Name, c.To)
+	case ChangeRemoved:
+		return fmt.Sprintf("- [%s] %s (removed from %s)", c.Index, c.Name, c.From)
+	case ChangeMoved:
+		return fmt.Sprintf("~ [%s] %s moved: %s -> %s", c.Index, c.Name, c.From, c.To)
+	case ChangeRenamed:
+		return fmt.Sprintf("~ [%s] renamed: %q -> %q", c.Index, c.From, c.To)
+	case ChangeDescribed:
+		return fmt.Sprintf("~ [%s] %s description: %q -> %q", c.Index, c.Name, c.From, c.To)
+	case ChangeEdited:
+		return fmt.Sprintf("~ [%s] %s detail edited (%s -> %s chars)", c.Index, c.Name, c.From, c.To)
+	default:
+		return fmt.Sprintf("~ [%s] %s %s", c.Index, c.Name, c.Kind)
+	}
+}
+
+// ContextDiff 两个快照之间的页面树差异
+type ContextDiff struct {
+	From    time.Time
+	To      time.Time
+	Changes []PageChange // 按页面索引排序
+}
+
+// IsEmpty 判断是否没有变更
+func (d *ContextDiff) IsEmpty() bool {
+	return len(d.Changes) == 0
+}
+
+// String 返回差异的文本表示，每行一项变更
+func (d *ContextDiff) String() string {
+	if d.IsEmpty() {
+		return "(no changes)\n"
+	}
+	var builder strings.Builder
+	for _, change := range d.Changes {
+		builder.WriteString(change.String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// Count 统计各类变更的数量
+func (d *ContextDiff) Count() map[ChangeKind]int {
+	counts := make(map[ChangeKind]int)
+	for _, change := range d.Changes {
+		counts[change.Kind]++
+	}
+	return counts
+}
+
+// pageStateOf 提取 Page 的结构状态
+func pageStateOf(page Page) PageState {
+	state := PageState{
+		Index:       page.GetIndex(),
+		Name:        page.GetName(),
+		Description: page.GetDescription(),
+		Parent:      page.GetParent(),
+		Visibility:  page.GetVisibility(),
+		Lifecycle:   page.GetLifecycle(),
+	}
+	switch p := page.(type) {
+	case *ContentsPage:
+		state.IsContents = true
+	case *DetailPage:
+		hash := fnv.New64a()
+		hash.Write([]byte(p.GetDetail()))
+		state.DetailHash = hash.Sum64()
+		state.DetailLen = len([]rune(p.GetDetail()))
+	}
+	return state
+}
+
+// pageStateIndex 结构状态索引
+//
+// 随 Page 从存储加载和 pageChanged 增量维护，TakeSnapshot 只复制内存中的状态，不扫描存储。
+type pageStateIndex struct {
+	current  map[PageIndex]PageState // 已知 Page 的最新状态
+	baseline map[PageIndex]PageState // 从存储首次加载时的状态（本进程中新建的 Page 没有）
+	mu       sync.Mutex
+}
+
+// newPageStateIndex 创建空的结构状态索引
+func newPageStateIndex() *pageStateIndex {
+	return &pageStateIndex{
+		current:  make(map[PageIndex]PageState),
+		baseline: make(map[PageIndex]PageState),
+	}
+}
+
+// Observe 记录从存储加载的Page（已知的Page忽略）
+func (idx *pageStateIndex) Observe(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	pageIndex := page.GetIndex()
+	if _, known := idx.current[pageIndex]; known {
+		return
+	}
+	if _, known := idx.baseline[pageIndex]; known {
+		return // 已删除
+	}
+	state := pageStateOf(page)
+	idx.current[pageIndex] = state
+	idx.baseline[pageIndex] = state
+}
+
+// Update 记录Page的最新状态，created 表示新建（同一索引此前的状态作废）
+func (idx *pageStateIndex) Update(page Page, created bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if created {
+		delete(idx.baseline, page.GetIndex())
+	}
+	idx.current[page.GetIndex()] = pageStateOf(page)
+}
+
+// Remove 记录Page已删除（保留首次加载的状态，用于报告删除）
+func (idx *pageStateIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.current, pageIndex)
+}
+
+// snapshot 复制当前状态
+func (idx *pageStateIndex) snapshot() *TreeSnapshot {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	snapshot := &TreeSnapshot{
+		TakenAt:  time.Now(),
+		Pages:    make(map[PageIndex]PageState, len(idx.current)),
+		baseline: make(map[PageIndex]PageState, len(idx.baseline)),
+	}
+	for pageIndex, state := range idx.current {
+		snapshot.Pages[pageIndex] = state
+	}
+	for pageIndex, state := range idx.baseline {
+		snapshot.baseline[pageIndex] = state
+	}
+	return snapshot
+}
+
+// TakeSnapshot 记录当前页面树的快照（包括冷归档的 Page）
+//
+// 快照由结构状态索引和缓存中的 Page 构成，不从存储加载；缓存中的 Page 以其当前状态为准。
+func (cs *ContextSystem) TakeSnapshot() *TreeSnapshot {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	snapshot := cs.states.snapshot()
+	for _, page := range cs.pages.Pages() {
+		snapshot.Pages[page.GetIndex()] = pageStateOf(page)
+	}
+	return snapshot
+}
+
+// stateBefore 返回 Page 在 from 时刻的状态
+//
+// from 中没有的 Page 若在 to 之前首次从存储加载，说明它在 from 时刻已存在且未被修改过，
+// 状态即首次加载时的状态；from 已知其首次加载状态却不在 Pages 中的，是 from 之前已删除的 Page。
+func stateBefore(from, to *TreeSnapshot, index PageIndex) (PageState, bool) {
+	if state, exists := from.Pages[index]; exists {
+		return state, true
+	}
+	if _, removed := from.baseline[index]; removed {
+		return PageState{}, false
+	}
+	state, exists := to.baseline[index]
+	return state, exists
+}
+
+// DiffSnapshots 比较两个快照，返回从 from 到 to 的变更
+func DiffSnapshots(from, to *TreeSnapshot) *ContextDiff {
+	diff := &ContextDiff{From: from.TakenAt, To: to.TakenAt}
+
+	candidates := make(map[PageIndex]bool, len(from.Pages)+len(to.Pages))
+	for index := range from.Pages {
+		candidates[index] = true
+	}
+	for index := range to.Pages {
+		candidates[index] = true
+	}
+	for index := range to.baseline {
+		candidates[index] = true
+	}
+	for index := range candidates {
+		before, existed := stateBefore(from, to, index)
+		after, exists := to.Pages[index]
+		switch {
+		case existed && !exists:
+			diff.Changes = append(diff.Changes, PageChange{Kind: ChangeRemoved, Index: index, Name: before.Name, From: string(before.Parent)})
+		case !existed && exists:
+			diff.Changes = append(diff.Changes, PageChange{Kind: ChangeAdded, Index: index, Name: after.Name, To: string(after.Parent)})
+		case existed && exists:
+			diff.Changes = append(diff.Changes, diffPageStates(before, after)...)
+		}
+	}
+
+	// 按页面索引排序，同一页面按变更类型的固定顺序
+	order := map[ChangeKind]int{
+		ChangeAdded: 0, ChangeRemoved: 1, ChangeArchived: 2, ChangeRestored: 3, ChangeMoved: 4,
+		ChangeRenamed: 5, ChangeDescribed: 6, ChangeEdited: 7, ChangeExpanded: 8, ChangeHidden: 9,
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		a, b := diff.Changes[i], diff.Changes[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return order[a.Kind] < order[b.Kind]
+	})
+	return diff
+}
+
+// diffPageStates 比较同一 Page 前后两个状态
+func diffPageStates(before, after PageState) []PageChange {
+	var changes []PageChange
+	add := func(kind ChangeKind, from, to string) {
+		changes = append(changes, PageChange{Kind: kind, Index: after.Index, Name: after.Name, From: from, To: to})
+	}
+
+	if before.Lifecycle != after.Lifecycle {
+		if after.Lifecycle == ColdArchived {
+			add(ChangeArchived, before.Lifecycle.String(), after.Lifecycle.String())
+		} else if before.Lifecycle == ColdArchived {
+			add(ChangeRestored, before.Lifecycle.String(), after.Lifecycle.String())
+		}
+	}
+	if before.Parent != after.Parent {
+		add(ChangeMoved, string(before.Parent), string(after.Parent))
+	}
+	if before.Name != after.Name {
+		add(ChangeRenamed, before.Name, after.Name)
+	}
+	if before.Description != after.Description {
+		add(ChangeDescribed, before.Description, after.Description)
+	}
+	if before.DetailHash != after.DetailHash {
+		add(ChangeEdited, fmt.Sprintf("%d", before.DetailLen), fmt.Sprintf("%d", after.DetailLen))
+	}
+	if before.Visibility != after.Visibility {
+		if after.Visibility == Expanded {
+			add(ChangeExpanded, before.Visibility.String(), after.Visibility.String())
+		} else {
+			add(ChangeHidden, before.Visibility.String(), after.Visibility.String())
+		}
+	}
+	return changes
+}
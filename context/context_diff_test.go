@@ -0,0 +1,91 @@
+package context
+
+import "testing"
+
+// TestContextDiff_Snapshots 测试两个快照之间的新增、删除、移动、重命名、展开和编辑
+func TestContextDiff_Snapshots(t *testing.T) {
+	cs, root := newTestSystem(t, t.TempDir())
+	group, _ := cs.createContentsPageInternal(ActorSystem, "Group", "", root)
+	note, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", "hello", root)
+	stale, _ := cs.createDetailPageInternal(ActorSystem, "Stale", "", "", root)
+
+	before := cs.TakeSnapshot()
+	if diff := DiffSnapshots(before, cs.TakeSnapshot()); !diff.IsEmpty() {
+		t.Fatalf("Expected no changes, got:\n%s", diff)
+	}
+
+	cs.movePageInternal(ActorSystem, note, group)
+	cs.updatePageInternal(ActorSystem, note, "Renamed", "")
+	cs.expandDetailsInternal(ActorSystem, note)
+	cs.removePageInternal(ActorSystem, stale)
+	added, _ := cs.createDetailPageInternal(ActorSystem, "New", "", "", group)
+
+	after := cs.TakeSnapshot()
+	// detail 仅通过历史回退修改，这里直接修改快照状态
+	edited := after.Pages[note]
+	edited.DetailHash++
+	after.Pages[note] = edited
+
+	counts := DiffSnapshots(before, after).Count()
+	expected := map[ChangeKind]int{
+		ChangeAdded: 1, ChangeRemoved: 1, ChangeMoved: 1, ChangeRenamed: 1, ChangeExpanded: 1, ChangeEdited: 1,
+	}
+	for kind, n := range expected {
+		if counts[kind] != n {
+			t.Errorf("Expected %d %s change(s), got %d", n, kind, counts[kind])
+		}
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("Unexpected change kinds: %v", counts)
+	}
+
+	diff := DiffSnapshots(before, after)
+	for _, change := range diff.Changes {
+		if change.Kind == ChangeAdded && change.Index != added {
+			t.Errorf("Expected added page %s, got %s", added, change.Index)
+		}
+		if change.Kind == ChangeMoved && (change.From != string(root) || change.To != string(group)) {
+			t.Errorf("Unexpected move: %s", change)
+		}
+	}
+}
+
+// countingStorage 统计 Load 调用次数的存储
+type countingStorage struct {
+	Storage
+	loads int
+}
+
+func (s *countingStorage) Load(pageIndex PageIndex) (Page, error) {
+	s.loads++
+	return s.Storage.Load(pageIndex)
+}
+
+// TestContextDiff_LazyPages 测试快照不从存储加载 Page，且恢复后才加载的 Page 的修改和删除被正确报告
+func TestContextDiff_LazyPages(t *testing.T) {
+	dir := t.TempDir()
+	cs, root := newTestSystem(t, dir)
+	note, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", "hello", root)
+	stale, _ := cs.createDetailPageInternal(ActorSystem, "Stale", "", "", root)
+	cs.createDetailPageInternal(ActorSystem, "Untouched", "", "", root)
+
+	restored := restoreTestSystem(t, dir)
+	counting := &countingStorage{Storage: restored.GetStorage()}
+	restored.SetStorage(counting)
+
+	before := restored.TakeSnapshot()
+	if counting.loads != 0 {
+		t.Errorf("TakeSnapshot should not load pages from storage, got %d loads", counting.loads)
+	}
+
+	restored.updatePageInternal(ActorSystem, note, "Renamed", "")
+	restored.removePageInternal(ActorSystem, stale)
+	after := restored.TakeSnapshot()
+	counts := DiffSnapshots(before, after).Count()
+	if len(counts) != 2 || counts[ChangeRenamed] != 1 || counts[ChangeRemoved] != 1 {
+		t.Errorf("Expected one rename and one removal, got:\n%s", DiffSnapshots(before, after))
+	}
+	if diff := DiffSnapshots(after, restored.TakeSnapshot()); !diff.IsEmpty() {
+		t.Errorf("Expected no changes after the removal was reported, got:\n%s", diff)
+	}
+}
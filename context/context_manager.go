@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"memci/config"
 	"memci/message"
+	"memci/tokenizer"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -14,20 +18,63 @@ type ContextManager struct {
 	agent  *AgentContext
 	window *ContextWindow
 	mu     sync.RWMutex
+
+	lastSnapshot *TreeSnapshot // 上一次 ExportToFile 时的页面树快照
 }
 
 // NewContextManager 创建新的上下文管理器
-func NewContextManager(cfg *config.ContextConfig) (*ContextManager, bool) {
-	system, restored := NewContextSystem(cfg)
+//
+// 存储无法打开（包括加密密钥错误）时返回错误；配置中的折叠策略或渲染格式无法识别时也返回错误，
+// 避免拼写错误静默回退到默认值。
+func NewContextManager(cfg *config.ContextConfig) (*ContextManager, bool, error) {
+	system, restored, err := NewContextSystem(cfg)
+	if err != nil {
+		return nil, false, err
+	}
 	agent := NewAgentContext(system)
 	window := NewContextWindow(system)
 
-	return &ContextManager{
+	cm := &ContextManager{
 		cfg:    cfg,
 		system: system,
 		agent:  agent,
 		window: window,
-	}, restored
+	}
+	if cfg != nil {
+		if err := cm.SetCollapsePolicy(cfg.CollapsePolicy); err != nil {
+			return nil, false, fmt.Errorf("invalid collapse_policy: %w", err)
+		}
+		if err := cm.SetRenderer(cfg.Renderer); err != nil {
+			return nil, false, fmt.Errorf("invalid renderer: %w", err)
+		}
+		for id, name := range cfg.SegmentRenderers {
+			if err := cm.SetSegmentRenderer(SegmentID(id), name); err != nil {
+				return nil, false, fmt.Errorf("invalid segment_renderers.%s: %w", id, err)
+			}
+		}
+		cm.SetShowTags(cfg.ShowTags)
+	}
+	// 恢复的 Segment 使用当前配置的预算（失败不影响管理器创建）
+	if restored {
+		_ = cm.applySegmentBudgets()
+	}
+	return cm, restored, nil
+}
+
+// applySegmentBudgets 将配置中的 token 预算应用到已存在的 Segment
+func (cm *ContextManager) applySegmentBudgets() error {
+	if cm.cfg == nil {
+		return nil
+	}
+	for id, budget := range cm.cfg.SegmentBudgets {
+		if _, err := cm.system.getSegmentInternal(SegmentID(id)); err != nil {
+			continue // 配置了不存在的 Segment，忽略
+		}
+		if err := cm.system.SetSegmentMaxCapacity(SegmentID(id), budget); err != nil {
+			return fmt.Errorf("failed to set budget of segment %s: %w", id, err)
+		}
+	}
+	return nil
 }
 
 // Initialize 初始化上下文管理器
@@ -83,7 +130,7 @@ func (cm *ContextManager) Initialize() error {
 		return err
 	}
 
-	return nil
+	return cm.applySegmentBudgets()
 }
 
 // createSegmentWithRootPage 创建 Segment 及其根 Page
@@ -188,6 +235,14 @@ func (cm *ContextManager) RemovePage(pageIndex PageIndex) error {
 	return cm.agent.RemovePage(pageIndex)
 }
 
+// PreviewRemove 预览删除 Page 的影响
+func (cm *ContextManager) PreviewRemove(pageIndex PageIndex) (*RemovalPreview, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.agent.PreviewRemove(pageIndex)
+}
+
 // CreateDetailPage 创建 DetailPage
 func (cm *ContextManager) CreateDetailPage(
 	name, description, detail string,
@@ -214,9 +269,11 @@ func (cm *ContextManager) CreateContentsPage(
 // ============ 渲染方法 ============
 
 // GenerateMessageList 生成发送给模型的 MessageList
+//
+// 生成前会执行已到期Page的到期动作，因此需要写锁。
 func (cm *ContextManager) GenerateMessageList() (*message.MessageList, error) {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 
 	return cm.window.GenerateMessageList()
 }
@@ -237,6 +294,22 @@ func (cm *ContextManager) AutoCollapse(maxTokens int) ([]PageIndex, error) {
 	return cm.window.AutoCollapse(maxTokens)
 }
 
+// EnforceSegmentBudgets 将超出自身预算的 Segment 折叠到预算以内
+func (cm *ContextManager) EnforceSegmentBudgets() ([]PageIndex, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	return cm.window.EnforceSegmentBudgets()
+}
+
+// SegmentTokenUsage 统计每个 Segment 的 token 使用情况
+func (cm *ContextManager) SegmentTokenUsage() ([]SegmentUsage, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.window.SegmentTokenUsage()
+}
+
 // ============ 查询方法 ============
 
 // GetPage 获取 Page
@@ -279,6 +352,67 @@ func (cm *ContextManager) GetAgentContext() *AgentContext {
 	return cm.agent
 }
 
+// SetCollapsePolicy 按名称设置 AutoCollapse 和 Segment 预算使用的折叠策略
+func (cm *ContextManager) SetCollapsePolicy(name string) error {
+	policy, err := NewCollapsePolicy(name)
+	if err != nil {
+		return err
+	}
+	cm.window.SetCollapsePolicy(policy)
+	return nil
+}
+
+// SetRenderer 按名称设置默认渲染格式
+func (cm *ContextManager) SetRenderer(name string) error {
+	renderer, err := NewRenderer(name)
+	if err != nil {
+		return err
+	}
+	cm.window.SetRenderer(renderer)
+	return nil
+}
+
+// SetSegmentRenderer 按名称为单个 Segment 设置渲染格式，名称为空表示使用默认渲染格式
+func (cm *ContextManager) SetSegmentRenderer(id SegmentID, name string) error {
+	if name == "" {
+		cm.window.SetSegmentRenderer(id, nil)
+		return nil
+	}
+	renderer, err := NewRenderer(name)
+	if err != nil {
+		return err
+	}
+	cm.window.SetSegmentRenderer(id, renderer)
+	return nil
+}
+
+// SetShowTags 设置是否在渲染结果中显示页面标签
+func (cm *ContextManager) SetShowTags(show bool) {
+	opts := cm.window.RenderOptions()
+	opts.ShowTags = show
+	cm.window.SetRenderOptions(opts)
+}
+
+// SetExpiryHandler 设置到期处理的回调，每条到期记录调用一次（用于记录日志）
+func (cm *ContextManager) SetExpiryHandler(handler func(ExpiryTransition)) {
+	cm.system.SetExpiryHandler(handler)
+}
+
+// SetTokenizer 设置估算 token 使用的分词器
+func (cm *ContextManager) SetTokenizer(tk tokenizer.Tokenizer) {
+	cm.window.SetTokenizer(tk)
+}
+
+// SetPinnedTokenBudget 设置固定Page的token预算（<=0 表示不限），固定预算和删除预览均使用当前分词器估算
+func (cm *ContextManager) SetPinnedTokenBudget(budget int) {
+	cm.system.SetPinnedBudget(budget, cm.window.PageTokens)
+}
+
+// SetEmbedder 设置语义检索使用的Embedder
+func (cm *ContextManager) SetEmbedder(embedder Embedder) {
+	cm.system.SetEmbedder(embedder)
+}
+
 // ============ 系统级操作（绕过权限检查） ============
 
 // CreateDetailPageSystem 系统级创建 DetailPage（绕过权限检查）
@@ -289,7 +423,7 @@ func (cm *ContextManager) CreateDetailPageSystem(
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	return cm.system.createDetailPageInternal(name, description, detail, parentIndex)
+	return cm.system.createDetailPageInternal(ActorSystem, name, description, detail, parentIndex)
 }
 
 // ExpandDetailsSystem 系统级展开 Page（绕过权限检查）
@@ -297,33 +431,188 @@ func (cm *ContextManager) ExpandDetailsSystem(pageIndex PageIndex) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	page, err := cm.system.GetPage(pageIndex)
+	return cm.system.expandDetailsInternal(ActorSystem, pageIndex)
+}
+
+// GetSegmentSystem 系统级获取 Segment（绕过权限检查）
+func (cm *ContextManager) GetSegmentSystem(id SegmentID) (*Segment, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.system.getSegmentInternal(id)
+}
+
+// ExportToFile 将当前ContextWindow导出到文件
+//
+// 同时记录页面树快照；存在上一次快照时，在同一目录写入与上一轮相比的
+// 差异文件 context_diff_turn_<turn>_<timestamp>.md。
+func (cm *ContextManager) ExportToFile(outputDir string, turn int) (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	snapshotPath, err := cm.window.ExportToFile(outputDir, turn)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	page.SetVisibility(Expanded)
+	snapshot := cm.system.TakeSnapshot()
+	previous := cm.lastSnapshot
+	cm.lastSnapshot = snapshot
+	if previous == nil {
+		return snapshotPath, nil
+	}
 
-	// 持久化更新
-	if cm.system.storage != nil {
-		cm.system.storage.Save(page)
+	diff := DiffSnapshots(previous, snapshot)
+	diffName := strings.Replace(filepath.Base(snapshotPath), "context_snapshot_", "context_diff_", 1)
+	content := fmt.Sprintf("# Turn: %d | Diff since %s\n\n%s", turn, previous.TakenAt.Format("20060102_150405"), diff)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(snapshotPath), diffName), []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write diff file: %w", err)
 	}
+	return snapshotPath, nil
+}
 
-	return nil
+// ============ 上下文差异 ============
+
+// Snapshot 记录当前页面树的快照，可与之后的快照通过 Diff 比较
+func (cm *ContextManager) Snapshot() *TreeSnapshot {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.system.TakeSnapshot()
 }
 
-// GetSegmentSystem 系统级获取 Segment（绕过权限检查）
-func (cm *ContextManager) GetSegmentSystem(id SegmentID) (*Segment, error) {
+// Diff 比较两个快照，返回从 from 到 to 的页面树变更
+func (cm *ContextManager) Diff(from, to *TreeSnapshot) *ContextDiff {
+	return DiffSnapshots(from, to)
+}
+
+// DiffSinceLastExport 返回自上一次 ExportToFile 以来的页面树变更
+//
+// 尚未导出过快照时与空树比较，即全部 Page 记为新增。
+func (cm *ContextManager) DiffSinceLastExport() *ContextDiff {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	return cm.system.getSegmentInternal(id)
+	previous := cm.lastSnapshot
+	if previous == nil {
+		previous = &TreeSnapshot{Pages: map[PageIndex]PageState{}}
+	}
+	return DiffSnapshots(previous, cm.system.TakeSnapshot())
 }
 
-// ExportToFile 将当前ContextWindow导出到文件
-func (cm *ContextManager) ExportToFile(outputDir string, turn int) (string, error) {
+// ============ 完整性检查 ============
+
+// CheckIntegrity 检查页面树和 Segment 索引计数器的完整性，不做任何修改
+func (cm *ContextManager) CheckIntegrity() *IntegrityReport {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
-	return cm.window.ExportToFile(outputDir, turn)
+	return cm.system.Check()
+}
+
+// Repair 修复完整性问题，dryRun 为 true 时只返回将要执行的修复动作
+func (cm *ContextManager) Repair(dryRun bool) (*IntegrityReport, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	return cm.system.Repair(dryRun)
+}
+
+// CollectGarbage 删除无法从任何 Segment 根 Page 到达的 Page，dryRun 为 true 时只返回待删除的 Page
+func (cm *ContextManager) CollectGarbage(dryRun bool) (*GCReport, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	return cm.system.CollectGarbage(dryRun)
+}
+
+// ============ 归档导入导出 ============
+
+// ExportArchive 将全部记忆（Segment、Page 及索引计数器）导出到归档文件
+//
+// 先写入临时文件再重命名，导出中断不会留下不完整的归档。
+func (cm *ContextManager) ExportArchive(path string) error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	if err := cm.system.ExportArchive(file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close archive file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename archive file: %w", err)
+	}
+	return nil
+}
+
+// ImportArchive 从归档文件导入记忆，导入后对 Segment 应用配置中的 token 预算
+func (cm *ContextManager) ImportArchive(path string, mode ImportMode) (*ImportResult, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer file.Close()
+
+	result, err := cm.system.ImportArchive(file, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.applySegmentBudgets(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// ============ markdown 导入导出 ============
+
+// ImportMarkdownFile 将 markdown 文件导入为 parentIndex 下的页面树（绕过权限检查）
+//
+// 标题层级生成 ContentsPage，正文生成 DetailPage；第一个标题之前的正文以文件名命名。
+func (cm *ContextManager) ImportMarkdownFile(path string, parentIndex PageIndex) ([]PageIndex, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read markdown file: %w", err)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return cm.system.ImportMarkdown(parentIndex, name, string(data))
+}
+
+// ExportMarkdownFile 将以 pageIndex 为根的子树导出为 markdown 文件
+func (cm *ContextManager) ExportMarkdownFile(pageIndex PageIndex, path string) error {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	markdown, err := cm.system.ExportMarkdown(pageIndex)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(markdown), 0644); err != nil {
+		return fmt.Errorf("failed to write markdown file: %w", err)
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package context
 
 import (
+	"errors"
 	"fmt"
 	"memci/config"
 	"strings"
@@ -16,14 +17,42 @@ type ContextSystem struct {
 	// Segment 管理
 	segments   []*Segment             // 按添加顺序存储，显示顺序
 	segmentMap map[SegmentID]*Segment // 快速查找
+	retired    map[SegmentID]int      // 已删除 Segment 的索引计数器（存储中的墓碑）
 
 	// Page 存储
-	pages   map[PageIndex]Page // 全局 Page 注册表（内存缓存）
-	storage Storage            // 持久化存储接口
+	pages    *pageCache      // 全局 Page 注册表（LRU 内存缓存，未命中时从存储加载）
+	storage  Storage         // 持久化存储接口
+	index    *searchIndex    // 全文索引
+	vectors  *vectorIndex    // 向量索引（语义检索）
+	links    *linkIndex      // 链接索引（反向链接）
+	expiries *expiryIndex    // 到期索引
+	states   *pageStateIndex // 结构状态索引（上下文差异快照）
+	pinned   *pinnedIndex    // 固定索引（固定预算）
+
+	// 访问记录尚未持久化的Page（见 FlushAccess）
+	accessed map[PageIndex]Page
+
+	// 到期清扫
+	onExpire  func(ExpiryTransition) // 到期处理回调
+	expiryLog []ExpiryTransition     // 最近的到期记录
 
 	// 索引生成
 	nextIndex int // 用于生成新的 PageIndex
 
+	// 自定义 Segment 数量上限（<0 表示不限）
+	maxCustomSegments int
+
+	// 固定Page的token预算（<=0 表示不限）及单个Page的估算函数（也用于删除预览）
+	pinnedBudget int
+	pageCost     func(Page) int
+
+	// 删除Page时改为冷归档子树，保留数据以便恢复
+	archiveOnRemove bool
+
+	// 修订历史
+	revisionCounts map[PageIndex]int // 每个 Page 的最新修订号缓存
+	historyMu      sync.Mutex        // 保护 revisionCounts
+
 	// 元数据
 	createdAt time.Time
 	updatedAt time.Time
@@ -33,40 +62,126 @@ type ContextSystem struct {
 }
 
 // NewContextSystem 创建新的上下文系统（使用内存存储）
-func NewContextSystem(cfg *config.ContextConfig) (*ContextSystem, bool) {
-	storage, err := NewFileStorage(cfg.StorageBaseDir)
+//
+// 存储无法创建、数据由未配置的密钥加密（继续运行会写入新的记忆并与无法解密的旧数据混杂）时返回错误，
+// 其他恢复错误不影响系统创建。
+func NewContextSystem(cfg *config.ContextConfig) (*ContextSystem, bool, error) {
+	storage, err := newStorageFromConfig(cfg)
 	if err != nil {
-		panic(err)
+		return nil, false, fmt.Errorf("failed to create storage: %w", err)
 	}
 	cs := &ContextSystem{
-		cfg:        cfg,
-		segments:   make([]*Segment, 0),
-		segmentMap: make(map[SegmentID]*Segment),
-		pages:      make(map[PageIndex]Page),
-		storage:    storage,
-		nextIndex:  0,
-		createdAt:  time.Now(),
-		updatedAt:  time.Now(),
+		cfg:               cfg,
+		segments:          make([]*Segment, 0),
+		segmentMap:        make(map[SegmentID]*Segment),
+		retired:           make(map[SegmentID]int),
+		pages:             newPageCache(pageCacheSizeFromConfig(cfg)),
+		storage:           storage,
+		nextIndex:         0,
+		maxCustomSegments: maxCustomSegmentsFromConfig(cfg),
+		archiveOnRemove:   cfg.ArchiveOnRemove,
+		pageCost:          heuristicPageCost,
+		revisionCounts:    make(map[PageIndex]int),
+		accessed:          make(map[PageIndex]Page),
+		index:             newSearchIndex(),
+		vectors:           newVectorIndex(NewHashEmbedder(cfg.EmbeddingDim)),
+		links:             newLinkIndex(),
+		expiries:          newExpiryIndex(),
+		states:            newPageStateIndex(),
+		pinned:            newPinnedIndex(heuristicPageCost),
+		createdAt:         time.Now(),
+		updatedAt:         time.Now(),
+	}
+	// 向量持久化到存储目录下的 sidecar 文件，启用加密时一同加密
+	if cfg.StorageBaseDir != "" {
+		var cipher embeddingCipher
+		if encrypted, ok := storage.(*EncryptedStorage); ok && encrypted.encrypts() {
+			cipher = encrypted
+		}
+		cs.vectors.SetCache(newEmbeddingCache(cfg.StorageBaseDir, cipher))
 	}
 	// 自动恢复持久化的数据
 	restored, err := cs.Restore()
+	if errors.Is(err, ErrWrongEncryptionKey) {
+		return nil, false, err
+	}
+	// 恢复时读到未加密或旧密钥加密的数据（开启加密、密钥轮换或上次改写中断）时改写为当前密钥加密
+	if encrypted, ok := storage.(*EncryptedStorage); ok && err == nil && encrypted.NeedsReencrypt() {
+		if _, err := encrypted.Reencrypt(); errors.Is(err, ErrWrongEncryptionKey) {
+			return nil, false, err
+		}
+	}
+	return cs, restored, nil
+}
+
+// newStorageFromConfig 根据配置创建存储后端，并使用 EncryptedStorage 包装（未配置加密密钥时不加密，只拒绝读取密文）
+func newStorageFromConfig(cfg *config.ContextConfig) (Storage, error) {
+	var storage Storage
+	var err error
+	switch cfg.StorageType {
+	case "", "file":
+		var fileStorage *FileStorage
+		fileStorage, err = NewFileStorageWithGzip(cfg.StorageBaseDir, cfg.StorageUseGzip)
+		if err != nil {
+			return nil, err
+		}
+		// 切换 storage_use_gzip 后将已有文件转换为当前格式，已是目标格式的文件直接跳过
+		if _, err = fileStorage.Migrate(); err != nil {
+			return nil, fmt.Errorf("failed to migrate storage: %w", err)
+		}
+		storage = fileStorage
+	case "wal":
+		threshold := cfg.WALCompactThreshold
+		if threshold == 0 {
+			threshold = defaultWALCompactThreshold
+		}
+		storage, err = NewWALStorage(cfg.StorageBaseDir, threshold)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", cfg.StorageType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, oldKeys, err := encryptionKeysFromConfig(cfg)
 	if err != nil {
-		// 恢复失败不影响系统创建，只记录错误
-		_ = err
+		return nil, err
+	}
+	if key == nil {
+		return NewEncryptedStorage(storage, nil)
+	}
+	return NewEncryptedStorage(storage, key, oldKeys...)
+}
+
+// pageCacheSizeFromConfig 获取Page缓存容量，未配置时使用默认值，负数表示不限
+func pageCacheSizeFromConfig(cfg *config.ContextConfig) int {
+	if cfg.PageCacheSize == 0 {
+		return defaultPageCacheSize
 	}
-	return cs, restored
+	return cfg.PageCacheSize
 }
 
 // NewContextSystemWithStorage 创建指定存储的上下文系统
 func NewContextSystemWithStorage(storage Storage) *ContextSystem {
 	return &ContextSystem{
-		segments:   make([]*Segment, 0),
-		segmentMap: make(map[SegmentID]*Segment),
-		pages:      make(map[PageIndex]Page),
-		storage:    storage,
-		nextIndex:  0,
-		createdAt:  time.Now(),
-		updatedAt:  time.Now(),
+		segments:          make([]*Segment, 0),
+		segmentMap:        make(map[SegmentID]*Segment),
+		retired:           make(map[SegmentID]int),
+		pages:             newPageCache(0),
+		storage:           storage,
+		nextIndex:         0,
+		maxCustomSegments: defaultMaxCustomSegments,
+		pageCost:          heuristicPageCost,
+		revisionCounts:    make(map[PageIndex]int),
+		accessed:          make(map[PageIndex]Page),
+		index:             newSearchIndex(),
+		vectors:           newVectorIndex(NewHashEmbedder(0)),
+		links:             newLinkIndex(),
+		expiries:          newExpiryIndex(),
+		states:            newPageStateIndex(),
+		pinned:            newPinnedIndex(heuristicPageCost),
+		createdAt:         time.Now(),
+		updatedAt:         time.Now(),
 	}
 }
 
@@ -78,6 +193,23 @@ func (cs *ContextSystem) SetStorage(storage Storage) {
 	cs.updatedAt = time.Now()
 }
 
+// SetPageCacheSize 设置Page内存缓存容量（<=0 表示不限）
+//
+// 未配置存储时缓存是唯一的数据副本，此时不做淘汰。
+func (cs *ContextSystem) SetPageCacheSize(size int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.storage == nil {
+		return
+	}
+	cs.pages.SetCapacity(size)
+}
+
+// SetEmbedder 设置语义检索使用的Embedder（向量索引会在下次检索时重建）
+func (cs *ContextSystem) SetEmbedder(embedder Embedder) {
+	cs.vectors.SetEmbedder(embedder)
+}
+
 // GetStorage 获取当前存储实现
 func (cs *ContextSystem) GetStorage() Storage {
 	cs.mu.RLock()
@@ -100,9 +232,12 @@ func (cs *ContextSystem) AddSegment(segment Segment) error {
 	// 注意：不验证 root page 是否存在，允许先添加 Segment 再添加 Page 的场景
 	// Page 的有效性由 AddPage 验证
 
-	// 创建副本并存储指针
+	// 创建副本并存储指针，同 ID 的 Segment 曾被删除时继续其索引计数
 	seg := &Segment{}
 	*seg = segment
+	if counter, ok := cs.retired[seg.GetID()]; ok && counter > seg.GetIndexCounter() {
+		seg.SetIndexCounter(counter)
+	}
 	cs.segments = append(cs.segments, seg)
 	cs.segmentMap[segment.GetID()] = seg
 	cs.updatedAt = time.Now()
@@ -116,21 +251,49 @@ func (cs *ContextSystem) AddSegment(segment Segment) error {
 			return fmt.Errorf("failed to save segment: %w", err)
 		}
 	}
+	delete(cs.retired, segment.GetID())
 
 	return nil
 }
 
 // RemoveSegment 移除Segment
+//
+// 存储中保留只含索引计数器的墓碑，同 ID 的 Segment 重建后不会复用旧的 Page 索引（及其修订历史）。
 func (cs *ContextSystem) RemoveSegment(id SegmentID) error {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
+	rollback, err := cs.removeSegmentTx(id, tx)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return fmt.Errorf("failed to delete segment from storage: %w", err)
+	}
+	cs.updatedAt = time.Now()
+
+	// 注意：不删除Segment下的Page，由 DeleteSegment 删除页面树，或由 CollectGarbage 回收
+	return nil
+}
+
+// removeSegmentTx 从内存移除Segment并在 tx 中暂存其墓碑，返回提交失败时的回滚函数（调用方需持有写锁）
+func (cs *ContextSystem) removeSegmentTx(id SegmentID, tx Transaction) (func(), error) {
 	segment, exists := cs.segmentMap[id]
 	if !exists {
-		return fmt.Errorf("segment %s not found", id)
+		return nil, fmt.Errorf("segment %s not found", id)
+	}
+	if err := tx.SaveSegment(segment.tombstone()); err != nil {
+		return nil, err
 	}
 
-	// 从切片中移除
+	// 从切片和map中移除，记录索引计数器
 	removedIndex := -1
 	for i, seg := range cs.segments {
 		if seg.GetID() == id {
@@ -139,31 +302,48 @@ func (cs *ContextSystem) RemoveSegment(id SegmentID) error {
 			break
 		}
 	}
-
-	// 从map中移除
 	delete(cs.segmentMap, id)
+	oldCounter, hadRetired := cs.retired[id]
+	cs.retired[id] = segment.GetIndexCounter()
 
-	// 从存储删除 Segment 元数据
-	if cs.storage != nil {
-		if err := cs.storage.DeleteSegment(id); err != nil {
-			// 删除失败，回滚内存操作
-			cs.segmentMap[id] = segment
-			if removedIndex >= 0 {
-				cs.segments = append(cs.segments[:removedIndex], append([]*Segment{segment}, cs.segments[removedIndex:]...)...)
-			}
-			return fmt.Errorf("failed to delete segment from storage: %w", err)
+	return func() {
+		cs.segmentMap[id] = segment
+		if removedIndex >= 0 {
+			cs.segments = append(cs.segments[:removedIndex], append([]*Segment{segment}, cs.segments[removedIndex:]...)...)
 		}
+		if hadRetired {
+			cs.retired[id] = oldCounter
+		} else {
+			delete(cs.retired, id)
+		}
+	}, nil
+}
+
+// SetSegmentRootIndex 设置Segment的rootIndex（内部方法）
+func (cs *ContextSystem) SetSegmentRootIndex(id SegmentID, rootIndex PageIndex) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	segment, exists := cs.segmentMap[id]
+	if !exists {
+		return fmt.Errorf("segment %s not found", id)
 	}
 
+	segment.rootIndex = rootIndex
 	cs.updatedAt = time.Now()
 
-	// 注意：不删除Segment下的Page，由外部管理
-	_ = segment // 避免未使用警告
+	// 持久化更新到存储
+	if cs.storage != nil {
+		if err := cs.storage.SaveSegment(segment); err != nil {
+			return fmt.Errorf("failed to save segment: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// SetSegmentRootIndex 设置Segment的rootIndex（内部方法）
-func (cs *ContextSystem) SetSegmentRootIndex(id SegmentID, rootIndex PageIndex) error {
+// SetSegmentMaxCapacity 设置Segment的token预算（0 表示不限）并持久化
+func (cs *ContextSystem) SetSegmentMaxCapacity(id SegmentID, capacity int) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
@@ -171,8 +351,12 @@ func (cs *ContextSystem) SetSegmentRootIndex(id SegmentID, rootIndex PageIndex)
 	if !exists {
 		return fmt.Errorf("segment %s not found", id)
 	}
-
-	segment.rootIndex = rootIndex
+	if segment.GetMaxCapacity() == capacity {
+		return nil
+	}
+	if err := segment.SetMaxCapacity(capacity); err != nil {
+		return err
+	}
 	cs.updatedAt = time.Now()
 
 	// 持久化更新到存储
@@ -198,7 +382,9 @@ func (cs *ContextSystem) GetSegment(id SegmentID) (Segment, error) {
 	return *segment, nil // 返回副本
 }
 
-// ListSegments 列出所有Segment（按顺序，返回副本）
+// ListSegments 列出所有Segment（按显示顺序，返回副本）
+//
+// 内置Segment按添加顺序在前，自定义Segment按创建时间排在其后（见 sortSegments）。
 func (cs *ContextSystem) ListSegments() ([]Segment, error) {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
@@ -209,6 +395,7 @@ func (cs *ContextSystem) ListSegments() ([]Segment, error) {
 			result = append(result, *seg) // 返回副本
 		}
 	}
+	sortSegments(result)
 	return result, nil
 }
 
@@ -262,14 +449,36 @@ func (cs *ContextSystem) getSegmentInternal(id SegmentID) (*Segment, error) {
 
 // AddPage 添加Page到系统（自动持久化）
 func (cs *ContextSystem) AddPage(page Page) error {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
+	if err := cs.addPageTx(page, tx); err != nil {
+		tx.Abort()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		cs.rollbackAddPage(page)
+		return fmt.Errorf("failed to save page %s to storage: %w", page.GetIndex(), err)
+	}
+	cs.pageChanged(page, ActorSystem, RevisionCreate)
+	return nil
+}
+
+// addPageTx 校验并添加Page到内存，写入暂存到事务（调用方需持有写锁）
+//
+// 页面和被更新 children 列表的父页面都在 tx 中暂存，由调用方提交；
+// 提交失败时调用方应使用 rollbackAddPage 回滚内存状态。
+func (cs *ContextSystem) addPageTx(page Page, tx Transaction) error {
 	pageIndex := page.GetIndex()
 	parentIndex := page.GetParent()
 
 	// 验证 1: Page 索引唯一性（先检查内存，再检查存储）
-	if _, exists := cs.pages[pageIndex]; exists {
+	if _, exists := cs.pages.Peek(pageIndex); exists {
 		return fmt.Errorf("page %s already exists", pageIndex)
 	}
 	if cs.storage != nil && cs.storage.Exists(pageIndex) {
@@ -277,6 +486,7 @@ func (cs *ContextSystem) AddPage(page Page) error {
 	}
 
 	// 验证 2: 父节点完整性（除了 root page，所有 page 必须有父节点）
+	var parentPage *ContentsPage
 	if parentIndex == "" {
 		// 没有 parent，必须是某个 Segment 的 root page
 		isRoot := false
@@ -291,173 +501,374 @@ func (cs *ContextSystem) AddPage(page Page) error {
 		}
 	} else {
 		// 有 parent，必须验证 parent 存在且是 ContentsPage
-		parent, exists := cs.pages[parentIndex]
-		if !exists {
-			// 尝试从存储加载
-			if cs.storage != nil && cs.storage.Exists(parentIndex) {
-				loadedPage, err := cs.storage.Load(parentIndex)
-				if err != nil {
-					return fmt.Errorf("failed to load parent page %s: %w", parentIndex, err)
-				}
-				parent = loadedPage
-				cs.pages[parentIndex] = parent // 缓存到内存
-			} else {
-				return fmt.Errorf("parent page %s not found for page %s", parentIndex, pageIndex)
-			}
+		parent, err := cs.getPageLocked(parentIndex)
+		if err != nil {
+			return fmt.Errorf("parent of page %s: %w", pageIndex, err)
 		}
-		if parentPage, ok := parent.(*ContentsPage); ok {
-			if err := parentPage.AddChild(pageIndex); err != nil {
-				return err
-			}
-		} else {
+		var ok bool
+		if parentPage, ok = parent.(*ContentsPage); !ok {
 			return fmt.Errorf("parent page %s is not a ContentsPage", parentIndex)
 		}
+		if err := parentPage.AddChild(pageIndex); err != nil {
+			return err
+		}
 	}
 
 	// 验证通过，添加到内存
-	cs.pages[pageIndex] = page
+	cs.pages.Put(page)
 	cs.updatedAt = time.Now()
 
-	// 自动持久化到存储
-	if cs.storage != nil {
-		if err := cs.storage.Save(page); err != nil {
-			// 持久化失败，回滚内存操作
-			delete(cs.pages, pageIndex)
-			return fmt.Errorf("failed to save page %s to storage: %w", pageIndex, err)
-		}
-
-		// 如果页面有父页面，也需要保存父页面（因为父页面的 children 列表被更新了）
-		if parentIndex != "" {
-			if parent, exists := cs.pages[parentIndex]; exists {
-				if err := cs.storage.Save(parent); err != nil {
-					// 父页面保存失败，回滚
-					delete(cs.pages, pageIndex)
-					cs.storage.Delete(pageIndex)
-					return fmt.Errorf("failed to save parent page %s: %w", parentIndex, err)
-				}
-			}
+	// 暂存页面及父页面（父页面的 children 列表被更新了）
+	if err := tx.Save(page); err != nil {
+		cs.rollbackAddPage(page)
+		return err
+	}
+	if parentPage != nil {
+		if err := tx.Save(parentPage); err != nil {
+			cs.rollbackAddPage(page)
+			return err
 		}
 	}
 
 	return nil
 }
 
+// rollbackAddPage 回滚 addPageTx 对内存的修改（调用方需持有写锁）
+func (cs *ContextSystem) rollbackAddPage(page Page) {
+	cs.pages.Remove(page.GetIndex())
+	if parent, exists := cs.pages.Peek(page.GetParent()); exists {
+		if parentPage, ok := parent.(*ContentsPage); ok && parentPage.HasChild(page.GetIndex()) {
+			parentPage.RemoveChild(page.GetIndex())
+		}
+	}
+}
+
+// beginTransaction 开启存储事务，未配置存储时返回空事务
+func (cs *ContextSystem) beginTransaction() (Transaction, error) {
+	if cs.storage == nil {
+		return nopTransaction{}, nil
+	}
+	tx, err := cs.storage.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// pageChanged Page变更提交后的统一处理：记录修订并维护全文、链接、到期和固定索引
+func (cs *ContextSystem) pageChanged(page Page, actor Actor, operation string) {
+	if page == nil {
+		return
+	}
+	if operation == RevisionRemove {
+		cs.index.Remove(page.GetIndex())
+		cs.vectors.Remove(page.GetIndex())
+		cs.links.Remove(page.GetIndex())
+		cs.expiries.Remove(page.GetIndex())
+		cs.states.Remove(page.GetIndex())
+		cs.pinned.Remove(page.GetIndex())
+	} else {
+		cs.index.Update(page)
+		cs.vectors.Update(page)
+		cs.links.Update(page)
+		cs.expiries.Update(page)
+		cs.states.Update(page, operation == RevisionCreate)
+		cs.pinned.Update(page)
+	}
+	cs.recordRevision(page, actor, operation)
+}
+
 // GetPage 获取Page（支持懒加载）
+//
+// 缓存未命中时从存储加载并放入 LRU 缓存。
 func (cs *ContextSystem) GetPage(pageIndex PageIndex) (Page, error) {
 	cs.mu.RLock()
-	page, exists := cs.pages[pageIndex]
+	page, exists := cs.pages.Get(pageIndex)
 	cs.mu.RUnlock()
 
 	if exists {
 		return page, nil
 	}
 
-	// Page不在内存中，尝试从存储加载
-	if cs.storage != nil && cs.storage.Exists(pageIndex) {
-		loadedPage, err := cs.storage.Load(pageIndex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load page %s from storage: %w", pageIndex, err)
-		}
-		// 加载到内存缓存
-		cs.mu.Lock()
-		// 再次检查，防止在加载过程中被其他goroutine添加
-		if _, exists := cs.pages[pageIndex]; !exists {
-			cs.pages[pageIndex] = loadedPage
-		}
-		cs.mu.Unlock()
-		return loadedPage, nil
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// 再次检查，防止在加载过程中被其他goroutine添加
+	return cs.getPageLocked(pageIndex)
+}
+
+// getPageLocked 从缓存获取Page，未命中时从存储加载并缓存（调用方需持有写锁）
+func (cs *ContextSystem) getPageLocked(pageIndex PageIndex) (Page, error) {
+	if page, exists := cs.pages.Get(pageIndex); exists {
+		return page, nil
+	}
+
+	if cs.storage == nil || !cs.storage.Exists(pageIndex) {
+		return nil, fmt.Errorf("page %s not found", pageIndex)
 	}
+	loadedPage, err := cs.loadStoredPage(pageIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load page %s from storage: %w", pageIndex, err)
+	}
+	// 冷归档的 Page 需先恢复
+	if loadedPage.GetLifecycle() == ColdArchived {
+		return nil, fmt.Errorf("page %s is archived, restore it first", pageIndex)
+	}
+	cs.pages.Put(loadedPage)
+	return loadedPage, nil
+}
 
-	return nil, fmt.Errorf("page %s not found", pageIndex)
+// loadStoredPage 从存储加载Page（不写入缓存），并记录其在本进程中首次加载时的结构状态
+//
+// 修改存储中的 Page 之前总是先加载它，因此首次加载的状态就是此前所有快照时刻的状态。
+func (cs *ContextSystem) loadStoredPage(pageIndex PageIndex) (Page, error) {
+	page, err := cs.storage.Load(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	cs.states.Observe(page)
+	return page, nil
 }
 
-// RemovePage 移除Page（自动删除持久化）
+// RemovePage 移除Page（自动删除持久化，系统级操作）
 func (cs *ContextSystem) RemovePage(pageIndex PageIndex) error {
+	return cs.removePageInternal(ActorSystem, pageIndex)
+}
+
+// SetArchiveOnRemove 设置删除Page时是否改为冷归档子树（保留数据以便恢复）
+func (cs *ContextSystem) SetArchiveOnRemove(archive bool) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.archiveOnRemove = archive
+}
 
-	page, exists := cs.pages[pageIndex]
-	if !exists {
-		// 尝试从存储删除
+// removePageInternal 移除Page（内部方法）
+//
+// 开启 archiveOnRemove 时将子树移入冷归档，已归档的 Page 和 Segment 根 Page 仍直接删除。
+func (cs *ContextSystem) removePageInternal(actor Actor, pageIndex PageIndex) error {
+	cs.mu.RLock()
+	archive := cs.archivesOnRemoveLocked(pageIndex)
+	cs.mu.RUnlock()
+
+	if archive {
+		return cs.archivePageInternal(actor, pageIndex)
+	}
+	return cs.deletePageInternal(actor, pageIndex)
+}
+
+// archivesOnRemoveLocked 判断删除该Page时是否改为冷归档（调用方需持有锁）
+func (cs *ContextSystem) archivesOnRemoveLocked(pageIndex PageIndex) bool {
+	return cs.archiveOnRemove && !cs.isArchivedLocked(pageIndex) && !cs.isSegmentRootLocked(pageIndex)
+}
+
+// isSegmentRootLocked 判断Page是否为某个Segment的根Page（调用方需持有锁）
+func (cs *ContextSystem) isSegmentRootLocked(pageIndex PageIndex) bool {
+	for _, seg := range cs.segments {
+		if seg.GetRootIndex() == pageIndex {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentOfLocked 按索引前缀查找Page所属Segment，多个前缀匹配时取最长的（调用方需持有锁）
+func (cs *ContextSystem) segmentOfLocked(pageIndex PageIndex) *Segment {
+	var matched *Segment
+	for _, seg := range cs.segments {
+		prefix := string(seg.GetID()) + "-"
+		if strings.HasPrefix(string(pageIndex), prefix) &&
+			(matched == nil || len(seg.GetID()) > len(matched.GetID())) {
+			matched = seg
+		}
+	}
+	return matched
+}
+
+// deletePageInternal 删除Page子树（内部方法）
+//
+// 整棵子树的删除和父页面 children 列表的更新在同一事务中提交。
+func (cs *ContextSystem) deletePageInternal(actor Actor, pageIndex PageIndex) error {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	page, err := cs.getPageLocked(pageIndex)
+	if err != nil {
+		tx.Abort()
+		// 无法加载（如已冷归档）时仅从存储删除
 		if cs.storage != nil && cs.storage.Exists(pageIndex) {
 			if err := cs.storage.Delete(pageIndex); err != nil {
 				return fmt.Errorf("failed to delete page %s from storage: %w", pageIndex, err)
 			}
+			cs.index.Remove(pageIndex)
+			cs.vectors.Remove(pageIndex)
+			cs.links.Remove(pageIndex)
+			cs.expiries.Remove(pageIndex)
+			cs.removeDanglingLinksLocked(actor, map[PageIndex]bool{pageIndex: true})
 			cs.updatedAt = time.Now()
 			return nil
 		}
-		return fmt.Errorf("page %s not found", pageIndex)
+		return err
 	}
 
-	// 递归删除子节点
-	if contentsPage, ok := page.(*ContentsPage); ok {
-		for _, childIndex := range contentsPage.GetChildren() {
-			if err := cs.removePageInternal(childIndex); err != nil {
-				return err
-			}
-		}
+	deletion, err := cs.stageDeleteLocked(page, tx)
+	if err != nil {
+		tx.Abort()
+		return err
 	}
+	if err := tx.Commit(); err != nil {
+		deletion.rollback()
+		return fmt.Errorf("failed to delete page %s from storage: %w", pageIndex, err)
+	}
+	deletion.apply(cs, actor)
+	cs.updatedAt = time.Now()
 
-	// 从父节点移除
+	return nil
+}
+
+// pageDeletion 已暂存的Page子树删除
+type pageDeletion struct {
+	subtree    []Page
+	cleaned    []linkCleanup
+	parentPage *ContentsPage
+	childPos   int
+}
+
+// stageDeleteLocked 暂存Page子树的删除、子树外链接的清理和父节点 children 的更新（调用方需持有写锁）
+//
+// 失败时已恢复内存状态，由调用方放弃事务；提交失败时调用方应调用 rollback。
+func (cs *ContextSystem) stageDeleteLocked(page Page, tx Transaction) (*pageDeletion, error) {
+	pageIndex := page.GetIndex()
+
+	// 检查父节点
+	var parentPage *ContentsPage
 	if page.GetParent() != "" {
-		parent, exists := cs.pages[page.GetParent()]
-		if !exists {
-			return fmt.Errorf("parent page %s not found", page.GetParent())
+		parent, err := cs.getPageLocked(page.GetParent())
+		if err != nil {
+			return nil, fmt.Errorf("parent page %s not found", page.GetParent())
 		}
-		if parentPage, ok := parent.(*ContentsPage); ok {
-			parentPage.RemoveChild(pageIndex)
-		} else {
-			return fmt.Errorf("parent page %s is not a ContentsPage", page.GetParent())
+		var ok bool
+		if parentPage, ok = parent.(*ContentsPage); !ok {
+			return nil, fmt.Errorf("parent page %s is not a ContentsPage", page.GetParent())
 		}
 	}
 
-	// 从存储删除
-	if cs.storage != nil && cs.storage.Exists(pageIndex) {
-		if err := cs.storage.Delete(pageIndex); err != nil {
-			return fmt.Errorf("failed to delete page %s from storage: %w", pageIndex, err)
+	// 收集子树（包括未缓存的后代）并暂存删除
+	subtree, err := cs.subtreePages(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range subtree {
+		if err := tx.Delete(p.GetIndex()); err != nil {
+			return nil, err
 		}
 	}
 
-	// 从内存删除
-	delete(cs.pages, pageIndex)
-	cs.updatedAt = time.Now()
+	// 清理子树外指向被删除Page的链接并暂存
+	removed := make(map[PageIndex]bool, len(subtree))
+	for _, p := range subtree {
+		removed[p.GetIndex()] = true
+	}
+	cleaned, err := cs.cleanupLinksLocked(removed)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cleaned {
+		if err := tx.Save(c.page); err != nil {
+			rollbackLinkCleanup(cleaned)
+			return nil, err
+		}
+	}
 
-	return nil
+	// 从父节点移除并暂存父节点
+	deletion := &pageDeletion{subtree: subtree, cleaned: cleaned, parentPage: parentPage, childPos: -1}
+	if parentPage != nil {
+		deletion.childPos = indexOfChild(parentPage, pageIndex)
+		parentPage.RemoveChild(pageIndex)
+		if err := tx.Save(parentPage); err != nil {
+			deletion.rollback()
+			return nil, err
+		}
+	}
+	return deletion, nil
 }
 
-// removePageInternal 删除Page的内部实现（递归）
-func (cs *ContextSystem) removePageInternal(pageIndex PageIndex) error {
-	page, exists := cs.pages[pageIndex]
-	if !exists {
-		return nil // 不存在，直接返回
+// rollback 恢复暂存删除时对内存的修改
+func (d *pageDeletion) rollback() {
+	if d.parentPage != nil {
+		insertChildAt(d.parentPage, d.subtree[0].GetIndex(), d.childPos)
 	}
+	rollbackLinkCleanup(d.cleaned)
+}
 
-	// 递归删除子节点
-	if contentsPage, ok := page.(*ContentsPage); ok {
-		for _, childIndex := range contentsPage.GetChildren() {
-			if err := cs.removePageInternal(childIndex); err != nil {
-				return err
-			}
-		}
+// apply 提交成功后从内存删除子树并维护索引（删除前记录修订，保留最后状态）
+func (d *pageDeletion) apply(cs *ContextSystem, actor Actor) {
+	for _, p := range d.subtree {
+		cs.pageChanged(p, actor, RevisionRemove)
+		cs.pages.Remove(p.GetIndex())
+	}
+	for _, c := range d.cleaned {
+		cs.pageChanged(c.page, actor, RevisionUpdate)
 	}
+}
 
-	// 从父节点移除
-	if page.GetParent() != "" {
-		if parent, exists := cs.pages[page.GetParent()]; exists {
-			if parentPage, ok := parent.(*ContentsPage); ok {
-				parentPage.RemoveChild(pageIndex)
+// subtreePages 收集以 pageIndex 为根的完整子树（调用方需持有锁）
+//
+// 优先使用内存中的 Page，不在内存中的从存储加载（不写入缓存），根 Page 位于结果首位。
+func (cs *ContextSystem) subtreePages(pageIndex PageIndex) ([]Page, error) {
+	var result []Page
+	var walk func(index PageIndex) error
+	walk = func(index PageIndex) error {
+		page, exists := cs.pages.Peek(index)
+		if !exists {
+			if cs.storage == nil || !cs.storage.Exists(index) {
+				return fmt.Errorf("page %s not found", index)
+			}
+			loaded, err := cs.loadStoredPage(index)
+			if err != nil {
+				return fmt.Errorf("failed to load page %s: %w", index, err)
+			}
+			page = loaded
+		}
+		result = append(result, page)
+		if contentsPage, ok := page.(*ContentsPage); ok {
+			for _, childIndex := range contentsPage.GetChildren() {
+				if err := walk(childIndex); err != nil {
+					return err
+				}
 			}
 		}
+		return nil
+	}
+	if err := walk(pageIndex); err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	// 从存储删除
-	if cs.storage != nil && cs.storage.Exists(pageIndex) {
-		cs.storage.Delete(pageIndex)
+// indexOfChild 返回子节点在父节点 children 中的位置，不存在返回 -1
+func indexOfChild(parent *ContentsPage, childIndex PageIndex) int {
+	for i, child := range parent.GetChildren() {
+		if child == childIndex {
+			return i
+		}
 	}
+	return -1
+}
 
-	// 从内存删除
-	delete(cs.pages, pageIndex)
-	return nil
+// insertChildAt 将子节点插回指定位置（用于回滚），pos 无效时追加到末尾
+func insertChildAt(parent *ContentsPage, childIndex PageIndex, pos int) {
+	if parent.HasChild(childIndex) {
+		return
+	}
+	if pos < 0 || pos > len(parent.children) {
+		parent.children = append(parent.children, childIndex)
+		return
+	}
+	parent.children = append(parent.children[:pos], append([]PageIndex{childIndex}, parent.children[pos:]...)...)
 }
 
 // ListPages 列出所有Page（内存中）
@@ -465,11 +876,7 @@ func (cs *ContextSystem) ListPages() []Page {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	pages := make([]Page, 0, len(cs.pages))
-	for _, page := range cs.pages {
-		pages = append(pages, page)
-	}
-	return pages
+	return cs.pages.Pages()
 }
 
 // LoadPageFromStorage 从存储加载Page（强制加载）
@@ -482,14 +889,14 @@ func (cs *ContextSystem) LoadPageFromStorage(pageIndex PageIndex) (Page, error)
 		return nil, fmt.Errorf("page %s not found in storage", pageIndex)
 	}
 
-	page, err := cs.storage.Load(pageIndex)
+	page, err := cs.loadStoredPage(pageIndex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load page %s: %w", pageIndex, err)
 	}
 
 	// 更新内存缓存
 	cs.mu.Lock()
-	cs.pages[pageIndex] = page
+	cs.pages.Put(page)
 	cs.mu.Unlock()
 
 	return page, nil
@@ -500,11 +907,10 @@ func (cs *ContextSystem) EvictPage(pageIndex PageIndex) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	if _, exists := cs.pages[pageIndex]; !exists {
+	if !cs.pages.Remove(pageIndex) {
 		return fmt.Errorf("page %s not found in memory", pageIndex)
 	}
 
-	delete(cs.pages, pageIndex)
 	return nil
 }
 
@@ -519,12 +925,13 @@ func (cs *ContextSystem) GenerateIndex(segmentID SegmentID) PageIndex {
 // ============ Page 操作的内部方法（无权限检查） ============
 
 // updatePageInternal 更新Page（内部方法）
-func (cs *ContextSystem) updatePageInternal(pageIndex PageIndex, name, description string) error {
+func (cs *ContextSystem) updatePageInternal(actor Actor, pageIndex PageIndex, name, description string) error {
 	page, err := cs.GetPage(pageIndex)
 	if err != nil {
 		return err
 	}
 
+	oldName, oldDescription := page.GetName(), page.GetDescription()
 	if name != "" {
 		if err := page.SetName(name); err != nil {
 			return err
@@ -536,131 +943,226 @@ func (cs *ContextSystem) updatePageInternal(pageIndex PageIndex, name, descripti
 			return err
 		}
 	}
+	// 固定的Page修改后不能超出固定预算
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.checkPinnedChangeLocked(page); err != nil {
+		page.SetName(oldName)
+		page.SetDescription(oldDescription)
+		return err
+	}
+	page.RecordAccess(AccessEdit, time.Now())
 
-	// 持久化更新
+	// 持久化更新，失败时恢复名称和描述
 	if cs.storage != nil {
-		cs.storage.Save(page)
+		if err := cs.storage.Save(page); err != nil {
+			page.SetName(oldName)
+			page.SetDescription(oldDescription)
+			return fmt.Errorf("failed to save page %s: %w", pageIndex, err)
+		}
 	}
+	cs.pageChanged(page, actor, RevisionUpdate)
 
 	return nil
 }
 
 // expandDetailsInternal 展开详情（内部方法）
-func (cs *ContextSystem) expandDetailsInternal(pageIndex PageIndex) error {
+func (cs *ContextSystem) expandDetailsInternal(actor Actor, pageIndex PageIndex) error {
 	page, err := cs.GetPage(pageIndex)
 	if err != nil {
 		return err
 	}
 
+	oldVisibility := page.GetVisibility()
 	page.SetVisibility(Expanded)
+	page.RecordAccess(AccessExpand, time.Now())
 
-	// 持久化更新
+	// 持久化更新，失败时恢复可见性
 	if cs.storage != nil {
-		cs.storage.Save(page)
+		if err := cs.storage.Save(page); err != nil {
+			page.SetVisibility(oldVisibility)
+			return fmt.Errorf("failed to save page %s: %w", pageIndex, err)
+		}
 	}
+	cs.pageChanged(page, actor, RevisionExpand)
 
 	return nil
 }
 
 // hideDetailsInternal 隐藏详情（内部方法）
-func (cs *ContextSystem) hideDetailsInternal(pageIndex PageIndex) error {
+func (cs *ContextSystem) hideDetailsInternal(actor Actor, pageIndex PageIndex) error {
 	page, err := cs.GetPage(pageIndex)
 	if err != nil {
 		return err
 	}
 
+	oldVisibility := page.GetVisibility()
 	page.SetVisibility(Hidden)
 
-	// 持久化更新
+	// 持久化更新，失败时恢复可见性
 	if cs.storage != nil {
-		cs.storage.Save(page)
+		if err := cs.storage.Save(page); err != nil {
+			page.SetVisibility(oldVisibility)
+			return fmt.Errorf("failed to save page %s: %w", pageIndex, err)
+		}
 	}
+	cs.pageChanged(page, actor, RevisionHide)
 
 	return nil
 }
 
 // movePageInternal 移动Page（内部方法）
-func (cs *ContextSystem) movePageInternal(source, target PageIndex) error {
+//
+// 源页面、原父页面和新父页面在同一事务中提交，提交失败时回滚内存状态。
+func (cs *ContextSystem) movePageInternal(actor Actor, source, target PageIndex) error {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+	sourcePage, rollback, err := cs.stageMove(tx, source, target)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return fmt.Errorf("failed to persist move of %s: %w", source, err)
+	}
+	cs.pageChanged(sourcePage, actor, RevisionMove)
+
+	return nil
+}
+
+// stageMove 修改内存中的父子关系并在事务中暂存相关页面（不提交）
+//
+// 返回源页面和回滚内存状态的函数；出错时内存状态已恢复，由调用方放弃事务。
+func (cs *ContextSystem) stageMove(tx Transaction, source, target PageIndex) (Page, func(), error) {
 	// 1. 获取源Page和目标父Page
 	sourcePage, err := cs.GetPage(source)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	targetParent, err := cs.GetPage(target)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// 2. 检查目标必须是ContentsPage
 	targetPage, ok := targetParent.(*ContentsPage)
 	if !ok {
-		return fmt.Errorf("target %s is not a ContentsPage", target)
+		return nil, nil, fmt.Errorf("target %s is not a ContentsPage", target)
+	}
+
+	// 3. 不能移动到自身或自己的子树下，否则父引用会形成环
+	if cs.isDescendantOf(target, source) {
+		return nil, nil, fmt.Errorf("cannot move page %s under itself or its descendant %s", source, target)
 	}
 
-	// 3. 从原父节点移除
-	if sourcePage.GetParent() != "" {
-		oldParent, err := cs.GetPage(sourcePage.GetParent())
+	var oldParentPage *ContentsPage
+	oldParentIndex := sourcePage.GetParent()
+	if oldParentIndex != "" {
+		oldParent, err := cs.GetPage(oldParentIndex)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		if oldParentPage, ok := oldParent.(*ContentsPage); ok {
-			oldParentPage.RemoveChild(source)
+		oldParentPage, _ = oldParent.(*ContentsPage)
+	}
+
+	// 4. 从原父节点移除
+	oldPos := -1
+	if oldParentPage != nil {
+		oldPos = indexOfChild(oldParentPage, source)
+		oldParentPage.RemoveChild(source)
+	}
+	rollback := func() {
+		targetPage.RemoveChild(source)
+		if oldParentPage != nil {
+			insertChildAt(oldParentPage, source, oldPos)
 		}
+		sourcePage.SetParent(oldParentIndex)
 	}
 
-	// 4. 添加到新父节点
+	// 5. 添加到新父节点
 	if err := targetPage.AddChild(source); err != nil {
-		return err
+		if oldParentPage != nil {
+			insertChildAt(oldParentPage, source, oldPos)
+		}
+		return nil, nil, err
 	}
 
-	// 5. 更新Page的父引用
+	// 6. 更新Page的父引用
 	sourcePage.SetParent(target)
 
-	// 持久化更新
-	if cs.storage != nil {
-		cs.storage.Save(sourcePage)
-		cs.storage.Save(targetParent)
+	// 暂存更新
+	staged := []Page{sourcePage, targetPage}
+	if oldParentPage != nil {
+		staged = append(staged, oldParentPage)
 	}
-
-	return nil
+	for _, page := range staged {
+		if err := tx.Save(page); err != nil {
+			rollback()
+			return nil, nil, err
+		}
+	}
+	return sourcePage, rollback, nil
 }
 
 // createDetailPageInternal 创建DetailPage（内部方法）
-func (cs *ContextSystem) createDetailPageInternal(name, description, detail string, parentIndex PageIndex) (PageIndex, error) {
+//
+// Segment 计数器、新页面和父页面在同一事务中提交。
+func (cs *ContextSystem) createDetailPageInternal(actor Actor, name, description, detail string, parentIndex PageIndex) (PageIndex, error) {
 	// 1. 获取父Page所属Segment（使用内部方法）
 	segment, err := cs.getSegmentByPageIndexInternal(parentIndex)
 	if err != nil {
 		return "", err
 	}
 
-	// 2. 生成新PageIndex（使用Segment的索引生成）
-	newPageIndex := segment.GenerateIndex()
-
-	// 保存更新后的 Segment（因为 nextIndex 已递增）
-	if cs.storage != nil {
-		if err := cs.storage.SaveSegment(segment); err != nil {
-			return "", fmt.Errorf("failed to save segment: %w", err)
-		}
+	// 2. 创建DetailPage
+	page, err := NewDetailPage(name, description, detail, parentIndex)
+	if err != nil {
+		return "", err
 	}
 
-	// 3. 创建DetailPage
-	page, err := NewDetailPage(name, description, detail, parentIndex)
+	tx, err := cs.beginTransaction()
 	if err != nil {
 		return "", err
 	}
+
+	// 3. 生成新PageIndex（使用Segment的索引生成），Segment 因 nextIndex 递增需要保存
+	//    事务失败时恢复计数器，避免内存中的计数器与存储不一致
+	oldCounter := segment.GetIndexCounter()
+	newPageIndex := segment.GenerateIndex()
 	page.SetIndex(newPageIndex)
+	if err := tx.SaveSegment(segment); err != nil {
+		segment.SetIndexCounter(oldCounter)
+		tx.Abort()
+		return "", err
+	}
 
 	// 4. 添加到系统
-	if err := cs.AddPage(page); err != nil {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.addPageTx(page, tx); err != nil {
+		segment.SetIndexCounter(oldCounter)
+		tx.Abort()
 		return "", err
 	}
+	if err := tx.Commit(); err != nil {
+		cs.rollbackAddPage(page)
+		segment.SetIndexCounter(oldCounter)
+		return "", fmt.Errorf("failed to save page %s: %w", newPageIndex, err)
+	}
+	cs.pageChanged(page, actor, RevisionCreate)
 
 	return newPageIndex, nil
 }
 
 // createContentsPageInternal 创建ContentsPage（内部方法）
-func (cs *ContextSystem) createContentsPageInternal(name, description string, parentIndex PageIndex, children ...PageIndex) (PageIndex, error) {
+//
+// Segment 计数器、新页面、父页面、被收纳的子页面及其原父页面在同一事务中提交。
+func (cs *ContextSystem) createContentsPageInternal(actor Actor, name, description string, parentIndex PageIndex, children ...PageIndex) (PageIndex, error) {
 	// 1. 获取父Page所属Segment（使用内部方法）
 	var segment *Segment
 	var err error
@@ -682,64 +1184,120 @@ func (cs *ContextSystem) createContentsPageInternal(name, description string, pa
 		}
 	}
 
-	// 2. 生成新PageIndex（使用Segment的索引生成）
-	newPageIndex := segment.GenerateIndex()
+	// 2. 创建ContentsPage
+	page, err := NewContentsPage(name, description, parentIndex)
+	if err != nil {
+		return "", err
+	}
 
-	// 保存更新后的 Segment（因为 nextIndex 已递增）
-	if cs.storage != nil {
-		if err := cs.storage.SaveSegment(segment); err != nil {
-			return "", fmt.Errorf("failed to save segment: %w", err)
+	// 3. 加载子节点及其原父节点到内存（在加锁和修改任何状态前）
+	childPages := make([]Page, 0, len(children))
+	for _, childIndex := range children {
+		childPage, err := cs.GetPage(childIndex)
+		if err != nil {
+			continue
+		}
+		if oldParentIndex := childPage.GetParent(); oldParentIndex != "" {
+			cs.GetPage(oldParentIndex)
 		}
+		childPages = append(childPages, childPage)
 	}
 
-	// 3. 创建ContentsPage
-	page, err := NewContentsPage(name, description, parentIndex)
+	tx, err := cs.beginTransaction()
 	if err != nil {
 		return "", err
 	}
+
+	// 4. 生成新PageIndex（使用Segment的索引生成），Segment 因 nextIndex 递增需要保存
+	//    事务失败时恢复计数器，避免内存中的计数器与存储不一致
+	oldCounter := segment.GetIndexCounter()
+	newPageIndex := segment.GenerateIndex()
 	page.SetIndex(newPageIndex)
+	if err := tx.SaveSegment(segment); err != nil {
+		segment.SetIndexCounter(oldCounter)
+		tx.Abort()
+		return "", err
+	}
 
-	// 4. 添加子节点
+	// 5. 添加子节点
 	for _, childIndex := range children {
 		if err := page.AddChild(childIndex); err != nil {
+			segment.SetIndexCounter(oldCounter)
+			tx.Abort()
 			return "", err
 		}
 	}
 
-	// 5. 添加到系统
-	if err := cs.AddPage(page); err != nil {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// 6. 添加到系统
+	if err := cs.addPageTx(page, tx); err != nil {
+		segment.SetIndexCounter(oldCounter)
+		tx.Abort()
 		return "", err
 	}
 
-	// 6. 更新子节点的父引用
-	for _, childIndex := range children {
-		childPage, err := cs.GetPage(childIndex)
-		if err != nil {
-			continue
+	// 7. 更新子节点的父引用
+	type childMove struct {
+		child     Page
+		oldParent *ContentsPage
+		oldIndex  PageIndex
+		oldPos    int
+	}
+	moves := make([]childMove, 0, len(childPages))
+	rollback := func() {
+		for i := len(moves) - 1; i >= 0; i-- {
+			m := moves[i]
+			if m.oldParent != nil {
+				insertChildAt(m.oldParent, m.child.GetIndex(), m.oldPos)
+			}
+			m.child.SetParent(m.oldIndex)
 		}
+		cs.rollbackAddPage(page)
+		segment.SetIndexCounter(oldCounter)
+	}
+
+	for _, childPage := range childPages {
+		childIndex := childPage.GetIndex()
+		move := childMove{child: childPage, oldIndex: childPage.GetParent(), oldPos: -1}
 
 		// 从原父节点移除（如果存在）
-		oldParentIndex := childPage.GetParent()
-		if oldParentIndex != "" && oldParentIndex != newPageIndex {
-			oldParent, err := cs.GetPage(oldParentIndex)
-			if err == nil {
+		if move.oldIndex != "" && move.oldIndex != newPageIndex {
+			if oldParent, err := cs.getPageLocked(move.oldIndex); err == nil {
 				if oldParentPage, ok := oldParent.(*ContentsPage); ok {
+					move.oldParent = oldParentPage
+					move.oldPos = indexOfChild(oldParentPage, childIndex)
 					oldParentPage.RemoveChild(childIndex)
-					// 持久化原父节点的更新
-					if cs.storage != nil {
-						cs.storage.Save(oldParent)
-					}
 				}
 			}
 		}
 
 		// 更新子节点的父引用
 		childPage.SetParent(newPageIndex)
+		moves = append(moves, move)
 
-		// 持久化更新
-		if cs.storage != nil {
-			cs.storage.Save(childPage)
+		if move.oldParent != nil {
+			if err := tx.Save(move.oldParent); err != nil {
+				rollback()
+				tx.Abort()
+				return "", err
+			}
 		}
+		if err := tx.Save(childPage); err != nil {
+			rollback()
+			tx.Abort()
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return "", fmt.Errorf("failed to save page %s: %w", newPageIndex, err)
+	}
+	cs.pageChanged(page, actor, RevisionCreate)
+	for _, m := range moves {
+		cs.pageChanged(m.child, actor, RevisionMove)
 	}
 
 	return newPageIndex, nil
@@ -814,24 +1372,143 @@ func (cs *ContextSystem) GetAncestors(pageIndex PageIndex) ([]Page, error) {
 	return ancestors, nil
 }
 
-// FindPage 查找Page（支持名称、描述搜索）
+// FindPage 查找Page（全文搜索，按相关度排序）
 func (cs *ContextSystem) FindPage(query string) []Page {
+	results := cs.Search(query, SearchOptions{})
+	pages := make([]Page, len(results))
+	for i, result := range results {
+		pages[i] = result.Page
+	}
+	return pages
+}
+
+// Search 全文搜索Page
+//
+// 覆盖名称、描述和 detail，按 BM25 分数降序返回。冷归档的 Page 同样可以被搜索到
+// （lifecycle 为 ColdArchived）。
+func (cs *ContextSystem) Search(query string, opts SearchOptions) []SearchResult {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
 
-	results := make([]Page, 0)
-	queryLower := strings.ToLower(query)
+	cs.buildIndexesLocked()
 
-	for _, page := range cs.pages {
-		if strings.Contains(strings.ToLower(page.GetName()), queryLower) ||
-			strings.Contains(strings.ToLower(page.GetDescription()), queryLower) {
-			results = append(results, page)
-		}
+	return cs.resolveHitsLocked(cs.index.Search(query, opts))
+}
+
+// Recall 语义检索与查询最相关的 k 个Page（余弦相似度降序）
+//
+// 向量计算在不持有 ContextSystem 锁的情况下进行，远程 Embedder 不会阻塞页面修改。
+func (cs *ContextSystem) Recall(query string, k int) ([]SearchResult, error) {
+	cs.mu.RLock()
+	cs.buildIndexesLocked()
+	cs.mu.RUnlock()
+
+	hits, err := cs.vectors.Search(query, k)
+	if err != nil {
+		return nil, err
 	}
 
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.resolveHitsLocked(hits), nil
+}
+
+// resolveHitsLocked 将命中的Page索引转换为搜索结果（调用方需持有锁）
+//
+// 已缓存的直接使用，未缓存的临时加载（不放入缓存），无法加载的跳过。
+func (cs *ContextSystem) resolveHitsLocked(hits []scoredIndex) []SearchResult {
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		page, exists := cs.pages.Peek(hit.index)
+		if !exists {
+			if cs.storage == nil {
+				continue
+			}
+			loaded, err := cs.loadStoredPage(hit.index)
+			if err != nil {
+				continue
+			}
+			page = loaded
+		}
+		results = append(results, SearchResult{Page: page, Score: hit.score})
+	}
 	return results
 }
 
+// listAllPagesLocked 列出存储中的全部Page（调用方需持有锁）
+//
+// 已缓存的直接使用，未缓存的临时加载（不放入缓存）。
+func (cs *ContextSystem) listAllPagesLocked() []Page {
+	var pages []Page
+	cs.forEachPageLocked(func(page Page) {
+		pages = append(pages, page)
+	})
+	return pages
+}
+
+// forEachPageLocked 依次访问存储中的全部Page（调用方需持有锁）
+//
+// 已缓存的直接使用，未缓存的逐个临时加载（不放入缓存），遍历过程中不会同时持有全部Page。
+func (cs *ContextSystem) forEachPageLocked(visit func(Page)) {
+	var pageIndices []PageIndex
+	var err error
+	if cs.storage != nil {
+		pageIndices, err = cs.storage.List()
+	}
+	if cs.storage == nil || err != nil {
+		for _, page := range cs.pages.Pages() {
+			visit(page)
+		}
+		return
+	}
+	for _, pageIndex := range pageIndices {
+		page, exists := cs.pages.Peek(pageIndex)
+		if !exists {
+			loaded, err := cs.loadStoredPage(pageIndex)
+			if err != nil {
+				continue
+			}
+			page = loaded
+		}
+		visit(page)
+	}
+}
+
+// indexBuilder 首次使用时从存储构建、此后随 Page 变更增量维护的索引
+type indexBuilder interface {
+	beginBuild() bool
+	buildPage(page Page)
+	endBuild()
+}
+
+// buildIndexes 在 forEach 的一次遍历中构建 indexes 中尚未构建的索引
+func buildIndexes(forEach func(visit func(Page)), indexes ...indexBuilder) {
+	var building []indexBuilder
+	for _, idx := range indexes {
+		if idx.beginBuild() {
+			building = append(building, idx)
+		}
+	}
+	if len(building) == 0 {
+		return
+	}
+	forEach(func(page Page) {
+		for _, idx := range building {
+			idx.buildPage(page)
+		}
+	})
+	for _, idx := range building {
+		idx.endBuild()
+	}
+}
+
+// buildIndexesLocked 构建尚未构建的全文、向量、链接、到期和固定索引（调用方需持有锁）
+//
+// 首次检索、召回、固定检查或到期清扫时触发，所有索引共用一次对存储的流式遍历。
+func (cs *ContextSystem) buildIndexesLocked() {
+	buildIndexes(cs.forEachPageLocked, cs.index, cs.vectors, cs.links, cs.expiries, cs.pinned)
+}
+
 // ============ 持久化恢复方法 ============
 
 // Restore 从存储恢复Segment和Page
@@ -845,10 +1522,19 @@ func (cs *ContextSystem) Restore() (bool, error) {
 	defer cs.mu.Unlock()
 
 	// 1. 恢复 Segments
-	segments, err := cs.storage.ListSegments()
+	stored, err := cs.storage.ListSegments()
 	if err != nil {
 		return false, fmt.Errorf("failed to list segments: %w", err)
 	}
+	// 墓碑只恢复索引计数器
+	var segments []*Segment
+	for _, seg := range stored {
+		if seg.deleted {
+			cs.retired[seg.GetID()] = seg.GetIndexCounter()
+			continue
+		}
+		segments = append(segments, seg)
+	}
 	if len(segments) != 0 {
 		restored = true
 	}
@@ -859,25 +1545,15 @@ func (cs *ContextSystem) Restore() (bool, error) {
 		cs.segmentMap[seg.GetID()] = seg
 	}
 
-	// 2. 恢复 Pages
-	pageIndices, err := cs.storage.List()
-	if err != nil {
-		return false, fmt.Errorf("failed to list pages: %w", err)
-	}
-
-	// 加载所有 Active 状态的 Page 到内存
-	for _, pageIndex := range pageIndices {
-		// 加载 page
-		page, err := cs.storage.Load(pageIndex)
-		if err != nil {
-			return false, fmt.Errorf("failed to load page %s: %w", pageIndex, err)
+	// 2. Page 由 GetPage 按需懒加载，这里只预热各 Segment 的 root Page
+	for _, seg := range segments {
+		rootIndex := seg.GetRootIndex()
+		if rootIndex == "" || !cs.storage.Exists(rootIndex) {
+			continue
+		}
+		if _, err := cs.getPageLocked(rootIndex); err != nil {
+			return false, fmt.Errorf("failed to load root page %s: %w", rootIndex, err)
 		}
-
-		// 只缓存 Active 状态的 Page
-		// if page.GetLifecycle() == Active {
-		cs.pages[pageIndex] = page
-		// }
-		// 非 Active 状态的 Page 按需懒加载
 	}
 
 	cs.updatedAt = time.Now()
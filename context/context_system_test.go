@@ -0,0 +1,1073 @@
+package context
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestSystem 创建带 usr Segment 的文件存储上下文系统
+func newTestSystem(t *testing.T, dir string) (*ContextSystem, PageIndex) {
+	t.Helper()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	cs := NewContextSystemWithStorage(storage)
+
+	seg := NewSegment("usr", "User", "", UserSegment)
+	seg.SetPermission(ReadWrite)
+	rootIndex := seg.GenerateIndex()
+	seg.SetRootIndex(rootIndex)
+	if err := cs.AddSegment(*seg); err != nil {
+		t.Fatalf("Failed to add segment: %v", err)
+	}
+	root, _ := NewContentsPage("User", "", "")
+	root.SetIndex(rootIndex)
+	if err := cs.AddPage(root); err != nil {
+		t.Fatalf("Failed to add root page: %v", err)
+	}
+	return cs, rootIndex
+}
+
+// restoreTestSystem 从目录恢复上下文系统
+func restoreTestSystem(t *testing.T, dir string) *ContextSystem {
+	t.Helper()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	cs := NewContextSystemWithStorage(storage)
+	if _, err := cs.Restore(); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	return cs
+}
+
+// TestContextSystem_CreatePersists 测试创建页面后Segment计数器、页面和父页面均已持久化
+func TestContextSystem_CreatePersists(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	folder, err := cs.createContentsPageInternal(ActorSystem, "Folder", "", rootIndex)
+	if err != nil {
+		t.Fatalf("Failed to create contents page: %v", err)
+	}
+	detail, err := cs.createDetailPageInternal(ActorSystem, "Detail", "", "content", folder)
+	if err != nil {
+		t.Fatalf("Failed to create detail page: %v", err)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	seg, err := restored.GetSegment("usr")
+	if err != nil {
+		t.Fatalf("Failed to get segment: %v", err)
+	}
+	if seg.GetIndexCounter() != 3 {
+		t.Errorf("Expected index counter 3, got %d", seg.GetIndexCounter())
+	}
+	folderPage, err := restored.GetPage(folder)
+	if err != nil {
+		t.Fatalf("Failed to get folder: %v", err)
+	}
+	if !folderPage.(*ContentsPage).HasChild(detail) {
+		t.Errorf("Folder should list %s as child", detail)
+	}
+}
+
+// TestContextSystem_MovePersists 测试移动页面后源、原父和新父均已持久化
+func TestContextSystem_MovePersists(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	a, _ := cs.createContentsPageInternal(ActorSystem, "A", "", rootIndex)
+	b, _ := cs.createContentsPageInternal(ActorSystem, "B", "", rootIndex)
+	detail, _ := cs.createDetailPageInternal(ActorSystem, "Detail", "", "", a)
+
+	if err := cs.movePageInternal(ActorSystem, detail, b); err != nil {
+		t.Fatalf("Failed to move page: %v", err)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	aPage, _ := restored.GetPage(a)
+	bPage, _ := restored.GetPage(b)
+	detailPage, _ := restored.GetPage(detail)
+	if aPage.(*ContentsPage).HasChild(detail) {
+		t.Error("Old parent should no longer list moved page")
+	}
+	if !bPage.(*ContentsPage).HasChild(detail) {
+		t.Error("New parent should list moved page")
+	}
+	if detailPage.GetParent() != b {
+		t.Errorf("Expected parent %s, got %s", b, detailPage.GetParent())
+	}
+}
+
+// TestContextSystem_RemovePersists 测试删除子树后父页面 children 已持久化
+func TestContextSystem_RemovePersists(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	folder, _ := cs.createContentsPageInternal(ActorSystem, "Folder", "", rootIndex)
+	detail, _ := cs.createDetailPageInternal(ActorSystem, "Detail", "", "", folder)
+
+	if err := cs.RemovePage(folder); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	root, _ := restored.GetPage(rootIndex)
+	if root.(*ContentsPage).HasChild(folder) {
+		t.Error("Root should no longer list removed page")
+	}
+	if _, err := restored.GetPage(detail); err == nil {
+		t.Error("Descendant page should be removed from storage")
+	}
+}
+
+// TestContextSystem_PageHistoryAndRevert 测试修订记录与回滚
+func TestContextSystem_PageHistoryAndRevert(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	agent := NewAgentContext(cs)
+
+	detail, err := agent.CreateDetailPage("Draft", "v1", "first", rootIndex)
+	if err != nil {
+		t.Fatalf("Failed to create detail page: %v", err)
+	}
+	if err := agent.UpdatePage(detail, "Final", "v2"); err != nil {
+		t.Fatalf("Failed to update page: %v", err)
+	}
+	// 展开/隐藏只改变可见性，不产生修订
+	agent.ExpandDetails(detail)
+	agent.HideDetails(detail)
+
+	history, err := agent.GetPageHistory(detail)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(history))
+	}
+	if history[0].Operation != RevisionCreate || history[1].Operation != RevisionUpdate {
+		t.Errorf("Unexpected operations: %s, %s", history[0].Operation, history[1].Operation)
+	}
+	if history[1].Actor != ActorAgent || history[1].Revision != 2 {
+		t.Errorf("Unexpected revision metadata: %+v", history[1])
+	}
+
+	if err := agent.RevertPage(detail, 1); err != nil {
+		t.Fatalf("Failed to revert page: %v", err)
+	}
+	page, _ := cs.GetPage(detail)
+	if page.GetName() != "Draft" || page.GetDescription() != "v1" {
+		t.Errorf("Expected reverted name/description, got %s/%s", page.GetName(), page.GetDescription())
+	}
+
+	// 修订历史在恢复后仍可读取，且修订号继续递增
+	restored := restoreTestSystem(t, dir)
+	history, err = restored.GetPageHistory(detail)
+	if err != nil {
+		t.Fatalf("Failed to get restored history: %v", err)
+	}
+	if len(history) != 3 || history[2].Operation != RevisionRevert {
+		t.Fatalf("Expected revert as third revision, got %d revisions", len(history))
+	}
+	if err := restored.updatePageInternal(ActorSystem, detail, "Again", ""); err != nil {
+		t.Fatalf("Failed to update restored page: %v", err)
+	}
+	history, _ = restored.GetPageHistory(detail)
+	if last := history[len(history)-1]; last.Revision != 4 || last.Actor != ActorSystem {
+		t.Errorf("Unexpected last revision: %+v", last)
+	}
+
+	if err := agent.RevertPage(detail, 99); err == nil {
+		t.Error("Expected error for unknown revision")
+	}
+
+	// 提交失败时既不移动也不修改内容
+	folder, _ := cs.createContentsPageInternal(ActorSystem, "Folder", "", rootIndex)
+	cs.movePageInternal(ActorSystem, detail, folder)
+	storage := cs.GetStorage()
+	cs.SetStorage(&failingCommitStorage{Storage: storage})
+	if err := agent.RevertPage(detail, 2); err == nil {
+		t.Fatal("Expected revert to fail when commit fails")
+	}
+	cs.SetStorage(storage)
+	page, _ = cs.GetPage(detail)
+	root, _ := cs.GetPage(rootIndex)
+	parent, _ := cs.GetPage(folder)
+	if page.GetParent() != folder || root.(*ContentsPage).HasChild(detail) || !parent.(*ContentsPage).HasChild(detail) {
+		t.Errorf("Failed revert should not move the page, parent is %s", page.GetParent())
+	}
+	if page.GetName() != "Draft" {
+		t.Errorf("Failed revert should keep the current name, got %s", page.GetName())
+	}
+
+	// 移动和内容修改只通过同一事务写入
+	cs.SetStorage(&failingSaveStorage{Storage: storage})
+	if err := agent.RevertPage(detail, 2); err != nil {
+		t.Fatalf("Failed to revert page: %v", err)
+	}
+	cs.SetStorage(storage)
+	page, _ = cs.GetPage(detail)
+	if page.GetParent() != rootIndex || page.GetName() != "Final" {
+		t.Errorf("Expected page back under root with revision 2 content, got %s under %s", page.GetName(), page.GetParent())
+	}
+}
+
+// TestContextSystem_ArchiveRestore 测试冷归档子树的驱逐、搜索、持久化与恢复
+func TestContextSystem_ArchiveRestore(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	folder, _ := cs.createContentsPageInternal(ActorSystem, "Travel", "trip notes", rootIndex)
+	detail, _ := cs.createDetailPageInternal(ActorSystem, "Kyoto", "temples", "day 1", folder)
+	other, _ := cs.createContentsPageInternal(ActorSystem, "Other", "", rootIndex)
+
+	if err := cs.ArchivePage(rootIndex); err == nil {
+		t.Error("Expected error when archiving segment root")
+	}
+	if err := cs.ArchivePage(folder); err != nil {
+		t.Fatalf("Failed to archive page: %v", err)
+	}
+	if _, err := cs.GetPage(detail); err == nil {
+		t.Error("Archived page should not be accessible")
+	}
+	root, _ := cs.GetPage(rootIndex)
+	if root.(*ContentsPage).HasChild(folder) {
+		t.Error("Root should no longer list archived page")
+	}
+	results := cs.FindPage("kyoto")
+	if len(results) != 1 || results[0].GetLifecycle() != ColdArchived {
+		t.Fatalf("Expected archived page in search results, got %d", len(results))
+	}
+
+	// 归档状态在恢复后保持
+	restored := restoreTestSystem(t, dir)
+	if !restored.IsArchived(detail) {
+		t.Fatal("Archived page should stay archived after restore")
+	}
+
+	// 不能恢复到其他 Segment 的父节点下
+	notesRoot, err := restored.CreateCustomSegment("notes", "Notes", "")
+	if err != nil {
+		t.Fatalf("Failed to create custom segment: %v", err)
+	}
+	if err := restored.RestorePage(detail, notesRoot); err == nil {
+		t.Error("Expected error when restoring under a parent in another segment")
+	}
+
+	// 子节点可单独恢复到指定父节点
+	if err := restored.RestorePage(detail, other); err != nil {
+		t.Fatalf("Failed to restore child page: %v", err)
+	}
+	page, err := restored.GetPage(detail)
+	if err != nil || page.GetParent() != other || page.GetLifecycle() != Active {
+		t.Fatalf("Restored child not attached to chosen parent: %v", err)
+	}
+
+	// 根节点恢复到原父节点，不再包含已单独恢复的子节点
+	if err := restored.RestorePage(folder, ""); err != nil {
+		t.Fatalf("Failed to restore page: %v", err)
+	}
+	root, _ = restored.GetPage(rootIndex)
+	if !root.(*ContentsPage).HasChild(folder) {
+		t.Error("Root should list restored page")
+	}
+	folderPage, _ := restored.GetPage(folder)
+	if folderPage.(*ContentsPage).HasChild(detail) {
+		t.Error("Restored folder should not list separately restored child")
+	}
+	if err := restored.RestorePage(folder, ""); err == nil {
+		t.Error("Expected error when restoring active page")
+	}
+}
+
+// TestContextSystem_LazyLoadWithBoundedCache 测试恢复时按需加载以及缓存容量上限
+func TestContextSystem_LazyLoadWithBoundedCache(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	details := make([]PageIndex, 0, 10)
+	for i := 0; i < 10; i++ {
+		detail, err := cs.createDetailPageInternal(ActorSystem, "Note", "", "", rootIndex)
+		if err != nil {
+			t.Fatalf("Failed to create detail page: %v", err)
+		}
+		details = append(details, detail)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	if n := len(restored.ListPages()); n != 1 {
+		t.Fatalf("Expected only the segment root to be loaded on restore, got %d pages", n)
+	}
+
+	restored.SetPageCacheSize(3)
+	for _, detail := range details {
+		if _, err := restored.GetPage(detail); err != nil {
+			t.Fatalf("Failed to lazily load %s: %v", detail, err)
+		}
+	}
+	if n := len(restored.ListPages()); n != 3 {
+		t.Errorf("Expected cache bounded to 3 pages, got %d", n)
+	}
+
+	// 被淘汰的 Page 仍可被修改和搜索
+	if err := restored.updatePageInternal(ActorSystem, details[0], "First", ""); err != nil {
+		t.Fatalf("Failed to update evicted page: %v", err)
+	}
+	if results := restored.FindPage("first"); len(results) != 1 {
+		t.Errorf("Expected 1 search result, got %d", len(results))
+	}
+	// 删除时父节点即使已被淘汰也会被重新加载并更新
+	if err := restored.RemovePage(details[1]); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+	root, _ := restored.GetPage(rootIndex)
+	if root.(*ContentsPage).HasChild(details[1]) {
+		t.Error("Root should no longer list removed page")
+	}
+}
+
+// TestContextSystem_SearchDetail 测试全文搜索覆盖 detail 并随修改更新
+func TestContextSystem_SearchDetail(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	detail, _ := cs.createDetailPageInternal(ActorSystem, "对话记录", "", "用户喜欢喝乌龙茶", rootIndex)
+	cs.createDetailPageInternal(ActorSystem, "天气", "", "今天下雨", rootIndex)
+
+	results := cs.Search("乌龙茶", SearchOptions{})
+	if len(results) != 1 || results[0].Page.GetIndex() != detail || results[0].Score <= 0 {
+		t.Fatalf("Expected detail match for %s, got %v", detail, results)
+	}
+
+	if err := cs.updatePageInternal(ActorSystem, detail, "饮品偏好", ""); err != nil {
+		t.Fatalf("Failed to update page: %v", err)
+	}
+	if results := cs.FindPage("饮品"); len(results) != 1 {
+		t.Errorf("Expected index to reflect updated name, got %d results", len(results))
+	}
+
+	if err := cs.RemovePage(detail); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+	if results := cs.FindPage("乌龙茶"); len(results) != 0 {
+		t.Errorf("Removed page should not be found, got %d results", len(results))
+	}
+}
+
+// TestContextSystem_Recall 测试语义检索随页面修改同步
+func TestContextSystem_Recall(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	tea, _ := cs.createDetailPageInternal(ActorSystem, "饮品偏好", "", "用户喜欢喝乌龙茶", rootIndex)
+	meeting, _ := cs.createDetailPageInternal(ActorSystem, "日程", "", "明天上午十点开会", rootIndex)
+
+	results, err := cs.Recall("用户爱喝什么茶", 1)
+	if err != nil {
+		t.Fatalf("Failed to recall: %v", err)
+	}
+	if len(results) != 1 || results[0].Page.GetIndex() != tea {
+		t.Fatalf("Expected %s recalled first, got %v", tea, results)
+	}
+
+	// 修改后向量随之更新
+	if err := cs.updatePageInternal(ActorSystem, meeting, "茶会", "周末和用户一起喝茶"); err != nil {
+		t.Fatalf("Failed to update page: %v", err)
+	}
+	cs.RemovePage(tea)
+	results, _ = cs.Recall("用户爱喝什么茶", 5)
+	if len(results) != 1 || results[0].Page.GetIndex() != meeting {
+		t.Errorf("Expected only %s after update and removal, got %v", meeting, results)
+	}
+}
+
+// TestContextSystem_AccessTracking 测试访问记录和重要性随页面持久化
+func TestContextSystem_AccessTracking(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	ac := NewAgentContext(cs)
+
+	index, _ := cs.createDetailPageInternal(ActorSystem, "饮品偏好", "", "用户喜欢喝乌龙茶", rootIndex)
+	if page, _ := cs.GetPage(index); page.GetImportance() != defaultImportance {
+		t.Errorf("Expected default importance %v, got %v", defaultImportance, page.GetImportance())
+	}
+
+	ac.GetPage(index)
+	ac.GetPage(index)
+	ac.ExpandDetails(index)
+	ac.SearchPages("乌龙茶", SearchOptions{})
+	ac.UpdatePage(index, "", "乌龙茶")
+	if err := ac.SetImportance(index, 0.9); err != nil {
+		t.Fatalf("Failed to set importance: %v", err)
+	}
+	if err := ac.SetImportance(index, 1.5); err == nil {
+		t.Error("Expected error for importance out of range")
+	}
+
+	restored := restoreTestSystem(t, dir)
+	page, err := restored.GetPage(index)
+	if err != nil {
+		t.Fatalf("Failed to get page: %v", err)
+	}
+	access := page.GetAccess()
+	if access.ViewCount != 2 || access.ExpandCount != 1 || access.FindCount != 1 || access.EditCount != 1 {
+		t.Errorf("Unexpected access counts: %+v", access)
+	}
+	if access.LastAccessedAt().IsZero() || !access.LastAccessedAt().Equal(access.LastEditedAt) {
+		t.Errorf("Expected last access to be the edit, got %+v", access)
+	}
+	if page.GetImportance() != 0.9 {
+		t.Errorf("Expected importance 0.9, got %v", page.GetImportance())
+	}
+
+	// 修改和展开保存失败时返回错误并恢复原状态
+	storage := cs.GetStorage()
+	cs.SetStorage(&failingSaveStorage{Storage: storage})
+	if err := ac.UpdatePage(index, "Renamed", ""); err == nil {
+		t.Error("Expected update to fail when save fails")
+	}
+	cs.SetStorage(storage)
+	if page, _ := cs.GetPage(index); page.GetName() != "饮品偏好" {
+		t.Errorf("Failed update should keep the name, got %s", page.GetName())
+	}
+	cs.hideDetailsInternal(ActorSystem, index)
+	cs.SetStorage(&failingSaveStorage{Storage: storage})
+	if err := ac.ExpandDetails(index); err == nil {
+		t.Error("Expected expand to fail when save fails")
+	}
+	cs.SetStorage(storage)
+	if page, _ := cs.GetPage(index); page.GetVisibility() != Hidden {
+		t.Errorf("Failed expand should keep the page hidden, got %v", page.GetVisibility())
+	}
+
+	// 只读访问延迟到 FlushAccess 批量写入，写入失败时返回错误并在下次重试
+	ac.GetPage(index)
+	cs.SetStorage(&failingCommitStorage{Storage: storage})
+	if err := cs.FlushAccess(); err == nil {
+		t.Error("Expected flush to fail when commit fails")
+	}
+	cs.SetStorage(storage)
+	if err := cs.FlushAccess(); err != nil {
+		t.Fatalf("Failed to flush access: %v", err)
+	}
+	page, _ = restoreTestSystem(t, dir).GetPage(index)
+	if page.GetAccess().ViewCount != 3 {
+		t.Errorf("Expected flushed view count 3, got %d", page.GetAccess().ViewCount)
+	}
+}
+
+// countingLoadStorage 统计 Load 次数的存储
+type countingLoadStorage struct {
+	Storage
+	loads int
+}
+
+func (s *countingLoadStorage) Load(pageIndex PageIndex) (Page, error) {
+	s.loads++
+	return s.Storage.Load(pageIndex)
+}
+
+// TestContextSystem_IndexesShareOneScan 测试检索、召回、固定预算和到期清扫的索引在同一次遍历中构建
+func TestContextSystem_IndexesShareOneScan(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	for i := 0; i < 5; i++ {
+		cs.createDetailPageInternal(ActorSystem, fmt.Sprintf("Note %d", i), "", "乌龙茶", rootIndex)
+	}
+
+	storage, _ := NewFileStorage(dir)
+	counting := &countingLoadStorage{Storage: storage}
+	restored := NewContextSystemWithStorage(counting)
+	restored.Restore()
+	counting.loads = 0
+
+	// 首次使用时构建全部索引，之后的到期清扫不再遍历存储
+	restored.PinnedTokens()
+	scanned := counting.loads
+	if scanned == 0 {
+		t.Fatal("Expected the first index user to scan storage")
+	}
+	restored.SweepExpired(time.Now())
+	if counting.loads != scanned {
+		t.Errorf("Expected sweeping to reuse the first scan (%d loads), got %d", scanned, counting.loads)
+	}
+
+	// 检索和召回只临时加载命中的未缓存Page
+	results := restored.Search("乌龙茶", SearchOptions{})
+	if len(results) != 5 {
+		t.Errorf("Expected 5 search results, got %d", len(results))
+	}
+	recalled, err := restored.Recall("乌龙茶", 3)
+	if err != nil {
+		t.Fatalf("Failed to recall: %v", err)
+	}
+	if want := scanned + len(results) + len(recalled); counting.loads != want {
+		t.Errorf("Expected %d loads, got %d", want, counting.loads)
+	}
+}
+
+// TestContextSystem_Tags 测试标签的权限检查、持久化、按标签查找和渲染
+func TestContextSystem_Tags(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	ac := NewAgentContext(cs)
+
+	done, _ := cs.createDetailPageInternal(ActorSystem, "Done", "", "", rootIndex)
+	todo, _ := cs.createDetailPageInternal(ActorSystem, "Todo", "", "", rootIndex)
+	if err := ac.SetTag(done, "status", "done"); err != nil {
+		t.Fatalf("Failed to set tag: %v", err)
+	}
+	ac.SetTag(todo, "status", "todo")
+	ac.SetTag(todo, "project", "memci")
+	if err := ac.SetTag(todo, "bad key", "x"); err == nil {
+		t.Error("Expected error for key with whitespace")
+	}
+	if err := ac.RemoveTag(todo, "missing"); err == nil {
+		t.Error("Expected error when removing missing tag")
+	}
+
+	// 只读 Segment 不允许 Agent 修改标签
+	sys := NewSegment("sys", "System", "", SystemSegment)
+	sys.SetPermission(ReadOnly)
+	sysRoot := sys.GenerateIndex()
+	sys.SetRootIndex(sysRoot)
+	cs.AddSegment(*sys)
+	prompt, _ := NewContentsPage("System", "", "")
+	prompt.SetIndex(sysRoot)
+	cs.AddPage(prompt)
+	if err := ac.SetTag(sysRoot, "status", "done"); err == nil {
+		t.Error("Expected permission error on read-only segment")
+	}
+
+	restored := restoreTestSystem(t, dir)
+	if pages := restored.FindByTag("status", "done"); len(pages) != 1 || pages[0].GetIndex() != done {
+		t.Errorf("Expected %s for status=done, got %v", done, pages)
+	}
+	if pages := restored.FindByTag("status", ""); len(pages) != 2 {
+		t.Errorf("Expected 2 pages with status tag, got %d", len(pages))
+	}
+	if err := restored.RemoveTag(todo, "status"); err != nil {
+		t.Fatalf("Failed to remove tag: %v", err)
+	}
+	if pages := NewAgentContext(restored).FindByTag("status", "todo"); len(pages) != 0 {
+		t.Errorf("Removed tag should not match, got %v", pages)
+	}
+
+	restored.expandDetailsInternal(ActorSystem, rootIndex)
+	cw := NewContextWindow(restored)
+	content, _ := cw.renderSegment(mustSegment(t, restored, "usr"))
+	if strings.Contains(content, "{project=memci}") {
+		t.Errorf("Tags should be hidden by default:\n%s", content)
+	}
+	cw.SetRenderOptions(RenderOptions{ShowTags: true})
+	content, _ = cw.renderSegment(mustSegment(t, restored, "usr"))
+	if !strings.Contains(content, "Todo {project=memci}") {
+		t.Errorf("Expected tags in rendering:\n%s", content)
+	}
+}
+
+// mustSegment 获取 Segment，失败时终止测试
+func mustSegment(t *testing.T, cs *ContextSystem, id SegmentID) Segment {
+	t.Helper()
+	seg, err := cs.GetSegment(id)
+	if err != nil {
+		t.Fatalf("Failed to get segment %s: %v", id, err)
+	}
+	return seg
+}
+
+// TestContextSystem_Links 测试跨 Segment 链接、反向链接、持久化、渲染以及删除Page时清理悬空链接
+func TestContextSystem_Links(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	topic := NewSegment("topic", "Topic", "", UserSegment)
+	topic.SetPermission(ReadWrite)
+	topicRoot := topic.GenerateIndex()
+	topic.SetRootIndex(topicRoot)
+	cs.AddSegment(*topic)
+	topicPage, _ := NewContentsPage("Topic", "", "")
+	topicPage.SetIndex(topicRoot)
+	cs.AddPage(topicPage)
+
+	ac := NewAgentContext(cs)
+	hobby, _ := cs.createDetailPageInternal(ActorSystem, "Hobby", "", "climbing", rootIndex)
+	sports, _ := cs.createContentsPageInternal(ActorSystem, "Sports", "", topicRoot)
+	if err := ac.CreateLink(hobby, sports, ""); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := ac.CreateLink(hobby, sports, "related"); err == nil {
+		t.Error("Expected error for duplicate link")
+	}
+	if err := ac.CreateLink(hobby, hobby, "related"); err == nil {
+		t.Error("Expected error for self link")
+	}
+	ac.CreateLink(sports, hobby, "contains")
+
+	restored := restoreTestSystem(t, dir)
+	rac := NewAgentContext(restored)
+	links, pages, err := rac.FollowLinks(hobby, "")
+	if err != nil || len(links) != 1 || links[0].Type != defaultLinkType || pages[0].GetIndex() != sports {
+		t.Fatalf("Unexpected links %v, %v, %v", links, pages, err)
+	}
+	if backlinks, _ := rac.GetBacklinks(sports); len(backlinks) != 1 || backlinks[0].Source != hobby {
+		t.Errorf("Expected backlink from %s, got %v", hobby, backlinks)
+	}
+
+	restored.expandDetailsInternal(ActorSystem, rootIndex)
+	restored.expandDetailsInternal(ActorSystem, hobby)
+	content, _ := NewContextWindow(restored).renderSegment(mustSegment(t, restored, "usr"))
+	if !strings.Contains(content, "Links: related→"+string(sports)) {
+		t.Errorf("Expected links of expanded page in rendering:\n%s", content)
+	}
+
+	// 删除 sports 后 hobby 中指向它的链接被清理
+	if err := restored.removePageInternal(ActorSystem, sports); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+	if links, _ := restored.GetLinks(hobby); len(links) != 0 {
+		t.Errorf("Dangling links should be removed, got %v", links)
+	}
+	if backlinks := restored.GetBacklinks(hobby); len(backlinks) != 0 {
+		t.Errorf("Links of removed page should be dropped, got %v", backlinks)
+	}
+	if page, _ := restoreTestSystem(t, dir).GetPage(hobby); len(page.GetLinks()) != 0 {
+		t.Errorf("Link cleanup should be persisted, got %v", page.GetLinks())
+	}
+
+	// 链接源已冷归档时删除目标仍然成功，归档的源Page保持归档并清理链接
+	source, _ := restored.createDetailPageInternal(ActorSystem, "Source", "", "", rootIndex)
+	target, _ := restored.createDetailPageInternal(ActorSystem, "Target", "", "", rootIndex)
+	if err := NewAgentContext(restored).CreateLink(source, target, ""); err != nil {
+		t.Fatalf("Failed to create link: %v", err)
+	}
+	if err := restored.ArchivePage(source); err != nil {
+		t.Fatalf("Failed to archive page: %v", err)
+	}
+	if err := restored.RemovePage(target); err != nil {
+		t.Fatalf("Failed to remove link target of archived page: %v", err)
+	}
+	archived, err := restored.GetStorage().Load(source)
+	if err != nil || archived.GetLifecycle() != ColdArchived || len(archived.GetLinks()) != 0 {
+		t.Errorf("Archived source should stay archived without dangling links, got %+v (err=%v)", archived, err)
+	}
+	if _, cached := restored.pages.Peek(source); cached {
+		t.Error("Archived source should not be cached by link cleanup")
+	}
+}
+
+// TestContextSystem_Expiry 测试到期动作的执行、持久化、回调以及到期时间解析
+func TestContextSystem_Expiry(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	now := time.Now()
+	past := now.Add(-time.Minute)
+
+	hidden, _ := cs.createDetailPageInternal(ActorSystem, "Hidden", "", "temporary", rootIndex)
+	archived, _ := cs.createDetailPageInternal(ActorSystem, "Archived", "", "old", rootIndex)
+	removed, _ := cs.createDetailPageInternal(ActorSystem, "Removed", "", "scratch", rootIndex)
+	later, _ := cs.createDetailPageInternal(ActorSystem, "Later", "", "keep", rootIndex)
+	cs.expandDetailsInternal(ActorSystem, hidden)
+
+	if err := cs.SetExpiry(rootIndex, past, ExpireRemove); err == nil {
+		t.Error("Expected error for removing segment root on expiry")
+	}
+	cs.SetExpiry(hidden, past, ExpireHide)
+	cs.SetExpiry(archived, past, ExpireArchive)
+	cs.SetExpiry(removed, past, ExpireRemove)
+	cs.SetExpiry(later, now.Add(time.Hour), ExpireRemove)
+
+	var handled []ExpiryTransition
+	cs.SetExpiryHandler(func(transition ExpiryTransition) {
+		handled = append(handled, transition)
+	})
+	transitions := cs.SweepExpired(now)
+	if len(transitions) != 3 || len(handled) != 3 {
+		t.Fatalf("Expected 3 transitions, got %v (handled %d)", transitions, len(handled))
+	}
+	for _, transition := range transitions {
+		if transition.Err != nil {
+			t.Errorf("Unexpected error for %s: %v", transition.Page, transition.Err)
+		}
+	}
+	if len(cs.SweepExpired(now)) != 0 {
+		t.Error("Expired pages should not be swept twice")
+	}
+	if len(cs.ExpiryLog(now)) != 3 {
+		t.Errorf("Expected 3 log entries, got %v", cs.ExpiryLog(now))
+	}
+
+	restored := restoreTestSystem(t, dir)
+	page, err := restored.GetPage(hidden)
+	if err != nil || page.GetVisibility() != Hidden || page.GetExpiry() != nil {
+		t.Errorf("Expected hidden page without expiry, got %v, %v", page, err)
+	}
+	if !restored.IsArchived(archived) {
+		t.Errorf("Expected %s to be archived", archived)
+	}
+	if _, err := restored.GetPage(removed); err == nil {
+		t.Errorf("Expected %s to be removed", removed)
+	}
+	if page, _ := restored.GetPage(later); page.GetExpiry() == nil || page.GetExpiry().Action != ExpireRemove {
+		t.Errorf("Pending expiry should be persisted, got %v", page.GetExpiry())
+	}
+	if got := restored.SweepExpired(now.Add(2 * time.Hour)); len(got) != 1 || got[0].Page != later {
+		t.Errorf("Expected %s to expire after restore, got %v", later, got)
+	}
+
+	at, err := ParseExpiryTime("2d", now)
+	if err != nil || !at.Equal(now.Add(48*time.Hour)) {
+		t.Errorf("Unexpected expiry time %v, %v", at, err)
+	}
+	if _, err := ParseExpiryAction("delete"); err == nil {
+		t.Error("Expected error for unknown expiry action")
+	}
+}
+
+// failingSaveStorage Save 总是失败的存储
+type failingSaveStorage struct {
+	Storage
+}
+
+func (s *failingSaveStorage) Save(page Page) error {
+	return errors.New("disk full")
+}
+
+// failingCommitStorage 事务提交总是失败的存储
+type failingCommitStorage struct {
+	Storage
+}
+
+func (s *failingCommitStorage) Begin() (Transaction, error) {
+	tx, err := s.Storage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &failingCommitTransaction{Transaction: tx}, nil
+}
+
+// failingCommitTransaction Commit 总是失败的事务
+type failingCommitTransaction struct {
+	Transaction
+}
+
+func (tx *failingCommitTransaction) Commit() error {
+	tx.Abort()
+	return errors.New("disk full")
+}
+
+// TestContextSystem_ExpiryFailure 测试到期动作持久化失败时保留到期设置、只记录一次并按退避间隔重试
+func TestContextSystem_ExpiryFailure(t *testing.T) {
+	cs, rootIndex := newTestSystem(t, t.TempDir())
+	now := time.Now()
+	page, _ := cs.createDetailPageInternal(ActorSystem, "Page", "", "temporary", rootIndex)
+	cs.expandDetailsInternal(ActorSystem, page)
+	cs.SetExpiry(page, now.Add(-time.Minute), ExpireHide)
+
+	storage := cs.GetStorage()
+	cs.SetStorage(&failingSaveStorage{Storage: storage})
+	// 修改或取消到期设置失败时保留原设置
+	if err := cs.SetExpiry(page, now.Add(time.Hour), ExpireHide); err == nil {
+		t.Error("Expected set expiry to fail when save fails")
+	}
+	if err := cs.ClearExpiry(page); err == nil {
+		t.Error("Expected clear expiry to fail when save fails")
+	}
+	if got, _ := cs.GetPage(page); got.GetExpiry() == nil || !got.GetExpiry().At.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Failed expiry changes should keep the old expiry, got %v", got.GetExpiry())
+	}
+	transitions := cs.SweepExpired(now)
+	if len(transitions) != 1 || transitions[0].Err == nil {
+		t.Fatalf("Expected a failed transition, got %v", transitions)
+	}
+	got, _ := cs.GetPage(page)
+	if got.GetVisibility() != Expanded || got.GetExpiry() == nil {
+		t.Errorf("Failed hide should keep visibility and expiry, got %v, %v", got.GetVisibility(), got.GetExpiry())
+	}
+	if len(cs.SweepExpired(now)) != 0 {
+		t.Error("Failed expiry should not be retried before the backoff delay")
+	}
+	if len(cs.SweepExpired(now.Add(expiryRetryDelay))) != 0 {
+		t.Error("Repeated failure should not be logged again")
+	}
+	if len(cs.ExpiryLog(now)) != 1 {
+		t.Errorf("Expected 1 log entry, got %v", cs.ExpiryLog(now))
+	}
+
+	cs.SetStorage(storage)
+	if got := cs.SweepExpired(now.Add(time.Hour)); len(got) != 1 || got[0].Err != nil {
+		t.Errorf("Expected retry to succeed, got %v", got)
+	}
+	if got, _ := cs.GetPage(page); got.GetVisibility() != Hidden || got.GetExpiry() != nil {
+		t.Errorf("Expected hidden page without expiry, got %v, %v", got.GetVisibility(), got.GetExpiry())
+	}
+}
+
+// TestContextSystem_CustomSegments 测试自定义 Segment 的创建、数量上限、重命名、排序、持久化和删除
+func TestContextSystem_CustomSegments(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	cs.SetMaxCustomSegments(1)
+	ac := NewAgentContext(cs)
+
+	if _, err := ac.CreateSegment("bad-id", "Bad", ""); err == nil {
+		t.Error("Expected error for segment id containing '-'")
+	}
+	notesRoot, err := ac.CreateSegment("notes", "Notes", "free notes")
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	if _, err := ac.CreateSegment("more", "More", ""); err == nil {
+		t.Error("Expected error when custom segment limit is reached")
+	}
+	note, err := ac.CreateDetailPage("Note", "", "remember this", notesRoot)
+	if err != nil {
+		t.Fatalf("Failed to create page in custom segment: %v", err)
+	}
+	hobby, _ := ac.CreateDetailPage("Hobby", "", "climbing", rootIndex)
+	ac.CreateLink(hobby, note, "")
+
+	// 内置 Segment 即使后添加也排在自定义 Segment 之前
+	tool := NewSegment("tool", "Tools", "", ToolSegment)
+	cs.AddSegment(*tool)
+	var ids []SegmentID
+	segments, _ := cs.ListSegments()
+	for _, seg := range segments {
+		ids = append(ids, seg.GetID())
+	}
+	if len(ids) != 3 || ids[0] != "usr" || ids[1] != "tool" || ids[2] != "notes" {
+		t.Errorf("Unexpected segment order %v", ids)
+	}
+
+	if err := ac.RenameSegment("usr", "Me", ""); err == nil {
+		t.Error("Expected error for renaming a built-in segment")
+	}
+	if err := ac.RenameSegment("notes", "Journal", ""); err != nil {
+		t.Fatalf("Failed to rename segment: %v", err)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	seg, err := restored.GetSegment("notes")
+	if err != nil || seg.GetName() != "Journal" || seg.GetDescription() != "free notes" || seg.GetType() != CustomSegment {
+		t.Fatalf("Unexpected restored segment %v, %v", seg, err)
+	}
+	if root, _ := restored.GetPage(notesRoot); root == nil || root.GetName() != "Journal" {
+		t.Errorf("Root page should be renamed with the segment, got %v", root)
+	}
+
+	restored.SetMaxCustomSegments(1)
+	rac := NewAgentContext(restored)
+	if err := rac.DeleteSegment("usr"); err == nil {
+		t.Error("Expected error for deleting a built-in segment")
+	}
+	if err := rac.DeleteSegment("notes"); err != nil {
+		t.Fatalf("Failed to delete segment: %v", err)
+	}
+	if _, err := restored.GetPage(note); err == nil {
+		t.Errorf("Pages of deleted segment should be removed")
+	}
+	if links, _ := restored.GetLinks(hobby); len(links) != 0 {
+		t.Errorf("Links into deleted segment should be removed, got %v", links)
+	}
+	if _, err := restoreTestSystem(t, dir).GetSegment("notes"); err == nil {
+		t.Error("Deleted segment should not be restored")
+	}
+	if _, err := rac.CreateSegment("more", "More", ""); err != nil {
+		t.Errorf("Expected limit to allow a new segment after deletion, got %v", err)
+	}
+
+	// 同 ID 重建的 Segment 继续旧计数器，新页面不会继承被删除页面的修订历史
+	again := restoreTestSystem(t, dir)
+	again.SetMaxCustomSegments(-1)
+	newRoot, err := again.CreateCustomSegment("notes", "Notes", "")
+	if err != nil {
+		t.Fatalf("Failed to recreate segment: %v", err)
+	}
+	newNote, _ := again.createDetailPageInternal(ActorSystem, "Note", "", "fresh", newRoot)
+	if newRoot == notesRoot || newNote == note {
+		t.Errorf("Recreated segment should not reuse indices, got %s and %s", newRoot, newNote)
+	}
+	if history, _ := again.GetPageHistory(newNote); len(history) != 1 {
+		t.Errorf("Expected only the create revision for %s, got %d", newNote, len(history))
+	}
+}
+
+// TestContextSystem_IntegrityRepair 测试完整性检查发现损坏的页面树，dry-run 不做修改，修复后持久化
+func TestContextSystem_IntegrityRepair(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	a, _ := cs.createContentsPageInternal(ActorSystem, "A", "", rootIndex)
+	b, _ := cs.createContentsPageInternal(ActorSystem, "B", "", a)
+	c, _ := cs.createDetailPageInternal(ActorSystem, "C", "", "", rootIndex)
+	d, _ := cs.createDetailPageInternal(ActorSystem, "D", "", "", rootIndex)
+	if err := cs.movePageInternal(ActorSystem, a, b); err == nil {
+		t.Error("Expected error for moving a page under its own descendant")
+	}
+	if report := cs.Check(); !report.OK() {
+		t.Fatalf("Expected a consistent tree, got %s", report)
+	}
+
+	// 直接写入存储制造损坏：重复子页面、a/b 父引用成环、d 的父页面不存在、计数器回退
+	root, _ := cs.GetPage(rootIndex)
+	rootPage := root.(*ContentsPage)
+	rootPage.children = []PageIndex{c, c}
+	aPage, _ := cs.GetPage(a)
+	aPage.SetParent(b)
+	bPage, _ := cs.GetPage(b)
+	bPage.(*ContentsPage).children = []PageIndex{a}
+	dPage, _ := cs.GetPage(d)
+	dPage.SetParent("usr-999")
+	for _, page := range []Page{rootPage, aPage, bPage, dPage} {
+		cs.storage.Save(page)
+	}
+	seg := cs.segmentMap["usr"]
+	seg.SetIndexCounter(1)
+	cs.storage.SaveSegment(seg)
+
+	broken := restoreTestSystem(t, dir)
+	report := broken.Check()
+	kinds := make(map[IntegrityIssueKind]bool)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind] = true
+	}
+	for _, kind := range []IntegrityIssueKind{IssueDuplicateChild, IssueCycle, IssueOrphan, IssueIndexCounter} {
+		if !kinds[kind] {
+			t.Errorf("Expected a %s issue, got %s", kind, report)
+		}
+	}
+	if report.Unrepairable() != 0 {
+		t.Errorf("Expected all issues to be repairable, got %s", report)
+	}
+
+	preview, err := broken.Repair(true)
+	if err != nil || !preview.DryRun || len(preview.Issues) != len(report.Issues) {
+		t.Fatalf("Unexpected dry run report %v, %v", preview, err)
+	}
+	if again := broken.Check(); len(again.Issues) != len(report.Issues) {
+		t.Errorf("Dry run should not change anything, got %s", again)
+	}
+
+	repaired, err := broken.Repair(false)
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if repaired.Repaired == 0 {
+		t.Errorf("Expected repaired objects, got %s", repaired)
+	}
+	if after := broken.Check(); !after.OK() {
+		t.Errorf("Expected no issues after repair, got %s", after)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	if after := restored.Check(); !after.OK() {
+		t.Errorf("Expected repair to persist, got %s", after)
+	}
+	for _, index := range []PageIndex{a, d} {
+		if page, _ := restored.GetPage(index); page == nil || page.GetParent() != rootIndex {
+			t.Errorf("Expected %s to be attached to the segment root, got %v", index, page)
+		}
+	}
+	if page, _ := restored.GetPage(b); page == nil || page.GetParent() != a {
+		t.Errorf("Expected %s to stay under %s, got %v", b, a, page)
+	}
+	created, err := restored.createDetailPageInternal(ActorSystem, "E", "", "", rootIndex)
+	if err != nil {
+		t.Fatalf("Failed to create page after repair: %v", err)
+	}
+	for _, index := range []PageIndex{rootIndex, a, b, c, d} {
+		if created == index {
+			t.Errorf("New page reused existing index %s", index)
+		}
+	}
+}
+
+// TestContextSystem_RemovalPreviewAndGC 测试删除预览、删除时冷归档，以及回收 Segment 删除后遗留的 Page
+func TestContextSystem_RemovalPreviewAndGC(t *testing.T) {
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+
+	folder, _ := cs.createContentsPageInternal(ActorSystem, "Folder", "", rootIndex)
+	cs.createDetailPageInternal(ActorSystem, "X", "", "some detail", folder)
+	y, _ := cs.createDetailPageInternal(ActorSystem, "Y", "", "more detail", folder)
+	z, _ := cs.createDetailPageInternal(ActorSystem, "Z", "", "", rootIndex)
+	archived, _ := cs.createDetailPageInternal(ActorSystem, "Archived", "", "", rootIndex)
+	cs.PinPage(y)
+	cs.AddLink(z, y, "")
+	cs.ArchivePage(archived)
+
+	preview, err := cs.PreviewRemove(folder)
+	if err != nil {
+		t.Fatalf("Failed to preview removal: %v", err)
+	}
+	if preview.Descendants() != 2 || preview.Tokens == 0 || preview.Archive {
+		t.Errorf("Unexpected preview %+v", preview)
+	}
+	if len(preview.Pinned) != 1 || preview.Pinned[0] != y {
+		t.Errorf("Expected pinned %s in preview, got %v", y, preview.Pinned)
+	}
+	if len(preview.Backlinks) != 1 || preview.Backlinks[0].Source != z {
+		t.Errorf("Expected backlink from %s in preview, got %v", z, preview.Backlinks)
+	}
+
+	// 删除 Segment 元数据后其页面树不可达
+	oldRoot, _ := cs.CreateCustomSegment("old", "Old", "")
+	oldChild, _ := cs.createDetailPageInternal(ActorSystem, "Old child", "", "", oldRoot)
+	cs.AddLink(z, oldChild, "")
+	if err := cs.RemoveSegment("old"); err != nil {
+		t.Fatalf("Failed to remove segment: %v", err)
+	}
+
+	report, err := cs.CollectGarbage(true)
+	if err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+	if len(report.Garbage) != 2 || report.Garbage[0] != oldRoot || report.Garbage[1] != oldChild {
+		t.Fatalf("Expected garbage [%s %s], got %v", oldRoot, oldChild, report.Garbage)
+	}
+	if !cs.storage.Exists(oldChild) {
+		t.Error("Dry run should not delete pages")
+	}
+	if _, err := cs.CollectGarbage(false); err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+
+	restored := restoreTestSystem(t, dir)
+	for _, index := range []PageIndex{oldRoot, oldChild} {
+		if restored.GetStorage().Exists(index) {
+			t.Errorf("Unreachable page %s should be deleted", index)
+		}
+	}
+	if !restored.IsArchived(archived) {
+		t.Error("Archived subtree should not be collected")
+	}
+	if links, _ := restored.GetLinks(z); len(links) != 1 || links[0].Target != y {
+		t.Errorf("Links to collected pages should be removed, got %v", links)
+	}
+
+	// 开启删除时冷归档
+	restored.SetArchiveOnRemove(true)
+	if preview, _ := restored.PreviewRemove(folder); preview == nil || !preview.Archive {
+		t.Errorf("Expected preview to report archiving, got %+v", preview)
+	}
+	if err := restored.RemovePage(folder); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+	if !restored.IsArchived(folder) {
+		t.Error("Removed subtree should be archived")
+	}
+	if err := restored.RestorePage(folder, ""); err != nil {
+		t.Errorf("Failed to restore removed subtree: %v", err)
+	}
+	if err := restored.RemovePage(archived); err != nil {
+		t.Fatalf("Failed to remove archived page: %v", err)
+	}
+	if restored.GetStorage().Exists(archived) {
+		t.Error("Removing an archived page should delete it")
+	}
+}
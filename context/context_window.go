@@ -5,215 +5,536 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"memci/message"
+	"memci/tokenizer"
 )
 
 // ContextWindow 页面树渲染层
 type ContextWindow struct {
-	system *ContextSystem
+	system       *ContextSystem
+	policy       CollapsePolicy
+	renderer     Renderer               // 默认渲染器
+	renderers    map[SegmentID]Renderer // 单独指定渲染器的Segment
+	options      RenderOptions          // 所有渲染器共用的渲染选项
+	tokenizer    tokenizer.Tokenizer
+	tokens       map[PageIndex]pageTokenCount // 每个Page自身渲染片段的token数缓存
+	lastRendered map[SegmentID]string         // 上次 GenerateMessageList 中各Segment的渲染结果
+	lastExportAt time.Time                    // 上次 ExportToFile 的时间
+	mu           sync.RWMutex
+}
+
+// pageTokenCount Page渲染片段的token数缓存项
+//
+// Page 的任何修改都会更新 updatedAt，以此判断缓存是否失效；
+// 标题级别随深度变化，深度或渲染器不同也需要重新计数。
+type pageTokenCount struct {
+	updatedAt time.Time
+	depth     int
+	renderer  string
+	tokens    int
 }
 
 // NewContextWindow 创建新的ContextWindow
 func NewContextWindow(system *ContextSystem) *ContextWindow {
 	return &ContextWindow{
-		system: system,
+		system:    system,
+		policy:    oldestFirstPolicy{},
+		renderer:  markdownRenderer{},
+		renderers: make(map[SegmentID]Renderer),
+		tokenizer: tokenizer.NewHeuristicTokenizer(),
+		tokens:    make(map[PageIndex]pageTokenCount),
+	}
+}
+
+// SetTokenizer 设置估算token使用的分词器并清空token缓存，nil 表示恢复启发式估算
+func (cw *ContextWindow) SetTokenizer(tk tokenizer.Tokenizer) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if tk == nil {
+		tk = tokenizer.NewHeuristicTokenizer()
+	}
+	cw.tokenizer = tk
+	cw.tokens = make(map[PageIndex]pageTokenCount)
+}
+
+// SetCollapsePolicy 设置折叠策略，nil 表示恢复默认（oldest）
+func (cw *ContextWindow) SetCollapsePolicy(policy CollapsePolicy) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if policy == nil {
+		policy = oldestFirstPolicy{}
+	}
+	cw.policy = policy
+}
+
+// CollapsePolicy 获取当前折叠策略
+func (cw *ContextWindow) CollapsePolicy() CollapsePolicy {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+
+	return cw.policy
+}
+
+// SetRenderer 设置默认渲染器，nil 表示恢复默认（markdown）
+func (cw *ContextWindow) SetRenderer(renderer Renderer) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if renderer == nil {
+		renderer = markdownRenderer{}
 	}
+	cw.renderer = renderer
+}
+
+// SetSegmentRenderer 为单个Segment指定渲染器，nil 表示使用默认渲染器
+func (cw *ContextWindow) SetSegmentRenderer(id SegmentID, renderer Renderer) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if renderer == nil {
+		delete(cw.renderers, id)
+		return
+	}
+	cw.renderers[id] = renderer
+}
+
+// SetRenderOptions 设置渲染选项并清空token缓存（选项不同，同一页面的渲染结果不同）
+func (cw *ContextWindow) SetRenderOptions(opts RenderOptions) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	cw.options = opts
+	cw.tokens = make(map[PageIndex]pageTokenCount)
+}
+
+// RenderOptions 获取当前渲染选项
+func (cw *ContextWindow) RenderOptions() RenderOptions {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+
+	return cw.options
+}
+
+// RendererFor 获取Segment使用的渲染器
+func (cw *ContextWindow) RendererFor(id SegmentID) Renderer {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+
+	if renderer, ok := cw.renderers[id]; ok {
+		return renderer
+	}
+	return cw.renderer
 }
 
 // GenerateMessageList 生成发送给模型的MessageList
+//
+// 为提高服务端 prompt 缓存的命中率，开头连续的系统段以及与上次调用相比内容未变化的 Segment
+// 构成稳定前缀，只在前缀的最后一个 Segment 上设置 cache_control 断点（服务端按前缀缓存，
+// 且限制断点数量），其余 Segment 仍为普通字符串。
+// Segment 始终按 ListSegments 的顺序输出（内置 Segment 在前，自定义 Segment 按创建时间在后），
+// 保证相同内容的前缀在每次调用中完全一致。
+//
+// 生成之前先执行已到期Page的到期动作（隐藏、归档或删除），并持久化待写入的访问记录。
 func (cw *ContextWindow) GenerateMessageList() (*message.MessageList, error) {
+	cw.system.SweepExpired(time.Now())
+	// 上一轮工具调用留下的访问记录在这里批量持久化
+	if err := cw.system.FlushAccess(); err != nil {
+		return nil, err
+	}
+	return cw.generateMessageList(true)
+}
+
+// generateMessageList 生成MessageList，markStable 为 false 时不标记缓存也不更新上次渲染的内容（用于导出等非请求场景）
+func (cw *ContextWindow) generateMessageList(markStable bool) (*message.MessageList, error) {
 	// 获取所有Segment
 	segments, err := cw.system.ListSegments()
 	if err != nil {
 		return nil, err
 	}
 
-	// 按顺序遍历每个Segment的root page
-	messageList := message.NewMessageList()
+	cw.mu.RLock()
+	lastRendered := cw.lastRendered
+	cw.mu.RUnlock()
+	rendered := make(map[SegmentID]string, len(segments))
+
+	// 按顺序渲染每个Segment的root page，并找出稳定前缀的末尾
+	type segmentMessage struct {
+		role    message.Role
+		content string
+	}
+	messages := make([]segmentMessage, 0, len(segments))
+	stableEnd := -1 // 稳定前缀最后一个消息的位置
 	for _, segment := range segments {
-		rootIndex := segment.GetRootIndex()
-		if rootIndex == "" {
+		wrappedContent, err := cw.renderSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		if wrappedContent == "" {
 			continue
 		}
+		rendered[segment.GetID()] = wrappedContent
 
-		// 递归渲染从root开始的页面树
-		rootPage, err := cw.system.GetPage(rootIndex)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get root page %s: %w", rootIndex, err)
+		// 为每个Segment创建一个消息节点
+		role := message.User
+		if segment.GetType() == SystemSegment {
+			role = message.System
+		}
+		last, seen := lastRendered[segment.GetID()]
+		stable := segment.GetType() == SystemSegment || (seen && last == wrappedContent)
+		if stable && stableEnd == len(messages)-1 {
+			stableEnd = len(messages)
 		}
+		messages = append(messages, segmentMessage{role: role, content: wrappedContent})
+	}
 
-		content := cw.renderPageRecursive(rootPage, 0)
-		if content != "" {
-			// 在最外层包裹 ```markdown ... ``` 提醒Agent这是markdown格式
-			wrappedContent := fmt.Sprintf("```markdown\n%s\n```", content)
-			// 为每个Segment创建一个消息节点
-			if segment.GetType() == SystemSegment {
-				messageList.Append(message.System, wrappedContent)
-			} else {
-				messageList.Append(message.User, wrappedContent)
-			}
+	messageList := message.NewMessageList()
+	for i, msg := range messages {
+		if markStable && i == stableEnd {
+			messageList.AddMessageContent(msg.role, message.NewContentParts([]message.ContentPart{
+				message.NewCachedTextContentPart(msg.content),
+			}))
+		} else {
+			messageList.Append(msg.role, msg.content)
 		}
 	}
 
+	if markStable {
+		cw.mu.Lock()
+		cw.lastRendered = rendered
+		cw.mu.Unlock()
+	}
 	return messageList, nil
 }
 
+// renderSegment 渲染单个Segment的页面树，没有可渲染内容时返回空字符串
+func (cw *ContextWindow) renderSegment(segment Segment) (string, error) {
+	rootIndex := segment.GetRootIndex()
+	if rootIndex == "" {
+		return "", nil
+	}
+
+	// 递归渲染从root开始的页面树
+	rootPage, err := cw.system.GetPage(rootIndex)
+	if err != nil {
+		return "", fmt.Errorf("failed to get root page %s: %w", rootIndex, err)
+	}
+
+	renderer := cw.RendererFor(segment.GetID())
+	content := cw.renderPageRecursive(renderer, rootPage, 0)
+	if content == "" {
+		return "", nil
+	}
+	return renderer.WrapSegment(segment, content), nil
+}
+
 // renderPageRecursive 递归渲染页面树
-// depth: 当前层级深度，用于markdown标题级别（1表示根层级）
-func (cw *ContextWindow) renderPageRecursive(page Page, depth int) string {
+// depth: 当前层级深度（0表示根层级）
+func (cw *ContextWindow) renderPageRecursive(renderer Renderer, page Page, depth int) string {
 	var builder strings.Builder
+	cw.walkRenderedPages(renderer, page, depth, func(_ Page, _ int, open, _ string) {
+		builder.WriteString(open)
+	}, func(_ Page, close string) {
+		builder.WriteString(close)
+	})
+	return builder.String()
+}
 
-	visibility := page.GetVisibility()
-	lifecycle := page.GetLifecycle()
-
+// walkRenderedPages 按渲染顺序遍历页面树中会被渲染的页面
+//
+// visit 在子页面之前收到每个页面自身的渲染片段（open 和 close），leave 在子页面之后收到 close 片段；
+// 依次拼接 visit 的 open 与 leave 的 close 即为完整的渲染结果。leave 可以为 nil。
+func (cw *ContextWindow) walkRenderedPages(renderer Renderer, page Page, depth int,
+	visit func(page Page, depth int, open, close string), leave func(page Page, close string)) {
 	// 只渲染Active状态的页面
-	if lifecycle != Active {
-		return ""
+	if page.GetLifecycle() != Active {
+		return
 	}
 
-	// 生成markdown标题级别（depth + 1个#）
-	headingLevel := depth + 1
-	heading := strings.Repeat("#", headingLevel)
+	open, close := renderer.RenderPage(page, depth, cw.RenderOptions())
+	visit(page, depth, open, close)
 
-	// 格式：### [索引] 名称: 描述
-	pageIndex := page.GetIndex()
-	pageName := page.GetName()
-	pageDesc := page.GetDescription()
-
-	switch p := page.(type) {
-	case *DetailPage:
-		// DetailPage: ### [索引] 名称: 描述 [标记]
-		builder.WriteString(fmt.Sprintf("%s [%s] %s", heading, pageIndex, pageName))
-		if pageDesc != "" {
-			builder.WriteString(fmt.Sprintf(": %s", pageDesc))
+	// 如果Expanded，递归渲染子节点
+	if contentsPage, ok := page.(*ContentsPage); ok && page.GetVisibility() == Expanded {
+		for _, childIndex := range contentsPage.GetChildren() {
+			childPage, err := cw.system.GetPage(childIndex)
+			if err != nil {
+				// 子页面不存在，跳过
+				continue
+			}
+			cw.walkRenderedPages(renderer, childPage, depth+1, visit, leave)
 		}
+	}
 
-		// 如果Expanded，显示detail内容
-		if visibility == Expanded && p.GetDetail() != "" {
-			// [Hide] 标记在外围，detail 内容用代码块包裹避免内部 markdown 语法冲突
-			builder.WriteString("\n")
-			builder.WriteString(fmt.Sprintf("[Hide]\n~~~\n%s\n~~~\n", p.GetDetail()))
-		} else if visibility == Hidden && p.GetDetail() != "" {
-			// Hidden 状态但有 detail 内容，显示 [Expand] 提示
-			builder.WriteString(" ([Expand]...)")
-		}
-		builder.WriteString("\n")
+	if leave != nil {
+		leave(page, close)
+	}
+}
 
-	case *ContentsPage:
-		// ContentsPage: ### [索引] 名称: 描述 [标记]
-		builder.WriteString(fmt.Sprintf("%s [%s] %s", heading, pageIndex, pageName))
-		if pageDesc != "" {
-			builder.WriteString(fmt.Sprintf(": %s", pageDesc))
+// EstimateTokens 估算当前MessageList的token数量
+//
+// 使用当前分词器逐页计数并累加（见 countPageTokens），与渲染结果整体编码的差异可以忽略。
+// 完整估算后丢弃不在当前渲染结果中的页面（已删除、移走或被折叠隐藏）的token缓存。
+func (cw *ContextWindow) EstimateTokens() (int, error) {
+	segments, err := cw.system.ListSegments()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	rendered := make(map[PageIndex]bool)
+	for _, segment := range segments {
+		tokens, err := cw.estimateSegmentTokens(segment, rendered)
+		if err != nil {
+			return 0, err
 		}
+		total += tokens
+	}
+	cw.pruneTokens(rendered)
+	return total, nil
+}
 
-		// 如果Expanded，递归渲染子节点
-		if visibility == Expanded {
-			builder.WriteString("\n")
-			children := p.GetChildren()
-			if len(children) > 0 {
-				for _, childIndex := range children {
-					childPage, err := cw.system.GetPage(childIndex)
-					if err != nil {
-						// 子页面不存在，跳过
-						continue
-					}
-
-					childContent := cw.renderPageRecursive(childPage, depth+1)
-					if childContent != "" {
-						builder.WriteString(childContent)
-					}
-				}
-			}
-		} else if visibility != Expanded && len(p.GetChildren()) > 0 {
-			// Hidden 状态但有子页面，显示 [Expand] 提示
-			builder.WriteString(fmt.Sprintf(" (%d [Expand]...)", len(p.GetChildren())))
-			builder.WriteString("\n")
-		} else {
-			builder.WriteString("\n")
+// pruneTokens 丢弃 rendered 以外的页面的token缓存
+func (cw *ContextWindow) pruneTokens(rendered map[PageIndex]bool) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	for pageIndex := range cw.tokens {
+		if !rendered[pageIndex] {
+			delete(cw.tokens, pageIndex)
 		}
 	}
+}
 
-	return builder.String()
+// SegmentUsage Segment的token使用情况
+type SegmentUsage struct {
+	ID          SegmentID
+	Name        string
+	Tokens      int // 渲染后的估算token数
+	MaxCapacity int // token预算，0 表示不限
 }
 
-// EstimateTokens 估算当前MessageList的token数量
-// 这是一个简化的估算，实际应用中应该使用更精确的tokenizer
-func (cw *ContextWindow) EstimateTokens() (int, error) {
-	messageList, err := cw.GenerateMessageList()
+// estimateSegmentTokens 估算单个Segment渲染后的token数量（与 renderSegment 的输出对应）
+//
+// rendered 不为 nil 时记录渲染到的页面。
+func (cw *ContextWindow) estimateSegmentTokens(segment Segment, rendered map[PageIndex]bool) (int, error) {
+	rootIndex := segment.GetRootIndex()
+	if rootIndex == "" {
+		return 0, nil
+	}
+	rootPage, err := cw.system.GetPage(rootIndex)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to get root page %s: %w", rootIndex, err)
 	}
 
-	// 简单估算：中文字符约1.5 tokens，英文单词约0.25 token
-	// 这里使用粗略估算：每个字符约0.3 token
-	totalChars := 0
-	nodes := messageList.GetNode()
-	for nodes != nil {
-		totalChars += len(nodes.GetMsg().Content.String())
-		nodes = nodes.Next()
+	renderer := cw.RendererFor(segment.GetID())
+	tokens := cw.countPageTokens(renderer, rootPage, 0, rendered)
+	if tokens == 0 {
+		return 0, nil
 	}
+	// renderSegment 的外层包裹
+	return tokens + cw.currentTokenizer().Count(renderer.WrapSegment(segment, "")), nil
+}
 
-	// 粗略估算：每3个字符约1个token
-	return int(float64(totalChars) / 3.0), nil
+// countPageTokens 统计页面树渲染后的token数量
+//
+// 每个页面自身片段的token数按 updatedAt 缓存，页面被修改后自动重新计数，
+// 未修改的页面无需重复分词。rendered 不为 nil 时记录渲染到的页面。
+func (cw *ContextWindow) countPageTokens(renderer Renderer, page Page, depth int, rendered map[PageIndex]bool) int {
+	total := 0
+	cw.walkRenderedPages(renderer, page, depth, func(p Page, d int, open, close string) {
+		if rendered != nil {
+			rendered[p.GetIndex()] = true
+		}
+		total += cw.fragmentTokens(renderer, p, d, open+close)
+	}, nil)
+	return total
 }
 
-// AutoCollapse 自动折叠以适应token限制
-func (cw *ContextWindow) AutoCollapse(maxTokens int) ([]PageIndex, error) {
-	// 这是一个简化的实现，实际应用中需要更智能的折叠策略
-	// 策略：优先折叠最早的DetailPage
+// fragmentTokens 返回页面自身片段的token数（带缓存）
+func (cw *ContextWindow) fragmentTokens(renderer Renderer, page Page, depth int, fragment string) int {
+	pageIndex := page.GetIndex()
+	updatedAt := page.GetUpdatedAt()
+
+	cw.mu.RLock()
+	cached, exists := cw.tokens[pageIndex]
+	tk := cw.tokenizer
+	cw.mu.RUnlock()
+	if exists && cached.depth == depth && cached.renderer == renderer.Name() && cached.updatedAt.Equal(updatedAt) {
+		return cached.tokens
+	}
 
-	var collapsedPages []PageIndex
-	currentTokens, err := cw.EstimateTokens()
+	tokens := tk.Count(fragment)
+
+	cw.mu.Lock()
+	if cw.tokenizer == tk {
+		cw.tokens[pageIndex] = pageTokenCount{updatedAt: updatedAt, depth: depth, renderer: renderer.Name(), tokens: tokens}
+	}
+	cw.mu.Unlock()
+	return tokens
+}
+
+// currentTokenizer 获取当前分词器
+func (cw *ContextWindow) currentTokenizer() tokenizer.Tokenizer {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+
+	return cw.tokenizer
+}
+
+// SegmentTokenUsage 统计每个Segment的token使用情况（按显示顺序）
+func (cw *ContextWindow) SegmentTokenUsage() ([]SegmentUsage, error) {
+	segments, err := cw.system.ListSegments()
 	if err != nil {
 		return nil, err
 	}
 
-	if currentTokens <= maxTokens {
-		return collapsedPages, nil
+	usages := make([]SegmentUsage, 0, len(segments))
+	for _, segment := range segments {
+		tokens, err := cw.estimateSegmentTokens(segment, nil)
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, SegmentUsage{
+			ID:          segment.GetID(),
+			Name:        segment.GetName(),
+			Tokens:      tokens,
+			MaxCapacity: segment.GetMaxCapacity(),
+		})
 	}
+	return usages, nil
+}
 
-	// 获取所有Segment
+// EnforceSegmentBudgets 将超出自身预算（maxCapacity）的Segment折叠到预算以内
+//
+// 每个Segment独立计算，按折叠策略依次折叠其中的页面，
+// 避免某个Segment（如 interact）挤占其他Segment的空间。系统段不折叠。
+func (cw *ContextWindow) EnforceSegmentBudgets() ([]PageIndex, error) {
 	segments, err := cw.system.ListSegments()
 	if err != nil {
 		return nil, err
 	}
 
-	// 遍历所有页面，优先折叠DetailPage
-	// 跳过 SystemSegment，避免折叠系统提示词导致 agent 行为失控
+	var collapsedPages []PageIndex
 	for _, segment := range segments {
-		// 跳过系统段，系统提示词不应该被折叠
-		if segment.GetType() == SystemSegment {
+		budget := segment.GetMaxCapacity()
+		if segment.GetType() == SystemSegment || budget <= 0 || segment.GetRootIndex() == "" {
 			continue
 		}
 
-		rootIndex := segment.GetRootIndex()
-		if rootIndex == "" {
-			continue
+		segment := segment
+		collapsed, err := cw.collapseWhile([]Segment{segment}, func() (bool, error) {
+			tokens, err := cw.estimateSegmentTokens(segment, nil)
+			return tokens > budget, err
+		})
+		collapsedPages = append(collapsedPages, collapsed...)
+		if err != nil {
+			return collapsedPages, err
 		}
+	}
 
-		pagesToCollapse := cw.findPagesToCollapse(rootIndex)
-		for _, pageIndex := range pagesToCollapse {
-			collapsedPages = append(collapsedPages, pageIndex)
+	return collapsedPages, nil
+}
 
-			// 折叠该页面
-			if err := cw.HideDetails(pageIndex); err != nil {
-				return nil, fmt.Errorf("failed to collapse page %s: %w", pageIndex, err)
-			}
+// AutoCollapse 自动折叠以适应token限制
+func (cw *ContextWindow) AutoCollapse(maxTokens int) ([]PageIndex, error) {
+	// 先将超出各自预算的Segment折叠到预算以内
+	collapsedPages, err := cw.EnforceSegmentBudgets()
+	if err != nil {
+		return nil, err
+	}
 
-			// 重新估算token
-			currentTokens, _ = cw.EstimateTokens()
-			if currentTokens <= maxTokens {
-				return collapsedPages, nil
-			}
+	// 获取所有Segment
+	segments, err := cw.system.ListSegments()
+	if err != nil {
+		return nil, err
+	}
+
+	// 跳过 SystemSegment，避免折叠系统提示词导致 agent 行为失控
+	var collapsible []Segment
+	for _, segment := range segments {
+		if segment.GetType() == SystemSegment || segment.GetRootIndex() == "" {
+			continue
 		}
+		collapsible = append(collapsible, segment)
+	}
+
+	// 所有Segment的候选页面统一按折叠策略排序
+	collapsed, err := cw.collapseWhile(collapsible, func() (bool, error) {
+		currentTokens, err := cw.EstimateTokens()
+		return currentTokens > maxTokens, err
+	})
+	collapsedPages = append(collapsedPages, collapsed...)
+	if err != nil {
+		return nil, err
 	}
 
 	return collapsedPages, nil
 }
 
+// collapseWhile 在 overLimit 返回 true 期间，按折叠策略逐个折叠 segments 下的页面
+//
+// 每折叠一个页面都重新收集候选：子节点全部折叠后，其父 ContentsPage 会成为新的候选。
+func (cw *ContextWindow) collapseWhile(segments []Segment, overLimit func() (bool, error)) ([]PageIndex, error) {
+	var collapsedPages []PageIndex
+	for {
+		over, err := overLimit()
+		if err != nil {
+			return collapsedPages, err
+		}
+		if !over {
+			return collapsedPages, nil
+		}
+
+		var candidates []CollapseCandidate
+		for _, segment := range segments {
+			candidates = append(candidates, cw.collapseCandidates(segment)...)
+		}
+		if len(candidates) == 0 {
+			return collapsedPages, nil
+		}
+
+		pageIndex := cw.CollapsePolicy().Order(candidates)[0].Page.GetIndex()
+		if err := cw.HideDetails(pageIndex); err != nil {
+			return collapsedPages, fmt.Errorf("failed to collapse page %s: %w", pageIndex, err)
+		}
+		collapsedPages = append(collapsedPages, pageIndex)
+	}
+}
+
+// collapseCandidates 收集Segment页面树中可折叠的页面及其排序依据
+func (cw *ContextWindow) collapseCandidates(segment Segment) []CollapseCandidate {
+	renderer := cw.RendererFor(segment.GetID())
+	pageIndices := cw.findPagesToCollapse(segment.GetRootIndex())
+	candidates := make([]CollapseCandidate, 0, len(pageIndices))
+	for _, pageIndex := range pageIndices {
+		page, err := cw.system.GetPage(pageIndex)
+		if err != nil {
+			continue
+		}
+		lastAccessed := page.GetAccess().LastAccessedAt()
+		if lastAccessed.IsZero() {
+			lastAccessed = page.GetCreatedAt()
+		}
+		candidates = append(candidates, CollapseCandidate{
+			Page:         page,
+			Tokens:       cw.countPageTokens(renderer, page, 0, nil),
+			LastAccessed: lastAccessed,
+			Importance:   page.GetImportance(),
+		})
+	}
+	return candidates
+}
+
 // findPagesToCollapse 查找可以折叠的页面（DFS遍历）
+//
+// 已展开的 DetailPage 可以折叠；ContentsPage 在所有子节点都已折叠后才可折叠，
+// 这样折叠顺序总是由叶子向上。Segment 根页面和固定的页面不折叠，
+// 包含固定子页面的 ContentsPage 也不折叠，保证固定的页面始终可见。
 func (cw *ContextWindow) findPagesToCollapse(rootIndex PageIndex) []PageIndex {
 	var pagesToCollapse []PageIndex
 
@@ -225,23 +546,31 @@ func (cw *ContextWindow) findPagesToCollapse(rootIndex PageIndex) []PageIndex {
 		}
 
 		// 只处理Expanded状态的页面
-		if page.GetVisibility() != Expanded {
+		if page.GetLifecycle() != Active || page.GetVisibility() != Expanded {
 			return
 		}
 
 		switch p := page.(type) {
 		case *DetailPage:
-			// DetailPage可以折叠
-			pagesToCollapse = append(pagesToCollapse, pageIndex)
+			// DetailPage可以折叠（固定的除外）
+			if !p.IsPinned() {
+				pagesToCollapse = append(pagesToCollapse, pageIndex)
+			}
 
 		case *ContentsPage:
-			// ContentsPage：先处理子节点，再考虑自己
+			// ContentsPage：先处理子节点，子节点全部折叠后再考虑自己
 			children := p.GetChildren()
+			allHidden := true
 			for _, childIndex := range children {
+				if child, err := cw.system.GetPage(childIndex); err == nil && child.GetLifecycle() == Active &&
+					(child.GetVisibility() == Expanded || child.IsPinned()) {
+					allHidden = false
+				}
 				dfs(childIndex)
 			}
-			// 如果折叠所有子节点后仍超出限制，也可以折叠ContentsPage本身
-			// 但这里简化处理，只折叠DetailPage
+			if allHidden && len(children) > 0 && pageIndex != rootIndex && !p.IsPinned() {
+				pagesToCollapse = append(pagesToCollapse, pageIndex)
+			}
 		}
 	}
 
@@ -249,13 +578,18 @@ func (cw *ContextWindow) findPagesToCollapse(rootIndex PageIndex) []PageIndex {
 	return pagesToCollapse
 }
 
+// PageTokens 使用当前分词器估算Page名称、描述和详情的token数（用于固定预算和删除预览）
+func (cw *ContextWindow) PageTokens(page Page) int {
+	return cw.currentTokenizer().Count(pageText(page))
+}
+
 // HideDetails 隐藏Page详情（代理到ContextSystem内部方法）
 func (cw *ContextWindow) HideDetails(pageIndex PageIndex) error {
-	return cw.system.hideDetailsInternal(pageIndex)
+	return cw.system.hideDetailsInternal(ActorSystem, pageIndex)
 }
 
 // ExportToFile 将当前ContextWindow导出到文件
-// 输出 Agent 实际看到的 MessageList 内容
+// 输出 Agent 实际看到的 MessageList 内容（各Segment使用与发送给模型时相同的渲染器）
 func (cw *ContextWindow) ExportToFile(outputDir string, turn int) (string, error) {
 	// 确保输出目录存在
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
@@ -267,8 +601,8 @@ func (cw *ContextWindow) ExportToFile(outputDir string, turn int) (string, error
 	filename := fmt.Sprintf("context_snapshot_turn_%d_%s.md", turn, timestamp)
 	filepath := filepath.Join(outputDir, filename)
 
-	// 生成 Agent 看到的消息列表
-	msgList, err := cw.GenerateMessageList()
+	// 生成 Agent 看到的消息列表（不影响缓存标记）
+	msgList, err := cw.generateMessageList(false)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate message list: %w", err)
 	}
@@ -293,6 +627,31 @@ func (cw *ContextWindow) ExportToFile(outputDir string, turn int) (string, error
 		builder.WriteString(fmt.Sprintf("---\n**Estimated Tokens**: %d\n", tokens))
 	}
 
+	// 各 Segment 的 Token 使用情况
+	usages, err := cw.SegmentTokenUsage()
+	if err == nil {
+		builder.WriteString("\n| Segment | Tokens | Budget |\n|---|---|---|\n")
+		for _, usage := range usages {
+			budget := "-"
+			if usage.MaxCapacity > 0 {
+				budget = fmt.Sprintf("%d", usage.MaxCapacity)
+			}
+			builder.WriteString(fmt.Sprintf("| %s | %d | %s |\n", usage.ID, usage.Tokens, budget))
+		}
+	}
+
+	// 自上次导出以来的到期处理
+	cw.mu.Lock()
+	since := cw.lastExportAt
+	cw.lastExportAt = time.Now()
+	cw.mu.Unlock()
+	if expired := cw.system.ExpiryLog(since); len(expired) > 0 {
+		builder.WriteString("\n**Expired Pages**\n\n")
+		for _, transition := range expired {
+			builder.WriteString(fmt.Sprintf("- %s\n", transition))
+		}
+	}
+
 	// 写入文件
 	if err := os.WriteFile(filepath, []byte(builder.String()), 0644); err != nil {
 		return "", fmt.Errorf("failed to write snapshot file: %w", err)
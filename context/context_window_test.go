@@ -0,0 +1,421 @@
+package context
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"memci/config"
+)
+
+// TestContextWindow_EnforceSegmentBudgets 测试超出预算的Segment优先折叠最早的页面且不影响其他Segment
+func TestContextWindow_EnforceSegmentBudgets(t *testing.T) {
+	cs, usrRoot := newTestSystem(t, t.TempDir())
+
+	other := NewSegment("teach", "Teach", "", UserSegment)
+	teachRoot := other.GenerateIndex()
+	other.SetRootIndex(teachRoot)
+	cs.AddSegment(*other)
+	root, _ := NewContentsPage("Teach", "", "")
+	root.SetIndex(teachRoot)
+	root.SetVisibility(Expanded)
+	cs.AddPage(root)
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+
+	body := strings.Repeat("x", 300)
+	var usrPages []PageIndex
+	for i := 0; i < 3; i++ {
+		index, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", body, usrRoot)
+		cs.expandDetailsInternal(ActorSystem, index)
+		usrPages = append(usrPages, index)
+	}
+	teachPage, _ := cs.createDetailPageInternal(ActorSystem, "Lesson", "", body, teachRoot)
+	cs.expandDetailsInternal(ActorSystem, teachPage)
+
+	if err := cs.SetSegmentMaxCapacity("usr", 250); err != nil {
+		t.Fatalf("Failed to set budget: %v", err)
+	}
+
+	cw := NewContextWindow(cs)
+	collapsed, err := cw.EnforceSegmentBudgets()
+	if err != nil {
+		t.Fatalf("Failed to enforce budgets: %v", err)
+	}
+	if len(collapsed) == 0 || collapsed[0] != usrPages[0] {
+		t.Fatalf("Expected oldest page %s collapsed first, got %v", usrPages[0], collapsed)
+	}
+	if page, _ := cs.GetPage(usrPages[2]); page.GetVisibility() != Expanded {
+		t.Error("Newest page should stay expanded")
+	}
+	if page, _ := cs.GetPage(teachPage); page.GetVisibility() != Expanded {
+		t.Error("Pages in other segments should not be collapsed")
+	}
+
+	usages, err := cw.SegmentTokenUsage()
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	for _, usage := range usages {
+		if usage.ID == "usr" && (usage.Tokens > 250 || usage.MaxCapacity != 250) {
+			t.Errorf("Unexpected usr usage: %+v", usage)
+		}
+	}
+}
+
+// TestContextWindow_AutoCollapseContentsPage 测试子节点全部折叠后 ContentsPage 也会被折叠
+func TestContextWindow_AutoCollapseContentsPage(t *testing.T) {
+	cs, usrRoot := newTestSystem(t, t.TempDir())
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+
+	var groups []PageIndex
+	for i := 0; i < 2; i++ {
+		group, _ := cs.createContentsPageInternal(ActorSystem, strings.Repeat("Group", 20), strings.Repeat("g", 200), usrRoot)
+		cs.expandDetailsInternal(ActorSystem, group)
+		page, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", strings.Repeat("x", 300), group)
+		cs.expandDetailsInternal(ActorSystem, page)
+		groups = append(groups, group)
+	}
+
+	cw := NewContextWindow(cs)
+	collapsed, err := cw.AutoCollapse(0)
+	if err != nil {
+		t.Fatalf("Failed to auto collapse: %v", err)
+	}
+	for _, group := range groups {
+		if page, _ := cs.GetPage(group); page.GetVisibility() != Hidden {
+			t.Errorf("ContentsPage %s should be collapsed, collapsed=%v", group, collapsed)
+		}
+	}
+	if page, _ := cs.GetPage(usrRoot); page.GetVisibility() != Expanded {
+		t.Error("Segment root should stay expanded")
+	}
+}
+
+// TestContextWindow_AutoCollapsePinned 测试固定的页面及其祖先不会被自动折叠，超出固定预算时拒绝固定、修改和导入
+func TestContextWindow_AutoCollapsePinned(t *testing.T) {
+	dir := t.TempDir()
+	cs, usrRoot := newTestSystem(t, dir)
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+
+	group, _ := cs.createContentsPageInternal(ActorSystem, "Facts", "", usrRoot)
+	cs.expandDetailsInternal(ActorSystem, group)
+	fact, _ := cs.createDetailPageInternal(ActorSystem, "Name", "", strings.Repeat("x", 300), group)
+	cs.expandDetailsInternal(ActorSystem, fact)
+	other, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", strings.Repeat("y", 300), usrRoot)
+	cs.expandDetailsInternal(ActorSystem, other)
+
+	cs.SetPinnedBudget(150, nil)
+	ac := NewAgentContext(cs)
+	if err := ac.PinPage(fact); err != nil {
+		t.Fatalf("Failed to pin page: %v", err)
+	}
+	if err := ac.PinPage(other); err == nil || !strings.Contains(err.Error(), "pinned budget") {
+		t.Errorf("Expected pinned budget error, got %v", err)
+	}
+
+	cw := NewContextWindow(cs)
+	if _, err := cw.AutoCollapse(0); err != nil {
+		t.Fatalf("Failed to auto collapse: %v", err)
+	}
+	for _, index := range []PageIndex{fact, group} {
+		if page, _ := cs.GetPage(index); page.GetVisibility() != Expanded {
+			t.Errorf("Pinned page and its ancestors should stay expanded, %s is %v", index, page.GetVisibility())
+		}
+	}
+	if page, _ := cs.GetPage(other); page.GetVisibility() != Hidden {
+		t.Error("Unpinned page should be collapsed")
+	}
+
+	if page, _ := restoreTestSystem(t, dir).GetPage(fact); !page.IsPinned() {
+		t.Error("Pinned flag should be persisted")
+	}
+	if err := ac.UnpinPage(fact); err != nil {
+		t.Fatalf("Failed to unpin page: %v", err)
+	}
+	if err := ac.PinPage(other); err != nil {
+		t.Errorf("Expected budget to be released after unpin, got %v", err)
+	}
+
+	// 修改和导入固定的Page同样受预算限制
+	if err := ac.UpdatePage(other, "", strings.Repeat("z", 600)); err == nil || !strings.Contains(err.Error(), "pinned budget") {
+		t.Errorf("Expected pinned budget error on update, got %v", err)
+	}
+	if page, _ := cs.GetPage(other); page.GetDescription() != "" {
+		t.Errorf("Rejected update should keep the description, got %q", page.GetDescription())
+	}
+	src, srcRoot := newTestSystem(t, t.TempDir())
+	big, _ := src.createDetailPageInternal(ActorSystem, "Big", "", strings.Repeat("w", 300), srcRoot)
+	src.PinPage(big)
+	var archive bytes.Buffer
+	if err := src.ExportArchive(&archive); err != nil {
+		t.Fatalf("Failed to export archive: %v", err)
+	}
+	if _, err := cs.ImportArchive(&archive, ImportMerge); err == nil || !strings.Contains(err.Error(), "pinned budget") {
+		t.Errorf("Expected pinned budget error on import, got %v", err)
+	}
+	if used, budget := cs.PinnedTokens(); used > budget {
+		t.Errorf("Pinned pages should stay within budget, got %d of %d", used, budget)
+	}
+
+	// 保存失败时恢复固定标记
+	storage := cs.GetStorage()
+	cs.SetStorage(&failingSaveStorage{Storage: storage})
+	if err := ac.UnpinPage(other); err == nil {
+		t.Fatal("Expected unpin to fail when save fails")
+	}
+	cs.SetStorage(storage)
+	if page, _ := cs.GetPage(other); !page.IsPinned() {
+		t.Error("Failed unpin should keep the page pinned")
+	}
+
+	// 并发固定不会共同超出预算
+	ac.UnpinPage(other)
+	candidates := []PageIndex{fact, other}
+	errs := make(chan error, len(candidates))
+	var wg sync.WaitGroup
+	for _, index := range candidates {
+		wg.Add(1)
+		go func(index PageIndex) {
+			defer wg.Done()
+			errs <- ac.PinPage(index)
+		}(index)
+	}
+	wg.Wait()
+	close(errs)
+	pinned := 0
+	for err := range errs {
+		if err == nil {
+			pinned++
+		}
+	}
+	if used, budget := cs.PinnedTokens(); pinned != 1 || used > budget {
+		t.Errorf("Expected exactly one concurrent pin within budget, got %d pins using %d of %d", pinned, used, budget)
+	}
+}
+
+// TestCollapsePolicy_Order 测试内置折叠策略的排序
+func TestCollapsePolicy_Order(t *testing.T) {
+	base := time.Now()
+	newCandidate := func(index PageIndex, age, tokens int, accessed int, importance float64) CollapseCandidate {
+		page, _ := NewDetailPage("Note", "", "", "")
+		page.SetIndex(index)
+		page.createdAt = base.Add(time.Duration(age) * time.Minute)
+		return CollapseCandidate{
+			Page:         page,
+			Tokens:       tokens,
+			LastAccessed: base.Add(time.Duration(accessed) * time.Minute),
+			Importance:   importance,
+		}
+	}
+	candidates := []CollapseCandidate{
+		newCandidate("a", 0, 10, 3, 0.5),
+		newCandidate("b", 1, 30, 1, 0.9),
+		newCandidate("c", 2, 20, 2, 0.1),
+	}
+
+	tests := map[string]string{
+		CollapseOldestFirst:      "abc",
+		CollapseLeastRecent:      "bca",
+		CollapseLargestFirst:     "bca",
+		CollapseLowestImportance: "cab",
+	}
+	for name, expected := range tests {
+		policy, err := NewCollapsePolicy(name)
+		if err != nil {
+			t.Fatalf("Failed to create policy %s: %v", name, err)
+		}
+		var order string
+		for _, candidate := range policy.Order(candidates) {
+			order += string(candidate.Page.GetIndex())
+		}
+		if order != expected {
+			t.Errorf("Policy %s: expected order %s, got %s", name, expected, order)
+		}
+	}
+
+	if _, err := NewCollapsePolicy("random"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+	cfg := &config.ContextConfig{StorageBaseDir: t.TempDir(), CollapsePolicy: "lru_typo"}
+	if _, _, err := NewContextManager(cfg); err == nil {
+		t.Error("Expected NewContextManager to report unknown collapse policy")
+	}
+}
+
+// countingTokenizer 按字符计数并记录调用次数的测试分词器
+type countingTokenizer struct {
+	calls int
+}
+
+func (t *countingTokenizer) Count(text string) int {
+	t.calls++
+	return len([]rune(text))
+}
+
+// TestContextWindow_TokenCache 测试页面token数缓存在页面修改后失效
+func TestContextWindow_TokenCache(t *testing.T) {
+	cs, usrRoot := newTestSystem(t, t.TempDir())
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+	index, _ := cs.createDetailPageInternal(ActorSystem, "笔记", "", "你好", usrRoot)
+	cs.expandDetailsInternal(ActorSystem, index)
+
+	tk := &countingTokenizer{}
+	cw := NewContextWindow(cs)
+	cw.SetTokenizer(tk)
+
+	first, err := cw.EstimateTokens()
+	if err != nil {
+		t.Fatalf("Failed to estimate tokens: %v", err)
+	}
+	messageList, _ := cw.GenerateMessageList()
+	rendered := len([]rune(messageList.GetNode().GetMsg().Content.String()))
+	if first != rendered {
+		t.Errorf("Expected %d tokens for rendered content, got %d", rendered, first)
+	}
+
+	calls := tk.calls
+	if second, _ := cw.EstimateTokens(); second != first {
+		t.Errorf("Expected stable estimate %d, got %d", first, second)
+	}
+	if pageCalls := tk.calls - calls; pageCalls != 1 {
+		t.Errorf("Expected only the segment wrapper to be recounted, got %d calls", pageCalls)
+	}
+
+	page, _ := cs.GetPage(index)
+	page.(*DetailPage).SetDetail("你好世界")
+	if third, _ := cw.EstimateTokens(); third != first+2 {
+		t.Errorf("Expected edited page to be recounted (%d), got %d", first+2, third)
+	}
+
+	// 不再渲染的页面的缓存在下次估算时丢弃
+	if err := cs.RemovePage(index); err != nil {
+		t.Fatalf("Failed to remove page: %v", err)
+	}
+	cw.EstimateTokens()
+	if _, cached := cw.tokens[index]; cached {
+		t.Errorf("Expected token cache of removed page %s to be pruned", index)
+	}
+	if _, cached := cw.tokens[usrRoot]; !cached {
+		t.Errorf("Expected token cache of rendered page %s to be kept", usrRoot)
+	}
+}
+
+// TestContextWindow_CacheStableSegments 测试未变化的Segment渲染为带缓存标记的内容块
+func TestContextWindow_CacheStableSegments(t *testing.T) {
+	cs, usrRoot := newTestSystem(t, t.TempDir())
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+	cw := NewContextWindow(cs)
+
+	isCached := func() bool {
+		t.Helper()
+		messageList, err := cw.GenerateMessageList()
+		if err != nil {
+			t.Fatalf("Failed to generate message list: %v", err)
+		}
+		content := messageList.GetNode().GetMsg().Content
+		return !content.IsString() && len(content.GetParts()) == 1 && content.GetParts()[0].CacheControl != nil
+	}
+
+	if isCached() {
+		t.Error("First render should not be marked as cached")
+	}
+	if !isCached() {
+		t.Error("Unchanged segment should be marked as cached")
+	}
+
+	cs.createDetailPageInternal(ActorSystem, "Note", "", "", usrRoot)
+	if isCached() {
+		t.Error("Changed segment should not be marked as cached")
+	}
+	if !isCached() {
+		t.Error("Segment should be cached again once stable")
+	}
+
+	// 多个 Segment 时只在稳定前缀的最后一个 Segment 上设置断点
+	notesRoot, err := cs.CreateCustomSegment("notes", "Notes", "")
+	if err != nil {
+		t.Fatalf("Failed to create custom segment: %v", err)
+	}
+	cs.expandDetailsInternal(ActorSystem, notesRoot)
+	cachedAt := func() []int {
+		t.Helper()
+		messageList, err := cw.GenerateMessageList()
+		if err != nil {
+			t.Fatalf("Failed to generate message list: %v", err)
+		}
+		var positions []int
+		for i, msg := range messageList.ToSlice() {
+			if !msg.Content.IsString() && msg.Content.GetParts()[0].CacheControl != nil {
+				positions = append(positions, i)
+			}
+		}
+		return positions
+	}
+	if got := cachedAt(); len(got) != 1 || got[0] != 0 {
+		t.Errorf("Expected breakpoint on the unchanged first segment only, got %v", got)
+	}
+	if got := cachedAt(); len(got) != 1 || got[0] != 1 {
+		t.Errorf("Expected a single breakpoint on the last stable segment, got %v", got)
+	}
+	cs.createDetailPageInternal(ActorSystem, "Other", "", "", usrRoot)
+	if got := cachedAt(); len(got) != 0 {
+		t.Errorf("Expected no breakpoint when the first segment changed, got %v", got)
+	}
+}
+
+// TestContextWindow_Renderers 测试各渲染器在 detail 包含结构字符时仍保持结构完整
+func TestContextWindow_Renderers(t *testing.T) {
+	cs, usrRoot := newTestSystem(t, t.TempDir())
+	cs.expandDetailsInternal(ActorSystem, usrRoot)
+	detail := "# 标题\n~~~\n```go\n<page index=\"x\">"
+	index, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", detail, usrRoot)
+	cs.expandDetailsInternal(ActorSystem, index)
+
+	cw := NewContextWindow(cs)
+	render := func() string {
+		t.Helper()
+		messageList, err := cw.GenerateMessageList()
+		if err != nil {
+			t.Fatalf("Failed to generate message list: %v", err)
+		}
+		return messageList.GetNode().GetMsg().Content.String()
+	}
+
+	markdown := render()
+	if !strings.Contains(markdown, "~~~~\n"+detail+"\n~~~~") || !strings.HasPrefix(markdown, "````markdown\n") {
+		t.Errorf("Markdown fences should be longer than fences in detail:\n%s", markdown)
+	}
+
+	renderer, _ := NewRenderer(RenderXML)
+	cw.SetSegmentRenderer("usr", renderer)
+	xmlContent := render()
+	if !strings.HasPrefix(xmlContent, `<segment id="usr"`) || !strings.Contains(xmlContent, "&lt;page index=&quot;x&quot;&gt;</page>") {
+		t.Errorf("Unexpected XML rendering:\n%s", xmlContent)
+	}
+
+	renderer, _ = NewRenderer(RenderJSON)
+	cw.SetRenderer(renderer)
+	cw.SetSegmentRenderer("usr", nil)
+	lines := strings.Split(render(), "\n")
+	if len(lines) != 5 || !strings.Contains(lines[3], `"depth":1`) || !strings.Contains(lines[3], `"detail":"# 标题\n~~~`) {
+		t.Errorf("Unexpected JSON rendering: %q", lines)
+	}
+
+	tokens, _ := cw.EstimateTokens()
+	if tokens == 0 {
+		t.Error("Expected tokens for JSON rendering")
+	}
+	if _, err := NewRenderer("yaml"); err == nil {
+		t.Error("Expected error for unknown renderer")
+	}
+	for _, cfg := range []*config.ContextConfig{
+		{StorageBaseDir: t.TempDir(), Renderer: "yaml"},
+		{StorageBaseDir: t.TempDir(), SegmentRenderers: map[string]string{"usr": "yaml"}},
+	} {
+		if _, _, err := NewContextManager(cfg); err == nil {
+			t.Errorf("Expected NewContextManager to report unknown renderer in %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package context
+
+import (
+	"fmt"
+	"memci/config"
+	"sort"
+	"time"
+)
+
+// defaultMaxCustomSegments 未配置时允许的自定义 Segment 数量上限
+const defaultMaxCustomSegments = 8
+
+// maxSegmentIDLength Segment ID 的最大长度
+const maxSegmentIDLength = 32
+
+// maxCustomSegmentsFromConfig 获取自定义 Segment 数量上限，未配置时使用默认值，负数表示不限
+func maxCustomSegmentsFromConfig(cfg *config.ContextConfig) int {
+	if cfg == nil || cfg.MaxCustomSegments == 0 {
+		return defaultMaxCustomSegments
+	}
+	return cfg.MaxCustomSegments
+}
+
+// validateSegmentID 检查 Segment ID 是否合法
+//
+// 只允许小写字母、数字和下划线：Page 索引的格式为 "{segmentID}-{number}"，
+// ID 中出现 "-" 会使按前缀查找所属 Segment 的结果不唯一。
+func validateSegmentID(id SegmentID) error {
+	if id == "" {
+		return fmt.Errorf("segment id cannot be empty")
+	}
+	if len(id) > maxSegmentIDLength {
+		return fmt.Errorf("segment id must be at most %d bytes", maxSegmentIDLength)
+	}
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return fmt.Errorf("segment id %q may only contain lowercase letters, digits and underscores", id)
+		}
+	}
+	return nil
+}
+
+// sortSegments 排序 Segment：非自定义 Segment 保持添加顺序在前，
+// 自定义 Segment 按创建时间（相同时按 ID）排在其后
+//
+// 新建的自定义 Segment 总是追加在末尾，已有 Segment 的渲染前缀保持不变。
+func sortSegments(segments []Segment) {
+	sort.SliceStable(segments, func(i, j int) bool {
+		a, b := segments[i], segments[j]
+		aCustom, bCustom := a.GetType() == CustomSegment, b.GetType() == CustomSegment
+		if aCustom != bCustom {
+			return bCustom
+		}
+		if !aCustom {
+			return false
+		}
+		if !a.GetCreatedAt().Equal(b.GetCreatedAt()) {
+			return a.GetCreatedAt().Before(b.GetCreatedAt())
+		}
+		return a.GetID() < b.GetID()
+	})
+}
+
+// SetMaxCustomSegments 设置自定义 Segment 数量上限（<0 表示不限）
+func (cs *ContextSystem) SetMaxCustomSegments(max int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.maxCustomSegments = max
+}
+
+// CreateCustomSegment 创建自定义 Segment 及其根 Page（系统级操作），返回根 Page 的索引
+func (cs *ContextSystem) CreateCustomSegment(id SegmentID, name, description string) (PageIndex, error) {
+	return cs.createCustomSegmentInternal(ActorSystem, id, name, description)
+}
+
+// RenameSegment 修改 Segment 及其根 Page 的名称和描述（系统级操作），空值表示不修改
+func (cs *ContextSystem) RenameSegment(id SegmentID, name, description string) error {
+	return cs.renameSegmentInternal(ActorSystem, id, name, description)
+}
+
+// DeleteSegment 删除 Segment 及其下的所有 Page（系统级操作）
+func (cs *ContextSystem) DeleteSegment(id SegmentID) error {
+	return cs.deleteSegmentInternal(ActorSystem, id)
+}
+
+// createCustomSegmentInternal 创建自定义 Segment（内部方法）
+//
+// Segment 和展开的根 ContentsPage 在同一事务中提交，提交失败时回滚内存状态。
+func (cs *ContextSystem) createCustomSegmentInternal(actor Actor, id SegmentID, name, description string) (PageIndex, error) {
+	if err := validateSegmentID(id); err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("segment name cannot be empty")
+	}
+
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return "", err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// 1. 检查 ID 唯一性和数量上限
+	if _, exists := cs.segmentMap[id]; exists {
+		tx.Abort()
+		return "", fmt.Errorf("segment %s already exists", id)
+	}
+	if cs.maxCustomSegments >= 0 {
+		count := 0
+		for _, seg := range cs.segments {
+			if seg.GetType() == CustomSegment {
+				count++
+			}
+		}
+		if count >= cs.maxCustomSegments {
+			tx.Abort()
+			return "", fmt.Errorf("custom segment limit reached (%d)", cs.maxCustomSegments)
+		}
+	}
+
+	// 2. 创建 Segment 并分配根 Page 索引（同 ID 的 Segment 曾被删除时继续其计数）
+	segment := NewSegment(id, name, description, CustomSegment)
+	segment.SetPermission(ReadWrite)
+	segment.SetIndexCounter(cs.retired[id])
+	rootIndex := segment.GenerateIndex()
+	segment.SetRootIndex(rootIndex)
+	cs.segments = append(cs.segments, segment)
+	cs.segmentMap[id] = segment
+	rollbackSegment := func() {
+		cs.segments = cs.segments[:len(cs.segments)-1]
+		delete(cs.segmentMap, id)
+	}
+
+	// 3. 创建根 Page，与 Segment 一起暂存
+	root, err := NewContentsPage(name, description, "")
+	if err != nil {
+		rollbackSegment()
+		tx.Abort()
+		return "", err
+	}
+	root.SetVisibility(Expanded)
+	root.SetIndex(rootIndex)
+	if err := cs.addPageTx(root, tx); err != nil {
+		rollbackSegment()
+		tx.Abort()
+		return "", err
+	}
+	if err := tx.SaveSegment(segment); err != nil {
+		cs.rollbackAddPage(root)
+		rollbackSegment()
+		tx.Abort()
+		return "", err
+	}
+
+	// 4. 提交
+	if err := tx.Commit(); err != nil {
+		cs.rollbackAddPage(root)
+		rollbackSegment()
+		return "", fmt.Errorf("failed to save segment %s: %w", id, err)
+	}
+	cs.pageChanged(root, actor, RevisionCreate)
+	delete(cs.retired, id)
+	cs.updatedAt = time.Now()
+
+	return rootIndex, nil
+}
+
+// renameSegmentInternal 修改 Segment 及其根 Page 的名称和描述（内部方法）
+//
+// Segment 和根 Page 在同一事务中提交，提交失败时回滚内存状态。
+func (cs *ContextSystem) renameSegmentInternal(actor Actor, id SegmentID, name, description string) error {
+	if name == "" && description == "" {
+		return fmt.Errorf("name and description cannot both be empty")
+	}
+
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	segment, exists := cs.segmentMap[id]
+	if !exists {
+		tx.Abort()
+		return fmt.Errorf("segment %s not found", id)
+	}
+	// 根 Page 的名称和描述与 Segment 保持一致
+	var root Page
+	if rootIndex := segment.GetRootIndex(); rootIndex != "" {
+		if root, err = cs.getPageLocked(rootIndex); err != nil {
+			tx.Abort()
+			return err
+		}
+	}
+
+	oldName, oldDescription := segment.GetName(), segment.GetDescription()
+	var oldRootName, oldRootDescription string
+	if root != nil {
+		oldRootName, oldRootDescription = root.GetName(), root.GetDescription()
+	}
+	rollback := func() {
+		segment.name, segment.description = oldName, oldDescription
+		if root != nil {
+			root.SetName(oldRootName)
+			root.SetDescription(oldRootDescription)
+		}
+	}
+
+	if name != "" {
+		segment.SetName(name)
+	}
+	if description != "" {
+		segment.SetDescription(description)
+	}
+	if err := tx.SaveSegment(segment); err != nil {
+		rollback()
+		tx.Abort()
+		return err
+	}
+	if root != nil {
+		if name != "" {
+			root.SetName(name)
+		}
+		if description != "" {
+			root.SetDescription(description)
+		}
+		if root.IsPinned() {
+			if err := cs.checkPinnedBudgetLocked([]PageIndex{root.GetIndex()}, cs.pageCost(root)); err != nil {
+				rollback()
+				tx.Abort()
+				return fmt.Errorf("cannot update pinned page %s: %w", root.GetIndex(), err)
+			}
+		}
+		root.RecordAccess(AccessEdit, time.Now())
+		if err := tx.Save(root); err != nil {
+			rollback()
+			tx.Abort()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return fmt.Errorf("failed to save segment %s: %w", id, err)
+	}
+	if root != nil {
+		cs.pageChanged(root, actor, RevisionUpdate)
+	}
+	cs.updatedAt = time.Now()
+	return nil
+}
+
+// deleteSegmentInternal 删除 Segment 及其根 Page 子树（内部方法）
+//
+// 页面树的删除（同时清理其他 Segment 中指向这些 Page 的链接）和 Segment 墓碑在同一事务中提交。
+func (cs *ContextSystem) deleteSegmentInternal(actor Actor, id SegmentID) error {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	segment, exists := cs.segmentMap[id]
+	if !exists {
+		tx.Abort()
+		return fmt.Errorf("segment %s not found", id)
+	}
+
+	var deletion *pageDeletion
+	if rootIndex := segment.GetRootIndex(); rootIndex != "" {
+		if root, err := cs.getPageLocked(rootIndex); err == nil {
+			if deletion, err = cs.stageDeleteLocked(root, tx); err != nil {
+				tx.Abort()
+				return fmt.Errorf("failed to remove pages of segment %s: %w", id, err)
+			}
+		}
+	}
+	rollbackSegment, err := cs.removeSegmentTx(id, tx)
+	if err != nil {
+		if deletion != nil {
+			deletion.rollback()
+		}
+		tx.Abort()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollbackSegment()
+		if deletion != nil {
+			deletion.rollback()
+		}
+		return fmt.Errorf("failed to delete segment %s: %w", id, err)
+	}
+	if deletion != nil {
+		deletion.apply(cs, actor)
+	}
+	cs.updatedAt = time.Now()
+	return nil
+}
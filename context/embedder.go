@@ -0,0 +1,220 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"memci/config"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// defaultEmbeddingDim 本地哈希嵌入的默认维度
+const defaultEmbeddingDim = 256
+
+// defaultEmbeddingModel OpenAI 兼容接口的默认嵌入模型
+const defaultEmbeddingModel = "text-embedding-v3"
+
+// defaultEmbeddingTimeout OpenAI 兼容接口的默认请求超时
+const defaultEmbeddingTimeout = 30 * time.Second
+
+// Embedder 文本向量化接口
+type Embedder interface {
+	// Embed 批量计算文本向量，返回结果与输入一一对应
+	Embed(texts []string) ([][]float32, error)
+}
+
+// NewEmbedderFromConfig 根据配置创建Embedder
+//
+// openai 类型复用 LLMConfig 的 BaseUrl 和 ApiKey 调用 /embeddings 接口。
+func NewEmbedderFromConfig(cfg *config.Config) (Embedder, error) {
+	switch cfg.Context.Embedder {
+	case "", "hash":
+		return NewHashEmbedder(cfg.Context.EmbeddingDim), nil
+	case "openai":
+		timeout := time.Duration(cfg.Context.EmbeddingTimeout) * time.Second
+		return NewOpenAIEmbedder(cfg.LLM.BaseUrl, cfg.LLM.ApiKey, cfg.Context.EmbeddingModel, timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown embedder: %s", cfg.Context.Embedder)
+	}
+}
+
+// ============ 本地哈希嵌入 ============
+
+// HashEmbedder 基于特征哈希的本地嵌入（确定性，无需网络）
+//
+// 特征为 tokenize 产出的词项（英文单词、中文单字和二元组）以及英文单词的字符三元组，
+// 通过哈希映射到固定维度并带符号累加，最后做 L2 归一化。
+type HashEmbedder struct {
+	dim int
+}
+
+// NewHashEmbedder 创建哈希嵌入，dim <= 0 时使用默认维度
+func NewHashEmbedder(dim int) *HashEmbedder {
+	if dim <= 0 {
+		dim = defaultEmbeddingDim
+	}
+	return &HashEmbedder{dim: dim}
+}
+
+// Embed 批量计算文本向量
+func (e *HashEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+// embed 计算单个文本向量
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dim)
+	addFeature := func(feature string) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		if sum&0x80000000 != 0 {
+			vector[int(sum&0x7fffffff)%e.dim]--
+		} else {
+			vector[int(sum)%e.dim]++
+		}
+	}
+
+	for _, token := range tokenize(text) {
+		addFeature(token)
+		// 英文单词的字符三元组，容忍词形变化
+		runes := []rune(token)
+		if len(runes) > 3 && !isCJK(runes[0]) {
+			padded := append(append([]rune{'#'}, runes...), '#')
+			for i := 0; i+3 <= len(padded); i++ {
+				addFeature(string(padded[i : i+3]))
+			}
+		}
+	}
+
+	normalize(vector)
+	return vector
+}
+
+// ============ OpenAI 兼容嵌入 ============
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /embeddings 接口
+type OpenAIEmbedder struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+// NewOpenAIEmbedder 创建 OpenAI 兼容嵌入，model 为空时使用默认模型，timeout <= 0 时使用默认超时
+//
+// 超时避免无响应的接口阻塞 recall 以及整轮对话。
+func NewOpenAIEmbedder(baseURL, apiKey, model string, timeout time.Duration) *OpenAIEmbedder {
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	if timeout <= 0 {
+		timeout = defaultEmbeddingTimeout
+	}
+	return &OpenAIEmbedder{
+		client:  &http.Client{Timeout: timeout},
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		model:   model,
+	}
+}
+
+// embeddingRequest /embeddings 请求体
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingResponse /embeddings 响应体
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed 批量计算文本向量
+func (e *OpenAIEmbedder) Embed(texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+
+	reqBody, err := json.Marshal(embeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+	req, err := http.NewRequest("POST", e.baseURL+"/embeddings", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result embeddingResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(result.Data))
+	}
+
+	sort.Slice(result.Data, func(i, j int) bool { return result.Data[i].Index < result.Data[j].Index })
+	vectors := make([][]float32, len(texts))
+	for i, item := range result.Data {
+		normalize(item.Embedding)
+		vectors[i] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// ============ 向量工具 ============
+
+// normalize 将向量原地 L2 归一化（零向量保持不变）
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
+
+// dot 计算两个向量的点积（归一化向量的点积即余弦相似度）
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,116 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestHashEmbedder 测试哈希嵌入的确定性与相似度
+func TestHashEmbedder(t *testing.T) {
+	embedder := NewHashEmbedder(128)
+	vectors, err := embedder.Embed([]string{"用户喜欢喝乌龙茶", "用户爱喝茶", "明天上午开会"})
+	if err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+	again, _ := embedder.Embed([]string{"用户喜欢喝乌龙茶"})
+	if dot(vectors[0], again[0]) < 0.999 {
+		t.Error("Embedding should be deterministic")
+	}
+	if dot(vectors[0], vectors[1]) <= dot(vectors[0], vectors[2]) {
+		t.Error("Related texts should be more similar than unrelated ones")
+	}
+}
+
+// TestOpenAIEmbedder 测试 OpenAI 兼容接口的请求与结果顺序
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var req embeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "test-model" || len(req.Input) != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// 乱序返回，客户端应按 index 排序
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,2]},{"index":0,"embedding":[3,0]}]}`))
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder(server.URL, "key", "test-model", 0)
+	vectors, err := embedder.Embed([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+	if vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("Expected ordered normalized vectors, got %v", vectors)
+	}
+}
+
+// TestVectorIndex_PersistentCache 测试向量持久化后重启无需重新嵌入，且启用加密时缓存文件不含明文
+func TestVectorIndex_PersistentCache(t *testing.T) {
+	embedded := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		embedded += len(req.Input)
+		var resp embeddingResponse
+		for i := range req.Input {
+			resp.Data = append(resp.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{Index: i, Embedding: []float32{1, float32(i)}})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	inner, _ := NewFileStorage(dir)
+	encrypted, _ := NewEncryptedStorage(inner, testEncryptionKey(1))
+	cache := newEmbeddingCache(dir, encrypted)
+
+	page, _ := NewDetailPage("Tea", "oolong", "用户喜欢喝乌龙茶", "")
+	page.SetIndex(PageIndex("usr-1"))
+	pages := func(visit func(Page)) { visit(page) }
+	flush := func() *vectorIndex {
+		idx := newVectorIndex(NewOpenAIEmbedder(server.URL, "key", "test-model", 0))
+		idx.SetCache(cache)
+		buildIndexes(pages, idx)
+		if err := idx.flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		return idx
+	}
+
+	flush()
+	if embedded != 1 {
+		t.Fatalf("Expected 1 embedded text, got %d", embedded)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, embeddingCacheFileName))
+	if err != nil {
+		t.Fatalf("Expected embedding cache file: %v", err)
+	}
+	if !isEncrypted(string(data)) || bytes.Contains(data, []byte("oolong")) {
+		t.Error("Embedding cache should be encrypted")
+	}
+
+	// 重启后文本未变的 Page 命中缓存
+	if idx := flush(); embedded != 1 || len(idx.vectors[PageIndex("usr-1")]) != 2 {
+		t.Errorf("Expected cached vector without re-embedding, got %d embedded texts", embedded)
+	}
+
+	// 文本变化后重新嵌入
+	page.SetDetail("用户改喝咖啡")
+	flush()
+	if embedded != 2 {
+		t.Errorf("Expected changed page to be re-embedded, got %d embedded texts", embedded)
+	}
+}
@@ -0,0 +1,110 @@
+package context
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// embeddingCacheFileName 向量缓存文件名（位于 storage_base_dir 下，不以 .json 结尾以免被当作 Page 文件）
+const embeddingCacheFileName = "embeddings.cache"
+
+// embeddingCacheAAD 加密向量缓存时绑定的附加数据
+const embeddingCacheAAD = "embeddings"
+
+// embeddingCipher 向量缓存的加解密实现（EncryptedStorage）
+type embeddingCipher interface {
+	seal(aad string, plaintext []byte) (string, error)
+	open(aad, text string) ([]byte, string, error)
+}
+
+// embeddingCacheFile 向量缓存文件内容
+//
+// 向量以文本的 SHA-256 为键，文本未变化的 Page 重启后无需重新嵌入；
+// Embedder 标识不同时整个缓存失效（不同 Embedder 的向量不可比较）。
+type embeddingCacheFile struct {
+	Embedder string               `json:"embedder"`
+	Vectors  map[string][]float32 `json:"vectors"`
+}
+
+// embeddingCache 持久化的向量缓存（sidecar 文件）
+//
+// 缓存只是优化：读取失败（文件损坏、密钥不匹配）时视为空缓存，写入失败不影响检索。
+type embeddingCache struct {
+	path   string
+	cipher embeddingCipher // 非 nil 时加密写入
+	mu     sync.Mutex
+}
+
+// newEmbeddingCache 创建位于 dir 下的向量缓存，cipher 为 nil 时以明文写入
+func newEmbeddingCache(dir string, cipher embeddingCipher) *embeddingCache {
+	return &embeddingCache{path: filepath.Join(dir, embeddingCacheFileName), cipher: cipher}
+}
+
+// embedderID 返回 Embedder 的标识，未知实现返回空字符串（不缓存）
+func embedderID(embedder Embedder) string {
+	switch e := embedder.(type) {
+	case *HashEmbedder:
+		return fmt.Sprintf("hash:%d", e.dim)
+	case *OpenAIEmbedder:
+		return fmt.Sprintf("openai:%s:%s", e.baseURL, e.model)
+	default:
+		return ""
+	}
+}
+
+// textKey 返回嵌入文本的缓存键
+func textKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// load 读取指定 Embedder 的缓存向量
+func (c *embeddingCache) load(embedder string) map[string][]float32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil
+	}
+	if isEncrypted(string(data)) {
+		if c.cipher == nil {
+			return nil
+		}
+		if data, _, err = c.cipher.open(embeddingCacheAAD, string(data)); err != nil {
+			return nil
+		}
+	}
+	var file embeddingCacheFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Embedder != embedder {
+		return nil
+	}
+	return file.Vectors
+}
+
+// save 用当前全部向量覆盖缓存（已删除或已修改的 Page 的旧向量随之清除）
+func (c *embeddingCache) save(embedder string, vectors map[string][]float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(embeddingCacheFile{Embedder: embedder, Vectors: vectors})
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding cache: %w", err)
+	}
+	if c.cipher != nil {
+		sealed, err := c.cipher.seal(embeddingCacheAAD, data)
+		if err != nil {
+			return err
+		}
+		data = []byte(sealed)
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return fmt.Errorf("failed to write embedding cache: %w", err)
+	}
+	return nil
+}
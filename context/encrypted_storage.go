@@ -0,0 +1,529 @@
+package context
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"memci/config"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// 加密密钥的环境变量，优先于配置文件中的密钥文件
+const (
+	EncryptionKeyEnv     = "MEMCI_ENCRYPTION_KEY"      // 当前密钥（base64 编码的 32 字节）
+	EncryptionOldKeysEnv = "MEMCI_ENCRYPTION_OLD_KEYS" // 轮换前的旧密钥，逗号分隔
+)
+
+// encryptedPrefix 密文的前缀，之后依次为密钥 ID、":" 和 base64 编码的 nonce+密文
+const encryptedPrefix = "memci-enc:v1:"
+
+// encryptedEnvelopeName 加密信封 Page 和 Segment 的名称
+const encryptedEnvelopeName = "encrypted"
+
+// ErrWrongEncryptionKey 数据由未配置的密钥加密（包括未配置任何密钥时读取加密数据）
+var ErrWrongEncryptionKey = errors.New("wrong encryption key")
+
+// isEncrypted 判断文本是否为 EncryptedStorage 写入的密文
+func isEncrypted(text string) bool {
+	return strings.HasPrefix(text, encryptedPrefix)
+}
+
+// ParseEncryptionKey 解析 base64 编码的 32 字节 AES-256 密钥（可用 openssl rand -base64 32 生成）
+func ParseEncryptionKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// encryptionKeysFromConfig 读取加密密钥：环境变量优先，其次是配置的密钥文件；未配置时返回 nil
+func encryptionKeysFromConfig(cfg *config.ContextConfig) ([]byte, [][]byte, error) {
+	encoded := os.Getenv(EncryptionKeyEnv)
+	if encoded == "" && cfg.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(cfg.EncryptionKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, nil, nil
+	}
+	key, err := ParseEncryptionKey(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var encodedOld []string
+	if env := os.Getenv(EncryptionOldKeysEnv); env != "" {
+		encodedOld = strings.Split(env, ",")
+	}
+	for _, path := range cfg.EncryptionOldKeyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read old encryption key file: %w", err)
+		}
+		encodedOld = append(encodedOld, string(data))
+	}
+	oldKeys := make([][]byte, 0, len(encodedOld))
+	for _, encoded := range encodedOld {
+		oldKey, err := ParseEncryptionKey(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid old encryption key: %w", err)
+		}
+		oldKeys = append(oldKeys, oldKey)
+	}
+	return key, oldKeys, nil
+}
+
+// encryptionKey AES-256-GCM 密钥，ID 为密钥 SHA-256 的前 4 字节，用于在密文中标识密钥
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// newEncryptionKey 创建 AES-256-GCM 密钥
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	sum := sha256.Sum256(key)
+	return &encryptionKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// EncryptedStorage 加密存储装饰器，可包装 FileStorage、WALStorage 等任意 Storage
+//
+// Page、Segment 元数据和修订快照以 AES-256-GCM 加密后交给底层存储：Page 存为保留索引的信封 DetailPage
+// （detail 为密文），Segment 只保留 ID，修订只保留索引、修订号等元数据。密文绑定对象类型和索引，
+// 不能被替换到其他 Page 上。写入总是使用当前密钥；读取时按密文中的密钥 ID 选择当前或旧密钥，
+// 未加密的数据按明文读取，便于从未加密的目录迁移，Reencrypt 将其统一改写为当前密钥加密。
+//
+// 未配置密钥时同样使用该装饰器：按明文读写，读到密文时返回 ErrWrongEncryptionKey，
+// 避免新写入的明文记忆与无法解密的旧数据混杂。
+type EncryptedStorage struct {
+	inner   Storage
+	primary *encryptionKey            // nil 表示未配置密钥，不加密
+	keys    map[string]*encryptionKey // 密钥 ID -> 密钥（包括当前密钥和旧密钥）
+	stale   atomic.Bool               // 读取过未加密或由旧密钥加密的对象
+}
+
+// NewEncryptedStorage 创建加密存储，key 为当前密钥，oldKeys 为轮换前的旧密钥（只用于读取）
+//
+// key 为 nil 时不加密，只拒绝读取密文。
+func NewEncryptedStorage(inner Storage, key []byte, oldKeys ...[]byte) (*EncryptedStorage, error) {
+	if key == nil {
+		if len(oldKeys) > 0 {
+			return nil, fmt.Errorf("old encryption keys require a current encryption key")
+		}
+		return &EncryptedStorage{inner: inner, keys: map[string]*encryptionKey{}}, nil
+	}
+	primary, err := newEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &EncryptedStorage{
+		inner:   inner,
+		primary: primary,
+		keys:    map[string]*encryptionKey{primary.id: primary},
+	}
+	for _, oldKey := range oldKeys {
+		k, err := newEncryptionKey(oldKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid old encryption key: %w", err)
+		}
+		if _, exists := s.keys[k.id]; !exists {
+			s.keys[k.id] = k
+		}
+	}
+	return s, nil
+}
+
+// ============ 加解密 ============
+
+// encrypts 是否配置了密钥（写入时加密）
+func (s *EncryptedStorage) encrypts() bool {
+	return s.primary != nil
+}
+
+// NeedsReencrypt 是否读取过未加密或由旧密钥加密的Page或Segment（未配置密钥时总是 false）
+//
+// Reencrypt 最后改写 Segment 元数据，因此恢复时读取的 Segment 足以判断是否需要（继续）改写。
+func (s *EncryptedStorage) NeedsReencrypt() bool {
+	return s.encrypts() && s.stale.Load()
+}
+
+// observe 记录读取到的对象所用的密钥 ID（空字符串表示未加密）
+func (s *EncryptedStorage) observe(keyID string) {
+	if s.encrypts() && keyID != s.primary.id {
+		s.stale.Store(true)
+	}
+}
+
+// seal 使用当前密钥加密数据，aad 将密文绑定到对象类型和索引
+func (s *EncryptedStorage) seal(aad string, plaintext []byte) (string, error) {
+	nonce := make([]byte, s.primary.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := s.primary.aead.Seal(nonce, nonce, plaintext, []byte(aad))
+	return encryptedPrefix + s.primary.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open 解密数据，同时返回加密所用密钥的 ID
+func (s *EncryptedStorage) open(aad, text string) ([]byte, string, error) {
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(text, encryptedPrefix), ":")
+	if !ok {
+		return nil, "", fmt.Errorf("malformed encrypted data for %s", aad)
+	}
+	key, exists := s.keys[keyID]
+	if !exists && !s.encrypts() {
+		return nil, keyID, fmt.Errorf("%w: %s was encrypted with key %s, but no encryption key is configured",
+			ErrWrongEncryptionKey, aad, keyID)
+	}
+	if !exists {
+		return nil, keyID, fmt.Errorf("%w: %s was encrypted with key %s, but the configured key is %s",
+			ErrWrongEncryptionKey, aad, keyID, s.primary.id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return nil, keyID, fmt.Errorf("malformed encrypted data for %s", aad)
+	}
+	nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+	plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return nil, keyID, fmt.Errorf("failed to decrypt %s: data is corrupted or was moved from another page", aad)
+	}
+	return plaintext, keyID, nil
+}
+
+// sealPage 将 Page 加密为信封 DetailPage，未配置密钥时原样返回
+func (s *EncryptedStorage) sealPage(page Page) (Page, error) {
+	if !s.encrypts() {
+		return page, nil
+	}
+	data, err := page.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal page: %w", err)
+	}
+	sealed, err := s.seal("page:"+string(page.GetIndex()), data)
+	if err != nil {
+		return nil, err
+	}
+	envelope, _ := NewDetailPage(encryptedEnvelopeName, "", sealed, "")
+	envelope.SetIndex(page.GetIndex())
+	return envelope, nil
+}
+
+// openPage 解密信封 Page，未加密的 Page 原样返回；keyID 为空表示未加密
+func (s *EncryptedStorage) openPage(page Page) (Page, string, error) {
+	envelope, ok := page.(*DetailPage)
+	if !ok || !isEncrypted(envelope.detail) {
+		s.observe("")
+		return page, "", nil
+	}
+	data, keyID, err := s.open("page:"+string(page.GetIndex()), envelope.detail)
+	if err != nil {
+		return nil, keyID, err
+	}
+	s.observe(keyID)
+	opened, err := unmarshalPage(data)
+	return opened, keyID, err
+}
+
+// sealSegment 将 Segment 元数据加密为只保留 ID 的信封 Segment，未配置密钥时原样返回
+func (s *EncryptedStorage) sealSegment(segment *Segment) (*Segment, error) {
+	if !s.encrypts() {
+		return segment, nil
+	}
+	data, err := segment.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal segment: %w", err)
+	}
+	sealed, err := s.seal("segment:"+string(segment.GetID()), data)
+	if err != nil {
+		return nil, err
+	}
+	return NewSegment(segment.GetID(), encryptedEnvelopeName, sealed, SystemSegment), nil
+}
+
+// openSegment 解密信封 Segment，未加密的 Segment 原样返回；keyID 为空表示未加密
+func (s *EncryptedStorage) openSegment(segment *Segment) (*Segment, string, error) {
+	if !isEncrypted(segment.description) {
+		s.observe("")
+		return segment, "", nil
+	}
+	data, keyID, err := s.open("segment:"+string(segment.GetID()), segment.description)
+	if err != nil {
+		return nil, keyID, err
+	}
+	s.observe(keyID)
+	opened, err := unmarshalSegmentJSON(data)
+	return opened, keyID, err
+}
+
+// sealRevision 加密修订快照（快照存为 JSON 字符串），返回副本
+func (s *EncryptedStorage) sealRevision(rev *PageRevision) (*PageRevision, error) {
+	sealedRev := *rev
+	if len(rev.Snapshot) == 0 || !s.encrypts() {
+		return &sealedRev, nil
+	}
+	sealed, err := s.seal(fmt.Sprintf("revision:%s:%d", rev.Index, rev.Revision), rev.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, err
+	}
+	sealedRev.Snapshot = snapshot
+	return &sealedRev, nil
+}
+
+// openRevision 解密修订快照，未加密的快照原样返回
+func (s *EncryptedStorage) openRevision(rev *PageRevision) (*PageRevision, error) {
+	var sealed string
+	if err := json.Unmarshal(rev.Snapshot, &sealed); err != nil || !isEncrypted(sealed) {
+		return rev, nil
+	}
+	snapshot, _, err := s.open(fmt.Sprintf("revision:%s:%d", rev.Index, rev.Revision), sealed)
+	if err != nil {
+		return nil, err
+	}
+	opened := *rev
+	opened.Snapshot = snapshot
+	return &opened, nil
+}
+
+// ============ Storage 接口实现 ============
+
+// Save 加密并保存Page
+func (s *EncryptedStorage) Save(page Page) error {
+	envelope, err := s.sealPage(page)
+	if err != nil {
+		return err
+	}
+	return s.inner.Save(envelope)
+}
+
+// Load 加载并解密Page
+func (s *EncryptedStorage) Load(pageIndex PageIndex) (Page, error) {
+	page, err := s.inner.Load(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	opened, _, err := s.openPage(page)
+	return opened, err
+}
+
+// Delete 删除Page
+func (s *EncryptedStorage) Delete(pageIndex PageIndex) error {
+	return s.inner.Delete(pageIndex)
+}
+
+// Exists 检查Page是否存在
+func (s *EncryptedStorage) Exists(pageIndex PageIndex) bool {
+	return s.inner.Exists(pageIndex)
+}
+
+// List 列出所有Page索引（索引不加密）
+func (s *EncryptedStorage) List() ([]PageIndex, error) {
+	return s.inner.List()
+}
+
+// SaveSegment 加密并保存Segment元数据
+func (s *EncryptedStorage) SaveSegment(segment *Segment) error {
+	envelope, err := s.sealSegment(segment)
+	if err != nil {
+		return err
+	}
+	return s.inner.SaveSegment(envelope)
+}
+
+// LoadSegment 加载并解密Segment元数据
+func (s *EncryptedStorage) LoadSegment(id SegmentID) (*Segment, error) {
+	segment, err := s.inner.LoadSegment(id)
+	if err != nil {
+		return nil, err
+	}
+	opened, _, err := s.openSegment(segment)
+	return opened, err
+}
+
+// ListSegments 列出并解密所有Segment
+func (s *EncryptedStorage) ListSegments() ([]*Segment, error) {
+	segments, err := s.inner.ListSegments()
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*Segment, 0, len(segments))
+	for _, segment := range segments {
+		seg, _, err := s.openSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, seg)
+	}
+	return opened, nil
+}
+
+// DeleteSegment 删除Segment元数据
+func (s *EncryptedStorage) DeleteSegment(id SegmentID) error {
+	return s.inner.DeleteSegment(id)
+}
+
+// Begin 开始事务，暂存的Page和Segment在提交前加密
+func (s *EncryptedStorage) Begin() (Transaction, error) {
+	tx, err := s.inner.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedTransaction{storage: s, inner: tx}, nil
+}
+
+// AppendRevision 加密快照并追加修订记录
+func (s *EncryptedStorage) AppendRevision(rev *PageRevision) error {
+	sealed, err := s.sealRevision(rev)
+	if err != nil {
+		return err
+	}
+	return s.inner.AppendRevision(sealed)
+}
+
+// ListRevisions 列出并解密修订记录
+func (s *EncryptedStorage) ListRevisions(pageIndex PageIndex) ([]*PageRevision, error) {
+	revisions, err := s.inner.ListRevisions(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*PageRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		openedRev, err := s.openRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, openedRev)
+	}
+	return opened, nil
+}
+
+// ============ 密钥轮换 ============
+
+// Reencrypt 将未加密或由旧密钥加密的Page和Segment改写为当前密钥加密，返回改写的对象数
+//
+// 用于开启加密后迁移已有目录和密钥轮换，已由当前密钥加密的对象保持不变，中断后可以重新执行。
+// Segment 元数据在全部 Page 之后改写，中断时总有 Segment 仍未改写，下次恢复时 NeedsReencrypt 可以发现。
+// 修订历史只能追加，不会被改写：读取旧密钥写入的历史仍需保留旧密钥。
+func (s *EncryptedStorage) Reencrypt() (int, error) {
+	if !s.encrypts() {
+		return 0, fmt.Errorf("no encryption key configured")
+	}
+	count := 0
+
+	pageIndices, err := s.inner.List()
+	if err != nil {
+		return count, fmt.Errorf("failed to list pages: %w", err)
+	}
+	for _, pageIndex := range pageIndices {
+		envelope, err := s.inner.Load(pageIndex)
+		if err != nil {
+			return count, fmt.Errorf("failed to load page %s: %w", pageIndex, err)
+		}
+		page, keyID, err := s.openPage(envelope)
+		if err != nil {
+			return count, err
+		}
+		if keyID == s.primary.id {
+			continue
+		}
+		if err := s.Save(page); err != nil {
+			return count, fmt.Errorf("failed to re-encrypt page %s: %w", pageIndex, err)
+		}
+		count++
+	}
+
+	segments, err := s.inner.ListSegments()
+	if err != nil {
+		return count, fmt.Errorf("failed to list segments: %w", err)
+	}
+	for _, envelope := range segments {
+		segment, keyID, err := s.openSegment(envelope)
+		if err != nil {
+			return count, err
+		}
+		if keyID == s.primary.id {
+			continue
+		}
+		if err := s.SaveSegment(segment); err != nil {
+			return count, fmt.Errorf("failed to re-encrypt segment %s: %w", segment.GetID(), err)
+		}
+		count++
+	}
+	s.stale.Store(false)
+	return count, nil
+}
+
+// ============ 事务 ============
+
+// encryptedTransaction 加密存储的事务，暂存前加密，提交和放弃由底层事务完成
+type encryptedTransaction struct {
+	storage *EncryptedStorage
+	inner   Transaction
+}
+
+// Save 加密并暂存Page保存
+func (tx *encryptedTransaction) Save(page Page) error {
+	envelope, err := tx.storage.sealPage(page)
+	if err != nil {
+		return err
+	}
+	return tx.inner.Save(envelope)
+}
+
+// Delete 暂存Page删除
+func (tx *encryptedTransaction) Delete(pageIndex PageIndex) error {
+	return tx.inner.Delete(pageIndex)
+}
+
+// SaveSegment 加密并暂存Segment元数据保存
+func (tx *encryptedTransaction) SaveSegment(segment *Segment) error {
+	envelope, err := tx.storage.sealSegment(segment)
+	if err != nil {
+		return err
+	}
+	return tx.inner.SaveSegment(envelope)
+}
+
+// DeleteSegment 暂存Segment元数据删除
+func (tx *encryptedTransaction) DeleteSegment(id SegmentID) error {
+	return tx.inner.DeleteSegment(id)
+}
+
+// Commit 提交所有暂存操作
+func (tx *encryptedTransaction) Commit() error {
+	return tx.inner.Commit()
+}
+
+// Abort 放弃所有暂存操作
+func (tx *encryptedTransaction) Abort() error {
+	return tx.inner.Abort()
+}
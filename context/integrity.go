@@ -0,0 +1,584 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntegrityIssueKind 页面树完整性问题类型
+type IntegrityIssueKind string
+
+const (
+	IssueCycle          IntegrityIssueKind = "cycle"           // 父引用形成环，无法到达 Segment 根
+	IssueOrphan         IntegrityIssueKind = "orphan"          // 父页面不存在或不是 ContentsPage，或没有父页面却不是 Segment 根
+	IssueDuplicateChild IntegrityIssueKind = "duplicate_child" // 同一子页面在 children 中出现多次
+	IssueMissingChild   IntegrityIssueKind = "missing_child"   // children 中的页面不存在
+	IssueParentMismatch IntegrityIssueKind = "parent_mismatch" // children 与子页面的 parent 不一致
+	IssueSegmentPrefix  IntegrityIssueKind = "segment_prefix"  // 索引前缀与所属 Segment 不符
+	IssueIndexCounter   IntegrityIssueKind = "index_counter"   // Segment 索引计数器小于已有索引
+)
+
+// IntegrityIssue 一个完整性问题及其修复动作
+type IntegrityIssue struct {
+	Kind    IntegrityIssueKind
+	Page    PageIndex // 相关页面（计数器问题为空）
+	Segment SegmentID // 相关 Segment（未知时为空）
+	Detail  string    // 问题描述
+	Fix     string    // 修复动作，为空表示无法自动修复
+}
+
+// Repairable 是否可以自动修复
+func (i IntegrityIssue) Repairable() bool {
+	return i.Fix != ""
+}
+
+// String 返回问题的单行描述
+func (i IntegrityIssue) String() string {
+	target := string(i.Page)
+	if target == "" {
+		target = "segment " + string(i.Segment)
+	}
+	fix := i.Fix
+	if fix == "" {
+		fix = "cannot be repaired automatically"
+	}
+	return fmt.Sprintf("[%s] %s: %s (%s)", i.Kind, target, i.Detail, fix)
+}
+
+// IntegrityReport 完整性检查（或修复）的结果
+type IntegrityReport struct {
+	CheckedAt time.Time
+	Pages     int              // 检查的页面数（包括冷归档）
+	Segments  int              // 检查的 Segment 数
+	Issues    []IntegrityIssue // 按发现顺序
+	DryRun    bool             // 是否只预览修复动作
+	Repaired  int              // 实际写入的页面和 Segment 数（只检查或 dry-run 时为 0）
+}
+
+// OK 判断是否没有问题
+func (r *IntegrityReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Unrepairable 统计无法自动修复的问题数
+func (r *IntegrityReport) Unrepairable() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if !issue.Repairable() {
+			count++
+		}
+	}
+	return count
+}
+
+// String 返回报告的文本表示，每行一个问题
+func (r *IntegrityReport) String() string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("checked %d pages in %d segments: %d issues", r.Pages, r.Segments, len(r.Issues)))
+	switch {
+	case r.DryRun:
+		builder.WriteString(" (dry run)")
+	case r.Repaired > 0:
+		builder.WriteString(fmt.Sprintf(", %d objects repaired", r.Repaired))
+	}
+	builder.WriteString("\n")
+	for _, issue := range r.Issues {
+		builder.WriteString("- ")
+		builder.WriteString(issue.String())
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// ============ 检查模型 ============
+
+// treeModel 页面树的可修改副本，检查时在副本上应用修复，修复时再写回 Page
+type treeModel struct {
+	pages    map[PageIndex]Page
+	order    []PageIndex               // 排序后的页面索引，保证结果稳定
+	parents  map[PageIndex]PageIndex   // 页面 -> 父页面
+	children map[PageIndex][]PageIndex // ContentsPage -> 子页面（其他页面不在其中）
+	segments []*Segment
+	roots    map[PageIndex]*Segment // Segment 根页面 -> Segment
+	counters map[SegmentID]int      // 需要调高的索引计数器
+	issues   []IntegrityIssue
+}
+
+// newTreeModel 从 Segment 和页面列表构建检查模型
+func newTreeModel(segments []*Segment, pages []Page) *treeModel {
+	m := &treeModel{
+		pages:    make(map[PageIndex]Page, len(pages)),
+		parents:  make(map[PageIndex]PageIndex, len(pages)),
+		children: make(map[PageIndex][]PageIndex),
+		segments: segments,
+		roots:    make(map[PageIndex]*Segment),
+		counters: make(map[SegmentID]int),
+	}
+	for _, page := range pages {
+		index := page.GetIndex()
+		m.pages[index] = page
+		m.order = append(m.order, index)
+		m.parents[index] = page.GetParent()
+		if contentsPage, ok := page.(*ContentsPage); ok {
+			m.children[index] = append([]PageIndex{}, contentsPage.GetChildren()...)
+		}
+	}
+	sort.Slice(m.order, func(i, j int) bool { return m.order[i] < m.order[j] })
+	for _, seg := range segments {
+		if _, exists := m.pages[seg.GetRootIndex()]; exists {
+			m.roots[seg.GetRootIndex()] = seg
+		}
+	}
+	return m
+}
+
+// report 记录问题
+func (m *treeModel) report(kind IntegrityIssueKind, pageIndex PageIndex, fix, format string, args ...any) {
+	issue := IntegrityIssue{Kind: kind, Page: pageIndex, Detail: fmt.Sprintf(format, args...), Fix: fix}
+	if seg := m.segmentOf(pageIndex); seg != nil {
+		issue.Segment = seg.GetID()
+	}
+	m.issues = append(m.issues, issue)
+}
+
+// segmentOf 按索引前缀查找Segment（最长匹配）
+func (m *treeModel) segmentOf(pageIndex PageIndex) *Segment {
+	var matched *Segment
+	for _, seg := range m.segments {
+		prefix := string(seg.GetID()) + "-"
+		if strings.HasPrefix(string(pageIndex), prefix) &&
+			(matched == nil || len(seg.GetID()) > len(matched.GetID())) {
+			matched = seg
+		}
+	}
+	return matched
+}
+
+// isContents 判断页面是否存在且为 ContentsPage
+func (m *treeModel) isContents(pageIndex PageIndex) bool {
+	_, ok := m.children[pageIndex]
+	return ok
+}
+
+// archived 判断页面是否处于冷归档
+func (m *treeModel) archived(pageIndex PageIndex) bool {
+	page, exists := m.pages[pageIndex]
+	return exists && page.GetLifecycle() == ColdArchived
+}
+
+// lists 判断 parent 的 children 是否包含 child
+func (m *treeModel) lists(parent, child PageIndex) bool {
+	for _, c := range m.children[parent] {
+		if c == child {
+			return true
+		}
+	}
+	return false
+}
+
+// removeChild 从 parent 的 children 中删除 child
+func (m *treeModel) removeChild(parent, child PageIndex) {
+	children, ok := m.children[parent]
+	if !ok {
+		return
+	}
+	kept := children[:0]
+	for _, c := range children {
+		if c != child {
+			kept = append(kept, c)
+		}
+	}
+	m.children[parent] = kept
+}
+
+// addChild 将 child 追加到 parent 的 children
+func (m *treeModel) addChild(parent, child PageIndex) {
+	if m.isContents(parent) && !m.lists(parent, child) {
+		m.children[parent] = append(m.children[parent], child)
+	}
+}
+
+// attachTarget 返回页面应挂回的 Segment 根页面，无法确定时返回空
+func (m *treeModel) attachTarget(pageIndex PageIndex) PageIndex {
+	seg := m.segmentOf(pageIndex)
+	if seg == nil {
+		return ""
+	}
+	root := seg.GetRootIndex()
+	if root == pageIndex || !m.isContents(root) {
+		return ""
+	}
+	return root
+}
+
+// attach 将页面挂到 parent 下（冷归档的页面只设置 parent，保持归档子树根的状态）
+func (m *treeModel) attach(pageIndex, parent PageIndex) {
+	m.parents[pageIndex] = parent
+	if !m.archived(pageIndex) || m.archived(parent) {
+		m.addChild(parent, pageIndex)
+	}
+}
+
+// analyze 依次检查各类问题，并在模型上应用修复（后面的检查基于前面修复后的结果）
+func (m *treeModel) analyze() {
+	m.checkRoots()
+	m.checkChildren()
+	m.checkParents()
+	m.checkCycles()
+	m.checkPrefixes()
+	m.checkCounters()
+}
+
+// checkRoots Segment 根页面不能有父页面
+func (m *treeModel) checkRoots() {
+	for _, index := range m.order {
+		if m.roots[index] == nil || m.parents[index] == "" {
+			continue
+		}
+		parent := m.parents[index]
+		m.report(IssueParentMismatch, index, "clear parent", "segment root has parent %s", parent)
+		m.removeChild(parent, index)
+		m.parents[index] = ""
+	}
+}
+
+// checkChildren 检查 children 列表：重复、不存在的子页面，以及与子页面 parent 不一致
+func (m *treeModel) checkChildren() {
+	for _, index := range m.order {
+		if !m.isContents(index) {
+			continue
+		}
+		seen := make(map[PageIndex]bool)
+		var kept []PageIndex
+		for _, child := range m.children[index] {
+			if seen[child] {
+				m.report(IssueDuplicateChild, index, "drop duplicate entry", "child %s is listed more than once", child)
+				continue
+			}
+			seen[child] = true
+			if _, exists := m.pages[child]; !exists {
+				m.report(IssueMissingChild, index, "drop entry", "child %s does not exist", child)
+				continue
+			}
+			kept = append(kept, child)
+		}
+		m.children[index] = kept
+	}
+
+	for _, index := range m.order {
+		if !m.isContents(index) {
+			continue
+		}
+		for _, child := range append([]PageIndex{}, m.children[index]...) {
+			parent := m.parents[child]
+			switch {
+			case parent == index:
+				continue
+			case m.roots[child] != nil:
+				m.report(IssueParentMismatch, child, fmt.Sprintf("remove from %s", index),
+					"segment root is listed as a child of %s", index)
+				m.removeChild(index, child)
+			case m.isContents(parent) && m.lists(parent, child):
+				// 被两个父页面同时列出，以子页面的 parent 为准
+				m.report(IssueParentMismatch, child, fmt.Sprintf("remove from %s", index),
+					"listed by both %s and its parent %s", index, parent)
+				m.removeChild(index, child)
+			case m.isContents(parent):
+				m.report(IssueParentMismatch, child, fmt.Sprintf("move entry from %s to %s", index, parent),
+					"listed by %s but its parent is %s", index, parent)
+				m.removeChild(index, child)
+				m.attach(child, parent)
+			default:
+				// 子页面的 parent 无效，以列出它的页面为准
+				m.report(IssueParentMismatch, child, fmt.Sprintf("set parent to %s", index),
+					"listed by %s but its parent %q is invalid", index, parent)
+				m.parents[child] = index
+			}
+		}
+	}
+}
+
+// checkParents 检查父引用：父页面未列出子页面，以及孤立页面
+func (m *treeModel) checkParents() {
+	for _, index := range m.order {
+		if m.roots[index] != nil {
+			continue
+		}
+		parent := m.parents[index]
+		if m.isContents(parent) {
+			// 冷归档子树的根页面保留原 parent 但不在其 children 中
+			if !m.lists(parent, index) && !(m.archived(index) && !m.archived(parent)) {
+				m.report(IssueParentMismatch, index, fmt.Sprintf("add to children of %s", parent),
+					"parent %s does not list it", parent)
+				m.addChild(parent, index)
+			}
+			continue
+		}
+
+		var detail string
+		switch _, exists := m.pages[parent]; {
+		case parent == "":
+			detail = "has no parent and is not a segment root"
+		case !exists:
+			detail = fmt.Sprintf("parent %s does not exist", parent)
+		default:
+			detail = fmt.Sprintf("parent %s is not a ContentsPage", parent)
+		}
+		target := m.attachTarget(index)
+		if target == "" {
+			m.report(IssueOrphan, index, "", "%s", detail)
+			continue
+		}
+		m.report(IssueOrphan, index, fmt.Sprintf("attach to segment root %s", target), "%s", detail)
+		m.attach(index, target)
+	}
+}
+
+// checkCycles 检查父引用形成的环，将环中索引最小的页面挂回 Segment 根页面
+func (m *treeModel) checkCycles() {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[PageIndex]int, len(m.pages))
+	for _, start := range m.order {
+		var path []PageIndex
+		current := start
+		for current != "" && state[current] == unvisited {
+			if _, exists := m.pages[current]; !exists {
+				break
+			}
+			state[current] = visiting
+			path = append(path, current)
+			current = m.parents[current]
+		}
+
+		if current != "" && state[current] == visiting {
+			var cycle []PageIndex
+			for i, index := range path {
+				if index == current {
+					cycle = path[i:]
+					break
+				}
+			}
+			entry := cycle[0]
+			names := make([]string, len(cycle))
+			for i, index := range cycle {
+				names[i] = string(index)
+				if index < entry {
+					entry = index
+				}
+			}
+			detail := fmt.Sprintf("pages %s form a parent cycle", strings.Join(names, " -> "))
+			if target := m.attachTarget(entry); target != "" {
+				m.report(IssueCycle, entry, fmt.Sprintf("attach to segment root %s", target), "%s", detail)
+				m.removeChild(m.parents[entry], entry)
+				m.attach(entry, target)
+			} else {
+				m.report(IssueCycle, entry, "", "%s", detail)
+			}
+		}
+		for _, index := range path {
+			state[index] = done
+		}
+	}
+}
+
+// checkPrefixes 检查索引前缀：必须对应某个 Segment，且页面位于该 Segment 的树中
+func (m *treeModel) checkPrefixes() {
+	for _, index := range m.order {
+		seg := m.segmentOf(index)
+		if seg == nil {
+			m.report(IssueSegmentPrefix, index, "", "index prefix matches no segment")
+			continue
+		}
+
+		// 沿父引用找到树根（未修复的环最多走 len(pages) 步）
+		top := index
+		for steps := 0; m.parents[top] != "" && steps < len(m.pages); steps++ {
+			top = m.parents[top]
+		}
+		if owner := m.roots[top]; owner != nil && owner != seg {
+			m.report(IssueSegmentPrefix, index, "", "index belongs to segment %s but the page is in the tree of segment %s",
+				seg.GetID(), owner.GetID())
+		}
+	}
+}
+
+// checkCounters 检查 Segment 索引计数器不小于已有索引的编号
+func (m *treeModel) checkCounters() {
+	highest := make(map[SegmentID]int)
+	for _, index := range m.order {
+		seg := m.segmentOf(index)
+		if seg == nil {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimPrefix(string(index), string(seg.GetID())+"-"))
+		if err == nil && number > highest[seg.GetID()] {
+			highest[seg.GetID()] = number
+		}
+	}
+	for _, seg := range m.segments {
+		if max := highest[seg.GetID()]; seg.GetIndexCounter() < max {
+			m.issues = append(m.issues, IntegrityIssue{
+				Kind:    IssueIndexCounter,
+				Segment: seg.GetID(),
+				Detail:  fmt.Sprintf("index counter %d is lower than existing index %s-%d", seg.GetIndexCounter(), seg.GetID(), max),
+				Fix:     fmt.Sprintf("raise counter to %d", max),
+			})
+			m.counters[seg.GetID()] = max
+		}
+	}
+}
+
+// ============ ContextSystem 检查与修复 ============
+
+// Check 检查页面树和 Segment 的完整性（包括未缓存和冷归档的 Page），不做任何修改
+func (cs *ContextSystem) Check() *IntegrityReport {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	model := newTreeModel(cs.segments, cs.listAllPagesLocked())
+	model.analyze()
+	return &IntegrityReport{
+		CheckedAt: time.Now(),
+		Pages:     len(model.pages),
+		Segments:  len(cs.segments),
+		Issues:    model.issues,
+	}
+}
+
+// Repair 检查并修复完整性问题，dryRun 为 true 时只返回将要执行的修复动作
+//
+// 修复只调整父子引用和 Segment 索引计数器，不删除任何 Page：孤立的页面和环中的页面挂回所属 Segment 的根页面。
+// 索引前缀不符等无法自动修复的问题只出现在报告中。所有写入在同一事务中提交，失败时回滚内存状态。
+func (cs *ContextSystem) Repair(dryRun bool) (*IntegrityReport, error) {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	model := newTreeModel(cs.segments, cs.listAllPagesLocked())
+	model.analyze()
+	report := &IntegrityReport{
+		CheckedAt: time.Now(),
+		Pages:     len(model.pages),
+		Segments:  len(cs.segments),
+		Issues:    model.issues,
+		DryRun:    dryRun,
+	}
+	if dryRun || report.OK() {
+		tx.Abort()
+		return report, nil
+	}
+
+	// 1. 将模型写回 Page，记录原值用于回滚
+	type pageState struct {
+		page     Page
+		parent   PageIndex
+		children []PageIndex
+	}
+	var changed []pageState
+	rollback := func() {
+		for _, state := range changed {
+			state.page.SetParent(state.parent)
+			if contentsPage, ok := state.page.(*ContentsPage); ok {
+				contentsPage.children = state.children
+			}
+		}
+	}
+	for _, index := range model.order {
+		page := model.pages[index]
+		contentsPage, isContents := page.(*ContentsPage)
+		parentChanged := model.parents[index] != page.GetParent()
+		childrenChanged := isContents && !equalIndices(model.children[index], contentsPage.GetChildren())
+		if !parentChanged && !childrenChanged {
+			continue
+		}
+
+		state := pageState{page: page, parent: page.GetParent()}
+		if isContents {
+			state.children = append([]PageIndex{}, contentsPage.GetChildren()...)
+			contentsPage.children = append([]PageIndex{}, model.children[index]...)
+		}
+		changed = append(changed, state)
+		page.SetParent(model.parents[index])
+		if err := tx.Save(page); err != nil {
+			rollback()
+			tx.Abort()
+			return nil, err
+		}
+	}
+
+	// 2. 调高 Segment 索引计数器
+	oldCounters := make(map[*Segment]int)
+	rollbackCounters := func() {
+		for seg, counter := range oldCounters {
+			seg.SetIndexCounter(counter)
+		}
+	}
+	for _, seg := range cs.segments {
+		counter, ok := model.counters[seg.GetID()]
+		if !ok {
+			continue
+		}
+		oldCounters[seg] = seg.GetIndexCounter()
+		seg.SetIndexCounter(counter)
+		if err := tx.SaveSegment(seg); err != nil {
+			rollbackCounters()
+			rollback()
+			tx.Abort()
+			return nil, err
+		}
+	}
+
+	// 3. 提交
+	if err := tx.Commit(); err != nil {
+		rollbackCounters()
+		rollback()
+		return nil, fmt.Errorf("failed to persist repair: %w", err)
+	}
+	for _, state := range changed {
+		cs.pageChanged(state.page, ActorSystem, RevisionUpdate)
+	}
+	report.Repaired = len(changed) + len(oldCounters)
+	cs.updatedAt = time.Now()
+	return report, nil
+}
+
+// equalIndices 判断两个索引列表是否相同
+func equalIndices(a, b []PageIndex) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isDescendantOf 判断 pageIndex 是否为 ancestor 本身或其后代（沿父引用向上查找）
+func (cs *ContextSystem) isDescendantOf(pageIndex, ancestor PageIndex) bool {
+	visited := make(map[PageIndex]bool)
+	for current := pageIndex; current != "" && !visited[current]; {
+		if current == ancestor {
+			return true
+		}
+		visited[current] = true
+		page, err := cs.GetPage(current)
+		if err != nil {
+			return false
+		}
+		current = page.GetParent()
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package context
+
+import (
+	"fmt"
+	"strings"
+)
+
+// markdown 与页面树的相互转换
+//
+// 导入规则：
+// - ATX 标题（# 到任意多个 #）构成层级，跳级的标题挂到最近的上级标题下
+// - 没有子标题的标题生成 DetailPage，标题为名称，正文为 detail
+// - 有子标题的标题生成 ContentsPage；其子标题之前的正文生成一个同名 DetailPage，作为第一个子页面
+// - 第一个标题之前的正文生成以文档名称命名的 DetailPage
+// - 标题下紧跟的 <!-- desc: ... --> 注释作为页面描述
+// - 代码块（``` 或 ~~~）内的 # 行不视为标题
+// - 以反斜杠转义的标题行（\# ...）是正文，导入时去掉一个反斜杠
+//
+// 导出规则与之相反，正文中会被解析为标题的行加反斜杠转义，导出结果重新导入后得到相同结构的页面树。
+
+// markdownDescPrefix / markdownDescSuffix 页面描述注释
+const (
+	markdownDescPrefix = "<!-- desc: "
+	markdownDescSuffix = " -->"
+)
+
+// markdownSection markdown 文档中的一个标题段落
+type markdownSection struct {
+	level       int
+	title       string
+	description string
+	body        []string
+	children    []*markdownSection
+}
+
+// text 返回段落正文（去掉首尾空行）
+func (s *markdownSection) text() string {
+	return strings.Trim(strings.Join(s.body, "\n"), "\n")
+}
+
+// parseHeading 解析 ATX 标题行，返回级别和标题文本
+func parseHeading(line string) (int, string, bool) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level >= len(line) || line[level] != ' ' {
+		return 0, "", false
+	}
+	title := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+	if title == "" {
+		return 0, "", false
+	}
+	return level, title, true
+}
+
+// nextFence 根据当前代码块围栏和本行内容返回新的围栏状态，inFence 表示本行属于代码块（包括围栏行本身）
+func nextFence(fence, line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if fence != "" {
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			return "", true
+		}
+		return fence, true
+	}
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == trimmed[0] {
+			n++
+		}
+		return trimmed[:n], true
+	}
+	return "", false
+}
+
+// isEscapedHeading 判断去掉行首所有反斜杠后是否为标题行
+func isEscapedHeading(line string) bool {
+	_, _, ok := parseHeading(strings.TrimLeft(line, "\\"))
+	return ok
+}
+
+// escapeMarkdownBody 为正文中代码块外会被解析为标题的行（以及已转义的这类行）加一个反斜杠
+func escapeMarkdownBody(body string) string {
+	lines := strings.Split(body, "\n")
+	fence := ""
+	for i, line := range lines {
+		var inFence bool
+		if fence, inFence = nextFence(fence, line); inFence {
+			continue
+		}
+		if isEscapedHeading(line) {
+			lines[i] = "\\" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseMarkdownSections 将 markdown 文档解析为标题树，返回第一个标题之前的正文和顶层段落
+func parseMarkdownSections(markdown string) (*markdownSection, []*markdownSection) {
+	preamble := &markdownSection{}
+	var roots []*markdownSection
+	var stack []*markdownSection
+	current := preamble
+	fence := ""
+	expectDesc := false
+
+	for _, line := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		// 代码块内原样保留
+		var inFence bool
+		if fence, inFence = nextFence(fence, line); inFence {
+			current.body = append(current.body, line)
+			expectDesc = false
+			continue
+		}
+
+		if level, title, ok := parseHeading(line); ok {
+			section := &markdownSection{level: level, title: title}
+			for len(stack) > 0 && stack[len(stack)-1].level >= level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				roots = append(roots, section)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, section)
+			}
+			stack = append(stack, section)
+			current = section
+			expectDesc = true
+			continue
+		}
+
+		if expectDesc && strings.HasPrefix(trimmed, markdownDescPrefix) && strings.HasSuffix(trimmed, markdownDescSuffix) {
+			current.description = strings.TrimSuffix(strings.TrimPrefix(trimmed, markdownDescPrefix), markdownDescSuffix)
+			expectDesc = false
+			continue
+		}
+		if trimmed != "" {
+			expectDesc = false
+		}
+		if strings.HasPrefix(line, "\\") && isEscapedHeading(line) {
+			line = line[1:]
+		}
+		current.body = append(current.body, line)
+	}
+	return preamble, roots
+}
+
+// ImportMarkdown 将 markdown 文档导入为 parentIndex 下的页面树（系统级操作）
+func (cs *ContextSystem) ImportMarkdown(parentIndex PageIndex, name, markdown string) ([]PageIndex, error) {
+	return cs.importMarkdownInternal(ActorSystem, parentIndex, name, markdown)
+}
+
+// importMarkdownInternal 将 markdown 文档导入为页面树（内部方法）
+//
+// name 用于第一个标题之前的正文。返回在 parentIndex 下直接创建的页面；
+// 中途失败时删除已创建的页面。
+func (cs *ContextSystem) importMarkdownInternal(actor Actor, parentIndex PageIndex, name, markdown string) ([]PageIndex, error) {
+	parent, err := cs.GetPage(parentIndex)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := parent.(*ContentsPage); !ok {
+		return nil, fmt.Errorf("parent page %s is not a ContentsPage", parentIndex)
+	}
+
+	preamble, sections := parseMarkdownSections(markdown)
+
+	var created []PageIndex
+	rollback := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			_ = cs.deletePageInternal(actor, created[i])
+		}
+	}
+
+	if text := preamble.text(); text != "" {
+		if name == "" {
+			name = "Untitled"
+		}
+		index, err := cs.createDetailPageInternal(actor, name, "", text, parentIndex)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, index)
+	}
+	for _, section := range sections {
+		index, err := cs.createMarkdownSection(actor, section, parentIndex)
+		if index != "" {
+			created = append(created, index)
+		}
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("failed to import section %q: %w", section.title, err)
+		}
+	}
+	return created, nil
+}
+
+// createMarkdownSection 递归创建段落对应的页面，出错时仍返回已创建的根页面索引以便回滚
+func (cs *ContextSystem) createMarkdownSection(actor Actor, section *markdownSection, parentIndex PageIndex) (PageIndex, error) {
+	if len(section.children) == 0 {
+		return cs.createDetailPageInternal(actor, section.title, section.description, section.text(), parentIndex)
+	}
+
+	index, err := cs.createContentsPageInternal(actor, section.title, section.description, parentIndex)
+	if err != nil {
+		return "", err
+	}
+	if text := section.text(); text != "" {
+		if _, err := cs.createDetailPageInternal(actor, section.title, "", text, index); err != nil {
+			return index, err
+		}
+	}
+	for _, child := range section.children {
+		if _, err := cs.createMarkdownSection(actor, child, index); err != nil {
+			return index, err
+		}
+	}
+	return index, nil
+}
+
+// ExportMarkdown 将以 pageIndex 为根的子树导出为 markdown，根页面为一级标题
+func (cs *ContextSystem) ExportMarkdown(pageIndex PageIndex) (string, error) {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	if err := cs.writeMarkdownSection(&builder, page, 1); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(builder.String(), "\n") + "\n", nil
+}
+
+// writeMarkdownSection 递归写出页面对应的段落
+func (cs *ContextSystem) writeMarkdownSection(builder *strings.Builder, page Page, level int) error {
+	builder.WriteString(fmt.Sprintf("%s %s\n", strings.Repeat("#", level), page.GetName()))
+	if desc := page.GetDescription(); desc != "" {
+		builder.WriteString(markdownDescPrefix + strings.Join(strings.Fields(desc), " ") + markdownDescSuffix + "\n")
+	}
+
+	switch p := page.(type) {
+	case *DetailPage:
+		if detail := strings.Trim(p.GetDetail(), "\n"); detail != "" {
+			builder.WriteString("\n" + escapeMarkdownBody(detail) + "\n")
+		}
+		builder.WriteString("\n")
+
+	case *ContentsPage:
+		children, err := cs.GetChildren(p.GetIndex())
+		if err != nil {
+			return err
+		}
+		// 与 ContentsPage 同名的第一个 DetailPage 是子标题之前的正文
+		if len(children) > 0 {
+			if intro, ok := children[0].(*DetailPage); ok && intro.GetName() == p.GetName() && intro.GetDescription() == "" {
+				if detail := strings.Trim(intro.GetDetail(), "\n"); detail != "" {
+					builder.WriteString("\n" + escapeMarkdownBody(detail) + "\n")
+				}
+				children = children[1:]
+			}
+		}
+		builder.WriteString("\n")
+		for _, child := range children {
+			if err := cs.writeMarkdownSection(builder, child, level+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
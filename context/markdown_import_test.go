@@ -0,0 +1,99 @@
+package context
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMarkdown_ImportExportRoundTrip 测试标题层级导入为页面树，导出后再导入得到相同的 markdown
+func TestMarkdown_ImportExportRoundTrip(t *testing.T) {
+	cs, root := newTestSystem(t, t.TempDir())
+
+	doc := strings.Join([]string{
+		"# Profile",
+		"<!-- desc: 用户画像 -->",
+		"",
+		"基本信息",
+		"",
+		"## 爱好",
+		"",
+		"- 爬山",
+		"",
+		"```",
+		"# 不是标题",
+		"```",
+		"",
+		"#### 跳级标题",
+		"",
+		"深层内容",
+		"",
+		"## 工作",
+		"",
+	}, "\n")
+
+	created, err := cs.ImportMarkdown(root, "profile", "前言\n\n"+doc)
+	if err != nil {
+		t.Fatalf("Failed to import markdown: %v", err)
+	}
+	if len(created) != 2 {
+		t.Fatalf("Expected preamble and one top-level section, got %v", created)
+	}
+	if page, _ := cs.GetPage(created[0]); page.GetName() != "profile" || page.(*DetailPage).GetDetail() != "前言" {
+		t.Errorf("Unexpected preamble page: %+v", page)
+	}
+
+	profile, _ := cs.GetPage(created[1])
+	if _, ok := profile.(*ContentsPage); !ok || profile.GetDescription() != "用户画像" {
+		t.Fatalf("Expected ContentsPage with description, got %+v", profile)
+	}
+	children, _ := cs.GetChildren(created[1])
+	if len(children) != 3 || children[0].(*DetailPage).GetDetail() != "基本信息" {
+		t.Fatalf("Expected intro, 爱好 and 工作 under Profile, got %v", children)
+	}
+	hobby, ok := children[1].(*ContentsPage)
+	if !ok || !strings.Contains(children[1].GetName(), "爱好") {
+		t.Fatalf("Expected 爱好 to be a ContentsPage, got %+v", children[1])
+	}
+	hobbyChildren, _ := cs.GetChildren(hobby.GetIndex())
+	if len(hobbyChildren) != 2 || !strings.Contains(hobbyChildren[0].(*DetailPage).GetDetail(), "# 不是标题") {
+		t.Errorf("Fenced heading should stay in detail, got %v", hobbyChildren)
+	}
+
+	exported, err := cs.ExportMarkdown(created[1])
+	if err != nil {
+		t.Fatalf("Failed to export markdown: %v", err)
+	}
+	reimported, err := cs.ImportMarkdown(root, "", exported)
+	if err != nil || len(reimported) != 1 {
+		t.Fatalf("Failed to re-import markdown: %v, %v", reimported, err)
+	}
+	again, _ := cs.ExportMarkdown(reimported[0])
+	if again != exported {
+		t.Errorf("Round trip mismatch:\n%s\n---\n%s", exported, again)
+	}
+}
+
+// TestMarkdown_RoundTripHeadingInDetail 测试 detail 中以 # 开头的行导出后不会在重新导入时变成标题
+func TestMarkdown_RoundTripHeadingInDetail(t *testing.T) {
+	cs, root := newTestSystem(t, t.TempDir())
+
+	detail := "steps:\n# not a heading\n\\# escaped\n```\n# fenced\n```\nend"
+	index, err := cs.createDetailPageInternal(ActorSystem, "Recipe", "", detail, root)
+	if err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+
+	exported, err := cs.ExportMarkdown(index)
+	if err != nil {
+		t.Fatalf("Failed to export markdown: %v", err)
+	}
+	reimported, err := cs.ImportMarkdown(root, "", exported)
+	if err != nil || len(reimported) != 1 {
+		t.Fatalf("Expected a single re-imported page, got %v (err=%v)\n%s", reimported, err, exported)
+	}
+	page, _ := cs.GetPage(reimported[0])
+	detailPage, ok := page.(*DetailPage)
+	if !ok || detailPage.GetDetail() != detail {
+		t.Errorf("Round trip changed detail:\n%q\n---\n%+v", detail, page)
+	}
+}
@@ -0,0 +1,615 @@
+package context
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 记忆归档文件格式
+//
+// 归档为 JSONL：首行为 archiveHeader，其后每行一条 archiveRecord，
+// 先按显示顺序列出全部 Segment（含索引计数器），再按索引顺序列出全部 Page（含冷归档的 Page）。
+const (
+	archiveFormat  = "memci-archive"
+	archiveVersion = 1
+
+	archiveKindSegment = "segment"
+	archiveKindPage    = "page"
+)
+
+// archiveHeader 归档文件头
+type archiveHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Segments  int       `json:"segments"`
+	Pages     int       `json:"pages"`
+}
+
+// archiveRecord 归档中的一条记录，Data 为 Segment 或 Page 的存储格式
+type archiveRecord struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// ImportMode 导入方式
+type ImportMode int
+
+const (
+	// ImportMerge 合并到现有记忆：同名 Segment 的页面挂到现有根页面下，冲突的索引重新分配
+	ImportMerge ImportMode = iota
+	// ImportReplace 清空现有记忆后按归档原样导入
+	ImportReplace
+)
+
+// String 返回导入方式的字符串表示
+func (m ImportMode) String() string {
+	switch m {
+	case ImportMerge:
+		return "merge"
+	case ImportReplace:
+		return "replace"
+	default:
+		return "Unknown"
+	}
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Segments int                     // 新增的 Segment 数
+	Pages    int                     // 导入的 Page 数
+	Remapped map[PageIndex]PageIndex // 索引发生变化的 Page（归档索引 -> 新索引）
+}
+
+// importPlan 已暂存到事务的导入操作
+//
+// apply 在事务提交后更新内存状态，rollback 在暂存失败或提交失败时撤销暂存期间对内存的修改。
+type importPlan struct {
+	result   *ImportResult
+	apply    func()
+	rollback func()
+}
+
+// memoryArchive 解析后的归档内容
+type memoryArchive struct {
+	header   archiveHeader
+	segments []*Segment
+	pages    map[PageIndex]Page
+	order    []PageIndex // Page 在归档中的顺序
+}
+
+// ============ 导出 ============
+
+// ExportArchive 将全部 Segment 和 Page 导出为归档
+func (cs *ContextSystem) ExportArchive(w io.Writer) error {
+	cs.mu.RLock()
+	segments := make([]*Segment, len(cs.segments))
+	copy(segments, cs.segments)
+	pages := cs.listAllPagesLocked()
+	cs.mu.RUnlock()
+
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].GetIndex() < pages[j].GetIndex()
+	})
+
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	header := archiveHeader{
+		Format:    archiveFormat,
+		Version:   archiveVersion,
+		CreatedAt: time.Now(),
+		Segments:  len(segments),
+		Pages:     len(pages),
+	}
+	if err := encoder.Encode(header); err != nil {
+		return fmt.Errorf("failed to write archive header: %w", err)
+	}
+
+	for _, seg := range segments {
+		data, err := seg.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal segment %s: %w", seg.GetID(), err)
+		}
+		if err := encoder.Encode(archiveRecord{Kind: archiveKindSegment, Data: data}); err != nil {
+			return fmt.Errorf("failed to write segment %s: %w", seg.GetID(), err)
+		}
+	}
+	for _, page := range pages {
+		data, err := page.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal page %s: %w", page.GetIndex(), err)
+		}
+		if err := encoder.Encode(archiveRecord{Kind: archiveKindPage, Data: data}); err != nil {
+			return fmt.Errorf("failed to write page %s: %w", page.GetIndex(), err)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// ============ 读取与校验 ============
+
+// readArchive 读取并校验归档
+func readArchive(r io.Reader) (*memoryArchive, error) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+
+	archive := &memoryArchive{pages: make(map[PageIndex]Page)}
+	if err := decoder.Decode(&archive.header); err != nil {
+		return nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	if archive.header.Format != archiveFormat {
+		return nil, fmt.Errorf("not a memci archive (format %q)", archive.header.Format)
+	}
+	if archive.header.Version < 1 || archive.header.Version > archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", archive.header.Version)
+	}
+
+	segmentIDs := make(map[SegmentID]bool)
+	for {
+		var record archiveRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read archive record: %w", err)
+		}
+
+		switch record.Kind {
+		case archiveKindSegment:
+			seg, err := unmarshalSegmentJSON(record.Data)
+			if err != nil {
+				return nil, err
+			}
+			if seg.GetID() == "" {
+				return nil, fmt.Errorf("segment without id")
+			}
+			if segmentIDs[seg.GetID()] {
+				return nil, fmt.Errorf("duplicate segment %s", seg.GetID())
+			}
+			segmentIDs[seg.GetID()] = true
+			archive.segments = append(archive.segments, seg)
+		case archiveKindPage:
+			page, err := unmarshalPage(record.Data)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := archive.pages[page.GetIndex()]; exists {
+				return nil, fmt.Errorf("duplicate page %s", page.GetIndex())
+			}
+			archive.pages[page.GetIndex()] = page
+			archive.order = append(archive.order, page.GetIndex())
+		default:
+			return nil, fmt.Errorf("unknown archive record kind: %s", record.Kind)
+		}
+	}
+
+	if len(archive.segments) != archive.header.Segments || len(archive.pages) != archive.header.Pages {
+		return nil, fmt.Errorf("archive is truncated: expected %d segments and %d pages, got %d and %d",
+			archive.header.Segments, archive.header.Pages, len(archive.segments), len(archive.pages))
+	}
+	if err := archive.validate(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// segmentOf 返回Page所属的归档 Segment（按最长的 "{id}-" 前缀匹配）
+func (a *memoryArchive) segmentOf(pageIndex PageIndex) *Segment {
+	var owner *Segment
+	for _, seg := range a.segments {
+		prefix := string(seg.GetID()) + "-"
+		if strings.HasPrefix(string(pageIndex), prefix) && (owner == nil || len(seg.GetID()) > len(owner.GetID())) {
+			owner = seg
+		}
+	}
+	return owner
+}
+
+// validate 校验归档中页面树的完整性
+//
+// 每个 Page 属于某个 Segment；Segment 根页面存在且没有父节点；
+// 其余 Page 的父节点是同一 Segment 的 ContentsPage 并在 children 中列出
+// （冷归档子树的根不在父节点的 children 中）；children 引用的 Page 都存在且指回父节点。
+func (a *memoryArchive) validate() error {
+	roots := make(map[PageIndex]bool)
+	for _, seg := range a.segments {
+		rootIndex := seg.GetRootIndex()
+		if rootIndex == "" {
+			continue
+		}
+		root, exists := a.pages[rootIndex]
+		if !exists {
+			return fmt.Errorf("root page %s of segment %s is missing", rootIndex, seg.GetID())
+		}
+		if root.GetParent() != "" {
+			return fmt.Errorf("root page %s of segment %s has a parent", rootIndex, seg.GetID())
+		}
+		if _, ok := root.(*ContentsPage); !ok {
+			return fmt.Errorf("root page %s of segment %s is not a ContentsPage", rootIndex, seg.GetID())
+		}
+		roots[rootIndex] = true
+	}
+
+	for _, pageIndex := range a.order {
+		page := a.pages[pageIndex]
+		seg := a.segmentOf(pageIndex)
+		if seg == nil {
+			return fmt.Errorf("page %s does not belong to any segment", pageIndex)
+		}
+
+		if !roots[pageIndex] {
+			parentIndex := page.GetParent()
+			parent, exists := a.pages[parentIndex]
+			if !exists {
+				return fmt.Errorf("parent %q of page %s is missing", parentIndex, pageIndex)
+			}
+			parentPage, ok := parent.(*ContentsPage)
+			if !ok {
+				return fmt.Errorf("parent %s of page %s is not a ContentsPage", parentIndex, pageIndex)
+			}
+			if a.segmentOf(parentIndex) != seg {
+				return fmt.Errorf("page %s and its parent %s belong to different segments", pageIndex, parentIndex)
+			}
+			if !parentPage.HasChild(pageIndex) && page.GetLifecycle() != ColdArchived {
+				return fmt.Errorf("page %s is not listed as a child of %s", pageIndex, parentIndex)
+			}
+		}
+
+		if contentsPage, ok := page.(*ContentsPage); ok {
+			for _, childIndex := range contentsPage.GetChildren() {
+				child, exists := a.pages[childIndex]
+				if !exists {
+					return fmt.Errorf("child %s of page %s is missing", childIndex, pageIndex)
+				}
+				if child.GetParent() != pageIndex {
+					return fmt.Errorf("child %s of page %s points to parent %q", childIndex, pageIndex, child.GetParent())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ============ 导入 ============
+
+// ImportArchive 从归档导入记忆
+//
+// 导入前完整校验归档；所有写入在同一事务中提交，失败时现有记忆保持不变。
+// 合并模式下，与现有 Segment 同名的归档 Segment 不会新建，其根页面的子页面挂到现有根页面下，
+// 这些页面使用现有 Segment 的计数器重新分配索引；其余 Page 保留原索引（与现有 Page 冲突时重新分配）。
+func (cs *ContextSystem) ImportArchive(r io.Reader, mode ImportMode) (*ImportResult, error) {
+	archive, err := readArchive(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %w", err)
+	}
+
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var plan *importPlan
+	switch mode {
+	case ImportReplace:
+		plan, err = cs.stageReplaceLocked(archive, tx)
+	case ImportMerge:
+		plan, err = cs.stageMergeLocked(archive, tx)
+	default:
+		err = fmt.Errorf("unknown import mode: %d", mode)
+	}
+	if err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		plan.rollback()
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	plan.apply()
+	cs.updatedAt = time.Now()
+
+	return plan.result, nil
+}
+
+// stageReplaceLocked 暂存替换导入：删除现有全部 Page 和 Segment，按原样写入归档内容
+//
+// 暂存期间不修改内存状态（调用方需持有写锁）。
+func (cs *ContextSystem) stageReplaceLocked(archive *memoryArchive, tx Transaction) (*importPlan, error) {
+	existing := make(map[PageIndex]bool)
+	for _, page := range cs.pages.Pages() {
+		existing[page.GetIndex()] = true
+	}
+	if cs.storage != nil {
+		indices, err := cs.storage.List()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pages: %w", err)
+		}
+		for _, pageIndex := range indices {
+			existing[pageIndex] = true
+		}
+	}
+
+	// 归档中的固定Page替换现有的全部固定Page，不能超出固定预算
+	replaced := make([]PageIndex, 0, len(existing))
+	for pageIndex := range existing {
+		replaced = append(replaced, pageIndex)
+	}
+	var active []Page
+	for _, pageIndex := range archive.order {
+		if page := archive.pages[pageIndex]; page.GetLifecycle() != ColdArchived {
+			active = append(active, page)
+		}
+	}
+	if err := cs.checkPinnedBudgetLocked(replaced, cs.pinnedCostLocked(active)); err != nil {
+		return nil, fmt.Errorf("cannot import pinned pages: %w", err)
+	}
+
+	for pageIndex := range existing {
+		if _, kept := archive.pages[pageIndex]; kept {
+			continue
+		}
+		if err := tx.Delete(pageIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	archived := make(map[SegmentID]bool)
+	for _, seg := range archive.segments {
+		archived[seg.GetID()] = true
+		if err := tx.SaveSegment(seg); err != nil {
+			return nil, err
+		}
+	}
+	retired := make(map[SegmentID]int)
+	for _, seg := range cs.segments {
+		if archived[seg.GetID()] {
+			continue
+		}
+		if err := tx.SaveSegment(seg.tombstone()); err != nil {
+			return nil, err
+		}
+		retired[seg.GetID()] = seg.GetIndexCounter()
+	}
+	for _, pageIndex := range archive.order {
+		if err := tx.Save(archive.pages[pageIndex]); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ImportResult{
+		Segments: len(archive.segments),
+		Pages:    len(archive.pages),
+		Remapped: make(map[PageIndex]PageIndex),
+	}
+	apply := func() {
+		for pageIndex := range existing {
+			cs.pages.Remove(pageIndex)
+			cs.states.Remove(pageIndex)
+		}
+		cs.segments = archive.segments
+		cs.segmentMap = make(map[SegmentID]*Segment, len(archive.segments))
+		for _, seg := range archive.segments {
+			cs.segmentMap[seg.GetID()] = seg
+			delete(cs.retired, seg.GetID())
+		}
+		for id, counter := range retired {
+			cs.retired[id] = counter
+		}
+		cs.index.reset()
+		cs.vectors.reset()
+		cs.links.reset()
+		cs.expiries.reset()
+		cs.pinned.reset()
+		cs.cacheImportedLocked(archive)
+	}
+	return &importPlan{result: result, apply: apply, rollback: func() {}}, nil
+}
+
+// stageMergeLocked 暂存合并导入（调用方需持有写锁）
+//
+// 暂存期间会推进现有 Segment 的索引计数器并修改现有根页面的 children，失败时需要 rollback。
+func (cs *ContextSystem) stageMergeLocked(archive *memoryArchive, tx Transaction) (plan *importPlan, err error) {
+	result := &ImportResult{Remapped: make(map[PageIndex]PageIndex)}
+	mapping := make(map[PageIndex]PageIndex, len(archive.pages))
+	skipped := make(map[PageIndex]bool) // 合并到现有根页面、本身不导入的归档根页面
+
+	// 1. 确定每个 Segment 的目标：现有 Segment 或新增 Segment
+	targets := make(map[SegmentID]*Segment, len(archive.segments))
+	var added []*Segment
+	localRoots := make(map[PageIndex]*ContentsPage)
+	counters := make(map[*Segment]int)
+	rootChildren := make(map[*ContentsPage][]PageIndex)
+	renumbered := make(map[*Segment]bool) // 同 ID 曾被删除的新增 Segment，全部页面重新分配索引
+	rollback := func() {
+		for seg, count := range counters {
+			seg.SetIndexCounter(count)
+		}
+		for root, children := range rootChildren {
+			root.children = children
+		}
+	}
+	defer func() {
+		if err != nil {
+			rollback()
+		}
+	}()
+	for _, seg := range archive.segments {
+		local, exists := cs.segmentMap[seg.GetID()]
+		if !exists {
+			targets[seg.GetID()] = seg
+			added = append(added, seg)
+			if counter, ok := cs.retired[seg.GetID()]; ok {
+				seg.SetIndexCounter(counter)
+				renumbered[seg] = true
+			}
+			continue
+		}
+		targets[seg.GetID()] = local
+		counters[local] = local.GetIndexCounter()
+
+		rootIndex := seg.GetRootIndex()
+		if rootIndex == "" {
+			continue
+		}
+		if local.GetRootIndex() == "" {
+			return nil, fmt.Errorf("segment %s has no root page to merge into", local.GetID())
+		}
+		localRoot, err := cs.getPageLocked(local.GetRootIndex())
+		if err != nil {
+			return nil, fmt.Errorf("root of segment %s: %w", local.GetID(), err)
+		}
+		rootPage, ok := localRoot.(*ContentsPage)
+		if !ok {
+			return nil, fmt.Errorf("root page %s of segment %s is not a ContentsPage", local.GetRootIndex(), local.GetID())
+		}
+		mapping[rootIndex] = rootPage.GetIndex()
+		skipped[rootIndex] = true
+		localRoots[rootIndex] = rootPage
+		rootChildren[rootPage] = append([]PageIndex(nil), rootPage.GetChildren()...)
+	}
+
+	// 2. 分配索引：合并到现有 Segment 或同 ID 曾被删除的 Segment 的页面使用其计数器，其余保留原索引（冲突时重新分配）
+	taken := make(map[PageIndex]bool)
+	isFree := func(pageIndex PageIndex) bool {
+		if taken[pageIndex] {
+			return false
+		}
+		if _, exists := cs.pages.Peek(pageIndex); exists {
+			return false
+		}
+		return cs.storage == nil || !cs.storage.Exists(pageIndex)
+	}
+	for _, pageIndex := range archive.order {
+		if skipped[pageIndex] {
+			continue
+		}
+		target := targets[archive.segmentOf(pageIndex).GetID()]
+		if _, tracked := counters[target]; !tracked {
+			counters[target] = target.GetIndexCounter()
+		}
+		newIndex := pageIndex
+		if _, merged := cs.segmentMap[target.GetID()]; merged || renumbered[target] || !isFree(newIndex) {
+			for newIndex = target.GenerateIndex(); !isFree(newIndex); newIndex = target.GenerateIndex() {
+			}
+		}
+		taken[newIndex] = true
+		mapping[pageIndex] = newIndex
+		if newIndex != pageIndex {
+			result.Remapped[pageIndex] = newIndex
+		}
+	}
+	remap := func(pageIndex PageIndex) PageIndex {
+		if newIndex, ok := mapping[pageIndex]; ok {
+			return newIndex
+		}
+		return pageIndex
+	}
+	for _, seg := range added {
+		seg.SetRootIndex(remap(seg.GetRootIndex()))
+	}
+
+	// 3. 改写索引引用，归档根页面的子页面追加到现有根页面
+	imported := make([]Page, 0, len(archive.pages))
+	for _, pageIndex := range archive.order {
+		if skipped[pageIndex] {
+			continue
+		}
+		page := archive.pages[pageIndex]
+		if page.GetParent() != "" {
+			page.SetParent(remap(page.GetParent()))
+		}
+		switch p := page.(type) {
+		case *DetailPage:
+			p.SetIndex(remap(pageIndex))
+		case *ContentsPage:
+			p.SetIndex(remap(pageIndex))
+			children := make([]PageIndex, len(p.children))
+			for i, childIndex := range p.children {
+				children[i] = remap(childIndex)
+			}
+			p.children = children
+		}
+		links := page.GetLinks()
+		for i := range links {
+			links[i].Target = remap(links[i].Target)
+		}
+		setLinks(page, links)
+		imported = append(imported, page)
+	}
+	var mergedRoots []*ContentsPage
+	for rootIndex, localRoot := range localRoots {
+		archiveRoot := archive.pages[rootIndex].(*ContentsPage)
+		for _, childIndex := range archiveRoot.GetChildren() {
+			if err := localRoot.AddChild(remap(childIndex)); err != nil {
+				return nil, err
+			}
+		}
+		mergedRoots = append(mergedRoots, localRoot)
+	}
+	// 导入的固定Page计入固定预算
+	var active []Page
+	for _, page := range imported {
+		if page.GetLifecycle() != ColdArchived {
+			active = append(active, page)
+		}
+	}
+	if err := cs.checkPinnedBudgetLocked(nil, cs.pinnedCostLocked(active)); err != nil {
+		return nil, fmt.Errorf("cannot import pinned pages: %w", err)
+	}
+
+	// 4. 暂存写入
+	for _, seg := range archive.segments {
+		if err := tx.SaveSegment(targets[seg.GetID()]); err != nil {
+			return nil, err
+		}
+	}
+	for _, page := range imported {
+		if err := tx.Save(page); err != nil {
+			return nil, err
+		}
+	}
+	for _, root := range mergedRoots {
+		if err := tx.Save(root); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Segments = len(added)
+	result.Pages = len(imported)
+	apply := func() {
+		for _, seg := range added {
+			cs.segments = append(cs.segments, seg)
+			cs.segmentMap[seg.GetID()] = seg
+			delete(cs.retired, seg.GetID())
+		}
+		for _, page := range imported {
+			if page.GetLifecycle() != ColdArchived {
+				cs.pages.Put(page)
+			}
+			cs.pageChanged(page, ActorSystem, RevisionCreate)
+		}
+		for _, root := range mergedRoots {
+			cs.pageChanged(root, ActorSystem, RevisionUpdate)
+		}
+	}
+	return &importPlan{result: result, apply: apply, rollback: rollback}, nil
+}
+
+// cacheImportedLocked 将替换导入的 Page 放入缓存并记录修订（调用方需持有写锁）
+func (cs *ContextSystem) cacheImportedLocked(archive *memoryArchive) {
+	for _, pageIndex := range archive.order {
+		page := archive.pages[pageIndex]
+		if page.GetLifecycle() != ColdArchived {
+			cs.pages.Put(page)
+		}
+		cs.states.Update(page, true)
+		cs.recordRevision(page, ActorSystem, RevisionCreate)
+	}
+}
@@ -0,0 +1,88 @@
+package context
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestArchive_ExportImport 测试导出后替换导入和合并导入（同名 Segment 合并到现有根页面并重新分配索引）
+func TestArchive_ExportImport(t *testing.T) {
+	src, srcRoot := newTestSystem(t, t.TempDir())
+	group, _ := src.createContentsPageInternal(ActorSystem, "Group", "", srcRoot)
+	note, _ := src.createDetailPageInternal(ActorSystem, "Note", "", "hello", group)
+
+	var buf bytes.Buffer
+	if err := src.ExportArchive(&buf); err != nil {
+		t.Fatalf("Failed to export archive: %v", err)
+	}
+	archive := buf.String()
+
+	// 替换导入：索引和计数器原样保留
+	replaced, _ := newTestSystem(t, t.TempDir())
+	replaced.createDetailPageInternal(ActorSystem, "Old", "", "stale", srcRoot)
+	result, err := replaced.ImportArchive(strings.NewReader(archive), ImportReplace)
+	if err != nil {
+		t.Fatalf("Failed to replace-import archive: %v", err)
+	}
+	if result.Pages != 3 || len(result.Remapped) != 0 {
+		t.Errorf("Unexpected replace result: %+v", result)
+	}
+	if page, err := replaced.GetPage(note); err != nil || page.(*DetailPage).GetDetail() != "hello" {
+		t.Errorf("Expected note %s after replace, got %v, %v", note, page, err)
+	}
+	if pages, _ := replaced.GetChildren(srcRoot); len(pages) != 1 {
+		t.Errorf("Replace should drop existing pages, got %d children", len(pages))
+	}
+	if seg, _ := replaced.GetSegment("usr"); seg.GetIndexCounter() != 3 {
+		t.Errorf("Expected index counter 3, got %d", seg.GetIndexCounter())
+	}
+
+	// 合并导入：归档根页面的子页面挂到现有根页面下
+	merged, mergedRoot := newTestSystem(t, t.TempDir())
+	existing, _ := merged.createDetailPageInternal(ActorSystem, "Existing", "", "", mergedRoot)
+	result, err = merged.ImportArchive(strings.NewReader(archive), ImportMerge)
+	if err != nil {
+		t.Fatalf("Failed to merge-import archive: %v", err)
+	}
+	if result.Pages != 2 || result.Segments != 0 {
+		t.Errorf("Unexpected merge result: %+v", result)
+	}
+	newGroup, ok := result.Remapped[group]
+	if !ok || newGroup == existing {
+		t.Fatalf("Expected group to be remapped, got %v", result.Remapped)
+	}
+	children, _ := merged.GetChildren(mergedRoot)
+	if len(children) != 2 || children[1].GetIndex() != newGroup {
+		t.Errorf("Expected existing page and merged group under root, got %v", children)
+	}
+	notes, _ := merged.GetChildren(newGroup)
+	if len(notes) != 1 || notes[0].GetIndex() != result.Remapped[note] || notes[0].GetParent() != newGroup {
+		t.Errorf("Merged subtree should be remapped consistently, got %v", notes)
+	}
+}
+
+// TestArchive_Invalid 测试损坏的归档被拒绝且不影响现有记忆
+func TestArchive_Invalid(t *testing.T) {
+	src, srcRoot := newTestSystem(t, t.TempDir())
+	src.createDetailPageInternal(ActorSystem, "Note", "", "hello", srcRoot)
+	var buf bytes.Buffer
+	src.ExportArchive(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	cs, root := newTestSystem(t, t.TempDir())
+	cases := map[string]string{
+		"not an archive": `{"format":"other","version":1}`,
+		"newer version":  strings.Replace(lines[0], `"version":1`, `"version":99`, 1),
+		"truncated":      strings.Join(lines[:len(lines)-1], "\n"),
+		"missing root":   strings.Join(append([]string{strings.Replace(lines[0], `"pages":2`, `"pages":1`, 1), lines[1]}, lines[3:]...), "\n"),
+	}
+	for name, data := range cases {
+		if _, err := cs.ImportArchive(strings.NewReader(data), ImportReplace); err == nil {
+			t.Errorf("%s: expected import to fail", name)
+		}
+	}
+	if _, err := cs.GetPage(root); err != nil {
+		t.Errorf("Existing memory should be untouched: %v", err)
+	}
+}
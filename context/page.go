@@ -15,7 +15,7 @@ const (
 	Active PageLifecycle = iota
 	// HotArchived Page不在上下文窗口内，但祖先Page是Active的，可通过展开恢复
 	HotArchived
-	// ColdArchived Page已脱离上下文系统，需通过外部记忆系统重新注入
+	// ColdArchived Page已从上下文系统驱逐，仅保留在存储中（可被搜索），需通过 RestorePage 重新挂载
 	ColdArchived
 )
 
@@ -72,10 +72,34 @@ type Page interface {
 	GetDescription() string        // 获取Page描述
 	GetLifecycle() PageLifecycle   // 获取生命周期状态
 	GetVisibility() PageVisibility // 获取可见性状态
+	GetCreatedAt() time.Time       // 获取创建时间
+	GetUpdatedAt() time.Time       // 获取更新时间
+	GetAccess() PageAccess         // 获取访问记录
+	GetImportance() float64        // 获取重要性分数
 
 	// 状态变更
 	SetVisibility(visibility PageVisibility) error // 设置可见性（Expanded/Hidden）
 	SetLifecycle(lifecycle PageLifecycle) error    // 设置生命周期状态
+	RecordAccess(kind AccessKind, at time.Time)    // 记录一次访问（不更新 updatedAt）
+	SetImportance(importance float64) error        // 设置重要性分数（0~1）
+
+	// 标签
+	GetTags() map[string]string          // 获取标签（副本）
+	SetTag(key, value string) error      // 设置标签
+	RemoveTag(key string) error          // 删除标签
+
+	// 链接
+	GetLinks() []PageLink                         // 获取指向其他Page的链接（副本）
+	AddLink(target PageIndex, linkType string) error    // 添加链接
+	RemoveLink(target PageIndex, linkType string) error // 删除链接，linkType 为空时删除全部类型
+
+	// 到期
+	GetExpiry() *PageExpiry        // 获取到期设置，未设置返回 nil
+	SetExpiry(expiry *PageExpiry)  // 设置到期设置，nil 表示取消
+
+	// 固定
+	IsPinned() bool             // 是否固定（自动折叠时不会被选中）
+	SetPinned(pinned bool)      // 设置固定标记
 
 	// 父子关系
 	GetParent() PageIndex               // 获取父Page的索引，根Page返回空字符串
@@ -108,6 +132,12 @@ type DetailPage struct {
 	// 元数据
 	createdAt   time.Time // 创建时间
 	updatedAt   time.Time // 更新时间
+	access      PageAccess // 访问记录
+	importance  float64    // 重要性分数
+	tags        map[string]string // 标签
+	links       []PageLink        // 指向其他Page的链接
+	expiry      *PageExpiry       // 到期设置
+	pinned      bool              // 是否固定
 }
 
 // detailPageJSON 用于JSON序列化的内部结构
@@ -122,6 +152,12 @@ type detailPageJSON struct {
 	Detail      string         `json:"detail"`
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
+	Access      PageAccess     `json:"access"`
+	Importance  *float64       `json:"importance,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Links       []PageLink        `json:"links,omitempty"`
+	Expiry      *PageExpiry       `json:"expiry,omitempty"`
+	Pinned      bool              `json:"pinned,omitempty"`
 }
 
 // NewDetailPage 创建新的DetailPage
@@ -139,6 +175,7 @@ func NewDetailPage(name, description, detail string, parentIndex PageIndex) (*De
 		visibility:  Hidden, // 默认只展示description
 		createdAt:   now,
 		updatedAt:   now,
+		importance:  defaultImportance,
 	}, nil
 }
 
@@ -205,6 +242,16 @@ func (p *DetailPage) GetVisibility() PageVisibility {
 	return p.visibility
 }
 
+// GetCreatedAt 获取创建时间
+func (p *DetailPage) GetCreatedAt() time.Time {
+	return p.createdAt
+}
+
+// GetUpdatedAt 获取更新时间
+func (p *DetailPage) GetUpdatedAt() time.Time {
+	return p.updatedAt
+}
+
 // SetDescription 设置描述
 func (p *DetailPage) SetDescription(description string) error {
 	p.description = description
@@ -240,6 +287,12 @@ func (p *DetailPage) Marshal() ([]byte, error) {
 		Detail:      p.detail,
 		CreatedAt:   p.createdAt,
 		UpdatedAt:   p.updatedAt,
+		Access:      p.access,
+		Importance:  &p.importance,
+		Tags:        p.tags,
+		Links:       p.links,
+		Expiry:      p.expiry,
+		Pinned:      p.pinned,
 	}
 	return json.Marshal(data)
 }
@@ -259,6 +312,15 @@ func (p *DetailPage) Unmarshal(data []byte) error {
 	p.detail = jsonData.Detail
 	p.createdAt = jsonData.CreatedAt
 	p.updatedAt = jsonData.UpdatedAt
+	p.access = jsonData.Access
+	p.importance = defaultImportance
+	if jsonData.Importance != nil {
+		p.importance = *jsonData.Importance
+	}
+	p.tags = copyTags(jsonData.Tags)
+	p.links = copyLinks(jsonData.Links)
+	p.expiry = jsonData.Expiry
+	p.pinned = jsonData.Pinned
 	return nil
 }
 
@@ -278,8 +340,14 @@ type ContentsPage struct {
 	children []PageIndex // 子Page索引列表（有序）
 
 	// 元数据
-	createdAt time.Time // 创建时间
-	updatedAt time.Time // 更新时间
+	createdAt  time.Time  // 创建时间
+	updatedAt  time.Time  // 更新时间
+	access     PageAccess // 访问记录
+	importance float64    // 重要性分数
+	tags       map[string]string // 标签
+	links      []PageLink        // 指向其他Page的链接
+	expiry     *PageExpiry       // 到期设置
+	pinned     bool              // 是否固定
 }
 
 // contentsPageJSON 用于JSON序列化的内部结构
@@ -294,6 +362,12 @@ type contentsPageJSON struct {
 	Children    []string       `json:"children"`
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
+	Access      PageAccess     `json:"access"`
+	Importance  *float64       `json:"importance,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Links       []PageLink        `json:"links,omitempty"`
+	Expiry      *PageExpiry       `json:"expiry,omitempty"`
+	Pinned      bool              `json:"pinned,omitempty"`
 }
 
 // NewContentsPage 创建新的ContentsPage
@@ -311,6 +385,7 @@ func NewContentsPage(name, description string, parentIndex PageIndex) (*Contents
 		children:    make([]PageIndex, 0),
 		createdAt:   now,
 		updatedAt:   now,
+		importance:  defaultImportance,
 	}, nil
 }
 
@@ -365,6 +440,16 @@ func (p *ContentsPage) GetVisibility() PageVisibility {
 	return p.visibility
 }
 
+// GetCreatedAt 获取创建时间
+func (p *ContentsPage) GetCreatedAt() time.Time {
+	return p.createdAt
+}
+
+// GetUpdatedAt 获取更新时间
+func (p *ContentsPage) GetUpdatedAt() time.Time {
+	return p.updatedAt
+}
+
 // SetDescription 设置描述
 func (p *ContentsPage) SetDescription(description string) error {
 	p.description = description
@@ -404,6 +489,12 @@ func (p *ContentsPage) Marshal() ([]byte, error) {
 		Children:    children,
 		CreatedAt:   p.createdAt,
 		UpdatedAt:   p.updatedAt,
+		Access:      p.access,
+		Importance:  &p.importance,
+		Tags:        p.tags,
+		Links:       p.links,
+		Expiry:      p.expiry,
+		Pinned:      p.pinned,
 	}
 	return json.Marshal(data)
 }
@@ -426,6 +517,15 @@ func (p *ContentsPage) Unmarshal(data []byte) error {
 	}
 	p.createdAt = jsonData.CreatedAt
 	p.updatedAt = jsonData.UpdatedAt
+	p.access = jsonData.Access
+	p.importance = defaultImportance
+	if jsonData.Importance != nil {
+		p.importance = *jsonData.Importance
+	}
+	p.tags = copyTags(jsonData.Tags)
+	p.links = copyLinks(jsonData.Links)
+	p.expiry = jsonData.Expiry
+	p.pinned = jsonData.Pinned
 	return nil
 }
 
@@ -0,0 +1,212 @@
+package context
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultImportance 未设置时的重要性分数
+const defaultImportance = 0.5
+
+// AccessKind 访问类型
+type AccessKind string
+
+const (
+	// AccessView Page 被 get_page、get_children 或 get_links 读取
+	//
+	// 渲染到上下文中不计为查看：每轮可见的Page都会被渲染，计入后它们的最近访问时间相同，
+	// lru 折叠策略就无法区分。
+	AccessView AccessKind = "view"
+	// AccessExpand Page 被展开
+	AccessExpand AccessKind = "expand"
+	// AccessFind Page 出现在 find_page / recall 的结果中
+	AccessFind AccessKind = "find"
+	// AccessEdit Page 的名称、描述或内容被修改
+	AccessEdit AccessKind = "edit"
+)
+
+// PageAccess Page 的访问记录
+type PageAccess struct {
+	LastViewedAt   time.Time `json:"lastViewedAt"`
+	ViewCount      int       `json:"viewCount"`
+	LastExpandedAt time.Time `json:"lastExpandedAt"`
+	ExpandCount    int       `json:"expandCount"`
+	LastFoundAt    time.Time `json:"lastFoundAt"`
+	FindCount      int       `json:"findCount"`
+	LastEditedAt   time.Time `json:"lastEditedAt"`
+	EditCount      int       `json:"editCount"`
+}
+
+// record 记录一次访问
+func (a *PageAccess) record(kind AccessKind, at time.Time) {
+	switch kind {
+	case AccessView:
+		a.LastViewedAt = at
+		a.ViewCount++
+	case AccessExpand:
+		a.LastExpandedAt = at
+		a.ExpandCount++
+	case AccessFind:
+		a.LastFoundAt = at
+		a.FindCount++
+	case AccessEdit:
+		a.LastEditedAt = at
+		a.EditCount++
+	}
+}
+
+// LastAccessedAt 返回任意类型访问中最近的一次，从未访问时返回零值
+func (a PageAccess) LastAccessedAt() time.Time {
+	latest := a.LastViewedAt
+	for _, t := range []time.Time{a.LastExpandedAt, a.LastFoundAt, a.LastEditedAt} {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// validateImportance 检查重要性分数是否在 [0, 1] 范围内
+func validateImportance(importance float64) error {
+	if importance < 0 || importance > 1 {
+		return fmt.Errorf("importance must be between 0 and 1, got %v", importance)
+	}
+	return nil
+}
+
+// ============ Page 访问记录方法 ============
+
+// GetAccess 获取访问记录
+func (p *DetailPage) GetAccess() PageAccess {
+	return p.access
+}
+
+// RecordAccess 记录一次访问
+func (p *DetailPage) RecordAccess(kind AccessKind, at time.Time) {
+	p.access.record(kind, at)
+}
+
+// GetImportance 获取重要性分数
+func (p *DetailPage) GetImportance() float64 {
+	return p.importance
+}
+
+// SetImportance 设置重要性分数
+func (p *DetailPage) SetImportance(importance float64) error {
+	if err := validateImportance(importance); err != nil {
+		return err
+	}
+	p.importance = importance
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// GetAccess 获取访问记录
+func (p *ContentsPage) GetAccess() PageAccess {
+	return p.access
+}
+
+// RecordAccess 记录一次访问
+func (p *ContentsPage) RecordAccess(kind AccessKind, at time.Time) {
+	p.access.record(kind, at)
+}
+
+// GetImportance 获取重要性分数
+func (p *ContentsPage) GetImportance() float64 {
+	return p.importance
+}
+
+// SetImportance 设置重要性分数
+func (p *ContentsPage) SetImportance(importance float64) error {
+	if err := validateImportance(importance); err != nil {
+		return err
+	}
+	p.importance = importance
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// ============ ContextSystem 访问记录 ============
+
+// recordAccess 记录Page访问
+//
+// 访问记录不是内容修改：不产生修订、不更新索引，也不立即写入存储，
+// 而是记入待持久化集合，由 FlushAccess 批量写入。不存在的 Page 被忽略，不影响触发访问的读操作。
+func (cs *ContextSystem) recordAccess(kind AccessKind, pageIndices ...PageIndex) {
+	if len(pageIndices) == 0 {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := time.Now()
+	for _, pageIndex := range pageIndices {
+		page, err := cs.getPageLocked(pageIndex)
+		if err != nil {
+			continue
+		}
+		page.RecordAccess(kind, now)
+		if cs.storage != nil {
+			cs.accessed[pageIndex] = page
+		}
+	}
+}
+
+// FlushAccess 将尚未持久化的访问记录在同一事务中写入存储（GenerateMessageList 每轮调用一次）
+//
+// 只写入仍在缓存中的同一实例：期间被删除、归档或淘汰的Page跳过，避免旧实例覆盖存储。
+// 写入失败时保留待持久化集合，下次调用时重试。
+func (cs *ContextSystem) FlushAccess() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if len(cs.accessed) == 0 {
+		return nil
+	}
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+	for pageIndex, page := range cs.accessed {
+		if cached, ok := cs.pages.Peek(pageIndex); !ok || cached != page {
+			continue
+		}
+		if err := tx.Save(page); err != nil {
+			tx.Abort()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save page access: %w", err)
+	}
+	cs.accessed = make(map[PageIndex]Page)
+	return nil
+}
+
+// SetImportance 设置Page的重要性分数（系统级操作）
+func (cs *ContextSystem) SetImportance(pageIndex PageIndex, importance float64) error {
+	return cs.setImportanceInternal(ActorSystem, pageIndex, importance)
+}
+
+// setImportanceInternal 设置Page的重要性分数（内部方法）
+func (cs *ContextSystem) setImportanceInternal(actor Actor, pageIndex PageIndex, importance float64) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+
+	if err := page.SetImportance(importance); err != nil {
+		return err
+	}
+
+	// 持久化更新
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			return fmt.Errorf("failed to save page %s: %w", pageIndex, err)
+		}
+	}
+	cs.pageChanged(page, actor, RevisionUpdate)
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package context
+
+import (
+	"fmt"
+	"time"
+)
+
+// ============ 冷归档方法 ============
+
+// ArchivePage 将Page子树移入冷归档层（系统级操作）
+func (cs *ContextSystem) ArchivePage(pageIndex PageIndex) error {
+	return cs.archivePageInternal(ActorSystem, pageIndex)
+}
+
+// RestorePage 将冷归档的Page子树恢复到上下文（系统级操作）
+func (cs *ContextSystem) RestorePage(pageIndex PageIndex, parentIndex PageIndex) error {
+	return cs.restorePageInternal(ActorSystem, pageIndex, parentIndex)
+}
+
+// IsArchived 判断Page是否处于冷归档层
+func (cs *ContextSystem) IsArchived(pageIndex PageIndex) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	return cs.isArchivedLocked(pageIndex)
+}
+
+// isArchivedLocked 判断Page是否处于冷归档层（调用方需持有锁）
+//
+// 冷归档的 Page 不会进入缓存，因此只需检查存储中的生命周期。
+func (cs *ContextSystem) isArchivedLocked(pageIndex PageIndex) bool {
+	if _, exists := cs.pages.Peek(pageIndex); exists {
+		return false
+	}
+	if cs.storage == nil || !cs.storage.Exists(pageIndex) {
+		return false
+	}
+	page, err := cs.loadStoredPage(pageIndex)
+	if err != nil {
+		return false
+	}
+	return page.GetLifecycle() == ColdArchived
+}
+
+// archivePageInternal 将Page子树移入冷归档层（内部方法）
+//
+// 子树中所有 Page 标记为 ColdArchived 并从内存驱逐，根 Page 从父节点的 children 中移除，
+// 但保留 parent 字段以便恢复到原位置。所有写入在同一事务中提交。
+func (cs *ContextSystem) archivePageInternal(actor Actor, pageIndex PageIndex) error {
+	if _, err := cs.GetPage(pageIndex); err != nil {
+		return err
+	}
+	if seg, err := cs.getSegmentByPageIndexInternal(pageIndex); err == nil && seg.GetRootIndex() == pageIndex {
+		return fmt.Errorf("cannot archive segment root page %s", pageIndex)
+	}
+
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	page, err := cs.getPageLocked(pageIndex)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+
+	var parentPage *ContentsPage
+	if page.GetParent() != "" {
+		parent, err := cs.getPageLocked(page.GetParent())
+		if err != nil {
+			tx.Abort()
+			return fmt.Errorf("parent page %s not found", page.GetParent())
+		}
+		var ok bool
+		if parentPage, ok = parent.(*ContentsPage); !ok {
+			tx.Abort()
+			return fmt.Errorf("parent page %s is not a ContentsPage", page.GetParent())
+		}
+	}
+
+	subtree, err := cs.subtreePages(pageIndex)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+
+	// 标记子树为冷归档并暂存
+	oldLifecycles := make([]PageLifecycle, len(subtree))
+	rollback := func() {
+		for i, p := range subtree {
+			p.SetLifecycle(oldLifecycles[i])
+		}
+	}
+	for i, p := range subtree {
+		oldLifecycles[i] = p.GetLifecycle()
+		p.SetLifecycle(ColdArchived)
+		if err := tx.Save(p); err != nil {
+			rollback()
+			tx.Abort()
+			return err
+		}
+	}
+
+	// 从父节点摘除
+	childPos := -1
+	if parentPage != nil {
+		childPos = indexOfChild(parentPage, pageIndex)
+		parentPage.RemoveChild(pageIndex)
+		if err := tx.Save(parentPage); err != nil {
+			insertChildAt(parentPage, pageIndex, childPos)
+			rollback()
+			tx.Abort()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		if parentPage != nil {
+			insertChildAt(parentPage, pageIndex, childPos)
+		}
+		rollback()
+		return fmt.Errorf("failed to archive page %s: %w", pageIndex, err)
+	}
+
+	// 从内存驱逐，仍保留在存储中可被搜索
+	for _, p := range subtree {
+		cs.pages.Remove(p.GetIndex())
+		cs.pageChanged(p, actor, RevisionArchive)
+	}
+	if parentPage != nil {
+		cs.pageChanged(parentPage, actor, RevisionUpdate)
+	}
+	cs.updatedAt = time.Now()
+
+	return nil
+}
+
+// restorePageInternal 将冷归档的Page子树恢复到上下文（内部方法）
+//
+// parentIndex 为空时恢复到归档前的父节点。若 Page 是某个归档子树中的子节点，
+// 会同时从归档父节点的 children 中摘除。所有写入在同一事务中提交。
+func (cs *ContextSystem) restorePageInternal(actor Actor, pageIndex PageIndex, parentIndex PageIndex) error {
+	if cs.storage == nil {
+		return fmt.Errorf("no storage configured")
+	}
+
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if !cs.isArchivedLocked(pageIndex) {
+		tx.Abort()
+		return fmt.Errorf("page %s is not archived", pageIndex)
+	}
+	subtree, err := cs.subtreePages(pageIndex)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+	page := subtree[0]
+
+	// 确定目标父节点
+	originalParent := page.GetParent()
+	if parentIndex == "" {
+		parentIndex = originalParent
+	}
+	if parentIndex == "" {
+		tx.Abort()
+		return fmt.Errorf("page %s has no original parent, a parent must be given", pageIndex)
+	}
+	if cs.isArchivedLocked(parentIndex) {
+		tx.Abort()
+		return fmt.Errorf("parent page %s is archived", parentIndex)
+	}
+	parent, err := cs.getPageLocked(parentIndex)
+	if err != nil {
+		tx.Abort()
+		return fmt.Errorf("parent page %s not found", parentIndex)
+	}
+	parentPage, ok := parent.(*ContentsPage)
+	if !ok {
+		tx.Abort()
+		return fmt.Errorf("parent page %s is not a ContentsPage", parentIndex)
+	}
+	// 索引前缀决定 Page 所属 Segment，挂到其他 Segment 的树下会破坏树的完整性
+	if cs.segmentOfLocked(pageIndex) != cs.segmentOfLocked(parentIndex) {
+		tx.Abort()
+		return fmt.Errorf("parent page %s is in a different segment than page %s", parentIndex, pageIndex)
+	}
+	// 恢复的固定Page重新计入固定预算
+	if err := cs.checkPinnedBudgetLocked(nil, cs.pinnedCostLocked(subtree)); err != nil {
+		tx.Abort()
+		return fmt.Errorf("cannot restore page %s: %w", pageIndex, err)
+	}
+
+	// 从归档中的原父节点摘除
+	if originalParent != "" && cs.isArchivedLocked(originalParent) {
+		archivedParent, err := cs.loadStoredPage(originalParent)
+		if err != nil {
+			tx.Abort()
+			return fmt.Errorf("failed to load archived parent %s: %w", originalParent, err)
+		}
+		if contentsPage, ok := archivedParent.(*ContentsPage); ok && contentsPage.HasChild(pageIndex) {
+			contentsPage.RemoveChild(pageIndex)
+			if err := tx.Save(contentsPage); err != nil {
+				tx.Abort()
+				return err
+			}
+		}
+	}
+
+	// 恢复子树为 Active 并挂到目标父节点
+	for _, p := range subtree {
+		p.SetLifecycle(Active)
+	}
+	page.SetParent(parentIndex)
+	for _, p := range subtree {
+		if err := tx.Save(p); err != nil {
+			tx.Abort()
+			return err
+		}
+	}
+	if err := parentPage.AddChild(pageIndex); err != nil {
+		tx.Abort()
+		return err
+	}
+	if err := tx.Save(parentPage); err != nil {
+		parentPage.RemoveChild(pageIndex)
+		tx.Abort()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		parentPage.RemoveChild(pageIndex)
+		return fmt.Errorf("failed to restore page %s: %w", pageIndex, err)
+	}
+
+	for _, p := range subtree {
+		cs.pages.Put(p)
+		cs.pageChanged(p, actor, RevisionRestore)
+	}
+	cs.pageChanged(parentPage, actor, RevisionUpdate)
+	cs.updatedAt = time.Now()
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package context
+
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultPageCacheSize 默认Page缓存容量
+const defaultPageCacheSize = 1024
+
+// pageCache Page 内存缓存（LRU）
+//
+// capacity <= 0 表示不限容量。超出容量时淘汰最久未访问的 Page，
+// 被淘汰的 Page 仍保留在存储中，下次访问时由 ContextSystem 重新加载。
+// 缓存内部有独立的锁，读路径（持有 ContextSystem 读锁）也可以安全地更新访问顺序。
+type pageCache struct {
+	capacity int
+	entries  map[PageIndex]*list.Element
+	order    *list.List // 队首为最近访问
+	mu       sync.Mutex
+}
+
+// newPageCache 创建指定容量的Page缓存
+func newPageCache(capacity int) *pageCache {
+	return &pageCache{
+		capacity: capacity,
+		entries:  make(map[PageIndex]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get 获取Page并标记为最近访问
+func (c *pageCache) Get(pageIndex PageIndex) (Page, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[pageIndex]
+	if !exists {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(Page), true
+}
+
+// Peek 获取Page但不影响访问顺序
+func (c *pageCache) Peek(pageIndex PageIndex) (Page, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[pageIndex]
+	if !exists {
+		return nil, false
+	}
+	return elem.Value.(Page), true
+}
+
+// Put 放入Page，超出容量时淘汰最久未访问的Page
+func (c *pageCache) Put(page Page) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pageIndex := page.GetIndex()
+	if elem, exists := c.entries[pageIndex]; exists {
+		elem.Value = page
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[pageIndex] = c.order.PushFront(page)
+
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(Page).GetIndex())
+	}
+}
+
+// Remove 移除Page
+func (c *pageCache) Remove(pageIndex PageIndex) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[pageIndex]
+	if !exists {
+		return false
+	}
+	c.order.Remove(elem)
+	delete(c.entries, pageIndex)
+	return true
+}
+
+// Len 返回缓存中的Page数量
+func (c *pageCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// Pages 返回缓存中的所有Page（按最近访问顺序）
+func (c *pageCache) Pages() []Page {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pages := make([]Page, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		pages = append(pages, elem.Value.(Page))
+	}
+	return pages
+}
+
+// SetCapacity 调整容量，缩小时立即淘汰多余的Page
+func (c *pageCache) SetCapacity(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	for c.capacity > 0 && c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(Page).GetIndex())
+	}
+}
@@ -0,0 +1,468 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExpiryAction Page到期后执行的动作
+type ExpiryAction string
+
+const (
+	ExpireHide    ExpiryAction = "hide"    // 隐藏详情
+	ExpireArchive ExpiryAction = "archive" // 移入冷归档
+	ExpireRemove  ExpiryAction = "remove"  // 删除Page子树
+)
+
+// maxExpiryLog 保留的最近到期记录数
+const maxExpiryLog = 100
+
+// 到期动作失败后的重试间隔，每次失败翻倍，不超过上限
+const (
+	expiryRetryDelay    = time.Minute
+	maxExpiryRetryDelay = time.Hour
+)
+
+// PageExpiry Page的到期时间和到期动作
+type PageExpiry struct {
+	At     time.Time    `json:"at"`
+	Action ExpiryAction `json:"action"`
+}
+
+// ExpiryTransition 一次到期处理的记录
+type ExpiryTransition struct {
+	Page      PageIndex
+	Name      string
+	Action    ExpiryAction
+	ExpiresAt time.Time
+	SweptAt   time.Time
+	Err       error // 动作执行失败的原因，成功为 nil
+}
+
+// String 返回到期记录的单行描述
+func (t ExpiryTransition) String() string {
+	text := fmt.Sprintf("[%s] %s %s (expired at %s)", t.Page, t.Name, t.Action, t.ExpiresAt.Format("2006-01-02 15:04:05"))
+	if t.Err != nil {
+		text += fmt.Sprintf(" failed: %v", t.Err)
+	}
+	return text
+}
+
+// ParseExpiryAction 解析到期动作，空字符串表示 hide
+func ParseExpiryAction(action string) (ExpiryAction, error) {
+	switch ExpiryAction(action) {
+	case "", ExpireHide:
+		return ExpireHide, nil
+	case ExpireArchive, ExpireRemove:
+		return ExpiryAction(action), nil
+	default:
+		return "", fmt.Errorf("unknown expiry action %q (expected hide, archive or remove)", action)
+	}
+}
+
+// expiryTimeLayouts 支持的绝对到期时间格式（本地时区）
+var expiryTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseExpiryTime 解析到期时间
+//
+// 支持相对时长（如 "30m"、"48h"、"7d"，相对于 now）和绝对时间
+// （RFC3339、"2006-01-02 15:04:05"、"2006-01-02 15:04"、"2006-01-02"，按本地时区）。
+func ParseExpiryTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("expiry time cannot be empty")
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	for _, layout := range expiryTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry time %q", value)
+}
+
+// ============ Page 到期方法 ============
+
+// GetExpiry 获取到期设置，未设置返回 nil
+func (p *DetailPage) GetExpiry() *PageExpiry {
+	return copyExpiry(p.expiry)
+}
+
+// SetExpiry 设置到期时间和动作，nil 表示取消
+func (p *DetailPage) SetExpiry(expiry *PageExpiry) {
+	p.expiry = copyExpiry(expiry)
+	p.updatedAt = time.Now()
+}
+
+// GetExpiry 获取到期设置，未设置返回 nil
+func (p *ContentsPage) GetExpiry() *PageExpiry {
+	return copyExpiry(p.expiry)
+}
+
+// SetExpiry 设置到期时间和动作，nil 表示取消
+func (p *ContentsPage) SetExpiry(expiry *PageExpiry) {
+	p.expiry = copyExpiry(expiry)
+	p.updatedAt = time.Now()
+}
+
+// copyExpiry 复制到期设置
+func copyExpiry(expiry *PageExpiry) *PageExpiry {
+	if expiry == nil {
+		return nil
+	}
+	copied := *expiry
+	return &copied
+}
+
+// ============ 到期索引 ============
+
+// expiryIndex 设置了到期时间的Page
+//
+// 与全文索引相同，在首次清扫时从存储构建，此后随每次 Page 变更增量维护，
+// 清扫时无需遍历全部Page。动作执行失败的Page按退避间隔重试，
+// 到期设置被修改或清除时失败记录随之清除。
+type expiryIndex struct {
+	pending  map[PageIndex]PageExpiry
+	failures map[PageIndex]expiryFailure
+	built    bool
+	mu       sync.Mutex
+}
+
+// expiryFailure 到期动作的失败记录
+type expiryFailure struct {
+	expiry  PageExpiry    // 失败时的到期设置
+	retryAt time.Time     // 下次重试时间
+	delay   time.Duration // 当前退避间隔
+}
+
+// newExpiryIndex 创建空的到期索引
+func newExpiryIndex() *expiryIndex {
+	return &expiryIndex{
+		pending:  make(map[PageIndex]PageExpiry),
+		failures: make(map[PageIndex]expiryFailure),
+	}
+}
+
+// beginBuild 索引尚未构建时加锁并返回 true，之后由 buildPage 逐个加入Page，endBuild 完成构建并解锁
+func (idx *expiryIndex) beginBuild() bool {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// buildPage 构建期间加入Page（beginBuild 已加锁）
+func (idx *expiryIndex) buildPage(page Page) {
+	if expiry := page.GetExpiry(); expiry != nil {
+		idx.pending[page.GetIndex()] = *expiry
+	}
+}
+
+// endBuild 标记索引已构建并解锁
+func (idx *expiryIndex) endBuild() {
+	idx.built = true
+	idx.mu.Unlock()
+}
+
+// reset 清空索引，下次清扫时重新构建
+func (idx *expiryIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.pending = make(map[PageIndex]PageExpiry)
+	idx.failures = make(map[PageIndex]expiryFailure)
+	idx.built = false
+}
+
+// Update 更新Page的到期设置（索引尚未构建时忽略）
+func (idx *expiryIndex) Update(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+	pageIndex := page.GetIndex()
+	expiry := page.GetExpiry()
+	if failure, ok := idx.failures[pageIndex]; ok && (expiry == nil || *expiry != failure.expiry) {
+		delete(idx.failures, pageIndex)
+	}
+	if expiry != nil {
+		idx.pending[pageIndex] = *expiry
+	} else {
+		delete(idx.pending, pageIndex)
+	}
+}
+
+// Remove 从索引移除Page
+func (idx *expiryIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.pending, pageIndex)
+	delete(idx.failures, pageIndex)
+}
+
+// Fail 记录Page到期动作失败并推迟重试，返回是否为该到期设置的首次失败
+func (idx *expiryIndex) Fail(pageIndex PageIndex, now time.Time) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	expiry, ok := idx.pending[pageIndex]
+	if !ok {
+		return true
+	}
+	failure, failed := idx.failures[pageIndex]
+	if !failed || failure.expiry != expiry {
+		failure = expiryFailure{expiry: expiry, delay: expiryRetryDelay}
+		failed = false
+	} else {
+		failure.delay = min(failure.delay*2, maxExpiryRetryDelay)
+	}
+	failure.retryAt = now.Add(failure.delay)
+	idx.failures[pageIndex] = failure
+	return !failed
+}
+
+// Due 返回到期时间不晚于 now 的Page，按到期时间排序
+func (idx *expiryIndex) Due(now time.Time) []PageIndex {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var due []PageIndex
+	for pageIndex, expiry := range idx.pending {
+		if failure, ok := idx.failures[pageIndex]; ok && failure.retryAt.After(now) {
+			continue
+		}
+		if !expiry.At.After(now) {
+			due = append(due, pageIndex)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := idx.pending[due[i]].At, idx.pending[due[j]].At
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return due[i] < due[j]
+	})
+	return due
+}
+
+// ============ ContextSystem 到期操作 ============
+
+// SetExpiry 设置Page的到期时间和动作（系统级操作）
+func (cs *ContextSystem) SetExpiry(pageIndex PageIndex, at time.Time, action ExpiryAction) error {
+	return cs.setExpiryInternal(ActorSystem, pageIndex, at, action)
+}
+
+// ClearExpiry 取消Page的到期设置（系统级操作）
+func (cs *ContextSystem) ClearExpiry(pageIndex PageIndex) error {
+	return cs.clearExpiryInternal(ActorSystem, pageIndex)
+}
+
+// SetExpiryHandler 设置到期处理的回调，每条到期记录在动作执行后调用一次（用于记录日志）
+func (cs *ContextSystem) SetExpiryHandler(handler func(ExpiryTransition)) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.onExpire = handler
+}
+
+// setExpiryInternal 设置Page的到期时间和动作（内部方法）
+//
+// Segment 根页面不能设置 archive / remove 动作。到期时间已过的设置在下次清扫时执行。
+func (cs *ContextSystem) setExpiryInternal(actor Actor, pageIndex PageIndex, at time.Time, action ExpiryAction) error {
+	if _, err := ParseExpiryAction(string(action)); err != nil {
+		return err
+	}
+	if at.IsZero() {
+		return fmt.Errorf("expiry time cannot be empty")
+	}
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	if action != ExpireHide {
+		if seg, err := cs.getSegmentByPageIndexInternal(pageIndex); err == nil && seg.GetRootIndex() == pageIndex {
+			return fmt.Errorf("cannot %s segment root page %s on expiry", action, pageIndex)
+		}
+	}
+
+	old := page.GetExpiry()
+	page.SetExpiry(&PageExpiry{At: at, Action: action})
+	return cs.saveExpiryPage(actor, page, old)
+}
+
+// clearExpiryInternal 取消Page的到期设置（内部方法）
+func (cs *ContextSystem) clearExpiryInternal(actor Actor, pageIndex PageIndex) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	if page.GetExpiry() == nil {
+		return fmt.Errorf("page %s has no expiry", pageIndex)
+	}
+	old := page.GetExpiry()
+	page.SetExpiry(nil)
+	return cs.saveExpiryPage(actor, page, old)
+}
+
+// saveExpiryPage 持久化到期设置并记录修订，保存失败时恢复为 old
+func (cs *ContextSystem) saveExpiryPage(actor Actor, page Page, old *PageExpiry) error {
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			page.SetExpiry(old)
+			return fmt.Errorf("failed to save page %s: %w", page.GetIndex(), err)
+		}
+	}
+	cs.pageChanged(page, actor, RevisionUpdate)
+	return nil
+}
+
+// SweepExpired 执行到期时间不晚于 now 的Page的到期动作，返回本次处理的记录
+//
+// 动作以系统身份执行并清除到期设置；执行失败的Page保留到期设置，按退避间隔重试，
+// 同一到期设置的失败只记录一次。冷归档的Page只执行 remove，其余动作直接清除到期设置。
+func (cs *ContextSystem) SweepExpired(now time.Time) []ExpiryTransition {
+	cs.mu.RLock()
+	cs.buildIndexesLocked()
+	handler := cs.onExpire
+	cs.mu.RUnlock()
+
+	var transitions []ExpiryTransition
+	for _, pageIndex := range cs.expiries.Due(now) {
+		transition, ok := cs.applyExpiry(pageIndex, now)
+		if !ok {
+			continue
+		}
+		if transition.Err != nil && !cs.expiries.Fail(pageIndex, now) {
+			continue
+		}
+		transitions = append(transitions, transition)
+	}
+
+	if len(transitions) > 0 {
+		cs.mu.Lock()
+		cs.expiryLog = append(cs.expiryLog, transitions...)
+		if len(cs.expiryLog) > maxExpiryLog {
+			cs.expiryLog = cs.expiryLog[len(cs.expiryLog)-maxExpiryLog:]
+		}
+		cs.mu.Unlock()
+	}
+	if handler != nil {
+		for _, transition := range transitions {
+			handler(transition)
+		}
+	}
+	return transitions
+}
+
+// applyExpiry 执行单个Page的到期动作，Page已不存在时返回 false
+func (cs *ContextSystem) applyExpiry(pageIndex PageIndex, now time.Time) (ExpiryTransition, bool) {
+	cs.mu.RLock()
+	page, archived, err := cs.peekPageLocked(pageIndex)
+	cs.mu.RUnlock()
+	if err != nil {
+		// 已随祖先一起删除
+		cs.expiries.Remove(pageIndex)
+		return ExpiryTransition{}, false
+	}
+	if !archived {
+		// 使用缓存中的实例，动作方法修改的是同一个Page
+		if page, err = cs.GetPage(pageIndex); err != nil {
+			return ExpiryTransition{}, false
+		}
+	}
+	expiry := page.GetExpiry()
+	if expiry == nil || expiry.At.After(now) {
+		cs.expiries.Update(page)
+		return ExpiryTransition{}, false
+	}
+
+	transition := ExpiryTransition{
+		Page:      pageIndex,
+		Name:      page.GetName(),
+		Action:    expiry.Action,
+		ExpiresAt: expiry.At,
+		SweptAt:   now,
+	}
+
+	if expiry.Action == ExpireRemove {
+		transition.Err = cs.removePageInternal(ActorSystem, pageIndex)
+		return transition, true
+	}
+
+	// hide / archive 先清除到期设置，随动作一起持久化；失败时恢复
+	page.SetExpiry(nil)
+	switch {
+	case archived:
+		// 冷归档的Page已不在上下文中，只需清除到期设置
+		transition.Err = cs.saveArchivedPage(page)
+	case expiry.Action == ExpireHide:
+		transition.Err = cs.hideDetailsInternal(ActorSystem, pageIndex)
+	case expiry.Action == ExpireArchive:
+		transition.Err = cs.archivePageInternal(ActorSystem, pageIndex)
+	}
+	if transition.Err != nil {
+		page.SetExpiry(expiry)
+	}
+	return transition, true
+}
+
+// peekPageLocked 获取Page（包括冷归档的Page，不放入缓存），返回是否处于冷归档（调用方需持有锁）
+func (cs *ContextSystem) peekPageLocked(pageIndex PageIndex) (Page, bool, error) {
+	if page, exists := cs.pages.Peek(pageIndex); exists {
+		return page, false, nil
+	}
+	if cs.storage == nil || !cs.storage.Exists(pageIndex) {
+		return nil, false, fmt.Errorf("page %s not found", pageIndex)
+	}
+	page, err := cs.loadStoredPage(pageIndex)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load page %s: %w", pageIndex, err)
+	}
+	return page, page.GetLifecycle() == ColdArchived, nil
+}
+
+// saveArchivedPage 持久化冷归档的Page（不放入缓存）
+func (cs *ContextSystem) saveArchivedPage(page Page) error {
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			return fmt.Errorf("failed to save page %s: %w", page.GetIndex(), err)
+		}
+	}
+	cs.expiries.Update(page)
+	return nil
+}
+
+// ExpiryLog 返回 SweptAt 不早于 since 的最近到期记录
+func (cs *ContextSystem) ExpiryLog(since time.Time) []ExpiryTransition {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	var log []ExpiryTransition
+	for _, transition := range cs.expiryLog {
+		if !transition.SweptAt.Before(since) {
+			log = append(log, transition)
+		}
+	}
+	return log
+}
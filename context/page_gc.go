@@ -0,0 +1,170 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ============ 删除预览 ============
+
+// RemovalPreview 删除Page前的影响预览
+type RemovalPreview struct {
+	Root      PageIndex
+	Pages     []PageIndex // 子树中的全部Page，根Page位于首位
+	Tokens    int         // 子树中Page名称、描述和详情的估算token数
+	Pinned    []PageIndex // 子树中固定的Page
+	Backlinks []Backlink  // 子树外指向子树的链接，删除时会被清理
+	Archive   bool        // 删除时改为冷归档（archive_on_remove）
+}
+
+// Descendants 返回将被一并删除的后代Page数
+func (p *RemovalPreview) Descendants() int {
+	return len(p.Pages) - 1
+}
+
+// PreviewRemove 预览删除Page的影响，不做任何修改
+func (cs *ContextSystem) PreviewRemove(pageIndex PageIndex) (*RemovalPreview, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	subtree, err := cs.subtreePages(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &RemovalPreview{
+		Root:    pageIndex,
+		Archive: cs.archivesOnRemoveLocked(pageIndex),
+	}
+	inSubtree := make(map[PageIndex]bool, len(subtree))
+	for _, page := range subtree {
+		inSubtree[page.GetIndex()] = true
+	}
+	cs.buildIndexesLocked()
+	for _, page := range subtree {
+		preview.Pages = append(preview.Pages, page.GetIndex())
+		preview.Tokens += cs.pageCost(page)
+		if page.IsPinned() {
+			preview.Pinned = append(preview.Pinned, page.GetIndex())
+		}
+		for _, backlink := range cs.links.Backlinks(page.GetIndex()) {
+			if !inSubtree[backlink.Source] {
+				preview.Backlinks = append(preview.Backlinks, backlink)
+			}
+		}
+	}
+	return preview, nil
+}
+
+// ============ 垃圾回收 ============
+
+// GCReport 垃圾回收的结果
+type GCReport struct {
+	CheckedAt time.Time
+	Pages     int         // 检查的Page数（包括冷归档）
+	Garbage   []PageIndex // 无法从任何Segment根Page到达的Page，按索引排序
+	Tokens    int         // 垃圾Page的估算token数
+	DryRun    bool        // 是否只预览，不删除
+}
+
+// CollectGarbage 标记-清除：删除无法从任何Segment根Page到达的Page，dryRun 为 true 时只返回待删除的Page
+//
+// 父子引用任一方向相连即视为可达，冷归档子树（根Page只保留 parent 引用）不会被回收。
+// 孤立的Page和脱离根的环也会被回收，需要保留时应先执行 Repair 将其挂回 Segment 根Page。
+func (cs *ContextSystem) CollectGarbage(dryRun bool) (*GCReport, error) {
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// 1. 标记
+	pages := cs.listAllPagesLocked()
+	reachable := markReachable(cs.segments, pages)
+	report := &GCReport{CheckedAt: time.Now(), Pages: len(pages), DryRun: dryRun}
+	var garbage []Page
+	for _, page := range pages {
+		if !reachable[page.GetIndex()] {
+			garbage = append(garbage, page)
+			report.Garbage = append(report.Garbage, page.GetIndex())
+			report.Tokens += cs.pageCost(page)
+		}
+	}
+	sort.Slice(report.Garbage, func(i, j int) bool { return report.Garbage[i] < report.Garbage[j] })
+	if dryRun || len(garbage) == 0 {
+		tx.Abort()
+		return report, nil
+	}
+
+	// 2. 清除：删除垃圾Page，并清理可达Page中指向它们的链接
+	removed := make(map[PageIndex]bool, len(garbage))
+	for _, page := range garbage {
+		removed[page.GetIndex()] = true
+		if err := tx.Delete(page.GetIndex()); err != nil {
+			tx.Abort()
+			return nil, err
+		}
+	}
+	cleaned, err := cs.cleanupLinksLocked(removed)
+	if err != nil {
+		tx.Abort()
+		return nil, err
+	}
+	for _, c := range cleaned {
+		if err := tx.Save(c.page); err != nil {
+			rollbackLinkCleanup(cleaned)
+			tx.Abort()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		rollbackLinkCleanup(cleaned)
+		return nil, fmt.Errorf("failed to delete unreachable pages: %w", err)
+	}
+	for _, page := range garbage {
+		cs.pageChanged(page, ActorSystem, RevisionRemove)
+		cs.pages.Remove(page.GetIndex())
+	}
+	for _, c := range cleaned {
+		cs.pageChanged(c.page, ActorSystem, RevisionUpdate)
+	}
+	cs.updatedAt = time.Now()
+	return report, nil
+}
+
+// markReachable 从各Segment根Page出发，沿 children 和 parent 引用标记可达的Page
+func markReachable(segments []*Segment, pages []Page) map[PageIndex]bool {
+	edges := make(map[PageIndex][]PageIndex)
+	for _, page := range pages {
+		if parent := page.GetParent(); parent != "" {
+			edges[parent] = append(edges[parent], page.GetIndex())
+		}
+		if contentsPage, ok := page.(*ContentsPage); ok {
+			edges[page.GetIndex()] = append(edges[page.GetIndex()], contentsPage.GetChildren()...)
+		}
+	}
+
+	reachable := make(map[PageIndex]bool, len(pages))
+	var queue []PageIndex
+	for _, seg := range segments {
+		if root := seg.GetRootIndex(); root != "" && !reachable[root] {
+			reachable[root] = true
+			queue = append(queue, root)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[current] {
+			if !reachable[next] {
+				reachable[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return reachable
+}
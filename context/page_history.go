@@ -0,0 +1,228 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actor 修订的操作者
+type Actor string
+
+const (
+	// ActorAgent Agent 通过工具发起的修改
+	ActorAgent Actor = "agent"
+	// ActorSystem 系统代码发起的修改（初始化、自动折叠等）
+	ActorSystem Actor = "system"
+)
+
+// 修订操作类型
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionExpand  = "expand"
+	RevisionHide    = "hide"
+	RevisionMove    = "move"
+	RevisionRemove  = "remove"
+	RevisionRevert  = "revert"
+	RevisionArchive = "archive"
+	RevisionRestore = "restore"
+)
+
+// PageRevision Page 的一次修订记录
+//
+// Snapshot 保存本次修改之后的 Page 序列化数据（remove 时为删除前的数据），
+// 修订号在每个 Page 内从 1 开始递增。
+type PageRevision struct {
+	Index     PageIndex       `json:"index"`
+	Revision  int             `json:"revision"`
+	Actor     Actor           `json:"actor"`
+	Operation string          `json:"operation"`
+	Timestamp time.Time       `json:"timestamp"`
+	Snapshot  json.RawMessage `json:"snapshot"`
+}
+
+// Page 返回修订快照对应的 Page
+func (r *PageRevision) Page() (Page, error) {
+	if len(r.Snapshot) == 0 {
+		return nil, fmt.Errorf("revision %d of %s has no snapshot", r.Revision, r.Index)
+	}
+	return unmarshalPage(r.Snapshot)
+}
+
+// ============ ContextSystem 修订记录 ============
+
+// recordRevision 记录Page修订
+//
+// 在变更提交之后调用，尽力而为：历史写入失败不回滚已提交的变更。
+// 展开/隐藏（包括自动折叠）只改变可见性，每轮都可能发生，不记录修订，避免历史无限增长。
+func (cs *ContextSystem) recordRevision(page Page, actor Actor, operation string) {
+	if cs.storage == nil || page == nil {
+		return
+	}
+	if operation == RevisionExpand || operation == RevisionHide {
+		return
+	}
+	snapshot, err := page.Marshal()
+	if err != nil {
+		return
+	}
+
+	cs.historyMu.Lock()
+	defer cs.historyMu.Unlock()
+
+	pageIndex := page.GetIndex()
+	count, known := cs.revisionCounts[pageIndex]
+	if !known {
+		revisions, err := cs.storage.ListRevisions(pageIndex)
+		if err != nil {
+			return
+		}
+		count = len(revisions)
+	}
+
+	rev := &PageRevision{
+		Index:     pageIndex,
+		Revision:  count + 1,
+		Actor:     actor,
+		Operation: operation,
+		Timestamp: time.Now(),
+		Snapshot:  snapshot,
+	}
+	if err := cs.storage.AppendRevision(rev); err != nil {
+		return
+	}
+	cs.revisionCounts[pageIndex] = rev.Revision
+}
+
+// GetPageHistory 获取Page的修订历史（按修订号升序）
+func (cs *ContextSystem) GetPageHistory(pageIndex PageIndex) ([]*PageRevision, error) {
+	if cs.storage == nil {
+		return nil, fmt.Errorf("no storage configured")
+	}
+
+	cs.historyMu.Lock()
+	defer cs.historyMu.Unlock()
+
+	return cs.storage.ListRevisions(pageIndex)
+}
+
+// revertPageInternal 将Page回滚到指定修订（内部方法）
+//
+// 恢复名称、描述和 detail；若修订时的父节点与当前不同且仍存在，则移动回原父节点。
+// 可见性和 children 列表不回滚，回滚本身作为一次新修订记录。
+func (cs *ContextSystem) revertPageInternal(actor Actor, pageIndex PageIndex, revision int) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := cs.GetPageHistory(pageIndex)
+	if err != nil {
+		return err
+	}
+	var target *PageRevision
+	for _, rev := range revisions {
+		if rev.Revision == revision {
+			target = rev
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("revision %d of page %s not found", revision, pageIndex)
+	}
+
+	old, err := target.Page()
+	if err != nil {
+		return err
+	}
+
+	// 先校验并恢复内容（类型、名称、描述），此时尚未写入任何存储
+	restore, err := revertContent(page, old)
+	if err != nil {
+		return fmt.Errorf("revision %d of page %s: %w", revision, pageIndex, err)
+	}
+	page.RecordAccess(AccessEdit, time.Now())
+
+	// 父节点移动和内容修改在同一事务中提交
+	tx, err := cs.beginTransaction()
+	if err != nil {
+		restore()
+		return err
+	}
+	rollback := restore
+	if oldParent := old.GetParent(); oldParent != "" && oldParent != page.GetParent() {
+		if _, err := cs.GetPage(oldParent); err == nil {
+			_, undoMove, err := cs.stageMove(tx, pageIndex, oldParent)
+			if err != nil {
+				tx.Abort()
+				restore()
+				return fmt.Errorf("failed to restore parent %s: %w", oldParent, err)
+			}
+			rollback = func() {
+				undoMove()
+				restore()
+			}
+		}
+	}
+
+	// 固定的Page回滚后不能超出固定预算
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err := cs.checkPinnedChangeLocked(page); err != nil {
+		tx.Abort()
+		rollback()
+		return err
+	}
+	if err := tx.Save(page); err != nil {
+		tx.Abort()
+		rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		rollback()
+		return fmt.Errorf("failed to save page %s: %w", pageIndex, err)
+	}
+	cs.pageChanged(page, actor, RevisionRevert)
+	return nil
+}
+
+// revertContent 将修订中的名称、描述、detail 和标签写入 page
+//
+// 修订与当前Page类型不同或名称、描述无效时返回错误且不修改 page；
+// 成功时返回恢复修改前内容的函数。
+func revertContent(page, old Page) (func(), error) {
+	detailPage, isDetail := page.(*DetailPage)
+	oldDetailPage, oldIsDetail := old.(*DetailPage)
+	if isDetail != oldIsDetail {
+		return nil, fmt.Errorf("page type changed since this revision")
+	}
+
+	name, description, tags := page.GetName(), page.GetDescription(), page.GetTags()
+	var detail string
+	if isDetail {
+		detail = detailPage.GetDetail()
+	}
+	restore := func() {
+		page.SetName(name)
+		page.SetDescription(description)
+		replaceTags(page, tags)
+		if isDetail {
+			detailPage.SetDetail(detail)
+		}
+	}
+
+	if err := page.SetName(old.GetName()); err != nil {
+		restore()
+		return nil, err
+	}
+	if err := page.SetDescription(old.GetDescription()); err != nil {
+		restore()
+		return nil, err
+	}
+	if isDetail {
+		detailPage.SetDetail(oldDetailPage.GetDetail())
+	}
+	replaceTags(page, old.GetTags())
+	return restore, nil
+}
@@ -0,0 +1,379 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLinkType 未指定类型时的链接类型
+const defaultLinkType = "related"
+
+// PageLink 从当前 Page 指向另一个 Page 的有类型链接（可跨 Segment）
+//
+// 链接保存在源 Page 上，反向链接由 linkIndex 计算。
+type PageLink struct {
+	Target PageIndex `json:"target"`
+	Type   string    `json:"type"`
+}
+
+// Backlink 指向当前 Page 的链接
+type Backlink struct {
+	Source PageIndex
+	Type   string
+}
+
+// validateLinkType 检查链接类型是否合法（不能为空，不能包含空白和渲染时使用的分隔符）
+func validateLinkType(linkType string) error {
+	if linkType == "" {
+		return fmt.Errorf("link type cannot be empty")
+	}
+	if len(linkType) > maxTagLength {
+		return fmt.Errorf("link type must be at most %d bytes", maxTagLength)
+	}
+	if strings.ContainsAny(linkType, " \t\r\n:,;") {
+		return fmt.Errorf("link type %q cannot contain whitespace or any of : , ;", linkType)
+	}
+	return nil
+}
+
+// addLink 添加链接到列表，重复的链接返回错误
+func addLink(links []PageLink, target PageIndex, linkType string) ([]PageLink, error) {
+	if err := validateLinkType(linkType); err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if link.Target == target && link.Type == linkType {
+			return nil, fmt.Errorf("link %s -> %s already exists", linkType, target)
+		}
+	}
+	return append(links, PageLink{Target: target, Type: linkType}), nil
+}
+
+// removeLink 从列表删除链接，linkType 为空时删除指向 target 的全部链接
+func removeLink(links []PageLink, target PageIndex, linkType string) ([]PageLink, bool) {
+	kept := links[:0:0]
+	for _, link := range links {
+		if link.Target == target && (linkType == "" || link.Type == linkType) {
+			continue
+		}
+		kept = append(kept, link)
+	}
+	return kept, len(kept) != len(links)
+}
+
+// copyLinks 复制链接列表，空列表返回 nil
+func copyLinks(links []PageLink) []PageLink {
+	if len(links) == 0 {
+		return nil
+	}
+	return append([]PageLink(nil), links...)
+}
+
+// formatLinks 格式化链接：type→target, type→target
+func formatLinks(links []PageLink) string {
+	parts := make([]string, len(links))
+	for i, link := range links {
+		parts[i] = fmt.Sprintf("%s→%s", link.Type, link.Target)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// setLinks 整体替换Page的链接（用于回滚）
+func setLinks(page Page, links []PageLink) {
+	switch p := page.(type) {
+	case *DetailPage:
+		p.links = links
+	case *ContentsPage:
+		p.links = links
+	}
+}
+
+// ============ Page 链接方法 ============
+
+// GetLinks 获取链接（返回副本）
+func (p *DetailPage) GetLinks() []PageLink {
+	return copyLinks(p.links)
+}
+
+// AddLink 添加指向 target 的链接
+func (p *DetailPage) AddLink(target PageIndex, linkType string) error {
+	links, err := addLink(p.links, target, linkType)
+	if err != nil {
+		return err
+	}
+	p.links = links
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// RemoveLink 删除指向 target 的链接，linkType 为空时删除全部类型
+func (p *DetailPage) RemoveLink(target PageIndex, linkType string) error {
+	links, removed := removeLink(p.links, target, linkType)
+	if !removed {
+		return fmt.Errorf("link to %s not found", target)
+	}
+	p.links = links
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// GetLinks 获取链接（返回副本）
+func (p *ContentsPage) GetLinks() []PageLink {
+	return copyLinks(p.links)
+}
+
+// AddLink 添加指向 target 的链接
+func (p *ContentsPage) AddLink(target PageIndex, linkType string) error {
+	links, err := addLink(p.links, target, linkType)
+	if err != nil {
+		return err
+	}
+	p.links = links
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// RemoveLink 删除指向 target 的链接，linkType 为空时删除全部类型
+func (p *ContentsPage) RemoveLink(target PageIndex, linkType string) error {
+	links, removed := removeLink(p.links, target, linkType)
+	if !removed {
+		return fmt.Errorf("link to %s not found", target)
+	}
+	p.links = links
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// ============ 反向链接索引 ============
+
+// linkIndex 链接索引，用于计算反向链接
+//
+// 与全文索引相同，在首次查询时从存储构建，此后随每次 Page 变更增量维护。
+type linkIndex struct {
+	outgoing map[PageIndex][]PageLink // 源 Page -> 链接
+	built    bool
+	mu       sync.Mutex
+}
+
+// newLinkIndex 创建空的链接索引
+func newLinkIndex() *linkIndex {
+	return &linkIndex{outgoing: make(map[PageIndex][]PageLink)}
+}
+
+// beginBuild 索引尚未构建时加锁并返回 true，之后由 buildPage 逐个加入Page，endBuild 完成构建并解锁
+func (idx *linkIndex) beginBuild() bool {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// buildPage 构建期间加入Page（beginBuild 已加锁）
+func (idx *linkIndex) buildPage(page Page) {
+	if links := page.GetLinks(); len(links) > 0 {
+		idx.outgoing[page.GetIndex()] = links
+	}
+}
+
+// endBuild 标记索引已构建并解锁
+func (idx *linkIndex) endBuild() {
+	idx.built = true
+	idx.mu.Unlock()
+}
+
+// reset 清空索引，下次查询时重新构建
+func (idx *linkIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.outgoing = make(map[PageIndex][]PageLink)
+	idx.built = false
+}
+
+// Update 更新Page的链接（索引尚未构建时忽略）
+func (idx *linkIndex) Update(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+	if links := page.GetLinks(); len(links) > 0 {
+		idx.outgoing[page.GetIndex()] = links
+	} else {
+		delete(idx.outgoing, page.GetIndex())
+	}
+}
+
+// Remove 从索引移除Page的链接
+func (idx *linkIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.outgoing, pageIndex)
+}
+
+// Backlinks 返回指向 target 的链接，按源索引和类型排序
+func (idx *linkIndex) Backlinks(target PageIndex) []Backlink {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var backlinks []Backlink
+	for source, links := range idx.outgoing {
+		for _, link := range links {
+			if link.Target == target {
+				backlinks = append(backlinks, Backlink{Source: source, Type: link.Type})
+			}
+		}
+	}
+	sort.Slice(backlinks, func(i, j int) bool {
+		if backlinks[i].Source != backlinks[j].Source {
+			return backlinks[i].Source < backlinks[j].Source
+		}
+		return backlinks[i].Type < backlinks[j].Type
+	})
+	return backlinks
+}
+
+// ============ ContextSystem 链接操作 ============
+
+// AddLink 添加 source 指向 target 的链接（系统级操作）
+func (cs *ContextSystem) AddLink(source, target PageIndex, linkType string) error {
+	return cs.addLinkInternal(ActorSystem, source, target, linkType)
+}
+
+// RemoveLink 删除 source 指向 target 的链接（系统级操作）
+func (cs *ContextSystem) RemoveLink(source, target PageIndex, linkType string) error {
+	return cs.removeLinkInternal(ActorSystem, source, target, linkType)
+}
+
+// addLinkInternal 添加链接（内部方法），linkType 为空时使用 related
+func (cs *ContextSystem) addLinkInternal(actor Actor, source, target PageIndex, linkType string) error {
+	if source == target {
+		return fmt.Errorf("cannot link page %s to itself", source)
+	}
+	if linkType == "" {
+		linkType = defaultLinkType
+	}
+	page, err := cs.GetPage(source)
+	if err != nil {
+		return err
+	}
+	if _, err := cs.GetPage(target); err != nil {
+		return fmt.Errorf("link target %s not found", target)
+	}
+	if err := page.AddLink(target, linkType); err != nil {
+		return err
+	}
+	return cs.saveLinkedPage(actor, page)
+}
+
+// removeLinkInternal 删除链接（内部方法），linkType 为空时删除全部类型
+func (cs *ContextSystem) removeLinkInternal(actor Actor, source, target PageIndex, linkType string) error {
+	page, err := cs.GetPage(source)
+	if err != nil {
+		return err
+	}
+	if err := page.RemoveLink(target, linkType); err != nil {
+		return err
+	}
+	return cs.saveLinkedPage(actor, page)
+}
+
+// saveLinkedPage 持久化链接变更并记录修订
+func (cs *ContextSystem) saveLinkedPage(actor Actor, page Page) error {
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			return fmt.Errorf("failed to save page %s: %w", page.GetIndex(), err)
+		}
+	}
+	cs.pageChanged(page, actor, RevisionUpdate)
+	return nil
+}
+
+// GetLinks 获取Page的链接
+func (cs *ContextSystem) GetLinks(pageIndex PageIndex) ([]PageLink, error) {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return nil, err
+	}
+	return page.GetLinks(), nil
+}
+
+// GetBacklinks 获取指向Page的链接
+func (cs *ContextSystem) GetBacklinks(pageIndex PageIndex) []Backlink {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	cs.buildIndexesLocked()
+	return cs.links.Backlinks(pageIndex)
+}
+
+// linkCleanup 删除Page时清理的悬空链接，links 为清理前的链接（用于回滚）
+type linkCleanup struct {
+	page  Page
+	links []PageLink
+}
+
+// cleanupLinksLocked 删除其他Page中指向 removed 的链接（调用方需持有写锁）
+//
+// 只修改内存中的 Page，由调用方持久化；失败时调用 rollbackLinkCleanup 恢复。
+// 未缓存的源Page（包括冷归档的）从存储加载但不放入缓存，冷归档的源Page保持归档状态。
+func (cs *ContextSystem) cleanupLinksLocked(removed map[PageIndex]bool) ([]linkCleanup, error) {
+	cs.buildIndexesLocked()
+
+	sources := make(map[PageIndex]bool)
+	for pageIndex := range removed {
+		for _, backlink := range cs.links.Backlinks(pageIndex) {
+			if !removed[backlink.Source] {
+				sources[backlink.Source] = true
+			}
+		}
+	}
+
+	var cleaned []linkCleanup
+	for source := range sources {
+		page, _, err := cs.peekPageLocked(source)
+		if err != nil {
+			rollbackLinkCleanup(cleaned)
+			return nil, fmt.Errorf("failed to load linking page %s: %w", source, err)
+		}
+		oldLinks := page.GetLinks()
+		for pageIndex := range removed {
+			page.RemoveLink(pageIndex, "")
+		}
+		cleaned = append(cleaned, linkCleanup{page: page, links: oldLinks})
+	}
+	return cleaned, nil
+}
+
+// removeDanglingLinksLocked 清理指向 removed 的链接并直接持久化（调用方需持有写锁）
+//
+// 用于无法在事务中删除的情况（如删除未加载的冷归档Page），尽力而为，失败的Page保留原链接。
+func (cs *ContextSystem) removeDanglingLinksLocked(actor Actor, removed map[PageIndex]bool) {
+	cleaned, err := cs.cleanupLinksLocked(removed)
+	if err != nil {
+		return
+	}
+	for _, c := range cleaned {
+		if cs.storage != nil {
+			if err := cs.storage.Save(c.page); err != nil {
+				setLinks(c.page, c.links)
+				continue
+			}
+		}
+		cs.pageChanged(c.page, actor, RevisionUpdate)
+	}
+}
+
+// rollbackLinkCleanup 恢复被清理的链接
+func rollbackLinkCleanup(cleaned []linkCleanup) {
+	for _, c := range cleaned {
+		setLinks(c.page, c.links)
+	}
+}
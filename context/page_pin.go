@@ -0,0 +1,299 @@
+package context
+
+import (
+	"fmt"
+	"memci/tokenizer"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ============ Page 固定方法 ============
+
+// IsPinned 是否固定
+func (p *DetailPage) IsPinned() bool {
+	return p.pinned
+}
+
+// SetPinned 设置固定标记
+func (p *DetailPage) SetPinned(pinned bool) {
+	p.pinned = pinned
+	p.updatedAt = time.Now()
+}
+
+// IsPinned 是否固定
+func (p *ContentsPage) IsPinned() bool {
+	return p.pinned
+}
+
+// SetPinned 设置固定标记
+func (p *ContentsPage) SetPinned(pinned bool) {
+	p.pinned = pinned
+	p.updatedAt = time.Now()
+}
+
+// heuristicPageCost 未设置估算函数时，使用启发式分词器估算Page（名称、描述和详情）的token数
+//
+// 与当前可见性无关，固定的Page之后被展开也不会超出预算。
+func heuristicPageCost(page Page) int {
+	return tokenizer.NewHeuristicTokenizer().Count(pageText(page))
+}
+
+// ============ 固定索引 ============
+
+// pinnedIndex 固定的活跃Page及其估算的token数
+//
+// 与到期索引相同，在首次使用时从存储构建，此后随每次 Page 变更增量维护；
+// 估算函数变更时清空，下次使用时重新构建。
+type pinnedIndex struct {
+	costs map[PageIndex]int
+	used  int
+	cost  func(Page) int
+	built bool
+	mu    sync.Mutex
+}
+
+// newPinnedIndex 创建空的固定索引
+func newPinnedIndex(cost func(Page) int) *pinnedIndex {
+	return &pinnedIndex{costs: make(map[PageIndex]int), cost: cost}
+}
+
+// beginBuild 索引尚未构建时加锁并返回 true，之后由 buildPage 逐个加入Page，endBuild 完成构建并解锁
+func (idx *pinnedIndex) beginBuild() bool {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// buildPage 构建期间加入Page（beginBuild 已加锁）
+func (idx *pinnedIndex) buildPage(page Page) {
+	idx.updateLocked(page)
+}
+
+// endBuild 标记索引已构建并解锁
+func (idx *pinnedIndex) endBuild() {
+	idx.built = true
+	idx.mu.Unlock()
+}
+
+// reset 清空索引，下次使用时重新构建
+func (idx *pinnedIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.costs = make(map[PageIndex]int)
+	idx.used = 0
+	idx.built = false
+}
+
+// setCost 更换估算函数并清空索引
+func (idx *pinnedIndex) setCost(cost func(Page) int) {
+	idx.reset()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.cost = cost
+}
+
+// Update 更新Page的固定状态（索引尚未构建时忽略）
+func (idx *pinnedIndex) Update(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.built {
+		idx.updateLocked(page)
+	}
+}
+
+// updateLocked 按Page当前状态更新索引（调用方需持有 idx.mu）
+func (idx *pinnedIndex) updateLocked(page Page) {
+	pageIndex := page.GetIndex()
+	idx.used -= idx.costs[pageIndex]
+	delete(idx.costs, pageIndex)
+	if page.IsPinned() && page.GetLifecycle() == Active {
+		cost := idx.cost(page)
+		idx.costs[pageIndex] = cost
+		idx.used += cost
+	}
+}
+
+// Remove 从索引移除Page
+func (idx *pinnedIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.used -= idx.costs[pageIndex]
+	delete(idx.costs, pageIndex)
+}
+
+// Usage 返回固定Page占用的总token数，以及其中 pages 的占用（未固定的为 0）
+func (idx *pinnedIndex) Usage(pages ...PageIndex) (used, subset int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, pageIndex := range pages {
+		subset += idx.costs[pageIndex]
+	}
+	return idx.used, subset
+}
+
+// Indices 返回固定Page的索引，按索引排序
+func (idx *pinnedIndex) Indices() []PageIndex {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	indices := make([]PageIndex, 0, len(idx.costs))
+	for pageIndex := range idx.costs {
+		indices = append(indices, pageIndex)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] < indices[j]
+	})
+	return indices
+}
+
+// ============ ContextSystem 固定操作 ============
+
+// SetPinnedBudget 设置固定Page的token预算（<=0 表示不限）和单个Page的估算函数（nil 使用启发式估算）
+func (cs *ContextSystem) SetPinnedBudget(budget int, cost func(Page) int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cost == nil {
+		cost = heuristicPageCost
+	}
+	cs.pinnedBudget = budget
+	cs.pageCost = cost
+	cs.pinned.setCost(cost)
+}
+
+// PinPage 固定Page（系统级操作）
+func (cs *ContextSystem) PinPage(pageIndex PageIndex) error {
+	return cs.pinPageInternal(ActorSystem, pageIndex)
+}
+
+// UnpinPage 取消固定Page（系统级操作）
+func (cs *ContextSystem) UnpinPage(pageIndex PageIndex) error {
+	return cs.unpinPageInternal(ActorSystem, pageIndex)
+}
+
+// PinnedPages 列出所有固定的活跃Page，按索引排序
+func (cs *ContextSystem) PinnedPages() []Page {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	cs.buildIndexesLocked()
+	var pinned []Page
+	for _, pageIndex := range cs.pinned.Indices() {
+		if page, _, err := cs.peekPageLocked(pageIndex); err == nil {
+			pinned = append(pinned, page)
+		}
+	}
+	return pinned
+}
+
+// PinnedTokens 返回固定Page占用的token数和预算（预算 <=0 表示不限）
+func (cs *ContextSystem) PinnedTokens() (used, budget int) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	cs.buildIndexesLocked()
+	used, _ = cs.pinned.Usage()
+	return used, cs.pinnedBudget
+}
+
+// pinnedCostLocked 返回 pages 中固定的Page估算的token数之和（调用方需持有锁）
+func (cs *ContextSystem) pinnedCostLocked(pages []Page) int {
+	total := 0
+	for _, page := range pages {
+		if page.IsPinned() {
+			total += cs.pageCost(page)
+		}
+	}
+	return total
+}
+
+// checkPinnedBudgetLocked 检查 replaced 中的固定Page被替换为占用 need 个token的固定Page后是否超出固定预算（调用方需持有锁）
+//
+// 只拒绝使占用增加并超出预算的修改：预算调低后，缩减已固定的Page仍然允许。
+func (cs *ContextSystem) checkPinnedBudgetLocked(replaced []PageIndex, need int) error {
+	if cs.pinnedBudget <= 0 {
+		return nil
+	}
+	cs.buildIndexesLocked()
+	used, old := cs.pinned.Usage(replaced...)
+	if after := used - old + need; after > cs.pinnedBudget && after > used {
+		return fmt.Errorf("it needs %d tokens but only %d of the %d-token pinned budget is left, unpin other pages first",
+			need, max(cs.pinnedBudget-used+old, 0), cs.pinnedBudget)
+	}
+	return nil
+}
+
+// checkPinnedChangeLocked 检查固定的Page修改为当前内容（名称、描述和详情）后是否超出固定预算
+//
+// 调用方需持有写锁直到修改提交并经 pageChanged 更新固定索引，否则并发修改可能都通过检查而共同超出预算。
+func (cs *ContextSystem) checkPinnedChangeLocked(page Page) error {
+	if !page.IsPinned() {
+		return nil
+	}
+	if err := cs.checkPinnedBudgetLocked([]PageIndex{page.GetIndex()}, cs.pageCost(page)); err != nil {
+		return fmt.Errorf("cannot update pinned page %s: %w", page.GetIndex(), err)
+	}
+	return nil
+}
+
+// pinPageInternal 固定Page（内部方法），超出固定预算时返回错误
+//
+// 从预算检查到持久化和更新固定索引都持有写锁，并发固定不会共同超出预算。
+func (cs *ContextSystem) pinPageInternal(actor Actor, pageIndex PageIndex) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if page.IsPinned() {
+		return fmt.Errorf("page %s is already pinned", pageIndex)
+	}
+	if err := cs.checkPinnedBudgetLocked(nil, cs.pageCost(page)); err != nil {
+		return fmt.Errorf("cannot pin page %s: %w", pageIndex, err)
+	}
+
+	page.SetPinned(true)
+	return cs.savePinnedPageLocked(actor, page)
+}
+
+// unpinPageInternal 取消固定Page（内部方法）
+func (cs *ContextSystem) unpinPageInternal(actor Actor, pageIndex PageIndex) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if !page.IsPinned() {
+		return fmt.Errorf("page %s is not pinned", pageIndex)
+	}
+
+	page.SetPinned(false)
+	return cs.savePinnedPageLocked(actor, page)
+}
+
+// savePinnedPageLocked 持久化固定标记并记录修订，保存失败时恢复原标记（调用方需持有写锁）
+func (cs *ContextSystem) savePinnedPageLocked(actor Actor, page Page) error {
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			page.SetPinned(!page.IsPinned())
+			return fmt.Errorf("failed to save page %s: %w", page.GetIndex(), err)
+		}
+	}
+	cs.pageChanged(page, actor, RevisionUpdate)
+	return nil
+}
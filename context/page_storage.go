@@ -1,10 +1,14 @@
 package context
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -36,18 +40,30 @@ type Storage interface {
 
 	// DeleteSegment 删除Segment元数据
 	DeleteSegment(id SegmentID) error
+
+	// Begin 开始一个事务，用于原子地提交多个Page/Segment写入
+	Begin() (Transaction, error)
+
+	// AppendRevision 追加Page修订记录
+	AppendRevision(rev *PageRevision) error
+
+	// ListRevisions 列出Page的修订记录（按修订号升序），没有记录时返回空列表
+	ListRevisions(pageIndex PageIndex) ([]*PageRevision, error)
 }
 
 // MemoryStorage 内存存储实现（默认）
 type MemoryStorage struct {
-	pages map[PageIndex]Page
-	mu    sync.RWMutex
+	pages     map[PageIndex]Page
+	segments  []*Segment // 按保存顺序
+	revisions map[PageIndex][]*PageRevision
+	mu        sync.RWMutex
 }
 
 // NewMemoryStorage 创建新的内存存储
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
-		pages: make(map[PageIndex]Page),
+		pages:     make(map[PageIndex]Page),
+		revisions: make(map[PageIndex][]*PageRevision),
 	}
 }
 
@@ -109,60 +125,182 @@ func (ms *MemoryStorage) Count() int {
 	return len(ms.pages)
 }
 
-// SaveSegment 内存存储不持久化Segment（无操作）
+// SaveSegment 保存Segment到内存
 func (ms *MemoryStorage) SaveSegment(segment *Segment) error {
-	// 内存存储不需要持久化Segment
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.saveSegmentLocked(segment)
 	return nil
 }
 
-// LoadSegment 内存存储不支持加载Segment
+// saveSegmentLocked 更新或追加Segment（调用方需持有写锁）
+func (ms *MemoryStorage) saveSegmentLocked(segment *Segment) {
+	for i, seg := range ms.segments {
+		if seg.GetID() == segment.GetID() {
+			ms.segments[i] = segment
+			return
+		}
+	}
+	ms.segments = append(ms.segments, segment)
+}
+
+// LoadSegment 从内存加载Segment
 func (ms *MemoryStorage) LoadSegment(id SegmentID) (*Segment, error) {
-	return nil, fmt.Errorf("memory storage does not support segment persistence")
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for _, seg := range ms.segments {
+		if seg.GetID() == id {
+			return seg, nil
+		}
+	}
+	return nil, fmt.Errorf("segment %s not found", id)
 }
 
-// ListSegments 内存存储不支持列出Segment
+// ListSegments 按保存顺序列出所有Segment
 func (ms *MemoryStorage) ListSegments() ([]*Segment, error) {
-	return []*Segment{}, nil
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	segments := make([]*Segment, len(ms.segments))
+	copy(segments, ms.segments)
+	return segments, nil
 }
 
-// DeleteSegment 内存存储不持久化Segment（无操作）
+// DeleteSegment 从内存删除Segment
 func (ms *MemoryStorage) DeleteSegment(id SegmentID) error {
-	// 内存存储不需要持久化Segment
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.deleteSegmentLocked(id)
+	return nil
+}
+
+// deleteSegmentLocked 删除Segment，不存在视为成功（调用方需持有写锁）
+func (ms *MemoryStorage) deleteSegmentLocked(id SegmentID) {
+	for i, seg := range ms.segments {
+		if seg.GetID() == id {
+			ms.segments = append(ms.segments[:i], ms.segments[i+1:]...)
+			return
+		}
+	}
+}
+
+// AppendRevision 追加Page修订记录到内存
+func (ms *MemoryStorage) AppendRevision(rev *PageRevision) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.revisions[rev.Index] = append(ms.revisions[rev.Index], rev)
 	return nil
 }
 
+// ListRevisions 列出Page的修订记录
+func (ms *MemoryStorage) ListRevisions(pageIndex PageIndex) ([]*PageRevision, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	revisions := ms.revisions[pageIndex]
+	result := make([]*PageRevision, len(revisions))
+	copy(result, revisions)
+	return result, nil
+}
+
 // pageTypeJSON 用于识别Page类型的通用结构
 type pageTypeJSON struct {
 	Type string `json:"type"`
 }
 
+// 文件后缀
+const (
+	jsonExt          = ".json"
+	gzipExt          = ".json.gz"
+	segmentsFileBase = "segments"
+)
+
 // FileStorage 文件存储实现
+//
+// 启用 gzip 时 Page 写入 "{index}.json.gz"，Segment 元数据写入 "segments.json.gz"；
+// 读取时同时兼容压缩和未压缩（旧版）文件，两种格式可以在同一目录中共存。
 type FileStorage struct {
-	dir string // 存储目录
-	mu  sync.RWMutex
+	dir     string       // 存储目录
+	useGzip bool         // 是否使用 gzip 压缩写入
+	pending *fileJournal // 已提交但未应用完的事务日志
+	mu      sync.RWMutex
 }
 
-// NewFileStorage 创建新的文件存储
+// NewFileStorage 创建新的文件存储（不压缩）
 func NewFileStorage(dir string) (*FileStorage, error) {
+	return NewFileStorageWithGzip(dir, false)
+}
+
+// NewFileStorageWithGzip 创建新的文件存储，useGzip 控制写入格式
+func NewFileStorageWithGzip(dir string, useGzip bool) (*FileStorage, error) {
 	// 确保目录存在
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
-	return &FileStorage{
-		dir: dir,
-	}, nil
+	fs := &FileStorage{
+		dir:     dir,
+		useGzip: useGzip,
+	}
+	// 重做已提交但未完成的事务，清理残留临时文件
+	if err := fs.recover(); err != nil {
+		return nil, fmt.Errorf("failed to recover storage: %w", err)
+	}
+	return fs, nil
 }
 
-// filePath 获取Page的文件路径
+// UseGzip 返回当前是否以 gzip 格式写入
+func (fs *FileStorage) UseGzip() bool {
+	return fs.useGzip
+}
+
+// filePath 获取Page的文件路径（按当前写入格式）
 func (fs *FileStorage) filePath(pageIndex PageIndex) string {
+	if fs.useGzip {
+		return fs.gzipFilePath(pageIndex)
+	}
+	return fs.plainFilePath(pageIndex)
+}
+
+// plainFilePath 获取Page未压缩文件路径
+func (fs *FileStorage) plainFilePath(pageIndex PageIndex) string {
 	// 使用安全的文件名
-	return filepath.Join(fs.dir, filepath.FromSlash(string(pageIndex))+".json")
+	return filepath.Join(fs.dir, filepath.FromSlash(string(pageIndex))+jsonExt)
+}
+
+// gzipFilePath 获取Page压缩文件路径
+func (fs *FileStorage) gzipFilePath(pageIndex PageIndex) string {
+	return filepath.Join(fs.dir, filepath.FromSlash(string(pageIndex))+gzipExt)
+}
+
+// otherFilePath 获取与当前写入格式相反的文件路径（用于清理旧格式文件）
+func (fs *FileStorage) otherFilePath(pageIndex PageIndex) string {
+	if fs.useGzip {
+		return fs.plainFilePath(pageIndex)
+	}
+	return fs.gzipFilePath(pageIndex)
+}
+
+// existingFilePath 查找Page实际存在的文件路径，优先当前写入格式
+func (fs *FileStorage) existingFilePath(pageIndex PageIndex) (string, bool) {
+	for _, path := range []string{fs.filePath(pageIndex), fs.otherFilePath(pageIndex)} {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
 }
 
 // Save 保存Page到文件
 func (fs *FileStorage) Save(page Page) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return err
+	}
 
 	data, err := page.Marshal()
 	if err != nil {
@@ -170,26 +308,38 @@ func (fs *FileStorage) Save(page Page) error {
 	}
 
 	path := fs.filePath(page.GetIndex())
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := fs.writeData(path, data); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+
+	// 删除另一种格式的旧文件，避免读取到过期数据
+	if err := os.Remove(fs.otherFilePath(page.GetIndex())); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale file: %w", err)
+	}
 	return nil
 }
 
 // Load 从文件加载Page
 func (fs *FileStorage) Load(pageIndex PageIndex) (Page, error) {
-	fs.mu.RLock()
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
 	defer fs.mu.RUnlock()
 
-	path := fs.filePath(pageIndex)
-	data, err := os.ReadFile(path)
+	path, exists := fs.existingFilePath(pageIndex)
+	if !exists {
+		return nil, fmt.Errorf("page %s not found", pageIndex)
+	}
+	data, err := readData(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("page %s not found", pageIndex)
-		}
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	return unmarshalPage(data)
+}
+
+// unmarshalPage 根据类型字段反序列化Page
+func unmarshalPage(data []byte) (Page, error) {
 	// 先读取类型字段
 	var typeData pageTypeJSON
 	if err := json.Unmarshal(data, &typeData); err != nil {
@@ -219,34 +369,38 @@ func (fs *FileStorage) Load(pageIndex PageIndex) (Page, error) {
 	return page, nil
 }
 
-// Delete 删除Page文件
+// Delete 删除Page文件（压缩和未压缩两种格式都会删除）
 func (fs *FileStorage) Delete(pageIndex PageIndex) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return err
+	}
 
-	path := fs.filePath(pageIndex)
-	if err := os.Remove(path); err != nil {
-		if os.IsNotExist(err) {
-			return nil // 不存在视为成功
+	for _, path := range []string{fs.plainFilePath(pageIndex), fs.gzipFilePath(pageIndex)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete file: %w", err)
 		}
-		return fmt.Errorf("failed to delete file: %w", err)
 	}
-	return nil
+	return nil // 不存在视为成功
 }
 
 // Exists 检查Page文件是否存在
 func (fs *FileStorage) Exists(pageIndex PageIndex) bool {
-	fs.mu.RLock()
+	if err := fs.rlock(); err != nil {
+		return false
+	}
 	defer fs.mu.RUnlock()
 
-	path := fs.filePath(pageIndex)
-	_, err := os.Stat(path)
-	return err == nil
+	_, exists := fs.existingFilePath(pageIndex)
+	return exists
 }
 
 // List 列出所有Page索引
 func (fs *FileStorage) List() ([]PageIndex, error) {
-	fs.mu.RLock()
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
 	defer fs.mu.RUnlock()
 
 	entries, err := os.ReadDir(fs.dir)
@@ -255,35 +409,65 @@ func (fs *FileStorage) List() ([]PageIndex, error) {
 	}
 
 	indices := make([]PageIndex, 0, len(entries))
+	seen := make(map[PageIndex]bool, len(entries))
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
-		name := entry.Name()
-		// 跳过 segments 元数据文件
-		if name == "segments.json" {
+		// 移除 .json / .json.gz 后缀
+		index, ok := pageIndexFromFileName(entry.Name())
+		if !ok || seen[index] {
 			continue
 		}
-		// 移除 .json 后缀
-		if filepath.Ext(name) == ".json" {
-			index := PageIndex(name[:len(name)-5])
-			indices = append(indices, index)
-		}
+		seen[index] = true
+		indices = append(indices, index)
 	}
 	return indices, nil
 }
 
+// pageIndexFromFileName 从文件名解析PageIndex，非Page文件返回false
+func pageIndexFromFileName(name string) (PageIndex, bool) {
+	var base string
+	switch {
+	case strings.HasSuffix(name, gzipExt):
+		base = strings.TrimSuffix(name, gzipExt)
+	case strings.HasSuffix(name, jsonExt):
+		base = strings.TrimSuffix(name, jsonExt)
+	default:
+		return "", false
+	}
+	// 跳过 segments 元数据文件
+	if base == segmentsFileBase || base == "" {
+		return "", false
+	}
+	return PageIndex(base), true
+}
+
 // ============ Segment 持久化方法 ============
 
-// segmentsFilePath 获取Segment元数据文件路径
+// segmentsFilePath 获取Segment元数据文件路径（按当前写入格式）
 func (fs *FileStorage) segmentsFilePath() string {
-	return filepath.Join(fs.dir, "segments.json")
+	if fs.useGzip {
+		return filepath.Join(fs.dir, segmentsFileBase+gzipExt)
+	}
+	return filepath.Join(fs.dir, segmentsFileBase+jsonExt)
+}
+
+// otherSegmentsFilePath 获取与当前写入格式相反的Segment元数据文件路径
+func (fs *FileStorage) otherSegmentsFilePath() string {
+	if fs.useGzip {
+		return filepath.Join(fs.dir, segmentsFileBase+jsonExt)
+	}
+	return filepath.Join(fs.dir, segmentsFileBase+gzipExt)
 }
 
 // SaveSegment 保存Segment元数据到文件
 func (fs *FileStorage) SaveSegment(segment *Segment) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return err
+	}
 
 	// 读取所有现有的 segments
 	segments, err := fs.loadAllSegments()
@@ -310,7 +494,9 @@ func (fs *FileStorage) SaveSegment(segment *Segment) error {
 
 // LoadSegment 加载单个Segment元数据
 func (fs *FileStorage) LoadSegment(id SegmentID) (*Segment, error) {
-	fs.mu.RLock()
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
 	defer fs.mu.RUnlock()
 
 	segments, err := fs.loadAllSegments()
@@ -329,7 +515,9 @@ func (fs *FileStorage) LoadSegment(id SegmentID) (*Segment, error) {
 
 // ListSegments 列出所有Segment
 func (fs *FileStorage) ListSegments() ([]*Segment, error) {
-	fs.mu.RLock()
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
 	defer fs.mu.RUnlock()
 
 	return fs.loadAllSegments()
@@ -339,6 +527,9 @@ func (fs *FileStorage) ListSegments() ([]*Segment, error) {
 func (fs *FileStorage) DeleteSegment(id SegmentID) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return err
+	}
 
 	segments, err := fs.loadAllSegments()
 	if err != nil {
@@ -366,8 +557,12 @@ func (fs *FileStorage) DeleteSegment(id SegmentID) error {
 // loadAllSegments 加载所有Segments（内部方法，不加锁）
 func (fs *FileStorage) loadAllSegments() ([]*Segment, error) {
 	path := fs.segmentsFilePath()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// 兼容另一种格式（如未压缩的旧文件）
+		path = fs.otherSegmentsFilePath()
+	}
 
-	data, err := os.ReadFile(path)
+	data, err := readData(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []*Segment{}, nil // 空列表
@@ -391,9 +586,196 @@ func (fs *FileStorage) saveAllSegments(segments []*Segment) error {
 	}
 
 	path := fs.segmentsFilePath()
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := fs.writeData(path, data); err != nil {
 		return fmt.Errorf("failed to write segments file: %w", err)
 	}
 
+	if err := os.Remove(fs.otherSegmentsFilePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale segments file: %w", err)
+	}
+
+	return nil
+}
+
+// ============ 修订历史持久化方法 ============
+
+// historyDirName 修订历史子目录
+const historyDirName = "history"
+
+// historyFilePath 获取Page修订历史文件路径（JSON Lines，每行一条修订）
+func (fs *FileStorage) historyFilePath(pageIndex PageIndex) string {
+	return filepath.Join(fs.dir, historyDirName, filepath.FromSlash(string(pageIndex))+".jsonl")
+}
+
+// AppendRevision 追加Page修订记录到历史文件
+func (fs *FileStorage) AppendRevision(rev *PageRevision) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	line, err := json.Marshal(rev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision: %w", err)
+	}
+	line = append(line, '\n')
+
+	path := fs.historyFilePath(rev.Index)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("failed to append revision: %w", err)
+	}
 	return nil
 }
+
+// ListRevisions 读取Page修订历史，忽略末尾不完整的记录
+func (fs *FileStorage) ListRevisions(pageIndex PageIndex) ([]*PageRevision, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	data, err := os.ReadFile(fs.historyFilePath(pageIndex))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*PageRevision{}, nil
+		}
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	revisions := make([]*PageRevision, 0)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var rev PageRevision
+		if err := json.Unmarshal(line, &rev); err != nil {
+			continue // 崩溃导致的半行
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, nil
+}
+
+// ============ gzip 支持 ============
+
+// writeData 按当前写入格式写文件（临时文件加 rename，崩溃时不会留下半写文件）
+func (fs *FileStorage) writeData(path string, data []byte) error {
+	if fs.useGzip {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+	}
+	return writeFileAtomic(path, data)
+}
+
+// readData 读取文件，根据 gzip 魔数自动解压
+func readData(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isGzipData(data) {
+		return data, nil
+	}
+	return gunzipBytes(data)
+}
+
+// isGzipData 检查数据是否以 gzip 魔数开头
+func isGzipData(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// gzipBytes 压缩数据
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to gzip data: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to gzip data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipBytes 解压数据
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip data: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gunzip data: %w", err)
+	}
+	return out, nil
+}
+
+// Migrate 将目录中所有 Page 和 Segment 元数据文件转换为当前写入格式
+//
+// 用于迁移已有的 storage_base_dir（例如开启 gzip 后压缩旧的 .json 文件），
+// 返回被转换的文件数量。已经是目标格式的文件保持不变，因此 newStorageFromConfig
+// 在每次启动时调用它的开销只是一次目录扫描。
+func (fs *FileStorage) Migrate() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	converted := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		isGzipFile := strings.HasSuffix(name, gzipExt)
+		if !isGzipFile && !strings.HasSuffix(name, jsonExt) {
+			continue
+		}
+		if isGzipFile == fs.useGzip {
+			continue // 已是目标格式
+		}
+
+		var target string
+		if isGzipFile {
+			target = strings.TrimSuffix(name, gzipExt) + jsonExt
+		} else {
+			target = strings.TrimSuffix(name, jsonExt) + gzipExt
+		}
+
+		source := filepath.Join(fs.dir, name)
+		targetPath := filepath.Join(fs.dir, target)
+
+		// 目标格式文件已存在时以其为准（Save 总是写目标格式）
+		if _, err := os.Stat(targetPath); err != nil {
+			data, err := readData(source)
+			if err != nil {
+				return converted, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if err := fs.writeData(targetPath, data); err != nil {
+				return converted, fmt.Errorf("failed to write %s: %w", target, err)
+			}
+		}
+		if err := os.Remove(source); err != nil {
+			return converted, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		converted++
+	}
+
+	return converted, nil
+}
@@ -1,8 +1,16 @@
 package context
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"memci/config"
 )
 
 // TestNewMemoryStorage 测试创建内存存储
@@ -231,3 +239,780 @@ func TestMemoryStorage_ConcurrentAccess(t *testing.T) {
 		<-done
 	}
 }
+
+// TestFileStorage_GzipRoundTrip 测试 gzip 压缩存储的保存与加载
+func TestFileStorage_GzipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorageWithGzip(dir, true)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	page, _ := NewDetailPage("Test Page", "Test description", "测试内容", "")
+	page.SetIndex(PageIndex("usr-1"))
+	if err := storage.Save(page); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "usr-1.json.gz")); err != nil {
+		t.Fatalf("Expected usr-1.json.gz to exist: %v", err)
+	}
+
+	loaded, err := storage.Load(PageIndex("usr-1"))
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+	if loaded.(*DetailPage).GetDetail() != "测试内容" {
+		t.Errorf("Expected detail '测试内容', got '%s'", loaded.(*DetailPage).GetDetail())
+	}
+
+	seg := NewSegment("usr", "User", "", UserSegment)
+	if err := storage.SaveSegment(seg); err != nil {
+		t.Fatalf("Failed to save segment: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "segments.json.gz")); err != nil {
+		t.Fatalf("Expected segments.json.gz to exist: %v", err)
+	}
+
+	list, err := storage.List()
+	if err != nil {
+		t.Fatalf("Failed to list pages: %v", err)
+	}
+	if len(list) != 1 || list[0] != PageIndex("usr-1") {
+		t.Errorf("Expected [usr-1], got %v", list)
+	}
+}
+
+// TestFileStorage_GzipReadsLegacy 测试 gzip 存储透明读取旧的未压缩文件
+func TestFileStorage_GzipReadsLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy, _ := NewFileStorage(dir)
+
+	page, _ := NewDetailPage("Legacy", "", "old detail", "")
+	page.SetIndex(PageIndex("usr-1"))
+	legacy.Save(page)
+	legacy.SaveSegment(NewSegment("usr", "User", "", UserSegment))
+
+	storage, _ := NewFileStorageWithGzip(dir, true)
+	if !storage.Exists(PageIndex("usr-1")) {
+		t.Fatal("Legacy page should exist")
+	}
+	loaded, err := storage.Load(PageIndex("usr-1"))
+	if err != nil {
+		t.Fatalf("Failed to load legacy page: %v", err)
+	}
+	if loaded.GetName() != "Legacy" {
+		t.Errorf("Expected name 'Legacy', got '%s'", loaded.GetName())
+	}
+	segments, err := storage.ListSegments()
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("Expected 1 legacy segment, got %d (err=%v)", len(segments), err)
+	}
+
+	// 重新保存后旧文件应被替换
+	if err := storage.Save(loaded); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usr-1.json")); !os.IsNotExist(err) {
+		t.Error("Legacy usr-1.json should be removed after save")
+	}
+
+	if err := storage.Delete(PageIndex("usr-1")); err != nil {
+		t.Fatalf("Failed to delete page: %v", err)
+	}
+	if storage.Exists(PageIndex("usr-1")) {
+		t.Error("Page should not exist after delete")
+	}
+}
+
+// TestFileStorage_Migrate 测试一次性迁移到 gzip 格式
+func TestFileStorage_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	legacy, _ := NewFileStorage(dir)
+	for i := 1; i <= 3; i++ {
+		page, _ := NewDetailPage("Page", "Description", "Detail", "")
+		page.SetIndex(PageIndex(fmt.Sprintf("usr-%d", i)))
+		legacy.Save(page)
+	}
+	legacy.SaveSegment(NewSegment("usr", "User", "", UserSegment))
+
+	storage, _ := NewFileStorageWithGzip(dir, true)
+	converted, err := storage.Migrate()
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if converted != 4 {
+		t.Errorf("Expected 4 converted files, got %d", converted)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(matches) != 0 {
+		t.Errorf("Expected no plain .json files after migration, got %v", matches)
+	}
+
+	list, _ := storage.List()
+	if len(list) != 3 {
+		t.Errorf("Expected 3 pages after migration, got %d", len(list))
+	}
+	segments, _ := storage.ListSegments()
+	if len(segments) != 1 {
+		t.Errorf("Expected 1 segment after migration, got %d", len(segments))
+	}
+
+	// 再次迁移无需转换
+	converted, _ = storage.Migrate()
+	if converted != 0 {
+		t.Errorf("Expected 0 converted files on second run, got %d", converted)
+	}
+}
+
+// TestNewStorageFromConfig_MigratesGzip 测试开启 gzip 后启动时自动迁移旧文件
+func TestNewStorageFromConfig_MigratesGzip(t *testing.T) {
+	dir := t.TempDir()
+	legacy, _ := NewFileStorage(dir)
+	page, _ := NewDetailPage("Legacy", "", "old detail", "")
+	page.SetIndex(PageIndex("usr-1"))
+	legacy.Save(page)
+
+	storage, err := newStorageFromConfig(&config.ContextConfig{StorageBaseDir: dir, StorageUseGzip: true})
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usr-1.json.gz")); err != nil {
+		t.Fatalf("Expected usr-1.json.gz after startup migration: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usr-1.json")); !os.IsNotExist(err) {
+		t.Error("Legacy usr-1.json should be removed by startup migration")
+	}
+	if loaded, err := storage.Load(PageIndex("usr-1")); err != nil || loaded.GetName() != "Legacy" {
+		t.Errorf("Expected migrated page to load, got %v (err=%v)", loaded, err)
+	}
+}
+
+// TestFileStorage_TransactionCommit 测试事务提交
+func TestFileStorage_TransactionCommit(t *testing.T) {
+	dir := t.TempDir()
+	storage, _ := NewFileStorage(dir)
+
+	old, _ := NewDetailPage("Old", "", "", "")
+	old.SetIndex(PageIndex("usr-9"))
+	storage.Save(old)
+
+	tx, err := storage.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		page, _ := NewDetailPage("Page", "", "", "")
+		page.SetIndex(PageIndex(fmt.Sprintf("usr-%d", i)))
+		tx.Save(page)
+	}
+	tx.Delete(PageIndex("usr-9"))
+	tx.SaveSegment(NewSegment("usr", "User", "", UserSegment))
+
+	// 提交前不可见
+	if storage.Exists(PageIndex("usr-1")) {
+		t.Error("Staged page should not be visible before commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if !storage.Exists(PageIndex("usr-1")) || !storage.Exists(PageIndex("usr-2")) {
+		t.Error("Committed pages should exist")
+	}
+	if storage.Exists(PageIndex("usr-9")) {
+		t.Error("Deleted page should not exist after commit")
+	}
+	segments, _ := storage.ListSegments()
+	if len(segments) != 1 {
+		t.Errorf("Expected 1 segment, got %d", len(segments))
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalFileName)); !os.IsNotExist(err) {
+		t.Error("Journal should be removed after commit")
+	}
+
+	if err := tx.Commit(); err != ErrTransactionClosed {
+		t.Errorf("Expected ErrTransactionClosed on second commit, got %v", err)
+	}
+}
+
+// TestFileStorage_TransactionAbort 测试事务放弃
+func TestFileStorage_TransactionAbort(t *testing.T) {
+	storage, _ := NewFileStorage(t.TempDir())
+
+	tx, _ := storage.Begin()
+	page, _ := NewDetailPage("Page", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	tx.Save(page)
+	if err := tx.Abort(); err != nil {
+		t.Fatalf("Failed to abort: %v", err)
+	}
+	if storage.Exists(PageIndex("usr-1")) {
+		t.Error("Aborted page should not exist")
+	}
+	if err := tx.Save(page); err != ErrTransactionClosed {
+		t.Errorf("Expected ErrTransactionClosed after abort, got %v", err)
+	}
+}
+
+// TestFileStorage_RecoverJournal 测试崩溃恢复：重做已提交日志，丢弃未提交临时文件
+func TestFileStorage_RecoverJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	// 模拟已写入日志但未完成 rename 的事务
+	page, _ := NewDetailPage("Committed", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	data, _ := page.Marshal()
+	os.WriteFile(filepath.Join(dir, "usr-1.json"+tmpExt), data, 0644)
+	os.WriteFile(filepath.Join(dir, "usr-2.json"), data, 0644)
+	journal := `{"renames":[{"from":"usr-1.json.tmp","to":"usr-1.json"}],"deletes":["usr-2.json"]}`
+	os.WriteFile(filepath.Join(dir, journalFileName), []byte(journal), 0644)
+
+	// 模拟未提交事务残留的临时文件
+	os.WriteFile(filepath.Join(dir, "usr-3.json"+tmpExt), data, 0644)
+
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to recover storage: %v", err)
+	}
+	if !storage.Exists(PageIndex("usr-1")) {
+		t.Error("Committed page should exist after recovery")
+	}
+	if storage.Exists(PageIndex("usr-2")) {
+		t.Error("Deleted page should not exist after recovery")
+	}
+	list, _ := storage.List()
+	if len(list) != 1 {
+		t.Errorf("Expected 1 page after recovery, got %v", list)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "usr-3.json"+tmpExt)); !os.IsNotExist(err) {
+		t.Error("Uncommitted temp file should be removed")
+	}
+}
+
+// TestFileStorage_CommitApplyFailure 测试日志持久化后应用失败：提交成功，重做前拒绝读取旧数据
+func TestFileStorage_CommitApplyFailure(t *testing.T) {
+	dir := t.TempDir()
+	storage, _ := NewFileStorage(dir)
+
+	// 目标路径被非空目录占用，rename 失败
+	blocker := filepath.Join(dir, "usr-1.json")
+	os.MkdirAll(filepath.Join(blocker, "x"), 0755)
+
+	tx, _ := storage.Begin()
+	page, _ := NewDetailPage("Committed", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	tx.Save(page)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit should succeed once the journal is durable, got %v", err)
+	}
+	if _, err := storage.Load(PageIndex("usr-1")); err == nil {
+		t.Error("Load should fail while the committed transaction is not applied")
+	}
+
+	// 障碍消除后下次访问自动重做
+	os.RemoveAll(blocker)
+	loaded, err := storage.Load(PageIndex("usr-1"))
+	if err != nil || loaded.GetName() != "Committed" {
+		t.Fatalf("Expected committed page after retry, got %v (err=%v)", loaded, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, journalFileName)); !os.IsNotExist(err) {
+		t.Error("Journal should be removed after retry")
+	}
+}
+
+// TestMemoryStorage_Transaction 测试内存存储事务
+func TestMemoryStorage_Transaction(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	tx, _ := storage.Begin()
+	page, _ := NewDetailPage("Page", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	tx.Save(page)
+	if storage.Count() != 0 {
+		t.Error("Staged page should not be visible before commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if storage.Count() != 1 {
+		t.Errorf("Expected count 1, got %d", storage.Count())
+	}
+
+	// Segment 操作同样在提交时生效
+	tx, _ = storage.Begin()
+	tx.SaveSegment(NewSegment("usr", "User", "", UserSegment))
+	tx.SaveSegment(NewSegment("self", "Self", "", UserSegment))
+	tx.DeleteSegment("self")
+	if segments, _ := storage.ListSegments(); len(segments) != 0 {
+		t.Error("Staged segments should not be visible before commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	segments, _ := storage.ListSegments()
+	if len(segments) != 1 || segments[0].GetID() != "usr" {
+		t.Errorf("Expected only segment usr after commit, got %v", segments)
+	}
+}
+
+// ============ Storage 契约测试（所有后端共用） ============
+
+// storageFactories 返回所有待测的存储后端构造函数
+func storageFactories() map[string]func(t *testing.T) Storage {
+	return map[string]func(t *testing.T) Storage{
+		"MemoryStorage": func(t *testing.T) Storage {
+			return NewMemoryStorage()
+		},
+		"FileStorage": func(t *testing.T) Storage {
+			storage, err := NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			return storage
+		},
+		"FileStorageGzip": func(t *testing.T) Storage {
+			storage, err := NewFileStorageWithGzip(t.TempDir(), true)
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			return storage
+		},
+		"EncryptedFileStorage": func(t *testing.T) Storage {
+			inner, err := NewFileStorageWithGzip(t.TempDir(), true)
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			storage, err := NewEncryptedStorage(inner, testEncryptionKey(1))
+			if err != nil {
+				t.Fatalf("Failed to create encrypted storage: %v", err)
+			}
+			return storage
+		},
+		"WALStorage": func(t *testing.T) Storage {
+			storage, err := NewWALStorage(t.TempDir(), 4)
+			if err != nil {
+				t.Fatalf("Failed to create storage: %v", err)
+			}
+			t.Cleanup(func() { storage.Close() })
+			return storage
+		},
+	}
+}
+
+// TestStorageContract 所有后端必须满足的 Storage 行为
+func TestStorageContract(t *testing.T) {
+	for name, factory := range storageFactories() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("SaveLoad", func(t *testing.T) {
+				storage := factory(t)
+				page, _ := NewDetailPage("Test Page", "Test description", "Test detail", "usr-1")
+				page.SetIndex(PageIndex("usr-2"))
+				if err := storage.Save(page); err != nil {
+					t.Fatalf("Failed to save page: %v", err)
+				}
+				loaded, err := storage.Load(PageIndex("usr-2"))
+				if err != nil {
+					t.Fatalf("Failed to load page: %v", err)
+				}
+				if loaded.GetName() != "Test Page" || loaded.GetParent() != PageIndex("usr-1") {
+					t.Errorf("Loaded page mismatch: %s / %s", loaded.GetName(), loaded.GetParent())
+				}
+				if _, err := storage.Load(PageIndex("nonexistent")); err == nil {
+					t.Error("Expected error when loading non-existent page")
+				}
+			})
+
+			t.Run("DeleteExistsList", func(t *testing.T) {
+				storage := factory(t)
+				for i := 1; i <= 3; i++ {
+					page, _ := NewContentsPage("Page", "", "")
+					page.SetIndex(PageIndex(fmt.Sprintf("usr-%d", i)))
+					if err := storage.Save(page); err != nil {
+						t.Fatalf("Failed to save page: %v", err)
+					}
+				}
+				if !storage.Exists(PageIndex("usr-2")) {
+					t.Error("Page should exist after save")
+				}
+				if err := storage.Delete(PageIndex("usr-2")); err != nil {
+					t.Fatalf("Failed to delete page: %v", err)
+				}
+				if storage.Exists(PageIndex("usr-2")) {
+					t.Error("Page should not exist after delete")
+				}
+				if err := storage.Delete(PageIndex("nonexistent")); err != nil {
+					t.Errorf("Delete should not error for non-existent page, got: %v", err)
+				}
+				list, err := storage.List()
+				if err != nil {
+					t.Fatalf("Failed to list pages: %v", err)
+				}
+				if len(list) != 2 {
+					t.Errorf("Expected 2 items, got %d", len(list))
+				}
+			})
+
+			t.Run("Transaction", func(t *testing.T) {
+				storage := factory(t)
+				old, _ := NewDetailPage("Old", "", "", "")
+				old.SetIndex(PageIndex("usr-9"))
+				storage.Save(old)
+
+				tx, err := storage.Begin()
+				if err != nil {
+					t.Fatalf("Failed to begin transaction: %v", err)
+				}
+				page, _ := NewDetailPage("New", "", "", "")
+				page.SetIndex(PageIndex("usr-1"))
+				tx.Save(page)
+				tx.Delete(PageIndex("usr-9"))
+				if storage.Exists(PageIndex("usr-1")) {
+					t.Error("Staged page should not be visible before commit")
+				}
+				if err := tx.Commit(); err != nil {
+					t.Fatalf("Failed to commit: %v", err)
+				}
+				if !storage.Exists(PageIndex("usr-1")) || storage.Exists(PageIndex("usr-9")) {
+					t.Error("Transaction effects not applied")
+				}
+
+				aborted, _ := storage.Begin()
+				page2, _ := NewDetailPage("Aborted", "", "", "")
+				page2.SetIndex(PageIndex("usr-2"))
+				aborted.Save(page2)
+				aborted.Abort()
+				if storage.Exists(PageIndex("usr-2")) {
+					t.Error("Aborted page should not exist")
+				}
+			})
+
+			t.Run("Revisions", func(t *testing.T) {
+				storage := factory(t)
+				for i := 1; i <= 5; i++ {
+					rev := &PageRevision{Index: PageIndex("usr-1"), Revision: i, Actor: ActorAgent, Operation: RevisionUpdate}
+					if err := storage.AppendRevision(rev); err != nil {
+						t.Fatalf("Failed to append revision: %v", err)
+					}
+				}
+				revisions, err := storage.ListRevisions(PageIndex("usr-1"))
+				if err != nil {
+					t.Fatalf("Failed to list revisions: %v", err)
+				}
+				if len(revisions) != 5 || revisions[4].Revision != 5 {
+					t.Errorf("Expected 5 ordered revisions, got %d", len(revisions))
+				}
+				if empty, _ := storage.ListRevisions(PageIndex("usr-2")); len(empty) != 0 {
+					t.Errorf("Expected no revisions, got %d", len(empty))
+				}
+			})
+		})
+	}
+}
+
+// TestWALStorage_Replay 测试WAL重放与压缩后状态一致
+func TestWALStorage_Replay(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewWALStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		page, _ := NewDetailPage(fmt.Sprintf("Page %d", i), "", "", "")
+		page.SetIndex(PageIndex(fmt.Sprintf("usr-%d", i)))
+		storage.Save(page)
+	}
+	storage.Delete(PageIndex("usr-2"))
+	storage.SaveSegment(NewSegment("usr", "User", "", UserSegment))
+	storage.SaveSegment(NewSegment("self", "Self", "", UserSegment))
+	storage.DeleteSegment("usr")
+	storage.Close()
+
+	reopened, err := NewWALStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	list, _ := reopened.List()
+	if len(list) != 2 || reopened.Exists(PageIndex("usr-2")) {
+		t.Errorf("Expected usr-1 and usr-3 after replay, got %v", list)
+	}
+	segments, _ := reopened.ListSegments()
+	if len(segments) != 1 || segments[0].GetID() != "self" {
+		t.Errorf("Expected [self] after replay, got %v", segments)
+	}
+
+	// 压缩后日志清空，状态不变
+	if err := reopened.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if reopened.LogRecords() != 0 {
+		t.Errorf("Expected 0 log records after compact, got %d", reopened.LogRecords())
+	}
+	page, _ := NewDetailPage("Page 4", "", "", "")
+	page.SetIndex(PageIndex("usr-4"))
+	reopened.Save(page)
+	reopened.Close()
+
+	compacted, err := NewWALStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen compacted storage: %v", err)
+	}
+	defer compacted.Close()
+	list, _ = compacted.List()
+	if len(list) != 3 {
+		t.Errorf("Expected 3 pages after snapshot + log replay, got %v", list)
+	}
+	loaded, err := compacted.Load(PageIndex("usr-3"))
+	if err != nil || loaded.GetName() != "Page 3" {
+		t.Errorf("Expected Page 3 from snapshot, got %v (err=%v)", loaded, err)
+	}
+}
+
+// TestWALStorage_TornWrite 测试崩溃导致的半行记录被丢弃
+func TestWALStorage_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	storage, _ := NewWALStorage(dir, 0)
+	page, _ := NewDetailPage("Page", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	storage.Save(page)
+	storage.Close()
+
+	f, _ := os.OpenFile(filepath.Join(dir, walLogFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"op":"save","index":"usr-2","data":{"ty`)
+	f.Close()
+
+	reopened, err := NewWALStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.Exists(PageIndex("usr-2")) {
+		t.Error("Torn record should be discarded")
+	}
+
+	// 截断后可以继续正常追加
+	page2, _ := NewDetailPage("Page 2", "", "", "")
+	page2.SetIndex(PageIndex("usr-2"))
+	if err := reopened.Save(page2); err != nil {
+		t.Fatalf("Failed to save after torn write: %v", err)
+	}
+	reopened.Close()
+
+	again, _ := NewWALStorage(dir, 0)
+	defer again.Close()
+	if !again.Exists(PageIndex("usr-2")) {
+		t.Error("Page saved after recovery should survive replay")
+	}
+}
+
+// TestWALStorage_CorruptRecord 测试日志中间的损坏记录在打开时报错，而不是丢弃后续记录
+func TestWALStorage_CorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	storage, _ := NewWALStorage(dir, 0)
+	page, _ := NewDetailPage("Page", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	storage.Save(page)
+
+	// 校验失败的 batch 不写日志、不应用任何操作
+	page2, _ := NewDetailPage("Page 2", "", "", "")
+	page2.SetIndex(PageIndex("usr-2"))
+	record, _ := pageRecord(page2)
+	batch := walRecord{Op: walBatch, Ops: []walRecord{record, {Op: "bogus"}}}
+	storage.mu.Lock()
+	err := storage.appendRecord(batch)
+	storage.mu.Unlock()
+	if err == nil {
+		t.Fatal("Expected invalid batch to be rejected")
+	}
+	if storage.Exists(PageIndex("usr-2")) {
+		t.Error("Rejected batch should not be partially applied")
+	}
+	storage.Close()
+
+	// 日志中间插入损坏的记录，之后仍有有效记录
+	line, _ := json.Marshal(record)
+	f, _ := os.OpenFile(filepath.Join(dir, walLogFileName), os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("{garbage}\n")
+	f.Write(append(line, '\n'))
+	f.Close()
+
+	if _, err := NewWALStorage(dir, 0); err == nil {
+		t.Error("Expected corrupt record in the middle of the log to fail replay")
+	}
+}
+
+// failingWALLog 只写入一半数据后返回错误的日志文件，模拟磁盘写满等部分写入失败
+type failingWALLog struct {
+	walLogFile
+}
+
+func (f *failingWALLog) Write(p []byte) (int, error) {
+	n, _ := f.walLogFile.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+// TestWALStorage_FailedAppend 测试部分写入失败后截断半行，后续记录在重放时不丢失
+func TestWALStorage_FailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	storage, _ := NewWALStorage(dir, 0)
+	page, _ := NewDetailPage("Page", "", "", "")
+	page.SetIndex(PageIndex("usr-1"))
+	storage.Save(page)
+
+	healthy := storage.log
+	storage.log = &failingWALLog{walLogFile: healthy}
+	page2, _ := NewDetailPage("Page 2", "", "", "")
+	page2.SetIndex(PageIndex("usr-2"))
+	if err := storage.Save(page2); err == nil {
+		t.Fatal("Expected save to fail on partial write")
+	}
+	if storage.Exists(PageIndex("usr-2")) {
+		t.Error("Failed save should not be applied")
+	}
+
+	storage.log = healthy
+	page3, _ := NewDetailPage("Page 3", "", "", "")
+	page3.SetIndex(PageIndex("usr-3"))
+	if err := storage.Save(page3); err != nil {
+		t.Fatalf("Failed to save after failed append: %v", err)
+	}
+	storage.Close()
+
+	reopened, err := NewWALStorage(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer reopened.Close()
+	if !reopened.Exists(PageIndex("usr-1")) || !reopened.Exists(PageIndex("usr-3")) {
+		list, _ := reopened.List()
+		t.Errorf("Expected usr-1 and usr-3 after replay, got %v", list)
+	}
+	if reopened.Exists(PageIndex("usr-2")) {
+		t.Error("Failed save should not survive replay")
+	}
+}
+
+// testEncryptionKey 生成测试用的 32 字节密钥
+func testEncryptionKey(seed byte) []byte {
+	return bytes.Repeat([]byte{seed}, 32)
+}
+
+// TestEncryptedStorage_KeyRotation 测试磁盘上没有明文、错误密钥在恢复时报错，以及密钥轮换
+func TestEncryptedStorage_KeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	inner, _ := NewFileStorage(dir)
+	storage, err := NewEncryptedStorage(inner, testEncryptionKey(1))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted storage: %v", err)
+	}
+	cs := NewContextSystemWithStorage(storage)
+	seg := NewSegment("usr", "User", "name, interests, preferences", UserSegment)
+	seg.SetPermission(ReadWrite)
+	rootIndex := seg.GenerateIndex()
+	seg.SetRootIndex(rootIndex)
+	cs.AddSegment(*seg)
+	root, _ := NewContentsPage("User", "", "")
+	root.SetIndex(rootIndex)
+	cs.AddPage(root)
+	hobby, err := cs.createDetailPageInternal(ActorSystem, "Hobby", "", "rock climbing", rootIndex)
+	if err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+	cs.updatePageInternal(ActorSystem, hobby, "Hobbies", "")
+
+	// 所有文件（Page、Segment 元数据和修订历史）都不含明文
+	filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, _ := os.ReadFile(path)
+		for _, secret := range []string{"rock climbing", "Hobbies", "interests"} {
+			if bytes.Contains(data, []byte(secret)) {
+				t.Errorf("File %s contains plaintext %q", path, secret)
+			}
+		}
+		return nil
+	})
+
+	// 错误密钥和未配置密钥在恢复时报错
+	wrong, _ := NewEncryptedStorage(inner, testEncryptionKey(2))
+	if _, err := NewContextSystemWithStorage(wrong).Restore(); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("Expected ErrWrongEncryptionKey with a wrong key, got %v", err)
+	}
+	keyless, _ := NewEncryptedStorage(inner, nil)
+	if _, err := NewContextSystemWithStorage(keyless).Restore(); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("Expected ErrWrongEncryptionKey without a key, got %v", err)
+	}
+
+	// 轮换：新密钥加旧密钥读取并改写，之后只用新密钥即可读取 Page
+	rotating, _ := NewEncryptedStorage(inner, testEncryptionKey(2), testEncryptionKey(1))
+	if _, err := NewContextSystemWithStorage(rotating).Restore(); err != nil || !rotating.NeedsReencrypt() {
+		t.Errorf("Expected restore with a rotated key to need re-encryption, got %v", err)
+	}
+	count, err := rotating.Reencrypt()
+	if err != nil || count != 3 {
+		t.Fatalf("Expected 3 re-encrypted objects, got %d, %v", count, err)
+	}
+	if count, _ := rotating.Reencrypt(); count != 0 || rotating.NeedsReencrypt() {
+		t.Errorf("Expected nothing to re-encrypt, got %d", count)
+	}
+	rotated, _ := NewEncryptedStorage(inner, testEncryptionKey(2))
+	restored := NewContextSystemWithStorage(rotated)
+	if _, err := restored.Restore(); err != nil {
+		t.Fatalf("Failed to restore with rotated key: %v", err)
+	}
+	if rotated.NeedsReencrypt() {
+		t.Error("Storage encrypted with the current key should not need re-encryption")
+	}
+	page, err := restored.GetPage(hobby)
+	if err != nil || page.(*DetailPage).GetDetail() != "rock climbing" || page.GetName() != "Hobbies" {
+		t.Fatalf("Unexpected page after rotation %v, %v", page, err)
+	}
+	if _, err := restored.GetPageHistory(hobby); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Errorf("History written with the retired key should need the old key, got %v", err)
+	}
+	if history, err := NewContextSystemWithStorage(rotating).GetPageHistory(hobby); err != nil || len(history) != 2 {
+		t.Errorf("Expected 2 revisions with the old key, got %d, %v", len(history), err)
+	}
+}
+
+// TestNewContextSystem_Encryption 测试开启加密后启动时改写明文，密钥错误或缺失时返回错误
+func TestNewContextSystem_Encryption(t *testing.T) {
+	t.Setenv(EncryptionKeyEnv, "")
+	t.Setenv(EncryptionOldKeysEnv, "")
+	dir := t.TempDir()
+	cs, rootIndex := newTestSystem(t, dir)
+	note, _ := cs.createDetailPageInternal(ActorSystem, "Note", "", "secret detail", rootIndex)
+	notePath := filepath.Join(dir, string(note)+".json")
+
+	keyFile := func(seed byte) string {
+		path := filepath.Join(t.TempDir(), "key")
+		os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(testEncryptionKey(seed))), 0600)
+		return path
+	}
+	key := keyFile(1)
+
+	// 开启加密后的首次启动改写明文
+	if _, _, err := NewContextSystem(&config.ContextConfig{StorageBaseDir: dir, EncryptionKeyFile: key}); err != nil {
+		t.Fatalf("Failed to start with encryption: %v", err)
+	}
+	data, _ := os.ReadFile(notePath)
+	if bytes.Contains(data, []byte("secret detail")) {
+		t.Error("Plaintext page should be re-encrypted on startup")
+	}
+
+	if _, restored, err := NewContextSystem(&config.ContextConfig{StorageBaseDir: dir, EncryptionKeyFile: key}); err != nil || !restored {
+		t.Fatalf("Failed to restart with encryption: %v", err)
+	}
+
+	// 错误密钥和未配置密钥返回错误而不是 panic
+	for _, cfg := range []*config.ContextConfig{
+		{StorageBaseDir: dir, EncryptionKeyFile: keyFile(2)},
+		{StorageBaseDir: dir},
+	} {
+		if _, _, err := NewContextSystem(cfg); !errors.Is(err, ErrWrongEncryptionKey) {
+			t.Errorf("Expected ErrWrongEncryptionKey, got %v", err)
+		}
+	}
+}
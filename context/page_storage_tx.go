@@ -0,0 +1,524 @@
+package context
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Transaction 存储事务
+//
+// 事务中暂存的 Page/Segment 写入和删除在 Commit 时一次性生效：
+// 要么全部写入，要么（崩溃恢复后）全部不生效。同一 key 多次暂存时以最后一次为准。
+// Save 暂存的是 Page 指针，序列化发生在 Commit 时。
+type Transaction interface {
+	// Save 暂存Page保存
+	Save(page Page) error
+
+	// Delete 暂存Page删除
+	Delete(pageIndex PageIndex) error
+
+	// SaveSegment 暂存Segment元数据保存
+	SaveSegment(segment *Segment) error
+
+	// DeleteSegment 暂存Segment元数据删除
+	DeleteSegment(id SegmentID) error
+
+	// Commit 提交所有暂存操作
+	Commit() error
+
+	// Abort 放弃所有暂存操作
+	Abort() error
+}
+
+// ErrTransactionClosed 事务已提交或放弃
+var ErrTransactionClosed = errors.New("transaction already committed or aborted")
+
+// stagedOps 事务暂存的操作（各存储实现共用）
+type stagedOps struct {
+	pageOrder []PageIndex
+	pages     map[PageIndex]Page // nil 表示删除
+
+	segmentOrder []SegmentID
+	segments     map[SegmentID]*Segment // nil 表示删除
+
+	closed bool
+}
+
+// newStagedOps 创建空的暂存操作集合
+func newStagedOps() *stagedOps {
+	return &stagedOps{
+		pages:    make(map[PageIndex]Page),
+		segments: make(map[SegmentID]*Segment),
+	}
+}
+
+// stagePage 暂存Page操作，page 为 nil 表示删除
+func (s *stagedOps) stagePage(pageIndex PageIndex, page Page) error {
+	if s.closed {
+		return ErrTransactionClosed
+	}
+	if _, exists := s.pages[pageIndex]; !exists {
+		s.pageOrder = append(s.pageOrder, pageIndex)
+	}
+	s.pages[pageIndex] = page
+	return nil
+}
+
+// stageSegment 暂存Segment操作，segment 为 nil 表示删除
+func (s *stagedOps) stageSegment(id SegmentID, segment *Segment) error {
+	if s.closed {
+		return ErrTransactionClosed
+	}
+	if _, exists := s.segments[id]; !exists {
+		s.segmentOrder = append(s.segmentOrder, id)
+	}
+	s.segments[id] = segment
+	return nil
+}
+
+// close 标记事务结束
+func (s *stagedOps) close() error {
+	if s.closed {
+		return ErrTransactionClosed
+	}
+	s.closed = true
+	return nil
+}
+
+// applySegments 将暂存的Segment操作应用到已有列表上，返回新列表
+func (s *stagedOps) applySegments(existing []*Segment) []*Segment {
+	result := make([]*Segment, 0, len(existing)+len(s.segmentOrder))
+	handled := make(map[SegmentID]bool, len(s.segmentOrder))
+	for _, seg := range existing {
+		id := seg.GetID()
+		staged, ok := s.segments[id]
+		if !ok {
+			result = append(result, seg)
+			continue
+		}
+		handled[id] = true
+		if staged != nil {
+			result = append(result, staged)
+		}
+	}
+	for _, id := range s.segmentOrder {
+		if handled[id] {
+			continue
+		}
+		if staged := s.segments[id]; staged != nil {
+			result = append(result, staged)
+		}
+	}
+	return result
+}
+
+// ============ nopTransaction ============
+
+// nopTransaction 空事务（未配置存储时使用）
+type nopTransaction struct{}
+
+func (nopTransaction) Save(page Page) error               { return nil }
+func (nopTransaction) Delete(pageIndex PageIndex) error   { return nil }
+func (nopTransaction) SaveSegment(segment *Segment) error { return nil }
+func (nopTransaction) DeleteSegment(id SegmentID) error   { return nil }
+func (nopTransaction) Commit() error                      { return nil }
+func (nopTransaction) Abort() error                       { return nil }
+
+// ============ MemoryStorage 事务 ============
+
+// memoryTransaction MemoryStorage 的事务实现
+type memoryTransaction struct {
+	storage *MemoryStorage
+	ops     *stagedOps
+}
+
+// Begin 开始一个事务
+func (ms *MemoryStorage) Begin() (Transaction, error) {
+	return &memoryTransaction{
+		storage: ms,
+		ops:     newStagedOps(),
+	}, nil
+}
+
+// Save 暂存Page保存
+func (tx *memoryTransaction) Save(page Page) error {
+	return tx.ops.stagePage(page.GetIndex(), page)
+}
+
+// Delete 暂存Page删除
+func (tx *memoryTransaction) Delete(pageIndex PageIndex) error {
+	return tx.ops.stagePage(pageIndex, nil)
+}
+
+// SaveSegment 暂存Segment元数据保存
+func (tx *memoryTransaction) SaveSegment(segment *Segment) error {
+	return tx.ops.stageSegment(segment.GetID(), segment)
+}
+
+// DeleteSegment 暂存Segment元数据删除
+func (tx *memoryTransaction) DeleteSegment(id SegmentID) error {
+	return tx.ops.stageSegment(id, nil)
+}
+
+// Commit 在一次加锁内应用所有暂存操作
+func (tx *memoryTransaction) Commit() error {
+	if err := tx.ops.close(); err != nil {
+		return err
+	}
+
+	tx.storage.mu.Lock()
+	defer tx.storage.mu.Unlock()
+
+	for _, pageIndex := range tx.ops.pageOrder {
+		if page := tx.ops.pages[pageIndex]; page != nil {
+			tx.storage.pages[pageIndex] = page
+		} else {
+			delete(tx.storage.pages, pageIndex)
+		}
+	}
+	for _, id := range tx.ops.segmentOrder {
+		if segment := tx.ops.segments[id]; segment != nil {
+			tx.storage.saveSegmentLocked(segment)
+		} else {
+			tx.storage.deleteSegmentLocked(id)
+		}
+	}
+	return nil
+}
+
+// Abort 放弃事务
+func (tx *memoryTransaction) Abort() error {
+	return tx.ops.close()
+}
+
+// ============ FileStorage 事务 ============
+
+// 事务日志文件名及临时文件后缀
+const (
+	journalFileName = "transaction.journal"
+	tmpExt          = ".tmp"
+)
+
+// fileJournal 提交日志：写入完成即为提交点，崩溃后据此重做
+type fileJournal struct {
+	Renames []fileRename `json:"renames"` // 临时文件 -> 目标文件
+	Deletes []string     `json:"deletes"` // 需要删除的文件
+}
+
+// fileRename 单个重命名操作（路径相对存储目录）
+type fileRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// fileTransaction FileStorage 的事务实现
+//
+// 提交流程：
+//  1. 所有新内容写入 "*.tmp" 临时文件并 fsync
+//  2. 原子写入事务日志（提交点）
+//  3. 按日志执行 rename 和删除，最后删除日志
+//
+// 日志持久化后事务即已提交，步骤 3 失败不会让 Commit 返回错误：未完成的日志
+// 记为 pending，之后每次访问存储前重试，成功前读写都返回错误而不是旧数据。
+// 崩溃恢复（NewFileStorage 时）：存在日志则重做步骤 3，再清理残留的临时文件。
+type fileTransaction struct {
+	storage *FileStorage
+	ops     *stagedOps
+}
+
+// Begin 开始一个事务
+func (fs *FileStorage) Begin() (Transaction, error) {
+	return &fileTransaction{
+		storage: fs,
+		ops:     newStagedOps(),
+	}, nil
+}
+
+// Save 暂存Page保存
+func (tx *fileTransaction) Save(page Page) error {
+	return tx.ops.stagePage(page.GetIndex(), page)
+}
+
+// Delete 暂存Page删除
+func (tx *fileTransaction) Delete(pageIndex PageIndex) error {
+	return tx.ops.stagePage(pageIndex, nil)
+}
+
+// SaveSegment 暂存Segment元数据保存
+func (tx *fileTransaction) SaveSegment(segment *Segment) error {
+	return tx.ops.stageSegment(segment.GetID(), segment)
+}
+
+// DeleteSegment 暂存Segment元数据删除
+func (tx *fileTransaction) DeleteSegment(id SegmentID) error {
+	return tx.ops.stageSegment(id, nil)
+}
+
+// Abort 放弃事务（尚未写入任何文件）
+func (tx *fileTransaction) Abort() error {
+	return tx.ops.close()
+}
+
+// Commit 提交事务
+func (tx *fileTransaction) Commit() error {
+	if err := tx.ops.close(); err != nil {
+		return err
+	}
+	if len(tx.ops.pageOrder) == 0 && len(tx.ops.segmentOrder) == 0 {
+		return nil
+	}
+
+	fs := tx.storage
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.settleLocked(); err != nil {
+		return err
+	}
+
+	journal := fileJournal{}
+	var tmpFiles []string
+	cleanup := func() {
+		for _, path := range tmpFiles {
+			os.Remove(path)
+		}
+	}
+
+	// stage 写入临时文件并记录到日志
+	stage := func(target string, data []byte) error {
+		tmp := target + tmpExt
+		if err := fs.writeTemp(tmp, data); err != nil {
+			return err
+		}
+		tmpFiles = append(tmpFiles, tmp)
+		journal.Renames = append(journal.Renames, fileRename{From: fs.relPath(tmp), To: fs.relPath(target)})
+		return nil
+	}
+
+	// 1. Page 写入临时文件
+	for _, pageIndex := range tx.ops.pageOrder {
+		page := tx.ops.pages[pageIndex]
+		if page == nil {
+			journal.Deletes = append(journal.Deletes,
+				fs.relPath(fs.plainFilePath(pageIndex)), fs.relPath(fs.gzipFilePath(pageIndex)))
+			continue
+		}
+		data, err := page.Marshal()
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to marshal page %s: %w", pageIndex, err)
+		}
+		if err := stage(fs.filePath(pageIndex), data); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to stage page %s: %w", pageIndex, err)
+		}
+		journal.Deletes = append(journal.Deletes, fs.relPath(fs.otherFilePath(pageIndex)))
+	}
+
+	// 2. Segment 元数据整体重写
+	if len(tx.ops.segmentOrder) > 0 {
+		existing, err := fs.loadAllSegments()
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to load existing segments: %w", err)
+		}
+		data, err := json.MarshalIndent(tx.ops.applySegments(existing), "", "  ")
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to marshal segments: %w", err)
+		}
+		if err := stage(fs.segmentsFilePath(), data); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to stage segments: %w", err)
+		}
+		journal.Deletes = append(journal.Deletes, fs.relPath(fs.otherSegmentsFilePath()))
+	}
+
+	// 3. 写入事务日志（提交点）
+	journalData, err := json.Marshal(journal)
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+	if err := writeFileAtomic(fs.journalPath(), journalData); err != nil {
+		cleanup()
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+
+	// 4. 应用日志：此时事务已提交，失败时留待下次访问或重启时重做
+	if err := fs.applyJournal(journal); err != nil {
+		fs.pending = &journal
+	}
+	return nil
+}
+
+// settleLocked 重做上次未应用完的已提交事务（调用方需持有写锁）
+func (fs *FileStorage) settleLocked() error {
+	if fs.pending == nil {
+		return nil
+	}
+	if err := fs.applyJournal(*fs.pending); err != nil {
+		return fmt.Errorf("committed transaction not applied: %w", err)
+	}
+	fs.pending = nil
+	return nil
+}
+
+// rlock 获取读锁，存在未应用完的已提交事务时先重做，避免读到提交前的数据
+func (fs *FileStorage) rlock() error {
+	for {
+		fs.mu.RLock()
+		if fs.pending == nil {
+			return nil
+		}
+		fs.mu.RUnlock()
+
+		fs.mu.Lock()
+		err := fs.settleLocked()
+		fs.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// journalPath 获取事务日志路径
+func (fs *FileStorage) journalPath() string {
+	return filepath.Join(fs.dir, journalFileName)
+}
+
+// relPath 获取相对存储目录的路径
+func (fs *FileStorage) relPath(path string) string {
+	rel, err := filepath.Rel(fs.dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// writeTemp 按当前写入格式写入临时文件并 fsync
+func (fs *FileStorage) writeTemp(path string, data []byte) error {
+	if fs.useGzip {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+	}
+	return writeFileSync(path, data)
+}
+
+// applyJournal 执行日志中的 rename 和删除，完成后删除日志（幂等，可重复执行）
+//
+// 删除日志前先 fsync 涉及的目录，保证 rename 和删除已持久化；
+// 否则崩溃后日志已不在，目录项却可能回到提交前的状态。
+func (fs *FileStorage) applyJournal(journal fileJournal) error {
+	dirs := map[string]bool{fs.dir: true}
+	for _, r := range journal.Renames {
+		from := filepath.Join(fs.dir, r.From)
+		to := filepath.Join(fs.dir, r.To)
+		dirs[filepath.Dir(to)] = true
+		if err := os.Rename(from, to); err != nil {
+			if os.IsNotExist(err) {
+				continue // 已在之前的恢复中完成
+			}
+			return fmt.Errorf("failed to apply journal rename %s: %w", r.To, err)
+		}
+	}
+	for _, d := range journal.Deletes {
+		path := filepath.Join(fs.dir, d)
+		dirs[filepath.Dir(path)] = true
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to apply journal delete %s: %w", d, err)
+		}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("failed to sync directory: %w", err)
+		}
+	}
+	if err := os.Remove(fs.journalPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	if err := syncDir(fs.dir); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
+
+// recover 崩溃恢复：重做已提交的事务，清理未提交的临时文件
+func (fs *FileStorage) recover() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, err := os.ReadFile(fs.journalPath())
+	if err == nil {
+		var journal fileJournal
+		if err := json.Unmarshal(data, &journal); err != nil {
+			return fmt.Errorf("failed to parse journal: %w", err)
+		}
+		if err := fs.applyJournal(journal); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), tmpExt) {
+			os.Remove(filepath.Join(fs.dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// writeFileSync 写入文件并 fsync
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeFileAtomic 通过临时文件加 rename 原子写入，并 fsync 所在目录使 rename 持久化
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + tmpExt
+	if err := writeFileSync(tmp, data); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsync 目录，持久化其中的 rename、创建和删除
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
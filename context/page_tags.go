@@ -0,0 +1,195 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTagLength 标签键和值的最大长度
+const maxTagLength = 64
+
+// validateTag 检查标签键值是否合法
+//
+// 键不能为空，且不能包含空白和渲染时使用的分隔符（= , ; { }）；值不能包含换行。
+func validateTag(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("tag key cannot be empty")
+	}
+	if len(key) > maxTagLength || len(value) > maxTagLength {
+		return fmt.Errorf("tag key and value must be at most %d bytes", maxTagLength)
+	}
+	if strings.ContainsAny(key, " \t\r\n=,;{}") {
+		return fmt.Errorf("tag key %q cannot contain whitespace or any of = , ; { }", key)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("tag value cannot contain newlines")
+	}
+	return nil
+}
+
+// copyTags 复制标签，空标签返回 nil
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
+
+// formatTags 按键排序格式化标签：key=value, key=value
+func formatTags(tags map[string]string, sep string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + tags[key]
+	}
+	return strings.Join(parts, sep)
+}
+
+// replaceTags 整体替换Page的标签（用于回滚修订）
+func replaceTags(page Page, tags map[string]string) {
+	switch p := page.(type) {
+	case *DetailPage:
+		p.tags = copyTags(tags)
+	case *ContentsPage:
+		p.tags = copyTags(tags)
+	}
+}
+
+// ============ Page 标签方法 ============
+
+// GetTags 获取标签（返回副本）
+func (p *DetailPage) GetTags() map[string]string {
+	return copyTags(p.tags)
+}
+
+// SetTag 设置标签，已存在的键覆盖原值
+func (p *DetailPage) SetTag(key, value string) error {
+	if err := validateTag(key, value); err != nil {
+		return err
+	}
+	if p.tags == nil {
+		p.tags = make(map[string]string)
+	}
+	p.tags[key] = value
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// RemoveTag 删除标签
+func (p *DetailPage) RemoveTag(key string) error {
+	if _, ok := p.tags[key]; !ok {
+		return fmt.Errorf("tag %s not found", key)
+	}
+	delete(p.tags, key)
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// GetTags 获取标签（返回副本）
+func (p *ContentsPage) GetTags() map[string]string {
+	return copyTags(p.tags)
+}
+
+// SetTag 设置标签，已存在的键覆盖原值
+func (p *ContentsPage) SetTag(key, value string) error {
+	if err := validateTag(key, value); err != nil {
+		return err
+	}
+	if p.tags == nil {
+		p.tags = make(map[string]string)
+	}
+	p.tags[key] = value
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// RemoveTag 删除标签
+func (p *ContentsPage) RemoveTag(key string) error {
+	if _, ok := p.tags[key]; !ok {
+		return fmt.Errorf("tag %s not found", key)
+	}
+	delete(p.tags, key)
+	p.updatedAt = time.Now()
+	return nil
+}
+
+// ============ ContextSystem 标签操作 ============
+
+// SetTag 设置Page标签（系统级操作）
+func (cs *ContextSystem) SetTag(pageIndex PageIndex, key, value string) error {
+	return cs.setTagInternal(ActorSystem, pageIndex, key, value)
+}
+
+// RemoveTag 删除Page标签（系统级操作）
+func (cs *ContextSystem) RemoveTag(pageIndex PageIndex, key string) error {
+	return cs.removeTagInternal(ActorSystem, pageIndex, key)
+}
+
+// setTagInternal 设置Page标签（内部方法）
+func (cs *ContextSystem) setTagInternal(actor Actor, pageIndex PageIndex, key, value string) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	if err := page.SetTag(key, value); err != nil {
+		return err
+	}
+	return cs.saveTaggedPage(actor, page)
+}
+
+// removeTagInternal 删除Page标签（内部方法）
+func (cs *ContextSystem) removeTagInternal(actor Actor, pageIndex PageIndex, key string) error {
+	page, err := cs.GetPage(pageIndex)
+	if err != nil {
+		return err
+	}
+	if err := page.RemoveTag(key); err != nil {
+		return err
+	}
+	return cs.saveTaggedPage(actor, page)
+}
+
+// saveTaggedPage 持久化标签变更并记录修订
+func (cs *ContextSystem) saveTaggedPage(actor Actor, page Page) error {
+	page.RecordAccess(AccessEdit, time.Now())
+	if cs.storage != nil {
+		if err := cs.storage.Save(page); err != nil {
+			return fmt.Errorf("failed to save page %s: %w", page.GetIndex(), err)
+		}
+	}
+	cs.pageChanged(page, actor, RevisionUpdate)
+	return nil
+}
+
+// FindByTag 查找带有指定标签的Page（包括未缓存和冷归档的Page），按索引排序
+//
+// value 为空时匹配该键的任意值。
+func (cs *ContextSystem) FindByTag(key, value string) []Page {
+	cs.mu.RLock()
+	pages := cs.listAllPagesLocked()
+	cs.mu.RUnlock()
+
+	var matched []Page
+	for _, page := range pages {
+		tagValue, ok := page.GetTags()[key]
+		if !ok || (value != "" && tagValue != value) {
+			continue
+		}
+		matched = append(matched, page)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].GetIndex() < matched[j].GetIndex()
+	})
+	return matched
+}
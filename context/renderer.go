@@ -0,0 +1,270 @@
+package context
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// 内置渲染器名称
+const (
+	RenderMarkdown = "markdown" // markdown 标题 + [Expand]/[Hide] 标记（默认）
+	RenderXML      = "xml"      // <page index= name=> 标签嵌套
+	RenderJSON     = "json"     // 每个页面一行紧凑 JSON
+)
+
+// RenderOptions 渲染选项，由 ContextWindow 统一设置，对所有渲染器生效
+type RenderOptions struct {
+	ShowTags bool // 渲染页面标签
+}
+
+// Renderer 页面树渲染格式，决定模型看到的上下文结构
+//
+// ContextWindow 按渲染顺序遍历页面：先输出页面的 open 片段，再输出子页面，最后输出 close 片段。
+// 每个页面的 open + close 片段只依赖页面自身、深度和渲染选项，以便按页面缓存token数。
+type Renderer interface {
+	// Name 返回渲染器名称
+	Name() string
+	// RenderPage 渲染页面自身（不含子页面），返回子页面之前和之后的片段
+	RenderPage(page Page, depth int, opts RenderOptions) (open, close string)
+	// WrapSegment 包裹整个Segment的渲染结果
+	WrapSegment(segment Segment, content string) string
+}
+
+// NewRenderer 根据名称创建内置渲染器，名称为空时使用 markdown
+func NewRenderer(name string) (Renderer, error) {
+	switch name {
+	case "", RenderMarkdown:
+		return markdownRenderer{}, nil
+	case RenderXML:
+		return xmlRenderer{}, nil
+	case RenderJSON:
+		return jsonRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown renderer: %s", name)
+	}
+}
+
+// longestRun 返回 text 中字符 ch 的最长连续长度
+func longestRun(text string, ch rune) int {
+	longest, current := 0, 0
+	for _, r := range text {
+		if r == ch {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
+
+// fence 生成比 text 中最长的 ch 连续串更长的代码块围栏（至少3个），避免内容提前闭合代码块
+func fence(text string, ch rune) string {
+	n := longestRun(text, ch) + 1
+	if n < 3 {
+		n = 3
+	}
+	return strings.Repeat(string(ch), n)
+}
+
+// markdownRenderer markdown 格式渲染器
+type markdownRenderer struct{}
+
+func (markdownRenderer) Name() string { return RenderMarkdown }
+
+// RenderPage 格式：### [索引] 名称: 描述 {标签} [标记]，标题级别为 depth + 1
+// 展开的页面在标题下一行列出链接：Links: type→index, ...
+func (markdownRenderer) RenderPage(page Page, depth int, opts RenderOptions) (string, string) {
+	var builder strings.Builder
+
+	visibility := page.GetVisibility()
+	heading := strings.Repeat("#", depth+1)
+
+	builder.WriteString(fmt.Sprintf("%s [%s] %s", heading, page.GetIndex(), page.GetName()))
+	if desc := page.GetDescription(); desc != "" {
+		builder.WriteString(fmt.Sprintf(": %s", desc))
+	}
+	if tags := page.GetTags(); opts.ShowTags && len(tags) > 0 {
+		builder.WriteString(fmt.Sprintf(" {%s}", formatTags(tags, ", ")))
+	}
+	if links := page.GetLinks(); visibility == Expanded && len(links) > 0 {
+		builder.WriteString(fmt.Sprintf("\nLinks: %s", formatLinks(links)))
+	}
+
+	switch p := page.(type) {
+	case *DetailPage:
+		detail := p.GetDetail()
+		if visibility == Expanded && detail != "" {
+			// [Hide] 标记在外围，detail 内容用代码块包裹避免内部 markdown 语法冲突，
+			// 围栏长度超过 detail 中最长的 ~ 串，保证 detail 不会提前闭合代码块
+			tildes := fence(detail, '~')
+			builder.WriteString(fmt.Sprintf("\n[Hide]\n%s\n%s\n%s\n", tildes, detail, tildes))
+		} else if visibility == Hidden && detail != "" {
+			// Hidden 状态但有 detail 内容，显示 [Expand] 提示
+			builder.WriteString(" ([Expand]...)")
+		}
+
+	case *ContentsPage:
+		if visibility != Expanded && len(p.GetChildren()) > 0 {
+			// Hidden 状态但有子页面，显示 [Expand] 提示
+			builder.WriteString(fmt.Sprintf(" (%d [Expand]...)", len(p.GetChildren())))
+		}
+	}
+	builder.WriteString("\n")
+
+	return builder.String(), ""
+}
+
+// WrapSegment 在最外层包裹 ```markdown ... ``` 提醒Agent这是markdown格式
+func (markdownRenderer) WrapSegment(_ Segment, content string) string {
+	backticks := fence(content, '`')
+	return fmt.Sprintf("%smarkdown\n%s\n%s", backticks, content, backticks)
+}
+
+// xmlRenderer XML 标签渲染器，所有文本均经过转义，detail 内容不会破坏结构
+type xmlRenderer struct{}
+
+func (xmlRenderer) Name() string { return RenderXML }
+
+// xmlEscaper 转义 XML 文本和属性值（保留换行，便于模型阅读）
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// xmlEscape 转义 XML 文本和属性值
+func xmlEscape(text string) string {
+	return xmlEscaper.Replace(text)
+}
+
+// RenderPage 格式：<page index="" name="" description="" tags="" links="" state="">detail</page>，links 仅在展开时输出
+func (xmlRenderer) RenderPage(page Page, depth int, opts RenderOptions) (string, string) {
+	var builder strings.Builder
+
+	indent := strings.Repeat("  ", depth)
+	visibility := page.GetVisibility()
+
+	builder.WriteString(fmt.Sprintf(`%s<page index="%s" name="%s"`, indent, xmlEscape(string(page.GetIndex())), xmlEscape(page.GetName())))
+	if desc := page.GetDescription(); desc != "" {
+		builder.WriteString(fmt.Sprintf(` description="%s"`, xmlEscape(desc)))
+	}
+	if tags := page.GetTags(); opts.ShowTags && len(tags) > 0 {
+		builder.WriteString(fmt.Sprintf(` tags="%s"`, xmlEscape(formatTags(tags, "; "))))
+	}
+	if links := page.GetLinks(); visibility == Expanded && len(links) > 0 {
+		builder.WriteString(fmt.Sprintf(` links="%s"`, xmlEscape(formatLinks(links))))
+	}
+
+	switch p := page.(type) {
+	case *DetailPage:
+		detail := p.GetDetail()
+		if visibility == Expanded && detail != "" {
+			builder.WriteString(fmt.Sprintf(` state="expanded">%s</page>`+"\n", xmlEscape(detail)))
+		} else if visibility == Hidden && detail != "" {
+			builder.WriteString(` state="hidden"/>` + "\n")
+		} else {
+			builder.WriteString("/>\n")
+		}
+		return builder.String(), ""
+
+	case *ContentsPage:
+		children := len(p.GetChildren())
+		if visibility != Expanded && children > 0 {
+			builder.WriteString(fmt.Sprintf(` state="hidden" children="%d"/>`+"\n", children))
+			return builder.String(), ""
+		}
+		if visibility != Expanded || children == 0 {
+			builder.WriteString("/>\n")
+			return builder.String(), ""
+		}
+		builder.WriteString(` state="expanded">` + "\n")
+		return builder.String(), indent + "</page>\n"
+	}
+
+	builder.WriteString("/>\n")
+	return builder.String(), ""
+}
+
+// WrapSegment 包裹为 <segment id="" name="">...</segment>
+func (xmlRenderer) WrapSegment(segment Segment, content string) string {
+	return fmt.Sprintf("<segment id=\"%s\" name=\"%s\">\n%s</segment>",
+		xmlEscape(string(segment.GetID())), xmlEscape(segment.GetName()), content)
+}
+
+// jsonRenderer 紧凑 JSON 渲染器：每个页面一行 JSON 对象，按渲染顺序排列，层级由 depth 表示
+type jsonRenderer struct{}
+
+func (jsonRenderer) Name() string { return RenderJSON }
+
+// jsonPage 单个页面的 JSON 渲染结构
+type jsonPage struct {
+	Index       PageIndex         `json:"index"`
+	Name        string            `json:"name"`
+	Description string            `json:"desc,omitempty"`
+	Depth       int               `json:"depth"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Links       []PageLink        `json:"links,omitempty"` // 仅在展开时输出
+	State       string            `json:"state,omitempty"` // expanded / hidden，无可展开内容时省略
+	Children    int               `json:"children,omitempty"`
+	Detail      string            `json:"detail,omitempty"`
+}
+
+// RenderPage 格式：{"index":"","name":"","desc":"","depth":0,"tags":{},"state":"","detail":""}
+func (jsonRenderer) RenderPage(page Page, depth int, opts RenderOptions) (string, string) {
+	item := jsonPage{
+		Index:       page.GetIndex(),
+		Name:        page.GetName(),
+		Description: page.GetDescription(),
+		Depth:       depth,
+	}
+	if opts.ShowTags {
+		item.Tags = page.GetTags()
+	}
+
+	visibility := page.GetVisibility()
+	if visibility == Expanded {
+		item.Links = page.GetLinks()
+	}
+	switch p := page.(type) {
+	case *DetailPage:
+		if p.GetDetail() != "" {
+			item.State = jsonState(visibility)
+			if visibility == Expanded {
+				item.Detail = p.GetDetail()
+			}
+		}
+	case *ContentsPage:
+		if len(p.GetChildren()) > 0 {
+			item.State = jsonState(visibility)
+			if visibility != Expanded {
+				item.Children = len(p.GetChildren())
+			}
+		}
+	}
+
+	var builder strings.Builder
+	encoder := json.NewEncoder(&builder)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(item); err != nil {
+		return "", ""
+	}
+	return builder.String(), ""
+}
+
+// WrapSegment 包裹为 ```json ... ``` 代码块，首行为 Segment 信息
+func (jsonRenderer) WrapSegment(segment Segment, content string) string {
+	header, _ := json.Marshal(struct {
+		Segment SegmentID `json:"segment"`
+		Name    string    `json:"name"`
+	}{segment.GetID(), segment.GetName()})
+	backticks := fence(content, '`')
+	return fmt.Sprintf("%sjson\n%s\n%s%s", backticks, header, content, backticks)
+}
+
+// jsonState 返回可见性在 JSON 渲染中的状态名
+func jsonState(v PageVisibility) string {
+	if v == Expanded {
+		return "expanded"
+	}
+	return "hidden"
+}
@@ -0,0 +1,275 @@
+package context
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// 字段权重：名称和描述是对内容的概括，命中时权重更高
+const (
+	nameFieldWeight        = 3
+	descriptionFieldWeight = 2
+	detailFieldWeight      = 1
+)
+
+// SearchOptions 搜索选项
+type SearchOptions struct {
+	Limit   int       // 最多返回的结果数，<=0 表示不限
+	Segment SegmentID // 仅搜索指定 Segment，为空表示全部
+}
+
+// SearchResult 搜索结果
+type SearchResult struct {
+	Page  Page
+	Score float64
+}
+
+// indexedDoc 已索引的Page
+type indexedDoc struct {
+	terms  map[string]int // 词项 -> 加权词频
+	length int            // 加权文档长度
+}
+
+// searchIndex Page 全文倒排索引（BM25 排序）
+//
+// 覆盖 name、description 和 DetailPage 的 detail。索引在首次搜索时从存储构建，
+// 此后随每次 Page 变更增量维护；构建之前的变更无需处理，构建时会读取最新状态。
+type searchIndex struct {
+	docs     map[PageIndex]*indexedDoc
+	postings map[string]map[PageIndex]int // 词项 -> Page -> 加权词频
+	totalLen int
+	built    bool
+	mu       sync.Mutex
+}
+
+// newSearchIndex 创建空的全文索引
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[PageIndex]*indexedDoc),
+		postings: make(map[string]map[PageIndex]int),
+	}
+}
+
+// beginBuild 索引尚未构建时加锁并返回 true，之后由 buildPage 逐个加入Page，endBuild 完成构建并解锁
+func (idx *searchIndex) beginBuild() bool {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// buildPage 构建期间加入Page（beginBuild 已加锁）
+func (idx *searchIndex) buildPage(page Page) {
+	idx.addLocked(page)
+}
+
+// endBuild 标记索引已构建并解锁
+func (idx *searchIndex) endBuild() {
+	idx.built = true
+	idx.mu.Unlock()
+}
+
+// reset 清空索引，下次搜索时重新构建
+func (idx *searchIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.docs = make(map[PageIndex]*indexedDoc)
+	idx.postings = make(map[string]map[PageIndex]int)
+	idx.totalLen = 0
+	idx.built = false
+}
+
+// Update 重新索引Page（索引尚未构建时忽略）
+func (idx *searchIndex) Update(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+	idx.removeLocked(page.GetIndex())
+	idx.addLocked(page)
+}
+
+// Remove 从索引移除Page
+func (idx *searchIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(pageIndex)
+}
+
+// addLocked 添加Page到索引（调用方需持有锁）
+func (idx *searchIndex) addLocked(page Page) {
+	doc := &indexedDoc{terms: make(map[string]int)}
+	addField := func(text string, weight int) {
+		for _, term := range tokenize(text) {
+			doc.terms[term] += weight
+			doc.length += weight
+		}
+	}
+	addField(page.GetName(), nameFieldWeight)
+	addField(page.GetDescription(), descriptionFieldWeight)
+	if detailPage, ok := page.(*DetailPage); ok {
+		addField(detailPage.GetDetail(), detailFieldWeight)
+	}
+
+	pageIndex := page.GetIndex()
+	idx.docs[pageIndex] = doc
+	idx.totalLen += doc.length
+	for term, tf := range doc.terms {
+		posting, exists := idx.postings[term]
+		if !exists {
+			posting = make(map[PageIndex]int)
+			idx.postings[term] = posting
+		}
+		posting[pageIndex] = tf
+	}
+}
+
+// removeLocked 从索引移除Page（调用方需持有锁）
+func (idx *searchIndex) removeLocked(pageIndex PageIndex) {
+	doc, exists := idx.docs[pageIndex]
+	if !exists {
+		return
+	}
+	for term := range doc.terms {
+		posting := idx.postings[term]
+		delete(posting, pageIndex)
+		if len(posting) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= doc.length
+	delete(idx.docs, pageIndex)
+}
+
+// scoredIndex 带分数的Page索引
+type scoredIndex struct {
+	index PageIndex
+	score float64
+}
+
+// Search 按 BM25 打分返回匹配的Page索引（分数降序，同分按索引排序）
+func (idx *searchIndex) Search(query string, opts SearchOptions) []scoredIndex {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	n := len(idx.docs)
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(idx.totalLen) / float64(n)
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	prefix := ""
+	if opts.Segment != "" {
+		prefix = string(opts.Segment) + "-"
+	}
+
+	scores := make(map[PageIndex]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		posting := idx.postings[term]
+		df := float64(len(posting))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+		for pageIndex, tf := range posting {
+			if prefix != "" && !strings.HasPrefix(string(pageIndex), prefix) {
+				continue
+			}
+			docLen := float64(idx.docs[pageIndex].length)
+			f := float64(tf)
+			scores[pageIndex] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+		}
+	}
+
+	results := make([]scoredIndex, 0, len(scores))
+	for pageIndex, score := range scores {
+		results = append(results, scoredIndex{index: pageIndex, score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].index < results[j].index
+	})
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results
+}
+
+// ============ 分词 ============
+
+// tokenize 将文本切分为小写词项
+//
+// 字母数字按连续片段切分为单词；中日韩文字没有空格分隔，
+// 对连续的 CJK 片段同时产出单字和相邻二元组，兼顾单字查询和词语匹配的精度。
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		for i, r := range cjk {
+			tokens = append(tokens, string(r))
+			if i+1 < len(cjk) {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// isCJK 判断字符是否属于中日韩文字
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
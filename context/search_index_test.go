@@ -0,0 +1,49 @@
+package context
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTokenize 测试英文单词切分与中文单字+二元组切分
+func TestTokenize(t *testing.T) {
+	got := tokenize("Go语言, BM25!")
+	want := []string{"go", "语", "语言", "言", "bm25"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize() = %v, want %v", got, want)
+	}
+}
+
+// TestSearchIndex_Ranking 测试BM25排序、字段权重与Segment过滤
+func TestSearchIndex_Ranking(t *testing.T) {
+	idx := newSearchIndex()
+	buildIndexes(func(visit func(Page)) {}, idx)
+
+	add := func(index, name, detail string) {
+		page, _ := NewDetailPage(name, "", detail, "")
+		page.SetIndex(PageIndex(index))
+		idx.Update(page)
+	}
+	add("usr-1", "旅行计划", "下个月去京都看寺庙")
+	add("usr-2", "工作笔记", "讨论了京都分公司的预算")
+	add("topic-1", "京都", "关于京都的资料")
+	add("usr-3", "购物清单", "牛奶和面包")
+
+	results := idx.Search("京都", SearchOptions{})
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].index != "topic-1" {
+		t.Errorf("Expected name match ranked first, got %s", results[0].index)
+	}
+
+	results = idx.Search("京都", SearchOptions{Segment: "usr", Limit: 1})
+	if len(results) != 1 || results[0].index[:4] != "usr-" {
+		t.Errorf("Expected one usr result, got %v", results)
+	}
+
+	idx.Remove("topic-1")
+	if results := idx.Search("资料", SearchOptions{}); len(results) != 0 {
+		t.Errorf("Removed page should not match, got %v", results)
+	}
+}
@@ -93,6 +93,9 @@ type Segment struct {
 	// 元数据
 	createdAt time.Time
 	updatedAt time.Time
+
+	// 墓碑：已删除的 Segment 只保留索引计数器，同 ID 重建时继续计数
+	deleted bool
 }
 
 // NewSegment 创建新的Segment
@@ -150,6 +153,14 @@ func (s *Segment) GetIndexCounter() int {
 	return s.nextIndex
 }
 
+// tombstone 返回删除后保存的墓碑（保留 ID 和索引计数器）
+func (s *Segment) tombstone() *Segment {
+	tombstone := NewSegment(s.id, s.name, "", s.segType)
+	tombstone.nextIndex = s.nextIndex
+	tombstone.deleted = true
+	return tombstone
+}
+
 // ============ 基本信息 Getter/Setter（保持不变）============
 
 // GetID 获取Segment ID
@@ -288,6 +299,7 @@ func (s *Segment) UnmarshalJSON(data []byte) error {
 	s.nextIndex = seg.nextIndex
 	s.createdAt = seg.createdAt
 	s.updatedAt = seg.updatedAt
+	s.deleted = seg.deleted
 
 	return nil
 }
@@ -333,6 +345,7 @@ type segmentJSON struct {
 	NextIndex   int               `json:"nextIndex"`
 	CreatedAt   time.Time         `json:"createdAt"`
 	UpdatedAt   time.Time         `json:"updatedAt"`
+	Deleted     bool              `json:"deleted,omitempty"`
 }
 
 // marshalSegmentJSON 将Segment序列化为JSON
@@ -348,6 +361,7 @@ func marshalSegmentJSON(s *Segment) ([]byte, error) {
 		NextIndex:   s.nextIndex,
 		CreatedAt:   s.createdAt,
 		UpdatedAt:   s.updatedAt,
+		Deleted:     s.deleted,
 	}
 
 	return json.Marshal(jsonData)
@@ -372,5 +386,6 @@ func unmarshalSegmentJSON(data []byte) (*Segment, error) {
 		segmentID:   string(jsonData.ID),
 		createdAt:   jsonData.CreatedAt,
 		updatedAt:   jsonData.UpdatedAt,
+		deleted:     jsonData.Deleted,
 	}, nil
 }
@@ -0,0 +1,257 @@
+package context
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// embedBatchSize 单次调用 Embedder 的最大文本数
+const embedBatchSize = 64
+
+// vectorIndex Page 向量索引（语义检索）
+//
+// 与 searchIndex 一样在首次检索时从存储构建、随 Page 变更增量维护。
+// 变更时只记录待嵌入的文本，实际的向量计算推迟到检索时批量进行，
+// 避免在持有 ContextSystem 写锁的修改路径上调用远程 Embedder。
+// 配置了 cache 时向量持久化到 sidecar 文件，重启后文本未变的 Page 不再重新嵌入。
+type vectorIndex struct {
+	embedder Embedder
+	cache    *embeddingCache // 可为 nil
+	vectors  map[PageIndex][]float32
+	texts    map[PageIndex]string // 已嵌入向量对应的文本
+	pending  map[PageIndex]string // 待嵌入的 Page 文本
+	built    bool
+	mu       sync.Mutex
+}
+
+// newVectorIndex 创建空的向量索引
+func newVectorIndex(embedder Embedder) *vectorIndex {
+	return &vectorIndex{
+		embedder: embedder,
+		vectors:  make(map[PageIndex][]float32),
+		texts:    make(map[PageIndex]string),
+		pending:  make(map[PageIndex]string),
+	}
+}
+
+// SetEmbedder 替换Embedder并清空索引（不同 Embedder 的向量不可比较）
+func (idx *vectorIndex) SetEmbedder(embedder Embedder) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.embedder = embedder
+	idx.vectors = make(map[PageIndex][]float32)
+	idx.texts = make(map[PageIndex]string)
+	idx.pending = make(map[PageIndex]string)
+	idx.built = false
+}
+
+// SetCache 设置向量持久化缓存
+func (idx *vectorIndex) SetCache(cache *embeddingCache) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.cache = cache
+}
+
+// reset 清空索引，下次检索时重新构建
+func (idx *vectorIndex) reset() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.vectors = make(map[PageIndex][]float32)
+	idx.texts = make(map[PageIndex]string)
+	idx.pending = make(map[PageIndex]string)
+	idx.built = false
+}
+
+// beginBuild 索引尚未构建时加锁并返回 true，之后由 buildPage 逐个加入Page，endBuild 完成构建并解锁
+func (idx *vectorIndex) beginBuild() bool {
+	idx.mu.Lock()
+	if idx.built {
+		idx.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// buildPage 构建期间加入Page（beginBuild 已加锁）
+func (idx *vectorIndex) buildPage(page Page) {
+	idx.pending[page.GetIndex()] = pageText(page)
+}
+
+// endBuild 标记索引已构建并解锁
+func (idx *vectorIndex) endBuild() {
+	idx.built = true
+	idx.mu.Unlock()
+}
+
+// Update 标记Page需要重新嵌入（索引尚未构建时忽略）
+func (idx *vectorIndex) Update(page Page) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.built {
+		return
+	}
+	// 仅可见性等非文本字段变化时无需重新嵌入
+	pageIndex := page.GetIndex()
+	text := pageText(page)
+	if pending, exists := idx.pending[pageIndex]; exists {
+		if pending == text {
+			return
+		}
+	} else if embedded, exists := idx.texts[pageIndex]; exists && embedded == text {
+		return
+	}
+	idx.pending[pageIndex] = text
+}
+
+// Remove 从索引移除Page
+func (idx *vectorIndex) Remove(pageIndex PageIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	delete(idx.vectors, pageIndex)
+	delete(idx.texts, pageIndex)
+	delete(idx.pending, pageIndex)
+}
+
+// flush 批量嵌入待处理的Page
+//
+// 文本未变化的 Page 先从持久化缓存取回向量，其余的调用 Embedder。
+// 嵌入期间不持有锁；若期间 Page 又被修改或删除，则丢弃本次结果，保留新的待处理文本。
+func (idx *vectorIndex) flush() error {
+	idx.mu.Lock()
+	embedder, cache := idx.embedder, idx.cache
+	if len(idx.pending) == 0 {
+		idx.mu.Unlock()
+		return nil
+	}
+	indices := make([]PageIndex, 0, len(idx.pending))
+	texts := make([]string, 0, len(idx.pending))
+	for pageIndex, text := range idx.pending {
+		indices = append(indices, pageIndex)
+		texts = append(texts, text)
+	}
+	idx.mu.Unlock()
+
+	id := embedderID(embedder)
+	if id == "" {
+		cache = nil // 未知 Embedder 无法判断缓存向量是否可比较
+	}
+	if cache != nil {
+		if cached := cache.load(id); len(cached) > 0 {
+			missIndices := make([]PageIndex, 0, len(indices))
+			missTexts := make([]string, 0, len(texts))
+			idx.mu.Lock()
+			for i, text := range texts {
+				if vector, exists := cached[textKey(text)]; exists {
+					idx.applyLocked(embedder, indices[i], text, vector)
+					continue
+				}
+				missIndices = append(missIndices, indices[i])
+				missTexts = append(missTexts, text)
+			}
+			idx.mu.Unlock()
+			indices, texts = missIndices, missTexts
+		}
+	}
+
+	for start := 0; start < len(texts); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		vectors, err := embedder.Embed(texts[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to embed pages: %w", err)
+		}
+
+		idx.mu.Lock()
+		for i, vector := range vectors {
+			idx.applyLocked(embedder, indices[start+i], texts[start+i], vector)
+		}
+		idx.mu.Unlock()
+	}
+
+	if cache != nil && len(texts) > 0 {
+		idx.mu.Lock()
+		vectors := make(map[string][]float32, len(idx.vectors))
+		if idx.embedder == embedder {
+			for pageIndex, text := range idx.texts {
+				vectors[textKey(text)] = idx.vectors[pageIndex]
+			}
+		}
+		idx.mu.Unlock()
+		// 缓存只是优化，写入失败下次检索时重试
+		if len(vectors) > 0 {
+			_ = cache.save(id, vectors)
+		}
+	}
+	return nil
+}
+
+// applyLocked 记录嵌入结果（调用方需持有锁）
+//
+// Embedder 已被替换或 Page 文本在嵌入期间发生变化时丢弃结果。
+func (idx *vectorIndex) applyLocked(embedder Embedder, pageIndex PageIndex, text string, vector []float32) {
+	if idx.embedder != embedder {
+		return
+	}
+	if pending, exists := idx.pending[pageIndex]; exists && pending == text {
+		idx.vectors[pageIndex] = vector
+		idx.texts[pageIndex] = text
+		delete(idx.pending, pageIndex)
+	}
+}
+
+// Search 返回与查询最相似的 k 个Page索引（余弦相似度降序）
+func (idx *vectorIndex) Search(query string, k int) ([]scoredIndex, error) {
+	if err := idx.flush(); err != nil {
+		return nil, err
+	}
+
+	idx.mu.Lock()
+	embedder := idx.embedder
+	idx.mu.Unlock()
+
+	queryVectors, err := embedder.Embed([]string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	queryVector := queryVectors[0]
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	results := make([]scoredIndex, 0, len(idx.vectors))
+	for pageIndex, vector := range idx.vectors {
+		score := dot(queryVector, vector)
+		if score <= 0 {
+			continue
+		}
+		results = append(results, scoredIndex{index: pageIndex, score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].index < results[j].index
+	})
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// pageText 拼接Page的名称、描述和详情作为嵌入文本
+func pageText(page Page) string {
+	parts := []string{page.GetName(), page.GetDescription()}
+	if detailPage, ok := page.(*DetailPage); ok {
+		parts = append(parts, detailPage.GetDetail())
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,610 @@
+package context
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WAL 文件名
+const (
+	walLogFileName      = "wal.log"
+	walSnapshotFileName = "wal.snapshot"
+)
+
+// defaultWALCompactThreshold 默认自动压缩阈值（日志记录数）
+const defaultWALCompactThreshold = 1000
+
+// walOp WAL 记录类型
+type walOp string
+
+const (
+	walSavePage      walOp = "save"
+	walDeletePage    walOp = "delete"
+	walSaveSegment   walOp = "saveSegment"
+	walDeleteSegment walOp = "deleteSegment"
+	walBatch         walOp = "batch"
+	walRevision      walOp = "revision"
+)
+
+// walRecord WAL 中的一条记录（JSON Lines，每行一条）
+//
+// 事务提交写入一条 batch 记录，整行写入成功才生效；
+// 崩溃导致的末尾半行在重放时被丢弃，日志中间的损坏记录则在打开时报错。
+type walRecord struct {
+	Op        walOp           `json:"op"`
+	Index     PageIndex       `json:"index,omitempty"`
+	SegmentID SegmentID       `json:"segmentId,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Ops       []walRecord     `json:"ops,omitempty"`
+}
+
+// walSnapshot 压缩后的快照
+type walSnapshot struct {
+	Pages     map[PageIndex]json.RawMessage   `json:"pages"`
+	Segments  []json.RawMessage               `json:"segments"`
+	Revisions map[PageIndex][]json.RawMessage `json:"revisions,omitempty"`
+}
+
+// walLogFile 追加写日志文件（*os.File 实现，测试中可替换以模拟写入失败）
+type walLogFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// WALStorage 追加写日志存储实现
+//
+// 所有 Page/Segment 变更追加到 wal.log，内存中保存当前状态的序列化数据。
+// 打开时先加载快照再重放日志重建状态；日志记录数超过阈值时自动压缩为快照并截断日志。
+type WALStorage struct {
+	dir string
+
+	pages        map[PageIndex][]byte   // 当前Page数据（序列化）
+	segments     map[SegmentID][]byte   // 当前Segment数据（序列化）
+	segmentOrder []SegmentID            // Segment 保存顺序
+	revisions    map[PageIndex][][]byte // Page修订记录（序列化，按修订号升序）
+
+	log              walLogFile // 追加写日志
+	logSize          int64      // 最后一条完整记录之后的偏移，写入失败时截断回此处
+	logRecords       int        // 上次压缩后的日志记录数
+	compactThreshold int        // 自动压缩阈值，<=0 表示不自动压缩
+
+	mu sync.RWMutex
+}
+
+// NewWALStorage 创建WAL存储并从快照和日志恢复状态
+func NewWALStorage(dir string, compactThreshold int) (*WALStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	ws := &WALStorage{
+		dir:              dir,
+		pages:            make(map[PageIndex][]byte),
+		segments:         make(map[SegmentID][]byte),
+		revisions:        make(map[PageIndex][][]byte),
+		compactThreshold: compactThreshold,
+	}
+	if err := ws.replay(); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(ws.logPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wal log: %w", err)
+	}
+	ws.log = log
+	return ws, nil
+}
+
+// logPath 获取日志文件路径
+func (ws *WALStorage) logPath() string {
+	return filepath.Join(ws.dir, walLogFileName)
+}
+
+// snapshotPath 获取快照文件路径
+func (ws *WALStorage) snapshotPath() string {
+	return filepath.Join(ws.dir, walSnapshotFileName)
+}
+
+// Close 关闭日志文件
+func (ws *WALStorage) Close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.log == nil {
+		return nil
+	}
+	err := ws.log.Close()
+	ws.log = nil
+	return err
+}
+
+// ============ 重放与压缩 ============
+
+// replay 加载快照并重放日志（仅在打开时调用）
+func (ws *WALStorage) replay() error {
+	data, err := os.ReadFile(ws.snapshotPath())
+	if err == nil {
+		var snapshot walSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return fmt.Errorf("failed to parse wal snapshot: %w", err)
+		}
+		for index, raw := range snapshot.Pages {
+			ws.pages[index] = raw
+		}
+		for _, raw := range snapshot.Segments {
+			if err := ws.applyRecord(walRecord{Op: walSaveSegment, Data: raw}); err != nil {
+				return err
+			}
+		}
+		for index, revisions := range snapshot.Revisions {
+			for _, raw := range revisions {
+				ws.revisions[index] = append(ws.revisions[index], raw)
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read wal snapshot: %w", err)
+	}
+
+	data, err = os.ReadFile(ws.logPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read wal log: %w", err)
+	}
+
+	valid := 0 // 最后一条完整记录之后的偏移
+	for valid < len(data) {
+		end := bytes.IndexByte(data[valid:], '\n')
+		if end < 0 {
+			break // 崩溃导致的半行（未写完换行符），丢弃
+		}
+		var record walRecord
+		if err := json.Unmarshal(data[valid:valid+end], &record); err != nil {
+			if valid+end+1 == len(data) {
+				break // 最后一行损坏视为写入中断，丢弃
+			}
+			// 之后还有记录，丢弃会连带丢失所有后续的有效记录
+			return fmt.Errorf("corrupt wal record at offset %d: %w", valid, err)
+		}
+		if err := ws.applyRecord(record); err != nil {
+			return fmt.Errorf("invalid wal record at offset %d: %w", valid, err)
+		}
+		valid += end + 1
+		ws.logRecords++
+	}
+
+	// 截断无效尾部，保证后续追加从完整记录之后开始
+	ws.logSize = int64(valid)
+	if valid < len(data) {
+		if err := os.Truncate(ws.logPath(), int64(valid)); err != nil {
+			return fmt.Errorf("failed to truncate wal log: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkRecord 校验记录可以应用；batch 中的每个操作都会被校验
+func checkRecord(record walRecord) error {
+	switch record.Op {
+	case walSavePage, walDeletePage, walDeleteSegment:
+	case walSaveSegment:
+		var seg Segment
+		if err := seg.UnmarshalJSON(record.Data); err != nil {
+			return fmt.Errorf("invalid segment data: %w", err)
+		}
+	case walRevision:
+		var rev PageRevision
+		if err := json.Unmarshal(record.Data, &rev); err != nil {
+			return fmt.Errorf("invalid revision data: %w", err)
+		}
+	case walBatch:
+		for _, op := range record.Ops {
+			if op.Op == walBatch {
+				return fmt.Errorf("nested wal batch")
+			}
+			if err := checkRecord(op); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown wal op: %s", record.Op)
+	}
+	return nil
+}
+
+// applyRecord 将一条记录应用到内存状态（调用方需持有写锁或处于初始化阶段）
+//
+// 先校验整条记录再应用，batch 要么全部生效要么全部不生效。
+func (ws *WALStorage) applyRecord(record walRecord) error {
+	if err := checkRecord(record); err != nil {
+		return err
+	}
+	ws.apply(record)
+	return nil
+}
+
+// apply 应用已校验的记录
+func (ws *WALStorage) apply(record walRecord) {
+	switch record.Op {
+	case walSavePage:
+		ws.pages[record.Index] = record.Data
+	case walDeletePage:
+		delete(ws.pages, record.Index)
+	case walSaveSegment:
+		var seg Segment
+		seg.UnmarshalJSON(record.Data) // 已由 checkRecord 校验
+		if _, exists := ws.segments[seg.GetID()]; !exists {
+			ws.segmentOrder = append(ws.segmentOrder, seg.GetID())
+		}
+		ws.segments[seg.GetID()] = record.Data
+	case walDeleteSegment:
+		if _, exists := ws.segments[record.SegmentID]; !exists {
+			return
+		}
+		delete(ws.segments, record.SegmentID)
+		for i, id := range ws.segmentOrder {
+			if id == record.SegmentID {
+				ws.segmentOrder = append(ws.segmentOrder[:i], ws.segmentOrder[i+1:]...)
+				break
+			}
+		}
+	case walRevision:
+		// 修订记录是追加而非覆盖：按修订号去重，保证压缩中途崩溃后重复重放结果不变
+		var rev PageRevision
+		json.Unmarshal(record.Data, &rev) // 已由 checkRecord 校验
+		if rev.Revision <= len(ws.revisions[record.Index]) {
+			return
+		}
+		ws.revisions[record.Index] = append(ws.revisions[record.Index], record.Data)
+	case walBatch:
+		for _, op := range record.Ops {
+			ws.apply(op)
+		}
+	}
+}
+
+// appendRecord 校验记录后追加到日志、应用到内存，必要时自动压缩（调用方需持有写锁）
+//
+// 校验在写日志之前完成，写入日志的记录在内存和重放时都能完整应用。
+func (ws *WALStorage) appendRecord(record walRecord) error {
+	if ws.log == nil {
+		return fmt.Errorf("wal storage is closed")
+	}
+	if err := checkRecord(record); err != nil {
+		return fmt.Errorf("invalid wal record: %w", err)
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wal record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := ws.log.Write(line); err != nil {
+		return ws.discardTail(fmt.Errorf("failed to append wal record: %w", err))
+	}
+	if err := ws.log.Sync(); err != nil {
+		return ws.discardTail(fmt.Errorf("failed to sync wal log: %w", err))
+	}
+	ws.apply(record)
+
+	ws.logSize += int64(len(line))
+	ws.logRecords++
+	if ws.compactThreshold > 0 && ws.logRecords >= ws.compactThreshold {
+		// 记录已持久化，压缩失败不影响本次写入，下次追加时会重试
+		_ = ws.compactLocked()
+	}
+	return nil
+}
+
+// discardTail 将日志截断回最后一条完整记录之后，丢弃写入失败留下的半行
+//
+// 否则下一条记录会接在半行后面，重放时从这一行开始的所有记录都被丢弃。
+func (ws *WALStorage) discardTail(cause error) error {
+	if err := ws.log.Truncate(ws.logSize); err != nil {
+		return fmt.Errorf("%w (failed to truncate wal log: %v)", cause, err)
+	}
+	return cause
+}
+
+// Compact 将当前状态写入快照并截断日志
+func (ws *WALStorage) Compact() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.compactLocked()
+}
+
+// compactLocked 压缩实现（调用方需持有写锁）
+//
+// 先原子写入快照再截断日志；两步之间崩溃时重放会在快照上重复应用日志，
+// 由于记录都是完整状态的覆盖写，重复应用结果不变。
+func (ws *WALStorage) compactLocked() error {
+	snapshot := walSnapshot{
+		Pages:    make(map[PageIndex]json.RawMessage, len(ws.pages)),
+		Segments: make([]json.RawMessage, 0, len(ws.segmentOrder)),
+	}
+	for index, data := range ws.pages {
+		snapshot.Pages[index] = data
+	}
+	for _, id := range ws.segmentOrder {
+		snapshot.Segments = append(snapshot.Segments, ws.segments[id])
+	}
+	if len(ws.revisions) > 0 {
+		snapshot.Revisions = make(map[PageIndex][]json.RawMessage, len(ws.revisions))
+		for index, revisions := range ws.revisions {
+			for _, data := range revisions {
+				snapshot.Revisions[index] = append(snapshot.Revisions[index], data)
+			}
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wal snapshot: %w", err)
+	}
+	if err := writeFileAtomic(ws.snapshotPath(), data); err != nil {
+		return fmt.Errorf("failed to write wal snapshot: %w", err)
+	}
+
+	if err := ws.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate wal log: %w", err)
+	}
+	ws.logSize = 0
+	ws.logRecords = 0
+	return nil
+}
+
+// LogRecords 返回上次压缩后追加的日志记录数
+func (ws *WALStorage) LogRecords() int {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	return ws.logRecords
+}
+
+// ============ Page 方法 ============
+
+// pageRecord 构造Page保存记录
+func pageRecord(page Page) (walRecord, error) {
+	data, err := page.Marshal()
+	if err != nil {
+		return walRecord{}, fmt.Errorf("failed to marshal page: %w", err)
+	}
+	return walRecord{Op: walSavePage, Index: page.GetIndex(), Data: data}, nil
+}
+
+// segmentRecord 构造Segment保存记录
+func segmentRecord(segment *Segment) (walRecord, error) {
+	data, err := segment.MarshalJSON()
+	if err != nil {
+		return walRecord{}, fmt.Errorf("failed to marshal segment: %w", err)
+	}
+	return walRecord{Op: walSaveSegment, SegmentID: segment.GetID(), Data: data}, nil
+}
+
+// Save 追加Page保存记录
+func (ws *WALStorage) Save(page Page) error {
+	record, err := pageRecord(page)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.appendRecord(record)
+}
+
+// Load 加载Page
+func (ws *WALStorage) Load(pageIndex PageIndex) (Page, error) {
+	ws.mu.RLock()
+	data, exists := ws.pages[pageIndex]
+	ws.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("page %s not found", pageIndex)
+	}
+	return unmarshalPage(data)
+}
+
+// Delete 追加Page删除记录
+func (ws *WALStorage) Delete(pageIndex PageIndex) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, exists := ws.pages[pageIndex]; !exists {
+		return nil // 不存在视为成功
+	}
+	return ws.appendRecord(walRecord{Op: walDeletePage, Index: pageIndex})
+}
+
+// Exists 检查Page是否存在
+func (ws *WALStorage) Exists(pageIndex PageIndex) bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	_, exists := ws.pages[pageIndex]
+	return exists
+}
+
+// List 列出所有Page索引
+func (ws *WALStorage) List() ([]PageIndex, error) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	indices := make([]PageIndex, 0, len(ws.pages))
+	for index := range ws.pages {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// ============ Segment 方法 ============
+
+// SaveSegment 追加Segment保存记录
+func (ws *WALStorage) SaveSegment(segment *Segment) error {
+	record, err := segmentRecord(segment)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.appendRecord(record)
+}
+
+// LoadSegment 加载Segment
+func (ws *WALStorage) LoadSegment(id SegmentID) (*Segment, error) {
+	ws.mu.RLock()
+	data, exists := ws.segments[id]
+	ws.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("segment %s not found", id)
+	}
+	return unmarshalSegmentJSON(data)
+}
+
+// ListSegments 按保存顺序列出所有Segment
+func (ws *WALStorage) ListSegments() ([]*Segment, error) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	segments := make([]*Segment, 0, len(ws.segmentOrder))
+	for _, id := range ws.segmentOrder {
+		seg, err := unmarshalSegmentJSON(ws.segments[id])
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// DeleteSegment 追加Segment删除记录
+func (ws *WALStorage) DeleteSegment(id SegmentID) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if _, exists := ws.segments[id]; !exists {
+		return nil // 不存在视为成功
+	}
+	return ws.appendRecord(walRecord{Op: walDeleteSegment, SegmentID: id})
+}
+
+// ============ 修订历史方法 ============
+
+// AppendRevision 追加Page修订记录
+func (ws *WALStorage) AppendRevision(rev *PageRevision) error {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revision: %w", err)
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.appendRecord(walRecord{Op: walRevision, Index: rev.Index, Data: data})
+}
+
+// ListRevisions 列出Page的修订记录
+func (ws *WALStorage) ListRevisions(pageIndex PageIndex) ([]*PageRevision, error) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+
+	revisions := make([]*PageRevision, 0, len(ws.revisions[pageIndex]))
+	for _, data := range ws.revisions[pageIndex] {
+		var rev PageRevision
+		if err := json.Unmarshal(data, &rev); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal revision: %w", err)
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, nil
+}
+
+// ============ 事务 ============
+
+// walTransaction WALStorage 的事务实现：提交时写入单条 batch 记录
+type walTransaction struct {
+	storage *WALStorage
+	ops     *stagedOps
+}
+
+// Begin 开始一个事务
+func (ws *WALStorage) Begin() (Transaction, error) {
+	return &walTransaction{
+		storage: ws,
+		ops:     newStagedOps(),
+	}, nil
+}
+
+// Save 暂存Page保存
+func (tx *walTransaction) Save(page Page) error {
+	return tx.ops.stagePage(page.GetIndex(), page)
+}
+
+// Delete 暂存Page删除
+func (tx *walTransaction) Delete(pageIndex PageIndex) error {
+	return tx.ops.stagePage(pageIndex, nil)
+}
+
+// SaveSegment 暂存Segment保存
+func (tx *walTransaction) SaveSegment(segment *Segment) error {
+	return tx.ops.stageSegment(segment.GetID(), segment)
+}
+
+// DeleteSegment 暂存Segment删除
+func (tx *walTransaction) DeleteSegment(id SegmentID) error {
+	return tx.ops.stageSegment(id, nil)
+}
+
+// Abort 放弃事务
+func (tx *walTransaction) Abort() error {
+	return tx.ops.close()
+}
+
+// Commit 将所有暂存操作作为一条 batch 记录追加
+func (tx *walTransaction) Commit() error {
+	if err := tx.ops.close(); err != nil {
+		return err
+	}
+	if len(tx.ops.pageOrder) == 0 && len(tx.ops.segmentOrder) == 0 {
+		return nil
+	}
+
+	batch := walRecord{Op: walBatch}
+	for _, pageIndex := range tx.ops.pageOrder {
+		page := tx.ops.pages[pageIndex]
+		if page == nil {
+			batch.Ops = append(batch.Ops, walRecord{Op: walDeletePage, Index: pageIndex})
+			continue
+		}
+		record, err := pageRecord(page)
+		if err != nil {
+			return err
+		}
+		batch.Ops = append(batch.Ops, record)
+	}
+	for _, id := range tx.ops.segmentOrder {
+		segment := tx.ops.segments[id]
+		if segment == nil {
+			batch.Ops = append(batch.Ops, walRecord{Op: walDeleteSegment, SegmentID: id})
+			continue
+		}
+		record, err := segmentRecord(segment)
+		if err != nil {
+			return err
+		}
+		batch.Ops = append(batch.Ops, record)
+	}
+
+	tx.storage.mu.Lock()
+	defer tx.storage.mu.Unlock()
+	return tx.storage.appendRecord(batch)
+}
@@ -143,7 +143,26 @@ func (m *Model) Process(msgs message.MessageList) (message.Message, error) {
 		ToolCalls: rsp.Choices[0].Message.ToolCalls,
 	}
 
-	fmt.Printf("Total Tokens: %d\nCached Tokens: %d\n", rsp.Usage.TotalTokens, rsp.Usage.PromptTokensDetails.CachedTokens)
+	m.logUsage(rsp.Usage)
 
 	return msg, nil
 }
+
+// logUsage 记录 token 用量和 prompt 缓存命中比例
+func (m *Model) logUsage(usage Usage) {
+	m.lg.Info("Token usage",
+		logger.F("model", string(m.name)),
+		logger.F("total_tokens", usage.TotalTokens),
+		logger.F("prompt_tokens", usage.PromptTokens),
+		logger.F("cached_tokens", usage.PromptTokensDetails.CachedTokens),
+		logger.F("cached_ratio", usage.CachedRatio()),
+	)
+}
+
+// CachedRatio 返回 prompt 中命中缓存的 token 比例，prompt 为空时返回 0
+func (u Usage) CachedRatio() float64 {
+	if u.PromptTokens == 0 {
+		return 0
+	}
+	return float64(u.PromptTokensDetails.CachedTokens) / float64(u.PromptTokens)
+}
@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"fmt"
+	"memci/tokenizer"
+	"path/filepath"
+)
+
+// TokenizerName 返回模型使用的分词器名称（即词表目录下的子目录名），未知模型返回空字符串
+func (n ModelName) TokenizerName() string {
+	switch n {
+	case ModelQwenMax, ModelQwenPlus, ModelQwenFlash:
+		return "qwen"
+	case ModelDeepSeek:
+		return "deepseek"
+	default:
+		return ""
+	}
+}
+
+// LoadTokenizer 从词表目录加载模型对应的 BPE 分词器
+//
+// 词表位于 <dir>/<TokenizerName>/ 下（tokenizer.json 或 vocab.json + merges.txt）。
+// 未知模型或词表缺失时返回错误，调用方应回退到 tokenizer.HeuristicTokenizer。
+func LoadTokenizer(dir string, name ModelName) (tokenizer.Tokenizer, error) {
+	tokenizerName := name.TokenizerName()
+	if tokenizerName == "" {
+		return nil, fmt.Errorf("no tokenizer known for model %s", name)
+	}
+	tk, err := tokenizer.LoadBPE(filepath.Join(dir, tokenizerName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %s for model %s: %w", tokenizerName, name, err)
+	}
+	return tk, nil
+}
@@ -0,0 +1,250 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 词表文件名
+const (
+	tokenizerJSONFile = "tokenizer.json" // HuggingFace tokenizers 格式（包含 vocab 和 merges）
+	vocabFile         = "vocab.json"     // GPT-2 格式词表
+	mergesFile        = "merges.txt"     // GPT-2 格式合并规则
+)
+
+// maxWordCacheSize 单词缓存的最大条目数，超出后清空重建
+const maxWordCacheSize = 100000
+
+// pretokenizePattern 预分词正则
+//
+// 与 GPT-2 的规则一致，但 Go 的 regexp 不支持 `\s+(?!\S)` 这类前瞻，
+// 连续空白统一作为一个片段，对计数的影响可以忽略。
+var pretokenizePattern = regexp.MustCompile(`'s|'t|'re|'ve|'m|'ll|'d| ?\pL+| ?\pN+| ?[^\s\pL\pN]+|\s+`)
+
+// byteEncoder 字节到可见 Unicode 字符的映射（byte-level BPE 的基础字母表）
+var byteEncoder = buildByteEncoder()
+
+// buildByteEncoder 构建 GPT-2 的 bytes_to_unicode 映射
+//
+// 可打印字符映射为自身，其余字节依次映射到 256 之后的码位，保证每个字节都有可见的表示。
+func buildByteEncoder() [256]string {
+	var encoder [256]string
+	printable := func(b int) bool {
+		return (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+	}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if printable(b) {
+			encoder[b] = string(rune(b))
+		} else {
+			encoder[b] = string(rune(256 + n))
+			n++
+		}
+	}
+	return encoder
+}
+
+// BPETokenizer 纯 Go 实现的 byte-level BPE 分词器
+//
+// 文本先按预分词正则切分，每个片段的 UTF-8 字节映射为基础字母表后，
+// 按合并规则的优先级反复合并相邻符号。片段的 token 数会被缓存，重复出现的单词无需重新合并。
+type BPETokenizer struct {
+	vocab map[string]int
+	ranks map[string]int // "a b" -> 合并优先级（越小越先合并）
+
+	cache map[string]int // 片段 -> token 数
+	mu    sync.Mutex
+}
+
+// NewBPETokenizer 由词表和合并规则创建分词器
+func NewBPETokenizer(vocab map[string]int, merges [][2]string) *BPETokenizer {
+	ranks := make(map[string]int, len(merges))
+	for i, merge := range merges {
+		key := merge[0] + " " + merge[1]
+		if _, exists := ranks[key]; !exists {
+			ranks[key] = i
+		}
+	}
+	return &BPETokenizer{
+		vocab: vocab,
+		ranks: ranks,
+		cache: make(map[string]int),
+	}
+}
+
+// LoadBPE 从目录加载分词器
+//
+// 优先读取 tokenizer.json，不存在时读取 vocab.json 和 merges.txt。
+func LoadBPE(dir string) (*BPETokenizer, error) {
+	if _, err := os.Stat(filepath.Join(dir, tokenizerJSONFile)); err == nil {
+		return LoadBPEFromTokenizerJSON(filepath.Join(dir, tokenizerJSONFile))
+	}
+	return LoadBPEFromFiles(filepath.Join(dir, vocabFile), filepath.Join(dir, mergesFile))
+}
+
+// LoadBPEFromFiles 从 GPT-2 格式的 vocab.json 和 merges.txt 加载分词器
+func LoadBPEFromFiles(vocabPath, mergesPath string) (*BPETokenizer, error) {
+	data, err := os.ReadFile(vocabPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vocab: %w", err)
+	}
+	vocab := make(map[string]int)
+	if err := json.Unmarshal(data, &vocab); err != nil {
+		return nil, fmt.Errorf("failed to parse vocab: %w", err)
+	}
+
+	file, err := os.Open(mergesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read merges: %w", err)
+	}
+	defer file.Close()
+
+	var merges [][2]string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#version") {
+			continue
+		}
+		parts := strings.Split(line, " ")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid merge at line %d: %q", lineNo, line)
+		}
+		merges = append(merges, [2]string{parts[0], parts[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read merges: %w", err)
+	}
+
+	return NewBPETokenizer(vocab, merges), nil
+}
+
+// tokenizerJSON tokenizer.json 中用到的字段
+type tokenizerJSON struct {
+	Model struct {
+		Type   string            `json:"type"`
+		Vocab  map[string]int    `json:"vocab"`
+		Merges []json.RawMessage `json:"merges"`
+	} `json:"model"`
+}
+
+// LoadBPEFromTokenizerJSON 从 HuggingFace 的 tokenizer.json 加载分词器
+//
+// merges 兼容 "a b" 字符串和 ["a", "b"] 数组两种写法。
+func LoadBPEFromTokenizerJSON(path string) (*BPETokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer: %w", err)
+	}
+	var parsed tokenizerJSON
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse tokenizer: %w", err)
+	}
+	if parsed.Model.Type != "" && parsed.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model type: %s", parsed.Model.Type)
+	}
+
+	merges := make([][2]string, 0, len(parsed.Model.Merges))
+	for i, raw := range parsed.Model.Merges {
+		var pair []string
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			pair = strings.Split(text, " ")
+		} else if err := json.Unmarshal(raw, &pair); err != nil {
+			return nil, fmt.Errorf("invalid merge %d: %w", i, err)
+		}
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid merge %d: %s", i, string(raw))
+		}
+		merges = append(merges, [2]string{pair[0], pair[1]})
+	}
+
+	return NewBPETokenizer(parsed.Model.Vocab, merges), nil
+}
+
+// Count 返回文本编码后的 token 数量
+func (t *BPETokenizer) Count(text string) int {
+	total := 0
+	for _, word := range pretokenizePattern.FindAllString(text, -1) {
+		total += t.countWord(word)
+	}
+	return total
+}
+
+// Tokenize 返回文本编码后的 token（基础字母表表示）
+func (t *BPETokenizer) Tokenize(text string) []string {
+	var tokens []string
+	for _, word := range pretokenizePattern.FindAllString(text, -1) {
+		tokens = append(tokens, t.bpe(word)...)
+	}
+	return tokens
+}
+
+// countWord 返回单个预分词片段的 token 数量（带缓存）
+func (t *BPETokenizer) countWord(word string) int {
+	t.mu.Lock()
+	count, exists := t.cache[word]
+	t.mu.Unlock()
+	if exists {
+		return count
+	}
+
+	count = len(t.bpe(word))
+
+	t.mu.Lock()
+	if len(t.cache) >= maxWordCacheSize {
+		t.cache = make(map[string]int)
+	}
+	t.cache[word] = count
+	t.mu.Unlock()
+	return count
+}
+
+// bpe 对单个预分词片段执行合并
+func (t *BPETokenizer) bpe(word string) []string {
+	symbols := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		symbols[i] = byteEncoder[word[i]]
+	}
+
+	for len(symbols) > 1 {
+		// 找到优先级最高的相邻符号对
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(symbols); i++ {
+			rank, exists := t.ranks[symbols[i]+" "+symbols[i+1]]
+			if exists && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		// 合并该符号对的所有出现
+		first, second := symbols[best], symbols[best+1]
+		merged := make([]string, 0, len(symbols)-1)
+		for i := 0; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == first && symbols[i+1] == second {
+				merged = append(merged, first+second)
+				i++
+			} else {
+				merged = append(merged, symbols[i])
+			}
+		}
+		symbols = merged
+	}
+	return symbols
+}
+
+// TokenID 返回 token 在词表中的 ID
+func (t *BPETokenizer) TokenID(token string) (int, bool) {
+	id, exists := t.vocab[token]
+	return id, exists
+}
@@ -0,0 +1,78 @@
+package tokenizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile 写入测试文件
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// TestBPETokenizer_Files 测试从 vocab.json 和 merges.txt 加载并计数
+func TestBPETokenizer_Files(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, vocabFile), `{"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "he": 5, "ll": 6, "hell": 7, "hello": 8}`)
+	writeFile(t, filepath.Join(dir, mergesFile), "#version: 0.2\nh e\nl l\nhe ll\nhell o\n")
+
+	tk, err := LoadBPE(dir)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+
+	// "hello" 合并为 1 个 token，" hello" 为 Ġ + hello
+	if got := tk.Count("hello hello"); got != 3 {
+		t.Errorf("Expected 3 tokens, got %d (%v)", got, tk.Tokenize("hello hello"))
+	}
+	if id, ok := tk.TokenID("hello"); !ok || id != 8 {
+		t.Errorf("Expected id 8 for hello, got %d", id)
+	}
+	// 无合并规则的中文按字节计数
+	if got := tk.Count("你好"); got != 6 {
+		t.Errorf("Expected 6 byte tokens, got %d", got)
+	}
+	// 缓存命中结果一致
+	if got := tk.Count("hello hello"); got != 3 {
+		t.Errorf("Expected cached count 3, got %d", got)
+	}
+}
+
+// TestBPETokenizer_TokenizerJSON 测试从 tokenizer.json 加载（数组形式的 merges）
+func TestBPETokenizer_TokenizerJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, tokenizerJSONFile), `{
+		"model": {
+			"type": "BPE",
+			"vocab": {"ä": 0, "½": 1, "ł": 2, "å": 3, "¥": 4, "½": 5, "ä½": 6, "ä½ł": 7},
+			"merges": [["ä", "½"], ["ä½", "ł"]]
+		}
+	}`)
+
+	tk, err := LoadBPE(dir)
+	if err != nil {
+		t.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	// "你" 的 UTF-8 字节 e4 bd a0 映射为 ä ½ ł，合并为 1 个 token
+	if got := tk.Count("你"); got != 1 {
+		t.Errorf("Expected 1 token, got %d (%v)", got, tk.Tokenize("你"))
+	}
+}
+
+// TestLoadBPE_Missing 测试词表不存在时返回错误
+func TestLoadBPE_Missing(t *testing.T) {
+	if _, err := LoadBPE(t.TempDir()); err == nil {
+		t.Error("Expected error for missing vocab")
+	}
+}
+
+// TestHeuristicTokenizer 测试启发式估算
+func TestHeuristicTokenizer(t *testing.T) {
+	if got := NewHeuristicTokenizer().Count("abcdef"); got != 2 {
+		t.Errorf("Expected 2 tokens, got %d", got)
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"fmt"
 	"go.starlark.net/starlark"
 	"memci/context"
+	"sort"
+	"time"
 )
 
+// defaultFindPageLimit find_page 默认返回的结果数
+const defaultFindPageLimit = 10
+
+// defaultRecallK recall 默认返回的结果数
+const defaultRecallK = 5
+
 // ContextToolsProvider 为 AgentContext 提供 Starlark 工具注册
 type ContextToolsProvider struct {
 	agentContext *context.AgentContext
@@ -25,23 +33,52 @@ func (p *ContextToolsProvider) RegisterTools() starlark.StringDict {
 		"get_segment":   starlark.NewBuiltin("get_segment", p.getSegmentFn),
 		"list_segments": starlark.NewBuiltin("list_segments", p.listSegmentsFn),
 
+		// 自定义 Segment 管理工具
+		"create_segment": starlark.NewBuiltin("create_segment", p.createSegmentFn),
+		"rename_segment": starlark.NewBuiltin("rename_segment", p.renameSegmentFn),
+		"delete_segment": starlark.NewBuiltin("delete_segment", p.deleteSegmentFn),
+
 		// Page 状态变更工具
 		"update_page":    starlark.NewBuiltin("update_page", p.updatePageFn),
 		"expand_details": starlark.NewBuiltin("expand_details", p.expandDetailsFn),
 		"hide_details":   starlark.NewBuiltin("hide_details", p.hideDetailsFn),
+		"set_importance": starlark.NewBuiltin("set_importance", p.setImportanceFn),
+		"set_tag":        starlark.NewBuiltin("set_tag", p.setTagFn),
+		"remove_tag":     starlark.NewBuiltin("remove_tag", p.removeTagFn),
+		"set_expiry":     starlark.NewBuiltin("set_expiry", p.setExpiryFn),
+		"clear_expiry":   starlark.NewBuiltin("clear_expiry", p.clearExpiryFn),
+		"pin_page":       starlark.NewBuiltin("pin_page", p.pinPageFn),
+		"unpin_page":     starlark.NewBuiltin("unpin_page", p.unpinPageFn),
 
 		// Page 结构操作工具
 		"move_page":           starlark.NewBuiltin("move_page", p.movePageFn),
 		"remove_page":         starlark.NewBuiltin("remove_page", p.removePageFn),
+		"preview_remove":      starlark.NewBuiltin("preview_remove", p.previewRemoveFn),
 		"create_detail_page":  starlark.NewBuiltin("create_detail_page", p.createDetailPageFn),
 		"create_contents_page": starlark.NewBuiltin("create_contents_page", p.createContentsPageFn),
 
+		// Page 链接工具
+		"create_link":   starlark.NewBuiltin("create_link", p.createLinkFn),
+		"delete_link":   starlark.NewBuiltin("delete_link", p.deleteLinkFn),
+		"follow_links":  starlark.NewBuiltin("follow_links", p.followLinksFn),
+		"get_backlinks": starlark.NewBuiltin("get_backlinks", p.getBacklinksFn),
+
 		// Page 查询工具
 		"get_page":      starlark.NewBuiltin("get_page", p.getPageFn),
 		"get_children":  starlark.NewBuiltin("get_children", p.getChildrenFn),
 		"get_parent":    starlark.NewBuiltin("get_parent", p.getParentFn),
 		"get_ancestors": starlark.NewBuiltin("get_ancestors", p.getAncestorsFn),
 		"find_page":     starlark.NewBuiltin("find_page", p.findPageFn),
+		"recall":        starlark.NewBuiltin("recall", p.recallFn),
+		"find_by_tag":   starlark.NewBuiltin("find_by_tag", p.findByTagFn),
+
+		// Page 修订历史工具
+		"get_page_history": starlark.NewBuiltin("get_page_history", p.getPageHistoryFn),
+		"revert_page":      starlark.NewBuiltin("revert_page", p.revertPageFn),
+
+		// Page 冷归档工具
+		"archive_page": starlark.NewBuiltin("archive_page", p.archivePageFn),
+		"restore_page": starlark.NewBuiltin("restore_page", p.restorePageFn),
 	}
 }
 
@@ -80,14 +117,65 @@ func (p *ContextToolsProvider) listSegmentsFn(thread *starlark.Thread, fn *starl
 
 // segmentToDict 将 context.Segment 转换为 Starlark Dict
 func segmentToDict(seg context.Segment) *starlark.Dict {
-	dict := starlark.NewDict(4)
+	dict := starlark.NewDict(5)
 	dict.SetKey(starlark.String("id"), starlark.String(string(seg.GetID())))
+	dict.SetKey(starlark.String("name"), starlark.String(seg.GetName()))
 	dict.SetKey(starlark.String("type"), starlark.String(seg.GetType().String()))
 	dict.SetKey(starlark.String("permission"), starlark.String(seg.GetPermission().String()))
 	dict.SetKey(starlark.String("root_index"), starlark.String(string(seg.GetRootIndex())))
 	return dict
 }
 
+// ============ 自定义 Segment 管理工具实现 ============
+
+// create_segment 创建自定义 Segment，返回根 Page 的 index
+func (p *ContextToolsProvider) createSegmentFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id, name, description string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "id", &id, "name", &name, "description?", &description); err != nil {
+		return nil, err
+	}
+
+	rootIndex, err := p.agentContext.CreateSegment(context.SegmentID(id), name, description)
+	if err != nil {
+		return nil, fmt.Errorf("create_segment: %w", err)
+	}
+
+	return starlark.String(string(rootIndex)), nil
+}
+
+// rename_segment 修改自定义 Segment 的名称和描述
+func (p *ContextToolsProvider) renameSegmentFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id, name, description string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "id", &id, "name", &name, "description?", &description); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.RenameSegment(context.SegmentID(id), name, description)
+	if err != nil {
+		return nil, fmt.Errorf("rename_segment: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// delete_segment 删除自定义 Segment 及其下的所有 Page
+func (p *ContextToolsProvider) deleteSegmentFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var id string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "id", &id); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.DeleteSegment(context.SegmentID(id))
+	if err != nil {
+		return nil, fmt.Errorf("delete_segment: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
 // ============ Page 状态变更工具实现 ============
 
 // update_page 更新 Page 信息
@@ -138,6 +226,131 @@ func (p *ContextToolsProvider) hideDetailsFn(thread *starlark.Thread, fn *starla
 	return starlark.None, nil
 }
 
+// set_importance 设置 Page 的重要性分数（0~1）
+func (p *ContextToolsProvider) setImportanceFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+	var importance float64
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "importance", &importance); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.SetImportance(context.PageIndex(pageIndex), importance)
+	if err != nil {
+		return nil, fmt.Errorf("set_importance: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// set_tag 设置 Page 标签，已存在的键覆盖原值
+func (p *ContextToolsProvider) setTagFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex, key, value string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "key", &key, "value", &value); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.SetTag(context.PageIndex(pageIndex), key, value)
+	if err != nil {
+		return nil, fmt.Errorf("set_tag: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// remove_tag 删除 Page 标签
+func (p *ContextToolsProvider) removeTagFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex, key string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "key", &key); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.RemoveTag(context.PageIndex(pageIndex), key)
+	if err != nil {
+		return nil, fmt.Errorf("remove_tag: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// set_expiry 设置 Page 到期时间和到期动作（hide/archive/remove）
+//
+// expires_at 可以是相对时长（如 "2h"、"3d"）或绝对时间（如 "2024-06-01 12:00"）。
+func (p *ContextToolsProvider) setExpiryFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex, expiresAt string
+	action := string(context.ExpireHide)
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "expires_at", &expiresAt, "action?", &action); err != nil {
+		return nil, err
+	}
+
+	at, err := context.ParseExpiryTime(expiresAt, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("set_expiry: %w", err)
+	}
+	expiryAction, err := context.ParseExpiryAction(action)
+	if err != nil {
+		return nil, fmt.Errorf("set_expiry: %w", err)
+	}
+
+	err = p.agentContext.SetExpiry(context.PageIndex(pageIndex), at, expiryAction)
+	if err != nil {
+		return nil, fmt.Errorf("set_expiry: %w", err)
+	}
+
+	return starlark.String(at.Format("2006-01-02 15:04:05")), nil
+}
+
+// clear_expiry 取消 Page 的到期设置
+func (p *ContextToolsProvider) clearExpiryFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.ClearExpiry(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("clear_expiry: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// pin_page 固定 Page，自动折叠时不会隐藏
+func (p *ContextToolsProvider) pinPageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.PinPage(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("pin_page: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// unpin_page 取消固定 Page
+func (p *ContextToolsProvider) unpinPageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.UnpinPage(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("unpin_page: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
 // ============ Page 结构操作工具实现 ============
 
 // move_page 移动 Page
@@ -172,6 +385,56 @@ func (p *ContextToolsProvider) removePageFn(thread *starlark.Thread, fn *starlar
 	return starlark.None, nil
 }
 
+// preview_remove 预览删除 Page 的影响
+func (p *ContextToolsProvider) previewRemoveFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	preview, err := p.agentContext.PreviewRemove(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("preview_remove: %w", err)
+	}
+
+	return removalPreviewToDict(preview), nil
+}
+
+// removalPreviewToDict 将 context.RemovalPreview 转换为 Starlark Dict
+func removalPreviewToDict(preview *context.RemovalPreview) *starlark.Dict {
+	indicesToList := func(indices []context.PageIndex) *starlark.List {
+		elements := make([]starlark.Value, len(indices))
+		for i, index := range indices {
+			elements[i] = starlark.String(string(index))
+		}
+		return starlark.NewList(elements)
+	}
+
+	backlinks := make([]starlark.Value, len(preview.Backlinks))
+	for i, backlink := range preview.Backlinks {
+		item := starlark.NewDict(2)
+		item.SetKey(starlark.String("source"), starlark.String(string(backlink.Source)))
+		item.SetKey(starlark.String("type"), starlark.String(backlink.Type))
+		backlinks[i] = item
+	}
+
+	action := "delete"
+	if preview.Archive {
+		action = "archive"
+	}
+
+	dict := starlark.NewDict(7)
+	dict.SetKey(starlark.String("page_index"), starlark.String(string(preview.Root)))
+	dict.SetKey(starlark.String("action"), starlark.String(action))
+	dict.SetKey(starlark.String("pages"), indicesToList(preview.Pages))
+	dict.SetKey(starlark.String("descendants"), starlark.MakeInt(preview.Descendants()))
+	dict.SetKey(starlark.String("tokens"), starlark.MakeInt(preview.Tokens))
+	dict.SetKey(starlark.String("pinned"), indicesToList(preview.Pinned))
+	dict.SetKey(starlark.String("backlinks"), starlark.NewList(backlinks))
+	return dict
+}
+
 // create_detail_page 创建 DetailPage
 func (p *ContextToolsProvider) createDetailPageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var name, description, detail, parentIndex string
@@ -220,6 +483,87 @@ func (p *ContextToolsProvider) createContentsPageFn(thread *starlark.Thread, fn
 	return starlark.String(string(index)), nil
 }
 
+// ============ Page 链接工具实现 ============
+
+// create_link 创建 source 指向 target 的有类型链接，type 默认为 related
+func (p *ContextToolsProvider) createLinkFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var source, target, linkType string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "source", &source, "target", &target, "type?", &linkType); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.CreateLink(context.PageIndex(source), context.PageIndex(target), linkType)
+	if err != nil {
+		return nil, fmt.Errorf("create_link: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// delete_link 删除 source 指向 target 的链接，省略 type 时删除全部类型
+func (p *ContextToolsProvider) deleteLinkFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var source, target, linkType string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "source", &source, "target", &target, "type?", &linkType); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.DeleteLink(context.PageIndex(source), context.PageIndex(target), linkType)
+	if err != nil {
+		return nil, fmt.Errorf("delete_link: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// follow_links 获取 Page 链接指向的 Page，每项在 Page 信息之外附带 link_type
+func (p *ContextToolsProvider) followLinksFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex, linkType string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "type?", &linkType); err != nil {
+		return nil, err
+	}
+
+	links, pages, err := p.agentContext.FollowLinks(context.PageIndex(pageIndex), linkType)
+	if err != nil {
+		return nil, fmt.Errorf("follow_links: %w", err)
+	}
+
+	elements := make([]starlark.Value, len(pages))
+	for i, page := range pages {
+		dict := pageToDict(page)
+		dict.SetKey(starlark.String("link_type"), starlark.String(links[i].Type))
+		elements[i] = dict
+	}
+
+	return starlark.NewList(elements), nil
+}
+
+// get_backlinks 获取指向 Page 的链接
+func (p *ContextToolsProvider) getBacklinksFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	backlinks, err := p.agentContext.GetBacklinks(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("get_backlinks: %w", err)
+	}
+
+	elements := make([]starlark.Value, len(backlinks))
+	for i, backlink := range backlinks {
+		dict := starlark.NewDict(2)
+		dict.SetKey(starlark.String("source"), starlark.String(string(backlink.Source)))
+		dict.SetKey(starlark.String("type"), starlark.String(backlink.Type))
+		elements[i] = dict
+	}
+
+	return starlark.NewList(elements), nil
+}
+
 // ============ Page 查询工具实现 ============
 
 // get_page 获取 Page
@@ -300,15 +644,33 @@ func (p *ContextToolsProvider) getAncestorsFn(thread *starlark.Thread, fn *starl
 	return starlark.NewList(elements), nil
 }
 
-// find_page 查找 Page
+// find_page 全文搜索 Page，按相关度排序
 func (p *ContextToolsProvider) findPageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var query string
+	var segment string
+	limit := defaultFindPageLimit
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "query", &query, "limit?", &limit, "segment?", &segment); err != nil {
+		return nil, err
+	}
+
+	results := p.agentContext.SearchPages(query, context.SearchOptions{
+		Limit:   limit,
+		Segment: context.SegmentID(segment),
+	})
+
+	return searchResultsToList(results), nil
+}
+
+// find_by_tag 查找带有指定标签的 Page，省略 value 时匹配该键的任意值
+func (p *ContextToolsProvider) findByTagFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key, value string
 
-	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "query", &query); err != nil {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "key", &key, "value?", &value); err != nil {
 		return nil, err
 	}
 
-	pages := p.agentContext.FindPage(query)
+	pages := p.agentContext.FindByTag(key, value)
 
 	elements := make([]starlark.Value, len(pages))
 	for i, page := range pages {
@@ -318,6 +680,147 @@ func (p *ContextToolsProvider) findPageFn(thread *starlark.Thread, fn *starlark.
 	return starlark.NewList(elements), nil
 }
 
+// ============ Page 修订历史工具实现 ============
+
+// get_page_history 获取 Page 修订历史
+func (p *ContextToolsProvider) getPageHistoryFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	revisions, err := p.agentContext.GetPageHistory(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("get_page_history: %w", err)
+	}
+
+	elements := make([]starlark.Value, len(revisions))
+	for i, rev := range revisions {
+		elements[i] = revisionToDict(rev)
+	}
+
+	return starlark.NewList(elements), nil
+}
+
+// revert_page 回滚 Page 到指定修订
+func (p *ContextToolsProvider) revertPageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+	var revision int
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "revision", &revision); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.RevertPage(context.PageIndex(pageIndex), revision)
+	if err != nil {
+		return nil, fmt.Errorf("revert_page: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// ============ Page 冷归档工具实现 ============
+
+// archive_page 将 Page 子树移入冷归档
+func (p *ContextToolsProvider) archivePageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.ArchivePage(context.PageIndex(pageIndex))
+	if err != nil {
+		return nil, fmt.Errorf("archive_page: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// restore_page 恢复冷归档的 Page 子树
+func (p *ContextToolsProvider) restorePageFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pageIndex string
+	var parentIndex string
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "page_index", &pageIndex, "parent_index?", &parentIndex); err != nil {
+		return nil, err
+	}
+
+	err := p.agentContext.RestorePage(context.PageIndex(pageIndex), context.PageIndex(parentIndex))
+	if err != nil {
+		return nil, fmt.Errorf("restore_page: %w", err)
+	}
+
+	return starlark.None, nil
+}
+
+// revisionToDict 将 context.PageRevision 转换为 Starlark Dict
+func revisionToDict(rev *context.PageRevision) *starlark.Dict {
+	dict := starlark.NewDict(6)
+	dict.SetKey(starlark.String("revision"), starlark.MakeInt(rev.Revision))
+	dict.SetKey(starlark.String("actor"), starlark.String(string(rev.Actor)))
+	dict.SetKey(starlark.String("operation"), starlark.String(rev.Operation))
+	dict.SetKey(starlark.String("timestamp"), starlark.String(rev.Timestamp.Format("2006-01-02 15:04:05")))
+
+	// 快照中的名称和描述，便于 Agent 选择回滚目标
+	if page, err := rev.Page(); err == nil {
+		dict.SetKey(starlark.String("name"), starlark.String(page.GetName()))
+		dict.SetKey(starlark.String("description"), starlark.String(page.GetDescription()))
+	}
+
+	return dict
+}
+
+// recall 语义检索相关 Page
+func (p *ContextToolsProvider) recallFn(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var query string
+	k := defaultRecallK
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "query", &query, "k?", &k); err != nil {
+		return nil, err
+	}
+
+	results, err := p.agentContext.Recall(query, k)
+	if err != nil {
+		return nil, fmt.Errorf("recall: %w", err)
+	}
+
+	return searchResultsToList(results), nil
+}
+
+// searchResultsToList 将搜索结果转换为 Starlark List，每项在 Page 信息之外附带 score
+func searchResultsToList(results []context.SearchResult) *starlark.List {
+	elements := make([]starlark.Value, len(results))
+	for i, result := range results {
+		dict := pageToDict(result.Page)
+		dict.SetKey(starlark.String("score"), starlark.Float(result.Score))
+		elements[i] = dict
+	}
+	return starlark.NewList(elements)
+}
+
+// accessToDict 将 Page 访问记录转换为 Starlark Dict，从未发生的访问时间为空字符串
+func accessToDict(access context.PageAccess) *starlark.Dict {
+	formatTime := func(t time.Time) starlark.String {
+		if t.IsZero() {
+			return starlark.String("")
+		}
+		return starlark.String(t.Format("2006-01-02 15:04:05"))
+	}
+
+	dict := starlark.NewDict(8)
+	dict.SetKey(starlark.String("last_viewed_at"), formatTime(access.LastViewedAt))
+	dict.SetKey(starlark.String("view_count"), starlark.MakeInt(access.ViewCount))
+	dict.SetKey(starlark.String("last_expanded_at"), formatTime(access.LastExpandedAt))
+	dict.SetKey(starlark.String("expand_count"), starlark.MakeInt(access.ExpandCount))
+	dict.SetKey(starlark.String("last_found_at"), formatTime(access.LastFoundAt))
+	dict.SetKey(starlark.String("find_count"), starlark.MakeInt(access.FindCount))
+	dict.SetKey(starlark.String("last_edited_at"), formatTime(access.LastEditedAt))
+	dict.SetKey(starlark.String("edit_count"), starlark.MakeInt(access.EditCount))
+	return dict
+}
+
 // pageToDict 将 context.Page 转换为 Starlark Dict
 func pageToDict(page context.Page) *starlark.Dict {
 	dict := starlark.NewDict(6)
@@ -326,6 +829,36 @@ func pageToDict(page context.Page) *starlark.Dict {
 	dict.SetKey(starlark.String("description"), starlark.String(page.GetDescription()))
 	dict.SetKey(starlark.String("lifecycle"), starlark.String(page.GetLifecycle().String()))
 	dict.SetKey(starlark.String("visibility"), starlark.String(page.GetVisibility().String()))
+	dict.SetKey(starlark.String("importance"), starlark.Float(page.GetImportance()))
+	dict.SetKey(starlark.String("pinned"), starlark.Bool(page.IsPinned()))
+	dict.SetKey(starlark.String("access"), accessToDict(page.GetAccess()))
+
+	// 标签按键排序，保证输出稳定
+	pageTags := page.GetTags()
+	keys := make([]string, 0, len(pageTags))
+	for key := range pageTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := starlark.NewDict(len(keys))
+	for _, key := range keys {
+		tags.SetKey(starlark.String(key), starlark.String(pageTags[key]))
+	}
+	dict.SetKey(starlark.String("tags"), tags)
+
+	links := make([]starlark.Value, 0, len(page.GetLinks()))
+	for _, link := range page.GetLinks() {
+		item := starlark.NewDict(2)
+		item.SetKey(starlark.String("target"), starlark.String(string(link.Target)))
+		item.SetKey(starlark.String("type"), starlark.String(link.Type))
+		links = append(links, item)
+	}
+	dict.SetKey(starlark.String("links"), starlark.NewList(links))
+
+	if expiry := page.GetExpiry(); expiry != nil {
+		dict.SetKey(starlark.String("expires_at"), starlark.String(expiry.At.Format("2006-01-02 15:04:05")))
+		dict.SetKey(starlark.String("expiry_action"), starlark.String(string(expiry.Action)))
+	}
 
 	// 判断页面类型
 	var pageType string